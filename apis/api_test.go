@@ -0,0 +1,215 @@
+package apis_test
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apploggers"
+	"Jevan/commons/mailer"
+	"Jevan/configs"
+	"Jevan/internals/app"
+	"Jevan/internals/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMain(m *testing.M) {
+	apploggers.Configure(apploggers.Config{Format: apploggers.FormatConsole, Level: "error", Outputs: []string{apploggers.OutputStderr}}) //nolint
+	os.Exit(m.Run())
+}
+
+// recordingMailer keeps the sent messages so a test can follow the links they contain
+type recordingMailer struct {
+	mutex    sync.Mutex
+	messages []mailer.Message
+}
+
+func (r *recordingMailer) Send(ctx context.Context, message mailer.Message) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *recordingMailer) last() mailer.Message {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.messages) == 0 {
+		return mailer.Message{}
+	}
+	return r.messages[len(r.messages)-1]
+}
+
+type testServer struct {
+	t         *testing.T
+	server    *echo.Echo
+	container *app.Container
+	mailer    *recordingMailer
+}
+
+func testConfig() *configs.ApplicationConfig {
+	return &configs.ApplicationConfig{
+		HttpPort:             "0",
+		MetricsPort:          "1",
+		JwtSecret:            "test-secret",
+		LoginMaxFailures:     3,
+		LoginIPMaxFailures:   100,
+		LoginLockoutDuration: time.Minute,
+		TotpIssuer:           "Jevan",
+		EmailVerifyURL:       "http://localhost/verify-email",
+		CartItemTTL:          time.Hour,
+		CartMaxItemQty:       10,
+		HealthCheckTimeout:   time.Second,
+		ShutdownTimeout:      time.Second,
+	}
+}
+
+// function to boot the api on a migrated in-memory database, every module is served
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	recorder := &recordingMailer{}
+	s := bootTestServer(t, app.NewBuilder(testConfig()).WithMailer(recorder))
+	s.mailer = recorder
+	return s
+}
+
+// function to boot the api of the builder on a migrated in-memory database
+func bootTestServer(t *testing.T, builder *app.Builder) *testServer {
+	t.Helper()
+	container, err := builder.
+		WithDatabase(appdb.NewMemoryDatabaseClient("jevan")).
+		Build(context.Background())
+	if err != nil {
+		t.Fatalf("building the container: %v", err)
+	}
+	if _, err := container.Migrations.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return &testServer{t: t, server: container.Server(), container: container}
+}
+
+type apiRequest struct {
+	method  string
+	path    string
+	body    interface{}
+	token   string
+	headers map[string]string
+}
+
+func (s *testServer) do(request apiRequest) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var body bytes.Buffer
+	if request.body != nil {
+		if raw, ok := request.body.(string); ok {
+			body.WriteString(raw)
+		} else if err := json.NewEncoder(&body).Encode(request.body); err != nil {
+			s.t.Fatalf("encoding the request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(request.method, request.path, &body)
+	if request.body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if request.token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+request.token)
+	}
+	for key, value := range request.headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	s.server.ServeHTTP(rec, req)
+	return rec
+}
+
+// function to send the request and check the status, the response body is decoded into out when set
+func (s *testServer) expect(request apiRequest, status int, out interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	rec := s.do(request)
+	if rec.Code != status {
+		s.t.Fatalf("%s %s = %d, want %d, body: %s", request.method, request.path, rec.Code, status, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+// function to register a user and log in, returns the token and the user id
+func (s *testServer) login(email string) (string, string) {
+	s.t.Helper()
+	s.expect(apiRequest{method: http.MethodPost, path: "/register", body: map[string]string{
+		"firstName": "Asha", "lastName": "Rao", "email": email, "password": "secret-password",
+	}}, http.StatusCreated, nil)
+
+	var response struct {
+		Token  string `json:"token"`
+		UserId string `json:"userId"`
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{
+		"email": email, "password": "secret-password",
+	}}, http.StatusOK, &response)
+	return response.Token, response.UserId
+}
+
+// function to register an administrator and log in, returns the token
+func (s *testServer) loginAdmin(email string) string {
+	s.t.Helper()
+	s.login(email)
+	if _, created, err := s.container.UserService.EnsureAdmin(context.Background(), &models.UserDetails{Email: email}); err != nil || created {
+		s.t.Fatalf("promoting to admin: created %v, %v", created, err)
+	}
+	token, _ := s.relogin(email)
+	return token
+}
+
+func (s *testServer) relogin(email string) (string, string) {
+	s.t.Helper()
+	var response struct {
+		Token  string `json:"token"`
+		UserId string `json:"userId"`
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{
+		"email": email, "password": "secret-password",
+	}}, http.StatusOK, &response)
+	return response.Token, response.UserId
+}
+
+// function to create a product through the api, returns its id
+func (s *testServer) createProduct(token string, product map[string]interface{}) string {
+	s.t.Helper()
+	var response struct {
+		ProductId string `json:"productId"`
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: "/products", body: product, token: token}, http.StatusCreated, &response)
+	return response.ProductId
+}
+
+// problem is the part of the problem+json body the tests check
+type problem struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+}
+
+func (s *testServer) expectProblem(request apiRequest, status int, code string) {
+	s.t.Helper()
+	var body problem
+	rec := s.expect(request, status, nil)
+	if request.method == http.MethodHead {
+		return
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		s.t.Fatalf("decoding problem %s: %v", rec.Body.String(), err)
+	}
+	if code != "" && body.Code != code {
+		s.t.Fatalf("%s %s problem code = %s, want %s", request.method, request.path, body.Code, code)
+	}
+}
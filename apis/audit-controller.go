@@ -0,0 +1,135 @@
+package apis
+
+import (
+	"Jevan/commons/apperrors"
+	"Jevan/commons/apploggers"
+	"Jevan/internals/models"
+	"Jevan/internals/services"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	auditFormatJSON = "json"
+	auditFormatCSV  = "csv"
+)
+
+type AuditController struct {
+	auditService services.AuditService
+}
+
+func NewAuditController(auditService services.AuditService) *AuditController {
+	return &AuditController{auditService: auditService}
+}
+
+// GetAuditEvents godoc
+// @Summary List the audit log (admin only)
+// @Description Lists the role changes, product price changes and order updates, the latest first. With format=csv the events are exported as a CSV attachment.
+// @Tags Audit
+// @Produce json
+// @Produce text/csv
+// @Security BearerAuth
+// @Param actorId query string false "User id of the actor"
+// @Param action query string false "Action, e.g. user.role.updated, user.password.reset, product.price.updated, order.updated or order.force_updated"
+// @Param targetType query string false "user, product or order"
+// @Param targetId query string false "Id of the target"
+// @Param from query int false "Unix timestamp of the oldest event"
+// @Param to query int false "Unix timestamp of the latest event"
+// @Param limit query int false "Maximum number of events, 100 by default and at most 10000"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} models.AuditEventsResponse
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 401 {object} commons.ProblemDetails
+// @Failure 403 {object} commons.ProblemDetails
+// @Router /admin/audit [get]
+func (ac *AuditController) GetAuditEvents(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	logger.Info("Executing GetAuditEvents")
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = auditFormatJSON
+	}
+	if format != auditFormatJSON && format != auditFormatCSV {
+		return apperrors.Validation("'format' must be json or csv")
+	}
+	filter := &models.AuditFilter{
+		ActorID:    c.QueryParam("actorId"),
+		Action:     c.QueryParam("action"),
+		TargetType: c.QueryParam("targetType"),
+		TargetID:   c.QueryParam("targetId"),
+	}
+	for name, target := range map[string]*int64{"from": &filter.From, "to": &filter.To} {
+		value, err := queryInt64(c, name)
+		if err != nil {
+			return err
+		}
+		*target = value
+	}
+	limit, err := queryInt64(c, "limit")
+	if err != nil {
+		return err
+	}
+	filter.Limit = int(limit)
+
+	events, err := ac.auditService.GetAuditEvents(lcontext, filter)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed GetAuditEvents, total: %d, format: %s", len(events), format)
+	if format == auditFormatCSV {
+		return writeAuditCSV(c, events)
+	}
+	return c.JSON(http.StatusOK, models.AuditEventsResponse{
+		Total:  len(events),
+		Events: events,
+	})
+}
+
+// function to read a query parameter which is a non negative integer, 0 when it is absent
+func queryInt64(c echo.Context, name string) (int64, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || value < 0 {
+		return 0, apperrors.Validationf("'%s' must be a non negative integer", name)
+	}
+	return value, nil
+}
+
+// function to send the events as a CSV attachment, one line per event with the changes as JSON
+func writeAuditCSV(c echo.Context, events []*models.AuditEvent) error {
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	response.Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit-events.csv"`)
+	response.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(response)
+	writer.Write([]string{"id", "timestamp", "action", "actorId", "actorRole", "targetType", "targetId", "changes", "ip", "correlationId"}) //nolint
+	for _, event := range events {
+		changes, _ := json.Marshal(event.Changes)
+		writer.Write([]string{ //nolint
+			event.ID.Hex(),
+			time.Unix(event.Timestamp, 0).UTC().Format(time.RFC3339),
+			event.Action,
+			event.ActorID,
+			event.ActorRole,
+			event.TargetType,
+			event.TargetID,
+			string(changes),
+			event.IP,
+			event.CorrelationID,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
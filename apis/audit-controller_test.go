@@ -0,0 +1,88 @@
+package apis_test
+
+import (
+	"Jevan/commons"
+	"Jevan/internals/models"
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuditEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	userToken, userId := s.login("asha@example.com")
+	adminToken := s.loginAdmin("admin@example.com")
+	_, adminId := s.relogin("admin@example.com")
+	requestId := "audit-test-request"
+
+	// a role change, a price change and two order updates, with and without If-Match; the server trusts no
+	// proxy, so the X-Forwarded-For sent by the client is not its ip
+	s.expect(apiRequest{method: http.MethodPut, path: "/admin/users/" + userId + "/role", body: map[string]string{"role": "admin"}, token: adminToken,
+		headers: map[string]string{echo.HeaderXRequestID: requestId, echo.HeaderXForwardedFor: "203.0.113.9"}}, http.StatusOK, nil)
+	teaId := s.createProduct(adminToken, map[string]interface{}{"name": "Tea", "price": 10, "isAvailable": true})
+	s.expect(apiRequest{method: http.MethodPatch, path: "/products/" + teaId, body: `{"description":"Masala"}`, token: adminToken}, http.StatusOK, nil)
+	s.expect(apiRequest{method: http.MethodPatch, path: "/products/" + teaId, body: `{"price":12.5}`, token: adminToken}, http.StatusOK, nil)
+
+	var created struct {
+		Id string `json:"id"`
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: "/orders", token: userToken, body: map[string]interface{}{
+		"userId": userId, "items": []map[string]interface{}{{"itemId": teaId, "quantity": 2}},
+	}}, http.StatusCreated, &created)
+	s.expect(apiRequest{method: http.MethodPut, path: "/orders/" + created.Id, body: map[string]interface{}{"status": models.OrderStatusPreparing}, token: userToken,
+		headers: map[string]string{commons.HeaderIfMatch: `"1"`}}, http.StatusOK, nil)
+	s.expect(apiRequest{method: http.MethodPut, path: "/orders/" + created.Id, body: map[string]interface{}{"status": models.OrderStatusCancelled}, token: adminToken}, http.StatusOK, nil)
+
+	s.expectProblem(apiRequest{method: http.MethodGet, path: "/admin/audit"}, http.StatusUnauthorized, "UNAUTHORIZED")
+	s.expectProblem(apiRequest{method: http.MethodGet, path: "/admin/audit?format=xml", token: adminToken}, http.StatusBadRequest, "VALIDATION")
+	s.expectProblem(apiRequest{method: http.MethodGet, path: "/admin/audit?from=yesterday", token: adminToken}, http.StatusBadRequest, "VALIDATION")
+
+	var all models.AuditEventsResponse
+	s.expect(apiRequest{method: http.MethodGet, path: "/admin/audit", token: adminToken}, http.StatusOK, &all)
+	if all.Total != 5 {
+		t.Fatalf("total = %d, want 5 events, the description change is not audited: %+v", all.Total, all.Events)
+	}
+	actions := []string{}
+	for _, event := range all.Events {
+		actions = append(actions, event.Action)
+	}
+	if strings.Join(actions, ",") != "order.force_updated,order.updated,product.price.updated,user.role.updated,user.role.updated" {
+		t.Errorf("actions = %v, want the latest first", actions)
+	}
+
+	// the admin was promoted outside of a request, the event has no actor
+	if grant := all.Events[4]; grant.TargetID != adminId || grant.ActorID != "" || grant.Changes[0].After != "admin" {
+		t.Errorf("admin grant event = %+v, want the promotion of the admin without an actor", grant)
+	}
+	role := all.Events[3]
+	if role.ActorID != adminId || role.ActorRole != "admin" || role.TargetID != userId || role.CorrelationID != requestId || role.IP != "192.0.2.1" || role.Timestamp == 0 {
+		t.Errorf("role event = %+v, want the admin, the user, the request id and the ip of the connection", role)
+	}
+	if len(role.Changes) != 1 || role.Changes[0].Field != "role" || role.Changes[0].Before != "user" || role.Changes[0].After != "admin" {
+		t.Errorf("role changes = %+v, want role from user to admin", role.Changes)
+	}
+
+	var price models.AuditEventsResponse
+	s.expect(apiRequest{method: http.MethodGet, path: "/admin/audit?targetType=product&targetId=" + teaId, token: adminToken}, http.StatusOK, &price)
+	if price.Total != 1 || len(price.Events[0].Changes) != 2 || price.Events[0].Changes[0].Field != "price" || price.Events[0].Changes[0].After != 12.5 || price.Events[0].Changes[1].Field != "version" {
+		t.Errorf("price events = %+v, want the price and version changes", price.Events)
+	}
+
+	var forced models.AuditEventsResponse
+	s.expect(apiRequest{method: http.MethodGet, path: "/admin/audit?action=order.force_updated&actorId=" + adminId, token: adminToken}, http.StatusOK, &forced)
+	if forced.Total != 1 || forced.Events[0].Changes[0].Before != models.OrderStatusPreparing {
+		t.Errorf("forced events = %+v, want the cancellation by the admin", forced.Events)
+	}
+
+	rec := s.expect(apiRequest{method: http.MethodGet, path: "/admin/audit?format=csv&limit=2", token: adminToken}, http.StatusOK, nil)
+	if !strings.HasPrefix(rec.Header().Get(echo.HeaderContentDisposition), "attachment") {
+		t.Errorf("Content-Disposition = %q, want an attachment", rec.Header().Get(echo.HeaderContentDisposition))
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(records) != 3 || records[0][2] != "action" || records[1][2] != models.AuditOrderForceUpdated {
+		t.Errorf("csv = %v, %v, want the header and the 2 latest events", records, err)
+	}
+}
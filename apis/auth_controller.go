@@ -1,25 +1,32 @@
 package apis
 
 import (
+	"Jevan/apis/middlewares"
 	"Jevan/commons"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
-	"Jevan/configs"
 	"Jevan/internals/models"
 	"Jevan/internals/services"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthController struct {
-	userService services.UserService
+	userService      services.UserService
+	twoFactorService services.TwoFactorService
 }
 
-func NewAuthController(userService services.UserService) *AuthController {
-	return &AuthController{userService: userService}
+func NewAuthController(userService services.UserService, twoFactorService services.TwoFactorService) *AuthController {
+	return &AuthController{
+		userService:      userService,
+		twoFactorService: twoFactorService,
+	}
 }
 
 // @Summary Register User
@@ -28,7 +35,8 @@ func NewAuthController(userService services.UserService) *AuthController {
 // @Produce json
 // @Param user body models.UserDetails true "User registration data"
 // @Success 201 {string} string "Registered successfully"
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 409 {object} commons.ProblemDetails "Email already registered"
 // @Router /register [post]
 func (ac *AuthController) Register(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -36,39 +44,18 @@ func (ac *AuthController) Register(c echo.Context) error {
 	var user models.UserDetails
 	if err := c.Bind(&user); err != nil {
 		logger.Error("Invalid request body: ", err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Invalid request body, Error: "+err.Error(), nil))
+		return apperrors.Validationf("Invalid request body, Error: %s", err.Error())
 	}
 
 	if errs := commons.ValidateStruct(user); errs != nil {
 		logger.Error("Validation error: ", errs)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Validation Error: "+errs.Error(), nil))
+		return errs
 	}
 
-	id, err := ac.userService.RegisterUser(lcontext, user.Email, user.Password)
+	id, err := ac.userService.RegisterUser(lcontext, &user)
 	if err != nil {
 		logger.Error("Registration failed: ", err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Registration failed, Error:"+err.Error(), nil))
-	}
-
-	userId, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		logger.Error("Invalid user ID hex: ", err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Error: Invalid user ID", nil))
-	}
-
-	userInfo := &models.User{
-		Id:        userId,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Email:     user.Email,
-		Type:      "user",
-	}
-
-	// Create user profile in the database
-	logger.Info("Creating user profile for: ", user.Email)
-	id, err = ac.userService.CreateUserProfile(lcontext, userInfo)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Error: Failed to create user profile: "+err.Error(), nil))
+		return err
 	}
 
 	logger.Info("User registered successfully with ID: ", id)
@@ -84,49 +71,273 @@ func (ac *AuthController) Register(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param credentials body models.UserLoginRequest true "User credentials"
+// @Description Returns an access token, or an interim token when two-factor authentication is enabled
 // @Success 200 {object} models.UserLoginResponse
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 401 {object} commons.ProblemDetails
+// @Failure 429 {object} commons.ProblemDetails
 // @Router /login [post]
 func (ac *AuthController) Login(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	var creds models.UserLoginRequest
 	if err := c.Bind(&creds); err != nil {
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Invalid request body, Error: "+err.Error(), nil))
+		return apperrors.Validationf("Invalid request body, Error: %s", err.Error())
 	}
 	logger.Info("Received login request for user: ", creds.Email)
 
 	// validate credentials
 	if errs := commons.ValidateStruct(creds); errs != nil {
 		logger.Error("Validation error: ", errs)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Validation Error: "+errs.Error(), nil))
+		return errs
 	}
 
-	user, ok, err := ac.userService.AuthenticateUser(lcontext, creds.Email, creds.Password)
+	user, ok, err := ac.userService.AuthenticateUser(lcontext, creds.Email, creds.Password, c.RealIP())
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		return tooManyAttempts(c, throttled)
+	}
 	if err != nil || !ok {
-		return c.JSON(http.StatusUnauthorized, commons.ApiErrorResponse("Error: Invalid credentials", nil))
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
 	}
 
-	claims := jwt.MapClaims{
-		"email": creds.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
+	return loginResponse(c, user)
+}
+
+// function to reject a throttled login, Retry-After is rounded up to whole seconds so it is never 0
+func tooManyAttempts(c echo.Context, throttled *services.LoginThrottledError) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	return echo.NewHTTPError(http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+}
+
+// function to respond with the access token, or with an interim token when two-factor login is pending
+func loginResponse(c echo.Context, user *models.UserDetails) error {
+	_, logger := apploggers.GetLoggerFromEcho(c)
+	if user.TwoFactorEnabled {
+		interim, err := middlewares.SignToken(jwt.MapClaims{
+			"userId": user.ID.Hex(),
+			"email":  user.Email,
+			"scope":  middlewares.ScopeTwoFactor,
+			"exp":    time.Now().Add(time.Minute * 5).Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		logger.Infof("Password verified, two-factor authentication pending for userId: %s", user.ID.Hex())
+		return c.JSON(http.StatusOK, models.UserLoginResponse{
+			Email:             user.Email,
+			Role:              user.Role,
+			UserId:            user.ID.Hex(),
+			TwoFactorRequired: true,
+			InterimToken:      interim,
+		})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(configs.AppConfig.JwtSecret))
+	signed, err := issueToken(user, false)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, commons.ApiErrorResponse("Token generation failed, Error: "+err.Error(), nil))
+		return err
 	}
-	logger.Info("User logged in successfully: ", creds.Email)
-	logger.Info("Generated JWT token: ", signed)
+	logger.Infof("User logged in successfully, userId: %s", user.ID.Hex())
 	return c.JSON(http.StatusOK, models.UserLoginResponse{
-		Email:  creds.Email,
+		Email:  user.Email,
 		Role:   user.Role,
 		UserId: user.ID.Hex(),
 		Token:  signed,
 	})
 }
 
+// function to issue the access token, mfa is set when the second factor was verified
+func issueToken(user *models.UserDetails, mfa bool) (string, error) {
+	return middlewares.SignToken(jwt.MapClaims{
+		"userId": user.ID.Hex(),
+		"email":  user.Email,
+		"role":   user.Role,
+		"mfa":    mfa,
+		"exp":    time.Now().Add(time.Hour * 24).Unix(),
+	})
+}
+
+// @Summary Complete two-factor login
+// @Description Exchanges the interim token from /login and a TOTP or recovery code for an access token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param payload body models.TwoFactorLoginRequest true "Interim token and code"
+// @Success 200 {object} models.UserLoginResponse
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 401 {object} commons.ProblemDetails
+// @Failure 429 {object} commons.ProblemDetails
+// @Router /login/2fa [post]
+func (ac *AuthController) LoginTwoFactor(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	var body models.TwoFactorLoginRequest
+	if err := c.Bind(&body); err != nil {
+		return apperrors.Validationf("Invalid request body, Error: %s", err.Error())
+	}
+	if errs := commons.ValidateStruct(body); errs != nil {
+		logger.Error("Validation error: ", errs)
+		return errs
+	}
+
+	claims, err := middlewares.ParseToken(body.InterimToken)
+	if scope, _ := claims["scope"].(string); err != nil || scope != middlewares.ScopeTwoFactor {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired interim token")
+	}
+	userId, _ := claims["userId"].(string)
+	logger.Info("Received two-factor login request for user: ", userId)
+
+	user, err := ac.twoFactorService.VerifyLogin(lcontext, userId, body.Code, c.RealIP())
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		return tooManyAttempts(c, throttled)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+	}
+
+	signed, err := issueToken(user, true)
+	if err != nil {
+		return err
+	}
+	logger.Info("User logged in successfully with two-factor: ", user.Email)
+	return c.JSON(http.StatusOK, models.UserLoginResponse{
+		Email:  user.Email,
+		Role:   user.Role,
+		UserId: user.ID.Hex(),
+		Token:  signed,
+	})
+}
+
+// @Summary Start two-factor enrollment
+// @Description Generates a TOTP secret and otpauth URI (for the QR code) for the logged in user
+// @Tags Auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TwoFactorEnrollmentResponse
+// @Failure 400 {object} commons.ProblemDetails
+// @Router /2fa/enroll [post]
+func (ac *AuthController) EnrollTwoFactor(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	userId := middlewares.GetUserId(c)
+	logger.Infof("Executing EnrollTwoFactor, userId: %s", userId)
+
+	enrollment, err := ac.twoFactorService.BeginEnrollment(lcontext, userId)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed EnrollTwoFactor, userId: %s", userId)
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// @Summary Confirm two-factor enrollment
+// @Description Verifies the first TOTP code, enables two-factor authentication and returns one-time recovery codes
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param payload body models.TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} models.TwoFactorRecoveryCodesResponse
+// @Failure 400 {object} commons.ProblemDetails
+// @Router /2fa/confirm [post]
+func (ac *AuthController) ConfirmTwoFactor(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	userId := middlewares.GetUserId(c)
+	logger.Infof("Executing ConfirmTwoFactor, userId: %s", userId)
+
+	var body models.TwoFactorCodeRequest
+	if err := c.Bind(&body); err != nil {
+		return apperrors.Validationf("Invalid request body, Error: %s", err.Error())
+	}
+	if errs := commons.ValidateStruct(body); errs != nil {
+		return errs
+	}
+
+	codes, err := ac.twoFactorService.ConfirmEnrollment(lcontext, userId, body.Code)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed ConfirmTwoFactor, userId: %s", userId)
+	return c.JSON(http.StatusOK, models.TwoFactorRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes, requires a valid TOTP or recovery code
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param payload body models.TwoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} models.TwoFactorRecoveryCodesResponse
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 429 {object} commons.ProblemDetails "Too many wrong codes, the account is throttled like its logins"
+// @Router /2fa/recovery-codes [post]
+func (ac *AuthController) RegenerateRecoveryCodes(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	userId := middlewares.GetUserId(c)
+	logger.Infof("Executing RegenerateRecoveryCodes, userId: %s", userId)
+
+	var body models.TwoFactorCodeRequest
+	if err := c.Bind(&body); err != nil {
+		return apperrors.Validationf("Invalid request body, Error: %s", err.Error())
+	}
+	if errs := commons.ValidateStruct(body); errs != nil {
+		return errs
+	}
+
+	codes, err := ac.twoFactorService.RegenerateRecoveryCodes(lcontext, userId, body.Code, c.RealIP())
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		return tooManyAttempts(c, throttled)
+	}
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed RegenerateRecoveryCodes, userId: %s", userId)
+	return c.JSON(http.StatusOK, models.TwoFactorRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disable two-factor authentication
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param payload body models.TwoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]string "Two-factor authentication disabled"
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 429 {object} commons.ProblemDetails "Too many wrong codes, the account is throttled like its logins"
+// @Router /2fa/disable [post]
+func (ac *AuthController) DisableTwoFactor(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	userId := middlewares.GetUserId(c)
+	logger.Infof("Executing DisableTwoFactor, userId: %s", userId)
+
+	var body models.TwoFactorCodeRequest
+	if err := c.Bind(&body); err != nil {
+		return apperrors.Validationf("Invalid request body, Error: %s", err.Error())
+	}
+	if errs := commons.ValidateStruct(body); errs != nil {
+		return errs
+	}
+
+	err := ac.twoFactorService.Disable(lcontext, userId, body.Code, c.RealIP())
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		return tooManyAttempts(c, throttled)
+	}
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed DisableTwoFactor, userId: %s", userId)
+	return c.JSON(http.StatusOK, echo.Map{"message": "Two-factor authentication disabled"})
+}
+
 // UpdateUserRole godoc
 // @Summary Update user role (admin only)
 // @Tags Auth
@@ -136,9 +347,10 @@ func (ac *AuthController) Login(c echo.Context) error {
 // @Param id path string true "User ID"
 // @Param body body models.UpdateUserRoleRequest true "New role (admin or user)"
 // @Success 200 {object} map[string]string "Role updated successfully"
-// @Failure 400 {object} map[string]string "Invalid request or validation error"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 400 {object} commons.ProblemDetails "Invalid request or validation error"
+// @Failure 500 {object} commons.ProblemDetails "Internal server error"
 // @Security BearerAuth
+// @Failure 404 {object} commons.ProblemDetails
 // @Router /admin/users/{id}/role [put]
 func (ac *AuthController) UpdateUserRole(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -148,16 +360,66 @@ func (ac *AuthController) UpdateUserRole(c echo.Context) error {
 	var body models.UpdateUserRoleRequest
 
 	if err := c.Bind(&body); err != nil {
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Invalid request, Error: "+err.Error(), nil))
+		return apperrors.Validationf("Invalid request, Error: %s", err.Error())
 	}
 
 	if err := commons.ValidateStruct(body); err != nil {
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Error(s): "+err.Error(), nil))
+		return err
 	}
 
 	err := ac.userService.UpdateUserRole(lcontext, id, body.Role)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, commons.ApiErrorResponse("failed to update user, Error: "+err.Error(), nil))
+		return err
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "Role updated successfully"})
 }
+
+// GetLockedAccounts godoc
+// @Summary List locked accounts (admin only)
+// @Description Lists accounts currently locked out after repeated failed logins
+// @Tags Auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.LockedAccountsResponse
+// @Failure 500 {object} commons.ProblemDetails
+// @Router /admin/users/locked [get]
+func (ac *AuthController) GetLockedAccounts(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	logger.Info("Executing GetLockedAccounts")
+
+	accounts, err := ac.userService.GetLockedAccounts(lcontext)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed GetLockedAccounts, total: %d", len(accounts))
+	return c.JSON(http.StatusOK, models.LockedAccountsResponse{
+		Total:    len(accounts),
+		Accounts: accounts,
+	})
+}
+
+// UnlockAccount godoc
+// @Summary Unlock a locked account (admin only)
+// @Description Clears failed login attempts and lockout for the user
+// @Tags Auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string "Account unlocked successfully"
+// @Failure 400 {object} commons.ProblemDetails
+// @Router /admin/users/{id}/unlock [post]
+func (ac *AuthController) UnlockAccount(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	id := c.Param("id")
+	logger.Infof("Executing UnlockAccount, userId: %s", id)
+
+	if err := ac.userService.UnlockAccount(lcontext, id); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed UnlockAccount, userId: %s", id)
+	return c.JSON(http.StatusOK, echo.Map{"message": "Account unlocked successfully"})
+}
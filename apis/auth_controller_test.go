@@ -0,0 +1,66 @@
+package apis_test
+
+import (
+	"Jevan/commons/totp"
+	"Jevan/internals/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// function to get the totp code of the secret at the step
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.CodeForStep(secret, step)
+	if err != nil {
+		t.Fatalf("generating the code: %v", err)
+	}
+	return code
+}
+
+// function to log in with the password, returns the interim token of the pending two-factor login
+func (s *testServer) loginInterim(email string) string {
+	s.t.Helper()
+	var response models.UserLoginResponse
+	s.expect(apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{"email": email, "password": "secret-password"}}, http.StatusOK, &response)
+	if !response.TwoFactorRequired || response.InterimToken == "" || response.Token != "" {
+		s.t.Fatalf("login = %+v, want only an interim token", response)
+	}
+	return response.InterimToken
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.login("asha@example.com")
+
+	// the codes are taken at fixed steps, a step boundary passing during the test stays within the skew
+	step := totp.Step(time.Now())
+	var enrollment models.TwoFactorEnrollmentResponse
+	s.expect(apiRequest{method: http.MethodPost, path: "/2fa/enroll", token: token}, http.StatusOK, &enrollment)
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/2fa/confirm", body: map[string]string{"code": "000000"}, token: token}, http.StatusBadRequest, "INVALID_TWO_FACTOR_CODE")
+	var recovery models.TwoFactorRecoveryCodesResponse
+	s.expect(apiRequest{method: http.MethodPost, path: "/2fa/confirm", body: map[string]string{"code": totpCode(t, enrollment.Secret, step)}, token: token}, http.StatusOK, &recovery)
+	if len(recovery.RecoveryCodes) == 0 {
+		t.Fatal("no recovery codes after confirming the enrollment")
+	}
+
+	// the code of the confirmation cannot be used again, the next one logs in once
+	interim := s.loginInterim("asha@example.com")
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/login/2fa", body: map[string]string{"interimToken": interim, "code": totpCode(t, enrollment.Secret, step)}}, http.StatusUnauthorized, "")
+	next := map[string]string{"interimToken": interim, "code": totpCode(t, enrollment.Secret, step+1)}
+	var response models.UserLoginResponse
+	s.expect(apiRequest{method: http.MethodPost, path: "/login/2fa", body: next}, http.StatusOK, &response)
+	if response.Token == "" {
+		t.Fatalf("two-factor login = %+v, want an access token", response)
+	}
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/login/2fa", body: next}, http.StatusUnauthorized, "")
+
+	// the interim token is not an access token, and a recovery code works once
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/2fa/enroll", token: interim}, http.StatusUnauthorized, "")
+	withRecovery := map[string]string{"interimToken": s.loginInterim("asha@example.com"), "code": recovery.RecoveryCodes[0]}
+	s.expect(apiRequest{method: http.MethodPost, path: "/login/2fa", body: withRecovery}, http.StatusOK, nil)
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/login/2fa", body: withRecovery}, http.StatusUnauthorized, "")
+
+	s.expect(apiRequest{method: http.MethodPost, path: "/2fa/disable", body: map[string]string{"code": recovery.RecoveryCodes[1]}, token: response.Token}, http.StatusOK, nil)
+	s.relogin("asha@example.com")
+}
@@ -1,7 +1,9 @@
 package apis
 
 import (
+	"Jevan/apis/middlewares"
 	"Jevan/commons"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/internals/models"
 	"Jevan/internals/services"
@@ -9,7 +11,6 @@ import (
 	"strings"
 
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // cartController handles operations related to cart.
@@ -25,42 +26,47 @@ func NewCartController(cservice services.CartService) cartController {
 }
 
 // UpdateCart godoc
-// @Summary Overwrite or add items to cart
-// @Description Creates or updates a cart with new list of items and total price
+// @Summary Replace the items of a cart
+// @Description Replaces the items of an existing cart and returns the recalculated cart, every item is checked for availability and its quantity limit
 // @Tags Cart
 // @Accept json
 // @Produce json
-// @Param cart body models.Cart true "Cart object"
-// @Success 200 {object} models.Cart "Cart updated successfully"
-// @Failure 400 {object} map[string]string "Invalid cart data"
-// @Failure 500 {object} map[string]string "Could not update cart"
-// @Router /cart [post]
+// @Param id path string true "Cart ID"
+// @Param cart body models.ReplaceCartRequest true "Items of the cart"
+// @Param If-Match header string false "ETag of the cart being overwritten"
+// @Success 200 {object} models.Cart "Recalculated cart"
+// @Header 200 {string} ETag "Version of the cart, send it as If-Match when updating"
+// @Failure 400 {object} commons.ProblemDetails "Invalid items or quantity limit reached"
+// @Failure 404 {object} commons.ProblemDetails "Cart or product not found"
+// @Failure 412 {object} commons.ProblemDetails "Cart was modified since it was read"
+// @Failure 500 {object} commons.ProblemDetails "Could not update cart"
+// @Router /cart/{id} [post]
 func (cc *cartController) UpdateCart(e echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(e)
-	var cart models.Cart
-	if err := e.Bind(&cart); err != nil {
-		return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cart data" + err.Error()})
+	var request models.ReplaceCartRequest
+	if err := e.Bind(&request); err != nil {
+		return apperrors.Validationf("Invalid cart data, Error: %s", err.Error())
 	}
 	cartId := e.Param("id")
-	logger.Infof("Executing cart update cartId: %s, Payload: %v", cartId, cart)
-
-	primitiveCartId, err := primitive.ObjectIDFromHex(cartId)
-	if err != nil {
-		logger.Error("Invalid cart ID provided")
-		return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cart ID" + err.Error()})
-	}
-	cart.ID = primitiveCartId
+	logger.Infof("Executing cart update cartId: %s", cartId)
 
-	if err := commons.ValidateStruct(cart); err != nil {
+	if err := commons.ValidateStruct(request); err != nil {
 		logger.Error("Validation failed for cart:", err)
-		return e.JSON(http.StatusBadRequest, map[string]string{"error": "Validation failed for cart" + err.Error()})
+		return err
+	}
+	expectedVersion, err := commons.GetIfMatch(e)
+	if err != nil {
+		logger.Error(err)
+		return err
 	}
 
-	logger.Infof("Executing UpdateCart %v", cart)
-	if err := cc.cservice.UpdateCart(lcontext, &cart); err != nil {
-		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update cart" + err.Error()})
+	cart, err := cc.cservice.UpdateCart(lcontext, cartId, request.Items, expectedVersion)
+	if err != nil {
+		logger.Error(err)
+		return err
 	}
-	logger.Infof("Executed UpdateCart %v", cart)
+	logger.Infof("Executed UpdateCart, cartId: %s", cartId)
+	commons.SetETag(e, cart.Version)
 	return e.JSON(http.StatusOK, cart)
 }
 
@@ -72,24 +78,27 @@ func (cc *cartController) UpdateCart(e echo.Context) error {
 // @Produce json
 // @Param id path string true "Cart ID"
 // @Success 200 {object} models.Cart "Cart object with all items"
-// @Failure 400 {object} commons.ApiErrorResponsePayload "Failed to get items from cart"
+// @Header 200 {string} ETag "Version of the cart, send it as If-Match when updating"
+// @Failure 400 {object} commons.ProblemDetails "Failed to get items from cart"
+// @Failure 404 {object} commons.ProblemDetails "Cart not found"
 // @Router /cart/{id} [get]
 func (c *cartController) GetCartItemsById(e echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(e)
 	cartId := e.Param("id")
 
 	if len(strings.TrimSpace(cartId)) == 0 {
-		logger.Error("error: cart id required.")
-		return e.JSON(http.StatusBadRequest, commons.ApiErrorResponse("error: cart id required.", nil))
+		logger.Error("cart id is required")
+		return apperrors.Validation("cart id is required")
 	}
 
 	cart, err := c.cservice.GetCartItemsById(lcontext, cartId)
 	if err != nil {
 		logger.Error(err)
-		return e.JSON(http.StatusBadRequest, commons.ApiErrorResponse(err.Error(), nil))
+		return err
 	}
 
 	logger.Info("Fetched cart items successfully")
+	commons.SetETag(e, cart.Version)
 	return e.JSON(http.StatusOK, cart)
 }
 
@@ -100,23 +109,194 @@ func (c *cartController) GetCartItemsById(e echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param id path string true "Cart ID"
+// @Param If-Match header string false "ETag of the cart being emptied"
 // @Success 200
-// @Failure 400 {object} commons.ApiErrorResponsePayload "Failed to delete items from cart"
+// @Failure 400 {object} commons.ProblemDetails "Failed to delete items from cart"
+// @Failure 404 {object} commons.ProblemDetails "Cart not found"
+// @Failure 412 {object} commons.ProblemDetails "Cart was modified since it was read"
 // @Router /cart/{id}/all [delete]
 func (c *cartController) DeleteAllItems(e echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(e)
 	cartId := e.Param("id")
 
 	if len(strings.TrimSpace(cartId)) == 0 {
-		logger.Error("error: cart id required.")
-		return e.JSON(http.StatusBadRequest, commons.ApiErrorResponse("error: cart id required.", nil))
+		logger.Error("cart id is required")
+		return apperrors.Validation("cart id is required")
+	}
+
+	expectedVersion, err := commons.GetIfMatch(e)
+	if err != nil {
+		logger.Error(err)
+		return err
 	}
 
-	if err := c.cservice.DeleteAllItems(lcontext, cartId); err != nil {
+	if err := c.cservice.DeleteAllItems(lcontext, cartId, expectedVersion); err != nil {
 		logger.Error(err)
-		return e.JSON(http.StatusBadRequest, commons.ApiErrorResponse(err.Error(), nil))
+		return err
 	}
 
 	logger.Info("All items deleted from cart successfully")
 	return e.NoContent(http.StatusOK)
 }
+
+// GetMyCart godoc
+// @Summary Get the cart of the logged in user
+// @Description Resolves the cart from the authenticated user, creating it if missing
+// @Tags Cart
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Cart "Cart object with all items"
+// @Header 200 {string} ETag "Version of the cart, send it as If-Match when updating"
+// @Failure 400 {object} commons.ProblemDetails "Failed to get cart"
+// @Failure 401 {object} commons.ProblemDetails "Missing user in token"
+// @Router /me/cart [get]
+func (c *cartController) GetMyCart(e echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(e)
+	userId := middlewares.GetUserId(e)
+	logger.Infof("Executing GetMyCart, userId: %s", userId)
+
+	if len(strings.TrimSpace(userId)) == 0 {
+		logger.Error("error: user id missing in token.")
+		return echo.NewHTTPError(http.StatusUnauthorized, "user id missing in token, please login again")
+	}
+
+	cart, err := c.cservice.GetCartForUser(lcontext, userId)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed GetMyCart, userId: %s", userId)
+	commons.SetETag(e, cart.Version)
+	return e.JSON(http.StatusOK, cart)
+}
+
+// AddItem godoc
+// @Summary Add an item to the cart
+// @Description Adds the item, or increments its quantity if already in the cart, and returns the recalculated cart
+// @Tags Cart
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Cart ID"
+// @Param item body models.AddCartItemRequest true "Item and quantity to add"
+// @Param If-Match header string false "ETag of the cart being changed"
+// @Success 200 {object} models.Cart "Recalculated cart"
+// @Failure 400 {object} commons.ProblemDetails "Invalid item or quantity limit reached"
+// @Failure 404 {object} commons.ProblemDetails "Cart or product not found"
+// @Failure 412 {object} commons.ProblemDetails "Cart was modified since it was read"
+// @Router /cart/{id}/items [post]
+func (c *cartController) AddItem(e echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(e)
+	cartId := e.Param("id")
+	logger.Infof("Executing AddItem, cartId: %s", cartId)
+
+	var item models.AddCartItemRequest
+	if err := e.Bind(&item); err != nil {
+		return apperrors.Validationf("Invalid item data, Error: %s", err.Error())
+	}
+	if err := commons.ValidateStruct(item); err != nil {
+		logger.Error("Validation failed for item:", err)
+		return err
+	}
+
+	expectedVersion, err := commons.GetIfMatch(e)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	cart, err := c.cservice.AddItem(lcontext, cartId, &item, expectedVersion)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed AddItem, cartId: %s", cartId)
+	commons.SetETag(e, cart.Version)
+	return e.JSON(http.StatusOK, cart)
+}
+
+// UpdateItem godoc
+// @Summary Set the quantity of a cart item
+// @Description Sets the quantity of the item, 0 removes it, and returns the recalculated cart
+// @Tags Cart
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Cart ID"
+// @Param itemId path string true "Item ID"
+// @Param item body models.UpdateCartItemRequest true "New quantity"
+// @Param If-Match header string false "ETag of the cart being changed"
+// @Success 200 {object} models.Cart "Recalculated cart"
+// @Failure 400 {object} commons.ProblemDetails "Invalid quantity or quantity limit reached"
+// @Failure 404 {object} commons.ProblemDetails "Cart or item not found"
+// @Failure 412 {object} commons.ProblemDetails "Cart was modified since it was read"
+// @Router /cart/{id}/items/{itemId} [patch]
+func (c *cartController) UpdateItem(e echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(e)
+	cartId := e.Param("id")
+	itemId := e.Param("itemId")
+	logger.Infof("Executing UpdateItem, cartId: %s, itemId: %s", cartId, itemId)
+
+	var item models.UpdateCartItemRequest
+	if err := e.Bind(&item); err != nil {
+		return apperrors.Validationf("Invalid item data, Error: %s", err.Error())
+	}
+	if err := commons.ValidateStruct(item); err != nil {
+		logger.Error("Validation failed for item:", err)
+		return err
+	}
+
+	expectedVersion, err := commons.GetIfMatch(e)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	cart, err := c.cservice.UpdateItemQuantity(lcontext, cartId, itemId, item.Quantity, expectedVersion)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed UpdateItem, cartId: %s, itemId: %s", cartId, itemId)
+	commons.SetETag(e, cart.Version)
+	return e.JSON(http.StatusOK, cart)
+}
+
+// RemoveItem godoc
+// @Summary Remove an item from the cart
+// @Description Removes the item and returns the recalculated cart
+// @Tags Cart
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Cart ID"
+// @Param itemId path string true "Item ID"
+// @Param If-Match header string false "ETag of the cart being changed"
+// @Success 200 {object} models.Cart "Recalculated cart"
+// @Failure 404 {object} commons.ProblemDetails "Cart or item not found"
+// @Failure 412 {object} commons.ProblemDetails "Cart was modified since it was read"
+// @Router /cart/{id}/items/{itemId} [delete]
+func (c *cartController) RemoveItem(e echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(e)
+	cartId := e.Param("id")
+	itemId := e.Param("itemId")
+	logger.Infof("Executing RemoveItem, cartId: %s, itemId: %s", cartId, itemId)
+
+	expectedVersion, err := commons.GetIfMatch(e)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	cart, err := c.cservice.RemoveItem(lcontext, cartId, itemId, expectedVersion)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed RemoveItem, cartId: %s, itemId: %s", cartId, itemId)
+	commons.SetETag(e, cart.Version)
+	return e.JSON(http.StatusOK, cart)
+}
@@ -0,0 +1,110 @@
+package apis_test
+
+import (
+	"Jevan/commons"
+	"Jevan/internals/models"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCartEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.login("asha@example.com")
+	teaId := s.createProduct(token, map[string]interface{}{"name": "Tea", "price": 10, "isAvailable": true})
+	coffeeId := s.createProduct(token, map[string]interface{}{"name": "Coffee", "price": 25, "isAvailable": true})
+	soldOutId := s.createProduct(token, map[string]interface{}{"name": "Juice", "price": 30, "isAvailable": false})
+
+	var cart models.Cart
+	s.expect(apiRequest{method: http.MethodGet, path: "/me/cart", token: token}, http.StatusOK, &cart)
+	cartPath := "/cart/" + cart.ID.Hex()
+
+	tests := []struct {
+		name      string
+		request   apiRequest
+		status    int
+		code      string
+		wantTotal float64
+		wantItems int
+	}{
+		{"needs a token", apiRequest{method: http.MethodGet, path: cartPath}, http.StatusUnauthorized, "UNAUTHORIZED", 0, 0},
+		{"add", apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": teaId, "quantity": 2}, token: token}, http.StatusOK, "", 20, 1},
+		{"add again increments", apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": teaId, "quantity": 1}, token: token}, http.StatusOK, "", 30, 1},
+		{"add another", apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": coffeeId, "quantity": 1}, token: token}, http.StatusOK, "", 55, 2},
+		{"add over the limit", apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": teaId, "quantity": 8}, token: token}, http.StatusBadRequest, "QUANTITY_LIMIT_REACHED", 0, 0},
+		{"add without quantity", apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": teaId}, token: token}, http.StatusBadRequest, "VALIDATION", 0, 0},
+		{"add missing product", apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": primitive.NewObjectID().Hex(), "quantity": 1}, token: token}, http.StatusNotFound, "PRODUCT_NOT_FOUND", 0, 0},
+		{
+			"add at stale version",
+			apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": teaId, "quantity": 1}, token: token, headers: map[string]string{commons.HeaderIfMatch: `"1"`}},
+			http.StatusPreconditionFailed, "VERSION_CONFLICT", 0, 0,
+		},
+		{"set quantity", apiRequest{method: http.MethodPatch, path: cartPath + "/items/" + teaId, body: map[string]interface{}{"quantity": 1}, token: token}, http.StatusOK, "", 35, 2},
+		{"set quantity of missing item", apiRequest{method: http.MethodPatch, path: cartPath + "/items/" + primitive.NewObjectID().Hex(), body: map[string]interface{}{"quantity": 1}, token: token}, http.StatusNotFound, "", 0, 0},
+		{"remove", apiRequest{method: http.MethodDelete, path: cartPath + "/items/" + coffeeId, token: token}, http.StatusOK, "", 10, 1},
+		{"remove again", apiRequest{method: http.MethodDelete, path: cartPath + "/items/" + coffeeId, token: token}, http.StatusNotFound, "CART_ITEM_NOT_FOUND", 0, 0},
+		{"get", apiRequest{method: http.MethodGet, path: cartPath, token: token}, http.StatusOK, "", 10, 1},
+		{
+			"replace ignores user and total",
+			apiRequest{method: http.MethodPost, path: cartPath, body: map[string]interface{}{"userId": "someone", "totalPrice": 1, "items": []map[string]interface{}{{"itemId": teaId, "quantity": 2}, {"itemId": coffeeId, "quantity": 1}}}, token: token},
+			http.StatusOK, "", 45, 2,
+		},
+		{"replace with item without id", apiRequest{method: http.MethodPost, path: cartPath, body: map[string]interface{}{"items": []map[string]interface{}{{"quantity": 1}}}, token: token}, http.StatusBadRequest, "VALIDATION", 0, 0},
+		{"replace with negative quantity", apiRequest{method: http.MethodPost, path: cartPath, body: map[string]interface{}{"items": []map[string]interface{}{{"itemId": teaId, "quantity": -1}}}, token: token}, http.StatusBadRequest, "VALIDATION", 0, 0},
+		{"replace with duplicate items", apiRequest{method: http.MethodPost, path: cartPath, body: map[string]interface{}{"items": []map[string]interface{}{{"itemId": teaId, "quantity": 1}, {"itemId": teaId, "quantity": 1}}}, token: token}, http.StatusBadRequest, "VALIDATION", 0, 0},
+		{"replace over the limit", apiRequest{method: http.MethodPost, path: cartPath, body: map[string]interface{}{"items": []map[string]interface{}{{"itemId": teaId, "quantity": 100}}}, token: token}, http.StatusBadRequest, "QUANTITY_LIMIT_REACHED", 0, 0},
+		{"replace with unavailable product", apiRequest{method: http.MethodPost, path: cartPath, body: map[string]interface{}{"items": []map[string]interface{}{{"itemId": soldOutId, "quantity": 1}}}, token: token}, http.StatusBadRequest, "PRODUCT_UNAVAILABLE", 0, 0},
+		{"get after replace", apiRequest{method: http.MethodGet, path: cartPath, token: token}, http.StatusOK, "", 45, 2},
+	}
+
+	// the cases run in order against the same cart
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.t = t
+			if tt.status >= 400 {
+				s.expectProblem(tt.request, tt.status, tt.code)
+				return
+			}
+			var got models.Cart
+			s.expect(tt.request, tt.status, &got)
+			if got.TotalPrice != tt.wantTotal || len(got.Items) != tt.wantItems {
+				t.Errorf("cart total = %v with %d items, want %v with %d", got.TotalPrice, len(got.Items), tt.wantTotal, tt.wantItems)
+			}
+		})
+	}
+
+	s.t = t
+	s.expect(apiRequest{method: http.MethodGet, path: cartPath, token: token}, http.StatusOK, &cart)
+	if cart.UserID == "someone" {
+		t.Errorf("cart userId = %s, taken from the replace request", cart.UserID)
+	}
+	s.expect(apiRequest{method: http.MethodDelete, path: cartPath + "/all", token: token}, http.StatusOK, nil)
+	s.expect(apiRequest{method: http.MethodGet, path: "/me/cart", token: token}, http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Errorf("items = %v after deleting all, want none", cart.Items)
+	}
+}
+
+func TestCartVersions(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.login("asha@example.com")
+	teaId := s.createProduct(token, map[string]interface{}{"name": "Tea", "price": 10, "isAvailable": true})
+
+	var cart models.Cart
+	s.expect(apiRequest{method: http.MethodGet, path: "/me/cart", token: token}, http.StatusOK, &cart)
+	cartPath := "/cart/" + cart.ID.Hex()
+
+	// the total is stored after the item, the ETag is the version of both writes
+	added := s.expect(apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": teaId, "quantity": 1}, token: token}, http.StatusOK, &cart)
+	etag := added.Header().Get(commons.HeaderETag)
+	current := s.expect(apiRequest{method: http.MethodGet, path: cartPath, token: token}, http.StatusOK, &cart)
+	if got := current.Header().Get(commons.HeaderETag); etag == "" || got != etag {
+		t.Errorf("ETag after add = %s, stored cart at %s", etag, got)
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: cartPath + "/items", body: map[string]interface{}{"itemId": teaId, "quantity": 1}, token: token, headers: map[string]string{commons.HeaderIfMatch: etag}}, http.StatusOK, nil)
+
+	// If-Match names a version of a cart which does not exist
+	missing := map[string]interface{}{"items": []interface{}{}}
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/cart/" + primitive.NewObjectID().Hex(), body: missing, token: token, headers: map[string]string{commons.HeaderIfMatch: `"1"`}}, http.StatusPreconditionFailed, "VERSION_CONFLICT")
+}
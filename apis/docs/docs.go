@@ -1,5 +1,6 @@
-// Package docs Code generated by swaggo/swag. DO NOT EDIT
-package docs
+// Code generated by swaggo/swag. DO NOT EDIT.
+
+package gen
 
 import "github.com/swaggo/swag"
 
@@ -18,16 +19,14 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/admin/users/{id}/role": {
-            "put": {
+        "/2fa/confirm": {
+            "post": {
                 "security": [
-                    {
-                        "BearerAuth": []
-                    },
                     {
                         "BearerAuth": []
                     }
                 ],
+                "description": "Verifies the first TOTP code, enables two-factor authentication and returns one-time recovery codes",
                 "consumes": [
                     "application/json"
                 ],
@@ -37,59 +36,41 @@ const docTemplate = `{
                 "tags": [
                     "Auth"
                 ],
-                "summary": "Update user role (admin only)",
+                "summary": "Confirm two-factor enrollment",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "New role (admin or user)",
-                        "name": "body",
+                        "description": "TOTP code",
+                        "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.UpdateUserRoleRequest"
+                            "$ref": "#/definitions/models.TwoFactorCodeRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Role updated successfully",
+                        "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.TwoFactorRecoveryCodesResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request or validation error",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
-                        }
-                    },
-                    "500": {
-                        "description": "Internal server error",
+                        "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/cart": {
+        "/2fa/disable": {
             "post": {
-                "description": "Creates or updates a cart with new list of items and total price",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "consumes": [
                     "application/json"
                 ],
@@ -97,29 +78,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Cart"
+                    "Auth"
                 ],
-                "summary": "Overwrite or add items to cart",
+                "summary": "Disable two-factor authentication",
                 "parameters": [
                     {
-                        "description": "Cart object",
-                        "name": "cart",
+                        "description": "TOTP or recovery code",
+                        "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Cart"
+                            "$ref": "#/definitions/models.TwoFactorCodeRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Cart updated successfully",
-                        "schema": {
-                            "$ref": "#/definitions/models.Cart"
-                        }
-                    },
-                    "400": {
-                        "description": "Invalid cart data",
+                        "description": "Two-factor authentication disabled",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -127,93 +102,60 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "500": {
-                        "description": "Could not update cart",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many wrong codes, the account is throttled like its logins",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/cart/{id}": {
-            "get": {
-                "description": "Get items in a cart using cartId",
-                "consumes": [
-                    "application/json"
+        "/2fa/enroll": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Generates a TOTP secret and otpauth URI (for the QR code) for the logged in user",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Cart"
-                ],
-                "summary": "Get all items in a cart",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Cart ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "Auth"
                 ],
+                "summary": "Start two-factor enrollment",
                 "responses": {
                     "200": {
-                        "description": "Cart object with all items",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Cart"
+                            "$ref": "#/definitions/models.TwoFactorEnrollmentResponse"
                         }
                     },
                     "400": {
-                        "description": "Failed to get items from cart",
+                        "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/cart/{id}/all": {
-            "delete": {
-                "description": "Remove all items from the cart identified by cartId",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Cart"
-                ],
-                "summary": "Delete all items from cart",
-                "parameters": [
+        "/2fa/recovery-codes": {
+            "post": {
+                "security": [
                     {
-                        "type": "string",
-                        "description": "Cart ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "BearerAuth": []
                     }
                 ],
-                "responses": {
-                    "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Failed to delete items from cart",
-                        "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
-                        }
-                    }
-                }
-            }
-        },
-        "/login": {
-            "post": {
+                "description": "Replaces all recovery codes, requires a valid TOTP or recovery code",
                 "consumes": [
                     "application/json"
                 ],
@@ -223,15 +165,15 @@ const docTemplate = `{
                 "tags": [
                     "Auth"
                 ],
-                "summary": "Login User",
+                "summary": "Regenerate recovery codes",
                 "parameters": [
                     {
-                        "description": "User credentials",
-                        "name": "credentials",
+                        "description": "TOTP or recovery code",
+                        "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.UserLoginRequest"
+                            "$ref": "#/definitions/models.TwoFactorCodeRequest"
                         }
                     }
                 ],
@@ -239,189 +181,263 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.UserLoginResponse"
+                            "$ref": "#/definitions/models.TwoFactorRecoveryCodesResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many wrong codes, the account is throttled like its logins",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/orders": {
+        "/admin/audit": {
             "get": {
-                "description": "Get all orders",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Lists the role changes, product price changes and order updates, the latest first. With format=csv the events are exported as a CSV attachment.",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/csv"
                 ],
                 "tags": [
-                    "Order Management"
+                    "Audit"
+                ],
+                "summary": "List the audit log (admin only)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User id of the actor",
+                        "name": "actorId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, e.g. user.role.updated, user.password.reset, product.price.updated, order.updated or order.force_updated",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "user, product or order",
+                        "name": "targetType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Id of the target",
+                        "name": "targetId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Unix timestamp of the oldest event",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Unix timestamp of the latest event",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of events, 100 by default and at most 10000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (default) or csv",
+                        "name": "format",
+                        "in": "query"
+                    }
                 ],
-                "summary": "GetAllOrders",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.AuditEventsResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/admin/products/{id}/restore": {
             "post": {
-                "description": "Create a new order with given details",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Restores a soft deleted product which was not purged yet",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Order Management"
+                    "Product"
                 ],
-                "summary": "CreateOrder",
+                "summary": "Restore Product by ID (admin only)",
                 "parameters": [
                     {
-                        "description": "Order Data",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Order"
-                        }
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
                             "type": "object",
-                            "additionalProperties": true
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "No deleted product with the id",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/orders/{id}": {
+        "/admin/users/locked": {
             "get": {
-                "description": "Get details of an order by its ID",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Lists accounts currently locked out after repeated failed logins",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Order Management"
-                ],
-                "summary": "GetOrderById",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Order ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "Auth"
                 ],
+                "summary": "List locked accounts (admin only)",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Order"
+                            "$ref": "#/definitions/models.LockedAccountsResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update an order's status or cancel the order",
-                "consumes": [
-                    "application/json"
+            }
+        },
+        "/admin/users/{id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "restore a soft deleted account which was not purged yet (admin only)",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Order Management"
+                    "User Management"
                 ],
-                "summary": "UpdateOrder",
+                "summary": "RestoreUserById",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Order ID",
+                        "description": "User id",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Order",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Order"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "No deleted account with the id",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "409": {
+                        "description": "Another account took the email of the account",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/products": {
-            "get": {
-                "description": "Retrieves all products",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Product"
-                ],
-                "summary": "Get All Products",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": true
-                        }
+        "/admin/users/{id}/role": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
-                }
-            },
-            "post": {
-                "description": "Creates a new product",
+                ],
                 "consumes": [
                     "application/json"
                 ],
@@ -429,23 +445,30 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Product"
+                    "Auth"
                 ],
-                "summary": "Create Product",
+                "summary": "Update user role (admin only)",
                 "parameters": [
                     {
-                        "description": "Product Info",
-                        "name": "product",
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New role (admin or user)",
+                        "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Product"
+                            "$ref": "#/definitions/models.UpdateUserRoleRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "Role updated successfully",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -454,28 +477,45 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid request or validation error",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/products/{id}": {
-            "get": {
-                "description": "Retrieves a product by its ID",
+        "/admin/users/{id}/unlock": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Clears failed login attempts and lockout for the user",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product"
+                    "Auth"
                 ],
-                "summary": "Get Product by ID",
+                "summary": "Unlock a locked account (admin only)",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Product ID",
+                        "description": "User ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -483,104 +523,110 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Account unlocked successfully",
                         "schema": {
-                            "$ref": "#/definitions/models.Product"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Updates an existing product",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/auth/oidc/{provider}/callback": {
+            "get": {
+                "description": "Exchanges the authorization code, links or creates the account and returns our access token",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product"
+                    "Auth"
                 ],
-                "summary": "Update Product",
+                "summary": "Complete OpenID Connect login",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Product ID",
-                        "name": "id",
+                        "description": "Provider name",
+                        "name": "provider",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Product Info",
-                        "name": "product",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Product"
-                        }
+                        "type": "string",
+                        "description": "Authorization code",
+                        "name": "code",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "State",
+                        "name": "state",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.UserLoginResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes a product by its ID",
-                "produces": [
-                    "application/json"
-                ],
+            }
+        },
+        "/auth/oidc/{provider}/login": {
+            "get": {
+                "description": "Redirects to the provider (e.g. google) using the authorization code flow with PKCE",
                 "tags": [
-                    "Product"
+                    "Auth"
                 ],
-                "summary": "Delete Product by ID",
+                "summary": "Start OpenID Connect login",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Product ID",
-                        "name": "id",
+                        "description": "Provider name",
+                        "name": "provider",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
-                        }
+                    "302": {
+                        "description": "Found"
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/register": {
-            "post": {
+        "/cart/{id}": {
+            "get": {
+                "description": "Get items in a cart using cartId",
                 "consumes": [
                     "application/json"
                 ],
@@ -588,39 +634,47 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Auth"
+                    "Cart"
                 ],
-                "summary": "Register User",
+                "summary": "Get all items in a cart",
                 "parameters": [
                     {
-                        "description": "User registration data",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.UserDetails"
-                        }
+                        "type": "string",
+                        "description": "Cart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Registered successfully",
+                    "200": {
+                        "description": "Cart object with all items",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Cart"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the cart, send it as If-Match when updating"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Failed to get items from cart",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Cart not found",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
-            }
-        },
-        "/users": {
-            "get": {
-                "description": "get details of all users",
+            },
+            "post": {
+                "description": "Replaces the items of an existing cart and returns the recalculated cart, every item is checked for availability and its quantity limit",
                 "consumes": [
                     "application/json"
                 ],
@@ -628,29 +682,76 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "User Management"
+                    "Cart"
+                ],
+                "summary": "Replace the items of a cart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Items of the cart",
+                        "name": "cart",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ReplaceCartRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the cart being overwritten",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
                 ],
-                "summary": "GetUsers",
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Recalculated cart",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.Cart"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the cart, send it as If-Match when updating"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid items or quantity limit reached",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Cart or product not found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Cart was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "500": {
+                        "description": "Could not update cart",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             }
         },
-        "/users/{id}": {
-            "get": {
-                "description": "Gets user details by user id such as name, email, status etc.",
+        "/cart/{id}/all": {
+            "delete": {
+                "description": "Remove all items from the cart identified by cartId",
                 "consumes": [
                     "application/json"
                 ],
@@ -658,35 +759,1131 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "User Management"
+                    "Cart"
                 ],
-                "summary": "GetUserById",
+                "summary": "Delete all items from cart",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "User id",
+                        "description": "Cart ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the cart being emptied",
+                        "name": "If-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Failed to delete items from cart",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Cart not found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Cart was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/cart/{id}/items": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Adds the item, or increments its quantity if already in the cart, and returns the recalculated cart",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cart"
+                ],
+                "summary": "Add an item to the cart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Item and quantity to add",
+                        "name": "item",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AddCartItemRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the cart being changed",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Recalculated cart",
+                        "schema": {
+                            "$ref": "#/definitions/models.Cart"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid item or quantity limit reached",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Cart or product not found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Cart was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/cart/{id}/items/{itemId}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Removes the item and returns the recalculated cart",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cart"
+                ],
+                "summary": "Remove an item from the cart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Item ID",
+                        "name": "itemId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the cart being changed",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Recalculated cart",
+                        "schema": {
+                            "$ref": "#/definitions/models.Cart"
+                        }
+                    },
+                    "404": {
+                        "description": "Cart or item not found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Cart was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Sets the quantity of the item, 0 removes it, and returns the recalculated cart",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cart"
+                ],
+                "summary": "Set the quantity of a cart item",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Item ID",
+                        "name": "itemId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New quantity",
+                        "name": "item",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UpdateCartItemRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the cart being changed",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Recalculated cart",
+                        "schema": {
+                            "$ref": "#/definitions/models.Cart"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid quantity or quantity limit reached",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Cart or item not found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Cart was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz/live": {
+            "get": {
+                "description": "Reports the process is up, dependencies are not checked",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.HealthReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz/ready": {
+            "get": {
+                "description": "Pings every dependency, reports not ready when one is down or while the server is draining",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.HealthReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/login": {
+            "post": {
+                "description": "Returns an access token, or an interim token when two-factor authentication is enabled",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Login User",
+                "parameters": [
+                    {
+                        "description": "User credentials",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserLoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserLoginResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/login/2fa": {
+            "post": {
+                "description": "Exchanges the interim token from /login and a TOTP or recovery code for an access token",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Complete two-factor login",
+                "parameters": [
+                    {
+                        "description": "Interim token and code",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.TwoFactorLoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserLoginResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/cart": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Resolves the cart from the authenticated user, creating it if missing",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cart"
+                ],
+                "summary": "Get the cart of the logged in user",
+                "responses": {
+                    "200": {
+                        "description": "Cart object with all items",
+                        "schema": {
+                            "$ref": "#/definitions/models.Cart"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the cart, send it as If-Match when updating"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Failed to get cart",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing user in token",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "get": {
+                "description": "Get all orders",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Order Management"
+                ],
+                "summary": "GetAllOrders",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new order with given details",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Order Management"
+                ],
+                "summary": "CreateOrder",
+                "parameters": [
+                    {
+                        "description": "Order Data",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}": {
+            "get": {
+                "description": "Get details of an order by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Order Management"
+                ],
+                "summary": "GetOrderById",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the order, send it as If-Match when updating"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update an order's status or cancel the order, with If-Match the update only applies to the given version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Order Management"
+                ],
+                "summary": "UpdateOrder",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the order being updated",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Order",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the updated order"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Order was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/products": {
+            "get": {
+                "description": "Retrieves all products, deleted products are left out unless an admin asks for them",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product"
+                ],
+                "summary": "Get All Products",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Include the soft deleted products, admins only",
+                        "name": "includeDeleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new product",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product"
+                ],
+                "summary": "Create Product",
+                "parameters": [
+                    {
+                        "description": "Product Info",
+                        "name": "product",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/products/{id}": {
+            "get": {
+                "description": "Retrieves a product by its ID, a deleted product is not found unless an admin asks for it",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product"
+                ],
+                "summary": "Get Product by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also find a soft deleted product, admins only",
+                        "name": "includeDeleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the product, send it as If-Match when updating"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Updates an existing product, with If-Match the update only applies to the given version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product"
+                ],
+                "summary": "Update Product",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the product being updated",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Product Info",
+                        "name": "product",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the updated product"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Product was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Soft deletes a product by its ID, it can be restored by an admin until it is purged",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product"
+                ],
+                "summary": "Delete Product by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Applies a JSON merge patch (RFC 7396), only the fields present are changed and null clears a field.\nThe merged product is validated; id and version cannot be changed.",
+                "consumes": [
+                    "application/json",
+                    "application/merge-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product"
+                ],
+                "summary": "Patch Product",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the product being patched",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Product was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/register": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Register User",
+                "parameters": [
+                    {
+                        "description": "User registration data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserDetails"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Registered successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "409": {
+                        "description": "Email already registered",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "description": "get details of all users, deleted users are left out unless an admin asks for them",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Management"
+                ],
+                "summary": "GetUsers",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Include the soft deleted users, admins only",
+                        "name": "includeDeleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/email/verify": {
+            "post": {
+                "description": "confirm an email change with the token sent to the new address",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Management"
+                ],
+                "summary": "VerifyEmail",
+                "parameters": [
+                    {
+                        "description": "Verification token",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.VerifyEmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "description": "Gets user details by user id such as name, email, status etc.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Management"
+                ],
+                "summary": "GetUserById",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also find a soft deleted user, admins only",
+                        "name": "includeDeleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the profile, send it as If-Match when updating"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
                     }
                 }
             },
             "delete": {
-                "description": "delete user details by user id",
+                "description": "soft delete the account by user id, only the user or an admin can. It can't log in anymore and can be restored by an admin until it is purged",
                 "consumes": [
                     "application/json"
                 ],
@@ -713,67 +1910,317 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "403": {
+                        "description": "Not the user nor an admin",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "partially update the profile with a JSON merge patch (RFC 7396), only the fields present are changed.\nThe merged profile is validated; _id, email, cartId, type and version cannot be changed, the email changes through POST /users/{id}/email.\nWith If-Match the update only applies to the given version of the profile. Only the user or an admin can update the profile.",
+                "consumes": [
+                    "application/json",
+                    "application/merge-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Management"
+                ],
+                "summary": "UpdateUser",
+                "parameters": [
+                    {
+                        "description": "Fields to change",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "User Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the profile being updated",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "412": {
+                        "description": "Profile was modified since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/email": {
+            "post": {
+                "description": "start the change of the account email, a verification link is sent to the new address and the\nemail changes once it is followed. Only the user or an admin can change the email.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Management"
+                ],
+                "summary": "ChangeEmail",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New email",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ChangeEmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Email verification sent",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    },
+                    "503": {
+                        "description": "No SMTP server is configured to send the verification",
+                        "schema": {
+                            "$ref": "#/definitions/commons.ProblemDetails"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "apperrors.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "param": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
+        },
+        "commons.ProblemDetails": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "machine readable, e.g. PRODUCT_NOT_FOUND",
+                    "type": "string"
+                },
+                "correlationId": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/apperrors.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.AddCartItemRequest": {
+            "type": "object",
+            "required": [
+                "itemId",
+                "quantity"
+            ],
+            "properties": {
+                "itemId": {
+                    "type": "string"
+                },
+                "quantity": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "models.AuditChange": {
+            "type": "object",
+            "properties": {
+                "after": {},
+                "before": {},
+                "field": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.AuditEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actorId": {
+                    "description": "user id, empty when the change did not come from a request",
+                    "type": "string"
+                },
+                "actorRole": {
+                    "type": "string"
+                },
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AuditChange"
                     }
+                },
+                "correlationId": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "targetId": {
+                    "type": "string"
+                },
+                "targetType": {
+                    "description": "user, product or order",
+                    "type": "string"
+                },
+                "timestamp": {
+                    "description": "Unix timestamp",
+                    "type": "integer"
                 }
-            },
-            "patch": {
-                "description": "update user details such as name, email, age, and is_Active status bu user id",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "User Management"
-                ],
-                "summary": "UpdateUser",
-                "parameters": [
-                    {
-                        "description": "User data",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.User"
-                        }
-                    },
-                    {
-                        "type": "string",
-                        "description": "User Id",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/commons.ApiErrorResponsePayload"
-                        }
+            }
+        },
+        "models.AuditEventsResponse": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AuditEvent"
                     }
+                },
+                "total": {
+                    "type": "integer"
                 }
             }
-        }
-    },
-    "definitions": {
-        "commons.ApiErrorResponsePayload": {
+        },
+        "models.BuildInfo": {
             "type": "object",
             "properties": {
-                "additional_info": {
-                    "type": "object",
-                    "additionalProperties": true
+                "commit": {
+                    "type": "string"
                 },
-                "message": {
+                "goVersion": {
                     "type": "string"
                 },
-                "status": {
+                "startedAt": {
+                    "type": "string"
+                },
+                "uptimeSeconds": {
+                    "type": "integer"
+                },
+                "version": {
                     "type": "string"
                 }
             }
@@ -795,6 +2242,17 @@ const docTemplate = `{
                 },
                 "totalPrice": {
                     "type": "number"
+                },
+                "updatedAt": {
+                    "description": "Unix timestamp, carts untouched past the ttl are emptied",
+                    "type": "integer"
+                },
+                "userId": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "incremented on every write, sent as ETag",
+                    "type": "integer"
                 }
             }
         },
@@ -814,6 +2272,102 @@ const docTemplate = `{
                 }
             }
         },
+        "models.ChangeEmailRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DependencyCheck": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "latencyMs": {
+                    "type": "number"
+                },
+                "status": {
+                    "description": "up or down",
+                    "type": "string"
+                }
+            }
+        },
+        "models.HealthReport": {
+            "type": "object",
+            "properties": {
+                "build": {
+                    "$ref": "#/definitions/models.BuildInfo"
+                },
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.DependencyCheck"
+                    }
+                },
+                "draining": {
+                    "type": "boolean"
+                },
+                "status": {
+                    "description": "ok or unavailable",
+                    "type": "string"
+                }
+            }
+        },
+        "models.LockedAccountsResponse": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.LoginAttempt"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.LoginAttempt": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "integer"
+                },
+                "firstFailureAt": {
+                    "description": "Unix timestamp, start of the failure window",
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "\"account\" or \"ip\"",
+                    "type": "string"
+                },
+                "lastFailureAt": {
+                    "description": "Unix timestamp",
+                    "type": "integer"
+                },
+                "lockedUntil": {
+                    "description": "Unix timestamp, 0 when not locked",
+                    "type": "integer"
+                },
+                "nextAttemptAt": {
+                    "description": "Unix timestamp in milliseconds, progressive delay",
+                    "type": "integer"
+                },
+                "subject": {
+                    "description": "email or ip address",
+                    "type": "string"
+                }
+            }
+        },
         "models.Order": {
             "type": "object",
             "required": [
@@ -826,6 +2380,7 @@ const docTemplate = `{
                 },
                 "items": {
                     "type": "array",
+                    "minItems": 1,
                     "items": {
                         "$ref": "#/definitions/models.OrderItem"
                     }
@@ -835,10 +2390,11 @@ const docTemplate = `{
                     "type": "integer"
                 },
                 "status": {
-                    "description": "e.g., \"Order Placed\", \"Ready\", \"Preparing\", \"Delivered\", \"Shipped\"",
+                    "description": "one of the OrderStatus constants",
                     "type": "string"
                 },
-                "totalprice": {
+                "totalPrice": {
+                    "description": "computed from the snapshots of the items, see OrderTotal",
                     "type": "number"
                 },
                 "updatedAt": {
@@ -846,6 +2402,10 @@ const docTemplate = `{
                 },
                 "userId": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "incremented on every write, sent as ETag",
+                    "type": "integer"
                 }
             }
         },
@@ -856,21 +2416,52 @@ const docTemplate = `{
                 "quantity"
             ],
             "properties": {
+                "category": {
+                    "type": "string"
+                },
+                "image": {
+                    "type": "string"
+                },
                 "itemId": {
                     "type": "string"
                 },
+                "name": {
+                    "type": "string"
+                },
                 "quantity": {
                     "type": "integer",
                     "minimum": 1
+                },
+                "snapshotBackfilled": {
+                    "description": "set on the lines of orders placed before the snapshots, migration 4 filled them from the product\nas it was then, so the unit price and tax rate may differ from what was charged",
+                    "type": "boolean"
+                },
+                "taxRate": {
+                    "description": "e.g. 0.05 for 5%",
+                    "type": "number"
+                },
+                "unitPrice": {
+                    "type": "number"
                 }
             }
         },
         "models.Product": {
             "type": "object",
+            "required": [
+                "name"
+            ],
             "properties": {
                 "category": {
                     "type": "string"
                 },
+                "deletedAt": {
+                    "description": "Unix timestamp, soft deleted until purged",
+                    "type": "integer"
+                },
+                "deletedBy": {
+                    "description": "user id",
+                    "type": "string"
+                },
                 "description": {
                     "type": "string"
                 },
@@ -883,6 +2474,11 @@ const docTemplate = `{
                 "isAvailable": {
                     "type": "boolean"
                 },
+                "maxQuantity": {
+                    "description": "per cart, 0 uses the default limit",
+                    "type": "integer",
+                    "minimum": 0
+                },
                 "mealTime": {
                     "type": "string"
                 },
@@ -890,13 +2486,96 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "price": {
-                    "type": "number"
+                    "type": "number",
+                    "minimum": 0
                 },
                 "rating": {
                     "type": "number"
                 },
+                "taxRate": {
+                    "description": "share of the price added as tax, e.g. 0.05 for 5%",
+                    "type": "number",
+                    "maximum": 1,
+                    "minimum": 0
+                },
                 "type": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "incremented on every write, sent as ETag",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ReplaceCartRequest": {
+            "type": "object",
+            "required": [
+                "items"
+            ],
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CartItem"
+                    }
+                }
+            }
+        },
+        "models.TwoFactorCodeRequest": {
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.TwoFactorEnrollmentResponse": {
+            "type": "object",
+            "properties": {
+                "otpauthUri": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.TwoFactorLoginRequest": {
+            "type": "object",
+            "required": [
+                "code",
+                "interimToken"
+            ],
+            "properties": {
+                "code": {
+                    "description": "totp or recovery code",
+                    "type": "string"
+                },
+                "interimToken": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.TwoFactorRecoveryCodesResponse": {
+            "type": "object",
+            "properties": {
+                "recoveryCodes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.UpdateCartItemRequest": {
+            "type": "object",
+            "properties": {
+                "quantity": {
+                    "type": "integer",
+                    "minimum": 0
                 }
             }
         },
@@ -932,6 +2611,14 @@ const docTemplate = `{
                 "cartId": {
                     "type": "string"
                 },
+                "deletedAt": {
+                    "description": "Unix timestamp, soft deleted until purged",
+                    "type": "integer"
+                },
+                "deletedBy": {
+                    "description": "user id",
+                    "type": "string"
+                },
                 "email": {
                     "type": "string"
                 },
@@ -946,6 +2633,10 @@ const docTemplate = `{
                 },
                 "type": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "incremented on every profile write, sent as ETag",
+                    "type": "integer"
                 }
             }
         },
@@ -980,6 +2671,9 @@ const docTemplate = `{
                         "admin",
                         "user"
                     ]
+                },
+                "twoFactorEnabled": {
+                    "type": "boolean"
                 }
             }
         },
@@ -1005,16 +2699,34 @@ const docTemplate = `{
                 "email": {
                     "type": "string"
                 },
+                "interimToken": {
+                    "type": "string"
+                },
                 "role": {
                     "type": "string"
                 },
                 "token": {
                     "type": "string"
                 },
+                "twoFactorRequired": {
+                    "description": "set instead of token, when the account has two-factor authentication enabled",
+                    "type": "boolean"
+                },
                 "userId": {
                     "type": "string"
                 }
             }
+        },
+        "models.VerifyEmailRequest": {
+            "type": "object",
+            "required": [
+                "token"
+            ],
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
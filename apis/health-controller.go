@@ -0,0 +1,47 @@
+package apis
+
+import (
+	"Jevan/commons/apploggers"
+	"Jevan/internals/models"
+	"Jevan/internals/services"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HealthController struct {
+	healthService services.HealthService
+}
+
+func NewHealthController(healthService services.HealthService) *HealthController {
+	return &HealthController{
+		healthService: healthService,
+	}
+}
+
+// @Summary Liveness probe
+// @Description Reports the process is up, dependencies are not checked
+// @Tags Health
+// @Produce json
+// @Success 200 {object} models.HealthReport
+// @Router /healthz/live [get]
+func (hc *HealthController) Live(c echo.Context) error {
+	lcontext, _ := apploggers.GetLoggerFromEcho(c)
+	return c.JSON(http.StatusOK, hc.healthService.Liveness(lcontext))
+}
+
+// @Summary Readiness probe
+// @Description Pings every dependency, reports not ready when one is down or while the server is draining
+// @Tags Health
+// @Produce json
+// @Success 200 {object} models.HealthReport
+// @Failure 503 {object} models.HealthReport
+// @Router /healthz/ready [get]
+func (hc *HealthController) Ready(c echo.Context) error {
+	lcontext, _ := apploggers.GetLoggerFromEcho(c)
+	report := hc.healthService.Readiness(lcontext)
+	if report.Status != models.HealthStatusOK {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
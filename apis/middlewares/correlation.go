@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"Jevan/commons/appaudit"
+	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"context"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// longest X-Request-ID accepted from clients, longer or non printable ids are replaced
+const maxRequestIdLength = 128
+
+// Correlation reads the X-Request-ID of the request, or creates one, and builds the request context
+// with a logger carrying it along with the method and path. The context is stored as "context" for
+// apploggers.GetLoggerFromEcho, and the id is sent back in the X-Request-ID response header.
+// Without an X-Request-ID the trace id is used, the logger carries the trace id either way and
+// the span records the correlation id, so logs and traces can be found from one another.
+func Correlation() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			requestId := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestId(requestId) {
+				requestId = apptracing.TraceId(req.Context())
+			}
+
+			ctx, _ := apploggers.NewLoggerWithCorrelationid(req.Context(), requestId)
+			fields := []zap.Field{zap.String("method", req.Method), zap.String("path", req.URL.Path)}
+			if traceId := apptracing.TraceId(ctx); traceId != "" {
+				fields = append(fields, zap.String("traceid", traceId))
+			}
+			ctx, _ = apploggers.WithLoggerFields(ctx, fields...)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("correlation.id", apploggers.GetCorrelationId(ctx)))
+			setContext(c, ctx)
+			c.Response().Header().Set(echo.HeaderXRequestID, apploggers.GetCorrelationId(ctx))
+			return next(c)
+		}
+	}
+}
+
+// adds the authenticated user to the request logger and as actor of the audit events, runs after the
+// token is verified
+func withUserLogger(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if userId := GetUserId(c); userId != "" {
+			ctx, _ := apploggers.GetLoggerFromEcho(c)
+			ctx, _ = apploggers.WithLoggerFields(ctx, zap.String("userId", userId))
+			role, _ := GetClaims(c)["role"].(string)
+			ctx = appaudit.WithActor(ctx, appaudit.Actor{UserId: userId, Role: role, IP: c.RealIP()})
+			setContext(c, ctx)
+		}
+		return next(c)
+	}
+}
+
+func setContext(c echo.Context, ctx context.Context) {
+	c.Set("context", ctx)
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for _, r := range id {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"Jevan/commons"
+	"Jevan/commons/apperrors"
+	"Jevan/commons/apploggers"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const problemTypePrefix = "urn:jevan:problem:"
+
+// status code for each kind of domain error
+var kindStatus = map[apperrors.Kind]int{
+	apperrors.KindNotFound:           http.StatusNotFound,
+	apperrors.KindConflict:           http.StatusConflict,
+	apperrors.KindValidation:         http.StatusBadRequest,
+	apperrors.KindForbidden:          http.StatusForbidden,
+	apperrors.KindInvalidID:          http.StatusBadRequest,
+	apperrors.KindPreconditionFailed: http.StatusPreconditionFailed,
+	apperrors.KindUnavailable:        http.StatusServiceUnavailable,
+}
+
+// ErrorHandler is the central echo error handler, handlers return errors and this maps domain
+// errors and echo errors to the status code and an RFC 7807 problem with a machine readable code.
+// Any other error is a 500 without details, the error itself is only logged.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+
+	problem := problemFor(err)
+	problem.Instance = c.Request().URL.Path
+	problem.CorrelationID = apploggers.GetCorrelationId(lcontext)
+	if problem.Status >= http.StatusInternalServerError {
+		logger.Errorf("Request failed: %v", err)
+	}
+
+	var responseErr error
+	if c.Request().Method == http.MethodHead {
+		responseErr = c.NoContent(problem.Status)
+	} else {
+		responseErr = writeProblem(c, problem)
+	}
+	if responseErr != nil {
+		logger.Errorf("Failed to send error response: %v", responseErr)
+	}
+}
+
+func writeProblem(c echo.Context, problem *commons.ProblemDetails) error {
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	return c.Blob(problem.Status, commons.MIMEProblemJSON, body)
+}
+
+func problemFor(err error) *commons.ProblemDetails {
+	if appErr, ok := apperrors.As(err); ok {
+		status, known := kindStatus[appErr.Kind]
+		if !known {
+			status = http.StatusInternalServerError
+		}
+		problem := newProblem(status, appErr.Code, appErr.Message)
+		problem.Errors = appErr.Fields
+		return problem
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		if internal, ok := httpErr.Internal.(*echo.HTTPError); ok {
+			httpErr = internal
+		}
+		message := http.StatusText(httpErr.Code)
+		if m, ok := httpErr.Message.(string); ok {
+			message = m
+		} else if httpErr.Message != nil {
+			message = fmt.Sprint(httpErr.Message)
+		}
+		return newProblem(httpErr.Code, statusCode(httpErr.Code), message)
+	}
+
+	return newProblem(http.StatusInternalServerError, statusCode(http.StatusInternalServerError), "Internal server error")
+}
+
+// the type of a problem is derived from its code, e.g. PRODUCT_NOT_FOUND -> urn:jevan:problem:product-not-found
+func newProblem(status int, code, detail string) *commons.ProblemDetails {
+	return &commons.ProblemDetails{
+		Type:   problemTypePrefix + strings.ToLower(strings.ReplaceAll(code, "_", "-")),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// machine readable code for plain http errors, e.g. 401 -> UNAUTHORIZED
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "HTTP_" + fmt.Sprint(status)
+	}
+	return strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
@@ -1,40 +1,187 @@
 package middlewares
 
 import (
+	"Jevan/commons/apperrors"
 	"Jevan/configs"
-	"fmt"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	// scope of the short lived token issued after password check, when two-factor login is pending
+	ScopeTwoFactor = "2fa"
+)
+
 func JWTMiddleware() echo.MiddlewareFunc {
-	return echojwt.WithConfig(echojwt.Config{
+	jwtAuth := echojwt.WithConfig(echojwt.Config{
 		SigningKey:  []byte(configs.AppConfig.JwtSecret),
 		TokenLookup: "header:Authorization:Bearer ",
 		ErrorHandler: func(c echo.Context, err error) error {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "Invalid or missing auth token",
-			})
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing auth token")
 		},
 	})
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return jwtAuth(requireAccessToken(withUserLogger(next)))
+	}
 }
 
-func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+// only access tokens are accepted, tokens signed for another purpose, e.g. the interim two-factor token, are not
+func requireAccessToken(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		user := c.Get("user").(*jwt.Token)
-		claims := user.Claims.(jwt.MapClaims)
-
-		role, ok := claims["role"].(string)
-		fmt.Println("User role:", role)
-		if !ok || role != "admin" {
-			return c.JSON(http.StatusForbidden, map[string]string{
-				"error": "Access denied: Admins only",
-			})
+		if err := checkAccessToken(GetClaims(c)); err != nil {
+			return err
+		}
+		return next(c)
+	}
+}
+
+// function to check the claims are those of an access token: no scope, which the tokens of the other
+// steps have, and the user id and role set
+func checkAccessToken(claims jwt.MapClaims) error {
+	if scope, found := claims["scope"]; found {
+		if scope == ScopeTwoFactor {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Two-factor authentication pending")
 		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing auth token")
+	}
+	userId, _ := claims["userId"].(string)
+	role, _ := claims["role"].(string)
+	if userId == "" || role == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing auth token")
+	}
+	return nil
+}
 
+func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := checkAdmin(GetClaims(c)); err != nil {
+			return err
+		}
 		return next(c)
 	}
 }
+
+// function to check the claims are those of an admin, with two-factor authentication when it is required
+func checkAdmin(claims jwt.MapClaims) error {
+	role, ok := claims["role"].(string)
+	if !ok || role != "admin" {
+		return apperrors.Forbidden("Access denied: Admins only")
+	}
+
+	if mfa, _ := claims["mfa"].(bool); configs.AppConfig.RequireAdminTwoFactor && !mfa {
+		return apperrors.Forbidden("Access denied: two-factor authentication required for admins")
+	}
+	return nil
+}
+
+// function to check the authenticated user is the one with the id, or an admin
+func CheckOwnerOrAdmin(c echo.Context, userId string) error {
+	if GetUserId(c) == userId {
+		return nil
+	}
+	if err := checkAdmin(GetClaims(c)); err != nil {
+		return apperrors.Forbidden("Access denied: only the user or an admin can change the account")
+	}
+	return nil
+}
+
+// function to read ?includeDeleted=true, which lists soft deleted records and is for admins only. The
+// routes using it are public, so the token is verified here when JWTMiddleware did not run
+func IncludeDeleted(c echo.Context) (bool, error) {
+	param := c.QueryParam("includeDeleted")
+	if param == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, apperrors.Validation("'includeDeleted' must be true or false")
+	}
+	if !include {
+		return false, nil
+	}
+
+	claims := GetClaims(c)
+	if len(claims) == 0 {
+		token, found := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if claims, err = ParseToken(token); !found || err != nil {
+			return false, echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing auth token")
+		}
+	}
+	if err := checkAccessToken(claims); err != nil {
+		return false, err
+	}
+	if err := checkAdmin(claims); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// function to get the claims of the authenticated user
+func GetClaims(c echo.Context) jwt.MapClaims {
+	if user, ok := c.Get("user").(*jwt.Token); ok {
+		if claims, ok := user.Claims.(jwt.MapClaims); ok {
+			return claims
+		}
+	}
+	return jwt.MapClaims{}
+}
+
+// function to get the user id of the authenticated user
+func GetUserId(c echo.Context) string {
+	userId, _ := GetClaims(c)["userId"].(string)
+	return userId
+}
+
+// function to sign the claims with the application secret
+func SignToken(claims jwt.MapClaims) (string, error) {
+	return signToken(claims, []byte(configs.AppConfig.JwtSecret))
+}
+
+// function to parse and verify a token signed with the application secret
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	return parseToken(tokenString, []byte(configs.AppConfig.JwtSecret))
+}
+
+// function to sign the state of a sign in flow, e.g. the OpenID Connect cookie. It is signed with a key
+// derived from the application secret, so it can never be used as an access token
+func SignFlowToken(claims jwt.MapClaims) (string, error) {
+	return signToken(claims, flowKey())
+}
+
+// function to parse and verify a token signed by SignFlowToken
+func ParseFlowToken(tokenString string) (jwt.MapClaims, error) {
+	return parseToken(tokenString, flowKey())
+}
+
+func flowKey() []byte {
+	mac := hmac.New(sha256.New, []byte(configs.AppConfig.JwtSecret))
+	mac.Write([]byte("jevan-sign-in-flow"))
+	return mac.Sum(nil)
+}
+
+func signToken(claims jwt.MapClaims, key []byte) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(key)
+}
+
+func parseToken(tokenString string, key []byte) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"Jevan/commons/appmetrics"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics records the duration of every request by route template, method and status code
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response, so the status is known
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			appmetrics.ObserveHTTPRequest(c.Request().Method, route, c.Response().Status, time.Since(start))
+			return nil
+		}
+	}
+}
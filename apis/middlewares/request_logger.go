@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"Jevan/commons/apploggers"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequestLogger logs every request once it completed, with its status, duration, client ip and response
+// size. The line is written by the request logger, so it carries the correlation id, method, path and user
+// and goes through the redaction of apploggers; the query string is not logged as it may carry tokens.
+func RequestLogger() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response, so the status is known
+				c.Error(err)
+			}
+
+			_, logger := apploggers.GetLoggerFromEcho(c)
+			res := c.Response()
+			if res.Status >= http.StatusInternalServerError {
+				logger.Errorf("Request failed, status: %d, duration: %s, ip: %s, bytes: %d", res.Status, time.Since(start), c.RealIP(), res.Size)
+			} else {
+				logger.Infof("Request completed, status: %d, duration: %s, ip: %s, bytes: %d", res.Status, time.Since(start), c.RealIP(), res.Size)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package apis
+
+import (
+	"Jevan/apis/middlewares"
+	"Jevan/commons/oidc"
+	"Jevan/internals/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Module is one feature of the api, it registers its own routes, auth is the JWT middleware
+// for the routes which need a logged in user
+type Module interface {
+	RegisterRoutes(e *echo.Echo, auth echo.MiddlewareFunc)
+}
+
+type operationsModule struct {
+	health *HealthController
+}
+
+// function to create the module serving the health checks, the metrics are served on their own port
+func NewOperationsModule(healthService services.HealthService) Module {
+	return &operationsModule{
+		health: NewHealthController(healthService),
+	}
+}
+
+func (m *operationsModule) RegisterRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
+	e.GET("/health", func(c echo.Context) error {
+		return c.String(200, "Jevan API is healthy!")
+	})
+	e.GET("/healthz/live", m.health.Live)
+	e.GET("/healthz/ready", m.health.Ready)
+}
+
+type usersModule struct {
+	users ucontroller
+	auth  *AuthController
+	oidc  *OidcController
+}
+
+// function to create the module of the users, the login flows, two-factor and the user administration
+func NewUsersModule(userService services.UserService, twoFactorService services.TwoFactorService, oidcClients []oidc.Client) Module {
+	return &usersModule{
+		users: NewUserController(userService),
+		auth:  NewAuthController(userService, twoFactorService),
+		oidc:  NewOidcController(userService, oidcClients),
+	}
+}
+
+func (m *usersModule) RegisterRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
+	// Auth
+	e.POST("/login", m.auth.Login)
+	e.POST("/register", m.auth.Register)
+	e.POST("/login/2fa", m.auth.LoginTwoFactor)
+	e.GET("/auth/oidc/:provider/login", m.oidc.Login)
+	e.GET("/auth/oidc/:provider/callback", m.oidc.Callback)
+
+	// Two-factor enrollment for the logged in user
+	twoFactor := e.Group("/2fa", auth)
+	twoFactor.POST("/enroll", m.auth.EnrollTwoFactor)
+	twoFactor.POST("/confirm", m.auth.ConfirmTwoFactor)
+	twoFactor.POST("/recovery-codes", m.auth.RegenerateRecoveryCodes)
+	twoFactor.POST("/disable", m.auth.DisableTwoFactor)
+
+	// Admin-only endpoints
+	admin := e.Group("/admin", auth, middlewares.AdminOnly)
+	admin.PUT("/users/:id/role", m.auth.UpdateUserRole)
+	admin.GET("/users/locked", m.auth.GetLockedAccounts)
+	admin.POST("/users/:id/unlock", m.auth.UnlockAccount)
+	admin.POST("/users/:id/restore", m.users.RestoreUserById)
+
+	// Public Routes
+	e.GET("/users", m.users.GetUsers)
+	e.GET("/users/:id", m.users.GetUserById)
+	e.POST("/users/email/verify", m.users.VerifyEmail)
+
+	// Auth-Protected User Actions
+	userPrivate := e.Group("/users", auth)
+	userPrivate.DELETE("/:id", m.users.DeleteUserById)
+	userPrivate.PATCH("/:id", m.users.UpdateUser)
+	userPrivate.POST("/:id/email", m.users.ChangeEmail)
+}
+
+type productsModule struct {
+	products *ProductController
+}
+
+func NewProductsModule(productService services.ProductService) Module {
+	return &productsModule{
+		products: NewProductController(productService),
+	}
+}
+
+func (m *productsModule) RegisterRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
+	productPublic := e.Group("/products")
+	productPublic.GET("", m.products.GetAllProducts)
+	productPublic.GET("/:id", m.products.GetProductById)
+
+	productPrivate := e.Group("/products", auth)
+	productPrivate.POST("", m.products.CreateProduct)
+	productPrivate.PUT("/:id", m.products.UpdateProduct)
+	productPrivate.PATCH("/:id", m.products.PatchProduct)
+	productPrivate.DELETE("/:id", m.products.DeleteProductById)
+
+	admin := e.Group("/admin", auth, middlewares.AdminOnly)
+	admin.POST("/products/:id/restore", m.products.RestoreProductById)
+}
+
+type cartModule struct {
+	cart cartController
+}
+
+func NewCartModule(cartService services.CartService) Module {
+	return &cartModule{
+		cart: NewCartController(cartService),
+	}
+}
+
+func (m *cartModule) RegisterRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
+	cart := e.Group("/cart", auth)
+	cart.POST("/:id", m.cart.UpdateCart)
+	cart.GET("/:id", m.cart.GetCartItemsById)
+	cart.DELETE("/:id/all", m.cart.DeleteAllItems)
+	cart.POST("/:id/items", m.cart.AddItem)
+	cart.PATCH("/:id/items/:itemId", m.cart.UpdateItem)
+	cart.DELETE("/:id/items/:itemId", m.cart.RemoveItem)
+
+	me := e.Group("/me", auth)
+	me.GET("/cart", m.cart.GetMyCart)
+}
+
+type ordersModule struct {
+	orders *OrderController
+}
+
+func NewOrdersModule(orderService services.OrderService) Module {
+	return &ordersModule{
+		orders: NewOrderController(orderService),
+	}
+}
+
+func (m *ordersModule) RegisterRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
+	order := e.Group("/orders", auth)
+	order.POST("", m.orders.CreateOrder)
+	order.GET("", m.orders.GetAllOrders)
+	order.GET("/:id", m.orders.GetOrderById)
+	order.PUT("/:id", m.orders.UpdateOrder)
+}
+
+type auditModule struct {
+	audit *AuditController
+}
+
+// function to create the module serving the audit log to the admins
+func NewAuditModule(auditService services.AuditService) Module {
+	return &auditModule{
+		audit: NewAuditController(auditService),
+	}
+}
+
+func (m *auditModule) RegisterRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
+	admin := e.Group("/admin", auth, middlewares.AdminOnly)
+	admin.GET("/audit", m.audit.GetAuditEvents)
+}
@@ -0,0 +1,159 @@
+package apis
+
+import (
+	"Jevan/apis/middlewares"
+	"Jevan/commons/apperrors"
+	"Jevan/commons/apploggers"
+	"Jevan/commons/oidc"
+	"Jevan/internals/services"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	oidcCookieName = "jevan_oidc"
+	oidcScope      = "oidc"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+type OidcController struct {
+	userService services.UserService
+	providers   map[string]oidc.Client
+}
+
+func NewOidcController(userService services.UserService, providers []oidc.Client) *OidcController {
+	pmap := make(map[string]oidc.Client, len(providers))
+	for _, provider := range providers {
+		pmap[provider.Name()] = provider
+	}
+	return &OidcController{
+		userService: userService,
+		providers:   pmap,
+	}
+}
+
+// @Summary Start OpenID Connect login
+// @Description Redirects to the provider (e.g. google) using the authorization code flow with PKCE
+// @Tags Auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} commons.ProblemDetails
+// @Router /auth/oidc/{provider}/login [get]
+func (oc *OidcController) Login(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	name := c.Param("provider")
+	logger.Infof("Executing OIDC Login, provider: %s", name)
+
+	provider, ok := oc.providers[name]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Unknown identity provider: "+name)
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+
+	redirectURL, err := provider.AuthCodeURL(lcontext, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		logger.Error(err)
+		return echo.NewHTTPError(http.StatusBadGateway, "Identity provider unavailable")
+	}
+
+	// flow state is kept in a signed, short lived cookie, bound to this browser
+	flow, err := middlewares.SignFlowToken(jwt.MapClaims{
+		"scope":    oidcScope,
+		"provider": name,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcFlowTTL).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oidcCookieName,
+		Value:    flow,
+		Path:     "/auth/oidc",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	logger.Infof("Executed OIDC Login, provider: %s", name)
+	return c.Redirect(http.StatusFound, redirectURL)
+}
+
+// @Summary Complete OpenID Connect login
+// @Description Exchanges the authorization code, links or creates the account and returns our access token
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} models.UserLoginResponse
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 401 {object} commons.ProblemDetails
+// @Router /auth/oidc/{provider}/callback [get]
+func (oc *OidcController) Callback(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	name := c.Param("provider")
+	logger.Infof("Executing OIDC Callback, provider: %s", name)
+
+	provider, ok := oc.providers[name]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Unknown identity provider: "+name)
+	}
+	if errParam := c.QueryParam("error"); errParam != "" {
+		logger.Errorf("Identity provider returned error: %s", errParam)
+		return echo.NewHTTPError(http.StatusUnauthorized, "Sign in was not completed")
+	}
+
+	cookie, err := c.Cookie(oidcCookieName)
+	if err != nil {
+		return apperrors.Validation("Sign in session not found or expired")
+	}
+	// the flow cookie is single use
+	c.SetCookie(&http.Cookie{Name: oidcCookieName, Path: "/auth/oidc", MaxAge: -1, HttpOnly: true})
+
+	flow, err := middlewares.ParseFlowToken(cookie.Value)
+	if err != nil {
+		return apperrors.Validation("Sign in session not found or expired")
+	}
+	scope, _ := flow["scope"].(string)
+	flowProvider, _ := flow["provider"].(string)
+	state, _ := flow["state"].(string)
+	if scope != oidcScope || flowProvider != name || state == "" || state != c.QueryParam("state") {
+		return apperrors.Validation("Invalid sign in state")
+	}
+	nonce, _ := flow["nonce"].(string)
+	verifier, _ := flow["verifier"].(string)
+
+	claims, err := provider.Exchange(lcontext, c.QueryParam("code"), verifier, nonce)
+	if err != nil {
+		logger.Error(err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "Sign in failed")
+	}
+
+	user, err := oc.userService.LoginExternalUser(lcontext, name, claims)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed OIDC Callback, provider: %s, userId: %s", name, user.ID.Hex())
+	return loginResponse(c, user)
+}
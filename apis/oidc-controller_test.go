@@ -0,0 +1,245 @@
+package apis_test
+
+import (
+	"Jevan/commons/oidc"
+	"Jevan/internals/app"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is an OpenID Connect provider which grants the codes a test authorizes, the code is only
+// exchanged with the PKCE verifier of the challenge it was authorized for
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex  sync.Mutex
+	grants map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating the signing key: %v", err)
+	}
+	m := &mockIssuer{t: t, key: key, grants: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{ //nolint
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{ //nolint
+			"kid": "test", "kty": "RSA", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// function to exchange a code for an id token, as the provider does once the verifier matches
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	grant, ok := m.grants[r.PostFormValue("code")]
+	delete(m.grants, r.PostFormValue("code"))
+	m.mutex.Unlock()
+	if !ok || r.PostFormValue("client_id") != "jevan" || oidc.CodeChallenge(r.PostFormValue("code_verifier")) != grant.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{"iss": m.server.URL, "aud": "jevan", "exp": time.Now().Add(time.Minute).Unix()}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Errorf("signing the id token: %v", err)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "provider-token", "token_type": "Bearer", "id_token": idToken}) //nolint
+}
+
+// function to authorize the sign in the server redirected to, the id token gets the claims and the
+// nonce of the request unless the claims set one; returns the code
+func (m *mockIssuer) authorize(location string, claims jwt.MapClaims) string {
+	m.t.Helper()
+	redirect, err := url.Parse(location)
+	if err != nil {
+		m.t.Fatalf("parsing the redirect %s: %v", location, err)
+	}
+	query := redirect.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("client_id") != "jevan" {
+		m.t.Fatalf("authorization request = %s, want the client and a S256 challenge", location)
+	}
+	granted := jwt.MapClaims{"nonce": query.Get("nonce")}
+	for name, value := range claims {
+		granted[name] = value
+	}
+	code, err := oidc.RandomString()
+	if err != nil {
+		m.t.Fatalf("generating the code: %v", err)
+	}
+	m.mutex.Lock()
+	m.grants[code] = mockGrant{challenge: query.Get("code_challenge"), claims: granted}
+	m.mutex.Unlock()
+	return code
+}
+
+// oidcFlow is a started sign in: where the browser is sent and the flow cookie it keeps
+type oidcFlow struct {
+	location string
+	cookie   string
+	state    string
+}
+
+func newOidcTestServer(t *testing.T) (*testServer, *mockIssuer) {
+	issuer := newMockIssuer(t)
+	client := oidc.NewClient(oidc.ProviderConfig{
+		Name:        "mock",
+		IssuerURL:   issuer.server.URL,
+		ClientID:    "jevan",
+		RedirectURL: "http://localhost/auth/oidc/mock/callback",
+	}, issuer.server.Client())
+	recorder := &recordingMailer{}
+	s := bootTestServer(t, app.NewBuilder(testConfig()).WithMailer(recorder).WithOidcClients(client))
+	s.mailer = recorder
+	return s, issuer
+}
+
+func (s *testServer) startOidc() oidcFlow {
+	s.t.Helper()
+	rec := s.expect(apiRequest{method: http.MethodGet, path: "/auth/oidc/mock/login"}, http.StatusFound, nil)
+	flow := oidcFlow{location: rec.Header().Get("Location")}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "jevan_oidc" {
+			flow.cookie = cookie.Value
+		}
+	}
+	redirect, err := url.Parse(flow.location)
+	if err != nil || flow.cookie == "" {
+		s.t.Fatalf("login = %s with cookies %v, want a redirect and the flow cookie", flow.location, rec.Result().Cookies())
+	}
+	flow.state = redirect.Query().Get("state")
+	return flow
+}
+
+func (f oidcFlow) callback(code, state string) apiRequest {
+	return apiRequest{
+		method:  http.MethodGet,
+		path:    "/auth/oidc/mock/callback?" + url.Values{"code": {code}, "state": {state}}.Encode(),
+		headers: map[string]string{"Cookie": "jevan_oidc=" + f.cookie},
+	}
+}
+
+type oidcLogin struct {
+	Token  string `json:"token"`
+	UserId string `json:"userId"`
+}
+
+func TestOidcSignIn(t *testing.T) {
+	s, issuer := newOidcTestServer(t)
+	identity := jwt.MapClaims{"sub": "mock-1", "email": "ravi@example.com", "email_verified": true, "given_name": "Ravi", "family_name": "Kumar"}
+
+	// a new account is created for an unknown identity
+	flow := s.startOidc()
+	var created oidcLogin
+	s.expect(flow.callback(issuer.authorize(flow.location, identity), flow.state), http.StatusOK, &created)
+	if created.Token == "" || created.UserId == "" {
+		t.Fatalf("sign in = %+v, want a token for the new account", created)
+	}
+	s.expect(apiRequest{method: http.MethodGet, path: "/users/" + created.UserId, token: created.Token}, http.StatusOK, nil)
+
+	// a replayed code is refused, and the identity signs into the same account
+	flow = s.startOidc()
+	code := issuer.authorize(flow.location, identity)
+	var again oidcLogin
+	s.expect(flow.callback(code, flow.state), http.StatusOK, &again)
+	s.expectProblem(flow.callback(code, flow.state), http.StatusUnauthorized, "")
+	if again.UserId != created.UserId {
+		t.Errorf("second sign in to %s, want the account %s", again.UserId, created.UserId)
+	}
+
+	// no account is created for an email the provider does not vouch for
+	flow = s.startOidc()
+	s.expectProblem(flow.callback(issuer.authorize(flow.location, jwt.MapClaims{"sub": "mock-3", "email": "meera@example.com", "email_verified": false}), flow.state),
+		http.StatusForbidden, "")
+	s.expect(apiRequest{method: http.MethodPost, path: "/register", body: map[string]string{
+		"firstName": "Meera", "lastName": "Nair", "email": "meera@example.com", "password": "secret-password",
+	}}, http.StatusCreated, nil)
+}
+
+func TestOidcRejectsForgedFlows(t *testing.T) {
+	s, issuer := newOidcTestServer(t)
+	identity := jwt.MapClaims{"sub": "mock-1", "email": "ravi@example.com", "email_verified": true}
+
+	flow := s.startOidc()
+	s.expectProblem(flow.callback(issuer.authorize(flow.location, identity), "forged-state"), http.StatusBadRequest, "VALIDATION")
+
+	flow = s.startOidc()
+	s.expectProblem(apiRequest{method: http.MethodGet, path: "/auth/oidc/mock/callback?code=x&state=" + flow.state}, http.StatusBadRequest, "VALIDATION")
+
+	// an id token issued for another sign in
+	flow = s.startOidc()
+	forged := jwt.MapClaims{"sub": "mock-1", "email": "ravi@example.com", "email_verified": true, "nonce": "another-nonce"}
+	s.expectProblem(flow.callback(issuer.authorize(flow.location, forged), flow.state), http.StatusUnauthorized, "")
+
+	// a code authorized for another browser's sign in cannot be exchanged without its PKCE verifier
+	victim, attacker := s.startOidc(), s.startOidc()
+	s.expectProblem(attacker.callback(issuer.authorize(victim.location, identity), attacker.state), http.StatusUnauthorized, "")
+}
+
+func TestOidcLinksVerifiedEmail(t *testing.T) {
+	s, issuer := newOidcTestServer(t)
+	_, userId := s.login("asha@example.com")
+
+	// the provider does not vouch for the email, the existing account is not taken over
+	flow := s.startOidc()
+	s.expectProblem(flow.callback(issuer.authorize(flow.location, jwt.MapClaims{"sub": "mock-2", "email": "asha@example.com", "email_verified": false}), flow.state),
+		http.StatusForbidden, "")
+
+	flow = s.startOidc()
+	var linked oidcLogin
+	s.expect(flow.callback(issuer.authorize(flow.location, jwt.MapClaims{"sub": "mock-2", "email": "asha@example.com", "email_verified": true}), flow.state),
+		http.StatusOK, &linked)
+	if linked.UserId != userId {
+		t.Errorf("signed into %s, want the existing account %s", linked.UserId, userId)
+	}
+
+	// the linked identity keeps signing into the account, whatever email the provider returns later
+	flow = s.startOidc()
+	s.expect(flow.callback(issuer.authorize(flow.location, jwt.MapClaims{"sub": "mock-2", "email": "asha.rao@example.com", "email_verified": true}), flow.state),
+		http.StatusOK, &linked)
+	if linked.UserId != userId {
+		t.Errorf("signed into %s, want the linked account %s", linked.UserId, userId)
+	}
+	s.relogin("asha@example.com")
+}
@@ -2,6 +2,7 @@ package apis
 
 import (
 	"Jevan/commons"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/internals/models"
 	"Jevan/internals/services"
@@ -28,7 +29,7 @@ func NewOrderController(oservice services.OrderService) *OrderController {
 // @Produce json
 // @Param payload body models.Order true "Order Data"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
 // @Router /orders [post]
 func (oc *OrderController) CreateOrder(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -37,18 +38,18 @@ func (oc *OrderController) CreateOrder(c echo.Context) error {
 	var order *models.Order
 	if err := c.Bind(&order); err != nil || order == nil {
 		logger.Error("Invalid request payload")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Invalid request payload, error: "+err.Error(), nil))
+		return apperrors.Validation("Invalid request payload")
 	}
 
 	if err := commons.ValidateStruct(order); err != nil {
 		logger.Error("Validation failed for order:", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Validation failed for order" + err.Error()})
+		return err
 	}
 
 	orderID, err := oc.oservice.CreateOrder(lcontext, order)
 	if err != nil {
 		logger.Error(err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(err.Error(), nil))
+		return err
 	}
 
 	logger.Infof("Order Placed Successfully, orderId: %s", orderID)
@@ -64,7 +65,9 @@ func (oc *OrderController) CreateOrder(c echo.Context) error {
 // @Produce json
 // @Param id path string true "Order ID"
 // @Success 200 {object} models.Order
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Header 200 {string} ETag "Version of the order, send it as If-Match when updating"
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
 // @Router /orders/{id} [get]
 func (oc *OrderController) GetOrderById(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -72,7 +75,7 @@ func (oc *OrderController) GetOrderById(c echo.Context) error {
 
 	if len(strings.TrimSpace(orderId)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
 	}
 
 	logger.Infof("Executing GetOrderById, orderId: %s", orderId)
@@ -80,22 +83,27 @@ func (oc *OrderController) GetOrderById(c echo.Context) error {
 	order, err := oc.oservice.GetOrderById(lcontext, orderId)
 	if err != nil {
 		logger.Error(err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(err.Error(), nil))
+		return err
 	}
 
 	logger.Infof("Executed GetOrderById, orderId: %s", orderId)
+	commons.SetETag(c, order.Version)
 	return c.JSON(http.StatusOK, order)
 }
 
 // @Tags Order Management
 // @Summary UpdateOrder
-// @Description Update an order's status or cancel the order
+// @Description Update an order's status or cancel the order, with If-Match the update only applies to the given version
 // @Accept json
 // @Produce json
 // @Param id path string true "Order ID"
+// @Param If-Match header string false "ETag of the order being updated"
 // @Param payload body models.Order true "Order"
 // @Success 200
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Header 200 {string} ETag "Version of the updated order"
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
+// @Failure 412 {object} commons.ProblemDetails "Order was modified since it was read"
 // @Router /orders/{id} [put]
 func (oc *OrderController) UpdateOrder(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -103,23 +111,31 @@ func (oc *OrderController) UpdateOrder(c echo.Context) error {
 
 	if len(strings.TrimSpace(orderId)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
+	}
+
+	expectedVersion, err := commons.GetIfMatch(c)
+	if err != nil {
+		logger.Error(err)
+		return err
 	}
 
 	var order *models.Order
 	if err := c.Bind(&order); err != nil || order == nil {
 		logger.Error("Invalid request payload")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Invalid request payload", nil))
+		return apperrors.Validation("Invalid request payload")
 	}
 
 	logger.Infof("Executing UpdateOrder, orderId: %s", orderId)
 
-	if err := oc.oservice.UpdateOrder(lcontext, orderId, order); err != nil {
+	version, err := oc.oservice.UpdateOrder(lcontext, orderId, order, expectedVersion)
+	if err != nil {
 		logger.Error(err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(err.Error(), nil))
+		return err
 	}
 
 	logger.Infof("Executed UpdateOrder, orderId: %s", orderId)
+	commons.SetETag(c, version)
 	return c.NoContent(http.StatusOK)
 }
 
@@ -129,7 +145,7 @@ func (oc *OrderController) UpdateOrder(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
 // @Router /orders [get]
 func (oc *OrderController) GetAllOrders(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -138,7 +154,7 @@ func (oc *OrderController) GetAllOrders(c echo.Context) error {
 	orders, err := oc.oservice.GetAllOrders(lcontext)
 	if err != nil {
 		logger.Error(err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(err.Error(), nil))
+		return err
 	}
 
 	response := map[string]interface{}{
@@ -0,0 +1,127 @@
+package apis_test
+
+import (
+	"Jevan/commons"
+	"Jevan/internals/models"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	token, userId := s.login("asha@example.com")
+	teaId := s.createProduct(token, map[string]interface{}{"name": "Tea", "price": 10, "isAvailable": true})
+
+	var created struct {
+		Id string `json:"id"`
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: "/orders", token: token, body: map[string]interface{}{
+		"userId": userId, "items": []map[string]interface{}{{"itemId": teaId, "quantity": 2}}, "status": models.OrderStatusPlaced,
+	}}, http.StatusCreated, &created)
+	orderPath := "/orders/" + created.Id
+
+	tests := []struct {
+		name     string
+		request  apiRequest
+		status   int
+		code     string
+		wantETag string
+	}{
+		{"create needs a token", apiRequest{method: http.MethodPost, path: "/orders", body: map[string]interface{}{"userId": userId}}, http.StatusUnauthorized, "UNAUTHORIZED", ""},
+		{"create validates", apiRequest{method: http.MethodPost, path: "/orders", body: map[string]interface{}{"status": models.OrderStatusPlaced}, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+		{
+			"create with a negative quantity",
+			apiRequest{method: http.MethodPost, path: "/orders", body: map[string]interface{}{"userId": userId, "items": []map[string]interface{}{{"itemId": teaId, "quantity": 2}, {"itemId": teaId, "quantity": -5}}}, token: token},
+			http.StatusBadRequest, "VALIDATION", "",
+		},
+		{"create without items", apiRequest{method: http.MethodPost, path: "/orders", body: map[string]interface{}{"userId": userId, "items": []interface{}{}}, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+		{"get", apiRequest{method: http.MethodGet, path: orderPath, token: token}, http.StatusOK, "", `"1"`},
+		{"get missing", apiRequest{method: http.MethodGet, path: "/orders/" + primitive.NewObjectID().Hex(), token: token}, http.StatusNotFound, "ORDER_NOT_FOUND", ""},
+		{
+			"update at version",
+			apiRequest{method: http.MethodPut, path: orderPath, body: map[string]interface{}{"status": models.OrderStatusPreparing}, token: token, headers: map[string]string{commons.HeaderIfMatch: `"1"`}},
+			http.StatusOK, "", `"2"`,
+		},
+		{
+			"update at stale version",
+			apiRequest{method: http.MethodPut, path: orderPath, body: map[string]interface{}{"status": models.OrderStatusDelivered}, token: token, headers: map[string]string{commons.HeaderIfMatch: `"1"`}},
+			http.StatusPreconditionFailed, "VERSION_CONFLICT", "",
+		},
+		{"update without version", apiRequest{method: http.MethodPut, path: orderPath, body: map[string]interface{}{"status": models.OrderStatusReady}, token: token}, http.StatusOK, "", `"3"`},
+		{"update to unknown status", apiRequest{method: http.MethodPut, path: orderPath, body: map[string]interface{}{"status": "Shipped"}, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+	}
+
+	// the cases run in order against the same order
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.t = t
+			if tt.status >= 400 {
+				s.expectProblem(tt.request, tt.status, tt.code)
+				return
+			}
+			rec := s.expect(tt.request, tt.status, nil)
+			if tt.wantETag != "" && rec.Header().Get(commons.HeaderETag) != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", rec.Header().Get(commons.HeaderETag), tt.wantETag)
+			}
+		})
+	}
+
+	s.t = t
+	var order models.Order
+	s.expect(apiRequest{method: http.MethodGet, path: orderPath, token: token}, http.StatusOK, &order)
+	if order.Status != models.OrderStatusReady || order.Version != 3 {
+		t.Errorf("order = %+v, want Ready at version 3", order)
+	}
+
+	var list struct {
+		Total  int            `json:"total"`
+		Orders []models.Order `json:"orders"`
+	}
+	s.expect(apiRequest{method: http.MethodGet, path: "/orders", token: token}, http.StatusOK, &list)
+	if list.Total != 1 || len(list.Orders) != 1 {
+		t.Errorf("total = %d, want 1", list.Total)
+	}
+}
+
+func TestOrderSnapshots(t *testing.T) {
+	s := newTestServer(t)
+	token, userId := s.login("asha@example.com")
+	adminToken := s.loginAdmin("admin@example.com")
+	teaId := s.createProduct(token, map[string]interface{}{"name": "Tea", "price": 10, "category": "Beverages", "taxRate": 0.05, "image": "tea.png", "isAvailable": true})
+	samosaId := s.createProduct(token, map[string]interface{}{"name": "Samosa", "price": 20, "isAvailable": true})
+	soldOutId := s.createProduct(token, map[string]interface{}{"name": "Vada Pav", "price": 25, "isAvailable": false})
+	order := func(items ...map[string]interface{}) apiRequest {
+		// the total and the snapshots sent by the client are ignored
+		return apiRequest{method: http.MethodPost, path: "/orders", token: token, body: map[string]interface{}{
+			"userId": userId, "items": items, "totalPrice": 1,
+		}}
+	}
+
+	s.expectProblem(order(map[string]interface{}{"itemId": soldOutId, "quantity": 1}), http.StatusBadRequest, "PRODUCT_UNAVAILABLE")
+	s.expectProblem(order(map[string]interface{}{"itemId": primitive.NewObjectID().Hex(), "quantity": 1}), http.StatusNotFound, "PRODUCT_NOT_FOUND")
+	s.expectProblem(apiRequest{method: http.MethodPatch, path: "/products/" + samosaId, body: `{"taxRate":5}`, token: token}, http.StatusBadRequest, "VALIDATION")
+
+	var created struct {
+		Id string `json:"id"`
+	}
+	s.expect(order(
+		map[string]interface{}{"itemId": teaId, "quantity": 3, "unitPrice": 0.5, "name": "Free Tea"},
+		map[string]interface{}{"itemId": samosaId, "quantity": 1},
+	), http.StatusCreated, &created)
+
+	// the order keeps what was bought once the product is repriced, renamed and deleted
+	s.expect(apiRequest{method: http.MethodPatch, path: "/products/" + teaId, body: `{"name":"Masala Tea","price":30}`, token: adminToken}, http.StatusOK, nil)
+	s.expect(apiRequest{method: http.MethodDelete, path: "/products/" + teaId, token: adminToken}, http.StatusOK, nil)
+
+	var placed models.Order
+	s.expect(apiRequest{method: http.MethodGet, path: "/orders/" + created.Id, token: token}, http.StatusOK, &placed)
+	want := models.OrderItem{ItemID: teaId, Quantity: 3, Name: "Tea", UnitPrice: 10, Category: "Beverages", TaxRate: 0.05, ImageURL: "tea.png"}
+	if len(placed.Items) != 2 || placed.Items[0] != want || placed.Items[1].Name != "Samosa" || placed.Items[1].UnitPrice != 20 {
+		t.Errorf("items = %+v, want the snapshots taken when the order was placed", placed.Items)
+	}
+	if placed.TotalPrice != 51.5 {
+		t.Errorf("total price = %v, want 3 x 10 + 5%% tax + 20 = 51.5", placed.TotalPrice)
+	}
+}
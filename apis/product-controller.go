@@ -1,10 +1,13 @@
 package apis
 
 import (
+	"Jevan/apis/middlewares"
 	"Jevan/commons"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/internals/models"
 	"Jevan/internals/services"
+	"io"
 	"net/http"
 	"strings"
 
@@ -28,22 +31,26 @@ func NewProductController(productService services.ProductService) *ProductContro
 // @Produce json
 // @Param product body models.Product true "Product Info"
 // @Success 201 {object} map[string]string
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
 // @Router /products [post]
 func (pc *ProductController) CreateProduct(c echo.Context) error {
-	logger := apploggers.GetLoggerWithCorrelationid(c.Request().Context())
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	logger.Info("Received request to create product")
 
 	var product models.Product
 	if err := c.Bind(&product); err != nil {
 		logger.Error("Invalid request body: ", err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Invalid request body", nil))
+		return apperrors.Validation("Invalid request body")
+	}
+	if err := commons.ValidateStruct(product); err != nil {
+		logger.Error("Validation failed for product: ", err)
+		return err
 	}
 
-	id, err := pc.productService.CreateProduct(c.Request().Context(), &product)
+	id, err := pc.productService.CreateProduct(lcontext, &product)
 	if err != nil {
 		logger.Error("Failed to create product: ", err)
-		return c.JSON(http.StatusInternalServerError, commons.ApiErrorResponse("Failed to create product", nil))
+		return err
 	}
 
 	logger.Infof("Product created with ID: %s", id)
@@ -51,19 +58,28 @@ func (pc *ProductController) CreateProduct(c echo.Context) error {
 }
 
 // @Summary Get All Products
-// @Description Retrieves all products
+// @Description Retrieves all products, deleted products are left out unless an admin asks for them
 // @Tags Product
 // @Produce json
+// @Param includeDeleted query bool false "Include the soft deleted products, admins only"
 // @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} commons.ProblemDetails
+// @Failure 403 {object} commons.ProblemDetails
 // @Router /products [get]
 func (pc *ProductController) GetAllProducts(c echo.Context) error {
-	logger := apploggers.GetLoggerWithCorrelationid(c.Request().Context())
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	logger.Info("Received request to get all products")
 
-	products, err := pc.productService.GetAllProducts(c.Request().Context())
+	includeDeleted, err := middlewares.IncludeDeleted(c)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	products, err := pc.productService.GetAllProducts(lcontext, includeDeleted)
 	if err != nil {
 		logger.Error("Failed to fetch products: ", err)
-		return c.JSON(http.StatusInternalServerError, commons.ApiErrorResponse("Failed to fetch products", nil))
+		return err
 	}
 
 	logger.Infof("Fetched %d products", len(products))
@@ -74,94 +90,197 @@ func (pc *ProductController) GetAllProducts(c echo.Context) error {
 }
 
 // @Summary Update Product
-// @Description Updates an existing product
+// @Description Updates an existing product, with If-Match the update only applies to the given version
 // @Tags Product
 // @Accept json
 // @Produce json
 // @Param id path string true "Product ID"
+// @Param If-Match header string false "ETag of the product being updated"
 // @Param product body models.Product true "Product Info"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Header 200 {string} ETag "Version of the updated product"
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
+// @Failure 412 {object} commons.ProblemDetails "Product was modified since it was read"
 // @Router /products/{id} [put]
 func (pc *ProductController) UpdateProduct(c echo.Context) error {
-	logger := apploggers.GetLoggerWithCorrelationid(c.Request().Context())
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	id := c.Param("id")
 
 	if len(strings.TrimSpace(id)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
 	}
 
 	logger.Infof("Received request to update product with ID: %s", id)
 
+	expectedVersion, err := commons.GetIfMatch(c)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
 	var product models.Product
 	if err := c.Bind(&product); err != nil {
 		logger.Error("Invalid request body: ", err)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("Invalid request body", nil))
+		return apperrors.Validation("Invalid request body")
+	}
+	if err := commons.ValidateStruct(product); err != nil {
+		logger.Error("Validation failed for product: ", err)
+		return err
 	}
 
-	if err := pc.productService.UpdateProduct(c.Request().Context(), &product, id); err != nil {
+	version, err := pc.productService.UpdateProduct(lcontext, &product, id, expectedVersion)
+	if err != nil {
 		logger.Error("Failed to update product: ", err)
-		return c.JSON(http.StatusInternalServerError, commons.ApiErrorResponse("Failed to update product", nil))
+		return err
 	}
 
 	logger.Infof("Successfully updated product with ID: %s", id)
+	commons.SetETag(c, version)
 	return c.JSON(http.StatusOK, map[string]string{"message": "Product updated successfully"})
 }
 
+// @Summary Patch Product
+// @Description Applies a JSON merge patch (RFC 7396), only the fields present are changed and null clears a field.
+// @Description The merged product is validated; id and version cannot be changed.
+// @Tags Product
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param If-Match header string false "ETag of the product being patched"
+// @Param patch body models.Product true "Fields to change"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
+// @Failure 412 {object} commons.ProblemDetails "Product was modified since it was read"
+// @Failure 415 {object} commons.ProblemDetails
+// @Router /products/{id} [patch]
+func (pc *ProductController) PatchProduct(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	id := c.Param("id")
+
+	if len(strings.TrimSpace(id)) == 0 {
+		logger.Error("'id' is required")
+		return apperrors.Validation("'id' is required")
+	}
+
+	logger.Infof("Received request to patch product with ID: %s", id)
+
+	if !commons.IsMergePatchContentType(c.Request().Header.Get(echo.HeaderContentType)) {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be "+commons.MIMEMergePatchJSON)
+	}
+	expectedVersion, err := commons.GetIfMatch(c)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		logger.Error("Invalid request body: ", err)
+		return apperrors.Validation("Invalid request body")
+	}
+
+	product, err := pc.productService.PatchProduct(lcontext, id, patch, expectedVersion)
+	if err != nil {
+		logger.Error("Failed to patch product: ", err)
+		return err
+	}
+
+	logger.Infof("Successfully patched product with ID: %s", id)
+	commons.SetETag(c, product.Version)
+	return c.JSON(http.StatusOK, product)
+}
+
 // @Summary Get Product by ID
-// @Description Retrieves a product by its ID
+// @Description Retrieves a product by its ID, a deleted product is not found unless an admin asks for it
 // @Tags Product
 // @Produce json
 // @Param id path string true "Product ID"
+// @Param includeDeleted query bool false "Also find a soft deleted product, admins only"
 // @Success 200 {object} models.Product
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Header 200 {string} ETag "Version of the product, send it as If-Match when updating"
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
 // @Router /products/{id} [get]
 func (pc *ProductController) GetProductById(c echo.Context) error {
-	logger := apploggers.GetLoggerWithCorrelationid(c.Request().Context())
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	id := c.Param("id")
 
 	if len(strings.TrimSpace(id)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
 	}
 
 	logger.Infof("Received request to get product by ID: %s", id)
 
-	product, err := pc.productService.GetProductById(c.Request().Context(), id)
+	includeDeleted, err := middlewares.IncludeDeleted(c)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	product, err := pc.productService.GetProductById(lcontext, id, includeDeleted)
 	if err != nil {
 		logger.Error("Failed to fetch product: ", err)
-		return c.JSON(http.StatusInternalServerError, commons.ApiErrorResponse("Failed to fetch product", nil))
+		return err
 	}
 
 	logger.Infof("Fetched product with ID: %s", id)
+	commons.SetETag(c, product.Version)
 	return c.JSON(http.StatusOK, product)
 }
 
 // @Summary Delete Product by ID
-// @Description Deletes a product by its ID
+// @Description Soft deletes a product by its ID, it can be restored by an admin until it is purged
 // @Tags Product
 // @Produce json
 // @Param id path string true "Product ID"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
 // @Router /products/{id} [delete]
 func (pc *ProductController) DeleteProductById(c echo.Context) error {
-	logger := apploggers.GetLoggerWithCorrelationid(c.Request().Context())
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	id := c.Param("id")
 
 	if len(strings.TrimSpace(id)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
 	}
 
 	logger.Infof("Received request to delete product with ID: %s", id)
 
-	if err := pc.productService.DeleteProductById(c.Request().Context(), id); err != nil {
+	if err := pc.productService.DeleteProductById(lcontext, id, middlewares.GetUserId(c)); err != nil {
 		logger.Error("Failed to delete product: ", err)
-		return c.JSON(http.StatusInternalServerError, commons.ApiErrorResponse("Failed to delete product", nil))
+		return err
 	}
 
 	logger.Infof("Successfully deleted product with ID: %s", id)
 	return c.JSON(http.StatusOK, map[string]string{"message": "Product deleted successfully"})
 }
+
+// @Summary Restore Product by ID (admin only)
+// @Description Restores a soft deleted product which was not purged yet
+// @Tags Product
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails "No deleted product with the id"
+// @Router /admin/products/{id}/restore [post]
+func (pc *ProductController) RestoreProductById(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	id := c.Param("id")
+	logger.Infof("Received request to restore product with ID: %s", id)
+
+	if err := pc.productService.RestoreProductById(lcontext, id); err != nil {
+		logger.Error("Failed to restore product: ", err)
+		return err
+	}
+
+	logger.Infof("Successfully restored product with ID: %s", id)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Product restored successfully"})
+}
@@ -0,0 +1,129 @@
+package apis_test
+
+import (
+	"Jevan/apis"
+	"Jevan/commons"
+	"Jevan/internals/models"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProductEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.login("asha@example.com")
+	teaId := s.createProduct(token, map[string]interface{}{"name": "Tea", "price": 10, "isAvailable": true})
+	coffeeId := s.createProduct(token, map[string]interface{}{"name": "Coffee", "price": 25, "isAvailable": true})
+	missingId := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name     string
+		request  apiRequest
+		status   int
+		code     string
+		wantETag string
+	}{
+		{"list is public", apiRequest{method: http.MethodGet, path: "/products"}, http.StatusOK, "", ""},
+		{"get", apiRequest{method: http.MethodGet, path: "/products/" + teaId}, http.StatusOK, "", `"1"`},
+		{"get missing", apiRequest{method: http.MethodGet, path: "/products/" + missingId}, http.StatusNotFound, "PRODUCT_NOT_FOUND", ""},
+		{"get invalid id", apiRequest{method: http.MethodGet, path: "/products/tea"}, http.StatusBadRequest, "INVALID_ID", ""},
+		{"create needs a token", apiRequest{method: http.MethodPost, path: "/products", body: map[string]interface{}{"name": "Juice"}}, http.StatusUnauthorized, "UNAUTHORIZED", ""},
+		{"create with malformed body", apiRequest{method: http.MethodPost, path: "/products", body: `{"name":`, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+		{"create without name", apiRequest{method: http.MethodPost, path: "/products", body: map[string]interface{}{"price": 10}, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+		{"create with negative price", apiRequest{method: http.MethodPost, path: "/products", body: map[string]interface{}{"name": "Juice", "price": -1}, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+		{"create with tax rate over 1", apiRequest{method: http.MethodPost, path: "/products", body: map[string]interface{}{"name": "Juice", "price": 10, "taxRate": 5}, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+		{"update validates", apiRequest{method: http.MethodPut, path: "/products/" + teaId, body: map[string]interface{}{"name": "Green Tea", "price": -12}, token: token}, http.StatusBadRequest, "VALIDATION", ""},
+		{
+			"update at version",
+			apiRequest{method: http.MethodPut, path: "/products/" + teaId, body: map[string]interface{}{"name": "Green Tea", "price": 12, "isAvailable": true}, token: token, headers: map[string]string{commons.HeaderIfMatch: `"1"`}},
+			http.StatusOK, "", `"2"`,
+		},
+		{
+			"update at stale version",
+			apiRequest{method: http.MethodPut, path: "/products/" + teaId, body: map[string]interface{}{"name": "Black Tea", "price": 12}, token: token, headers: map[string]string{commons.HeaderIfMatch: `"1"`}},
+			http.StatusPreconditionFailed, "VERSION_CONFLICT", "",
+		},
+		{
+			"patch needs merge patch",
+			apiRequest{method: http.MethodPatch, path: "/products/" + teaId, body: `price=15`, token: token, headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}},
+			http.StatusUnsupportedMediaType, "", "",
+		},
+		{
+			"patch",
+			apiRequest{method: http.MethodPatch, path: "/products/" + teaId, body: `{"price": 15}`, token: token, headers: map[string]string{"Content-Type": commons.MIMEMergePatchJSON}},
+			http.StatusOK, "", `"3"`,
+		},
+		{"update without version", apiRequest{method: http.MethodPut, path: "/products/" + teaId, body: map[string]interface{}{"name": "Green Tea", "price": 15, "isAvailable": true}, token: token}, http.StatusOK, "", `"4"`},
+		{"delete", apiRequest{method: http.MethodDelete, path: "/products/" + coffeeId, token: token}, http.StatusOK, "", ""},
+		{"delete missing", apiRequest{method: http.MethodDelete, path: "/products/" + coffeeId, token: token}, http.StatusNotFound, "PRODUCT_NOT_FOUND", ""},
+		{"get deleted", apiRequest{method: http.MethodGet, path: "/products/" + coffeeId}, http.StatusNotFound, "PRODUCT_NOT_FOUND", ""},
+		{"include deleted needs a token", apiRequest{method: http.MethodGet, path: "/products?includeDeleted=true"}, http.StatusUnauthorized, "UNAUTHORIZED", ""},
+		{"include deleted is for admins", apiRequest{method: http.MethodGet, path: "/products/" + coffeeId + "?includeDeleted=true", token: token}, http.StatusForbidden, "", ""},
+		{"include deleted must be a bool", apiRequest{method: http.MethodGet, path: "/products?includeDeleted=yes"}, http.StatusBadRequest, "VALIDATION", ""},
+		{"restore is for admins", apiRequest{method: http.MethodPost, path: "/admin/products/" + coffeeId + "/restore", token: token}, http.StatusForbidden, "", ""},
+	}
+
+	// the cases run in order against the same server
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.t = t
+			if tt.status >= 400 {
+				s.expectProblem(tt.request, tt.status, tt.code)
+				return
+			}
+			rec := s.expect(tt.request, tt.status, nil)
+			if tt.wantETag != "" && rec.Header().Get(commons.HeaderETag) != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", rec.Header().Get(commons.HeaderETag), tt.wantETag)
+			}
+		})
+	}
+
+	s.t = t
+	// every invalid field is listed by its JSON name
+	var invalid commons.ProblemDetails
+	s.expect(apiRequest{method: http.MethodPost, path: "/products", body: map[string]interface{}{"price": -1, "taxRate": 5}, token: token}, http.StatusBadRequest, &invalid)
+	fields := map[string]bool{}
+	for _, field := range invalid.Errors {
+		fields[field.Field] = true
+	}
+	if len(fields) != 3 || !fields["name"] || !fields["price"] || !fields["taxRate"] {
+		t.Errorf("invalid fields = %+v, want name, price and taxRate", invalid.Errors)
+	}
+
+	var product models.Product
+	s.expect(apiRequest{method: http.MethodGet, path: "/products/" + teaId}, http.StatusOK, &product)
+	if product.Name != "Green Tea" || product.Price != 15 || product.Version != 4 {
+		t.Errorf("product = %+v, want Green Tea at 15 and version 4", product)
+	}
+
+	var list struct {
+		Total int `json:"total"`
+	}
+	s.expect(apiRequest{method: http.MethodGet, path: "/products"}, http.StatusOK, &list)
+	if list.Total != 1 {
+		t.Errorf("total = %d, want 1", list.Total)
+	}
+
+	// admins see the deleted product and can restore it
+	adminToken := s.loginAdmin("admin@example.com")
+	s.expect(apiRequest{method: http.MethodGet, path: "/products/" + coffeeId + "?includeDeleted=true", token: adminToken}, http.StatusOK, &product)
+	if product.DeletedAt == 0 || product.DeletedBy == "" {
+		t.Errorf("deleted product = %+v, want deletedAt and deletedBy", product)
+	}
+	s.expect(apiRequest{method: http.MethodGet, path: "/products?includeDeleted=true", token: adminToken}, http.StatusOK, &list)
+	if list.Total != 2 {
+		t.Errorf("total with includeDeleted = %d, want 2", list.Total)
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: "/admin/products/" + coffeeId + "/restore", token: adminToken}, http.StatusOK, nil)
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/admin/products/" + coffeeId + "/restore", token: adminToken}, http.StatusNotFound, "PRODUCT_NOT_FOUND")
+	s.expect(apiRequest{method: http.MethodGet, path: "/products/" + coffeeId}, http.StatusOK, nil)
+}
+
+func TestServerWithSubsetOfModules(t *testing.T) {
+	s := newTestServer(t)
+	s.server = s.container.Server(apis.NewProductsModule(s.container.ProductService))
+
+	s.expect(apiRequest{method: http.MethodGet, path: "/products"}, http.StatusOK, nil)
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{}}, http.StatusNotFound, "NOT_FOUND")
+}
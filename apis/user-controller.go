@@ -1,10 +1,13 @@
 package apis
 
 import (
+	"Jevan/apis/middlewares"
 	"Jevan/commons"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/internals/models"
 	"Jevan/internals/services"
+	"io"
 	"net/http"
 	"strings"
 
@@ -27,8 +30,11 @@ func NewUserController(eservice services.UserService) ucontroller {
 // @Accept json
 // @Produce json
 // @Param id path string true "User id"
+// @Param includeDeleted query bool false "Also find a soft deleted user, admins only"
 // @Success 200 {object} models.User
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Header 200 {string} ETag "Version of the profile, send it as If-Match when updating"
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
 // @Router /users/{id} [Get]
 func (u *ucontroller) GetUserById(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -36,25 +42,33 @@ func (u *ucontroller) GetUserById(c echo.Context) error {
 	logger.Infof("Executing GetUserById, userId: %s", userId)
 	if len(strings.TrimSpace(userId)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
 	}
-	user, serror := u.eservice.GetUserById(lcontext, userId)
+	includeDeleted, serror := middlewares.IncludeDeleted(c)
 	if serror != nil {
 		logger.Error(serror)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(serror.Error(), nil))
+		return serror
+	}
+	user, serror := u.eservice.GetUserById(lcontext, userId, includeDeleted)
+	if serror != nil {
+		logger.Error(serror)
+		return serror
 	}
 	logger.Infof("Executed GetUserById, userId:%s, user %s", userId, commons.PrintStruct(user))
+	commons.SetETag(c, user.Version)
 	return c.JSON(http.StatusOK, user)
 }
 
 // @Tags User Management
 // @Summary DeleteUserById
-// @Description delete user details by user id
+// @Description soft delete the account by user id, only the user or an admin can. It can't log in anymore and can be restored by an admin until it is purged
 // @Accept json
 // @Produce json
 // @Param id path string true "User id"
 // @Success 204
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 403 {object} commons.ProblemDetails "Not the user nor an admin"
+// @Failure 404 {object} commons.ProblemDetails
 // @Router /users/{id} [Delete]
 func (u *ucontroller) DeleteUserById(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
@@ -62,32 +76,66 @@ func (u *ucontroller) DeleteUserById(c echo.Context) error {
 	logger.Infof("Executing DeleteUserById, userId: %s", userId)
 	if len(strings.TrimSpace(userId)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
 	}
-	serror := u.eservice.DeleteUserById(lcontext, userId)
+	if serror := middlewares.CheckOwnerOrAdmin(c, userId); serror != nil {
+		logger.Error(serror)
+		return serror
+	}
+	serror := u.eservice.DeleteUserById(lcontext, userId, middlewares.GetUserId(c))
 	if serror != nil {
 		logger.Error(serror)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(serror.Error(), nil))
+		return serror
 	}
 	logger.Infof("Executed DeleteUserById, userId: %s", userId)
 	return c.NoContent(http.StatusNoContent)
 }
 
+// @Tags User Management
+// @Summary RestoreUserById
+// @Description restore a soft deleted account which was not purged yet (admin only)
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User id"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails "No deleted account with the id"
+// @Failure 409 {object} commons.ProblemDetails "Another account took the email of the account"
+// @Router /admin/users/{id}/restore [post]
+func (u *ucontroller) RestoreUserById(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	userId := c.Param("id")
+	logger.Infof("Executing RestoreUserById, userId: %s", userId)
+	serror := u.eservice.RestoreUserById(lcontext, userId)
+	if serror != nil {
+		logger.Error(serror)
+		return serror
+	}
+	logger.Infof("Executed RestoreUserById, userId: %s", userId)
+	return c.JSON(http.StatusOK, map[string]string{"message": "User restored successfully"})
+}
+
 // @Tags User Management
 // @Summary GetUsers
-// @Description get details of all users
+// @Description get details of all users, deleted users are left out unless an admin asks for them
 // @Accept json
 // @Produce json
+// @Param includeDeleted query bool false "Include the soft deleted users, admins only"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Failure 400 {object} commons.ProblemDetails
 // @Router /users [Get]
 func (u *ucontroller) GetUsers(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	logger.Info("Executing Get All Users")
-	users, serror := u.eservice.GetUsers(lcontext)
+	includeDeleted, serror := middlewares.IncludeDeleted(c)
+	if serror != nil {
+		logger.Error(serror)
+		return serror
+	}
+	users, serror := u.eservice.GetUsers(lcontext, includeDeleted)
 	if serror != nil {
 		logger.Error(serror)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(serror.Error(), nil))
+		return serror
 	}
 	logger.Infof("Executed GetUsers, users %s", commons.PrintStruct(users))
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -98,48 +146,124 @@ func (u *ucontroller) GetUsers(c echo.Context) error {
 
 // @Tags User Management
 // @Summary UpdateUser
-// @Description update user details such as name, email, age, and is_Active status bu user id
+// @Description partially update the profile with a JSON merge patch (RFC 7396), only the fields present are changed.
+// @Description The merged profile is validated; _id, email, cartId, type and version cannot be changed, the email changes through POST /users/{id}/email.
+// @Description With If-Match the update only applies to the given version of the profile. Only the user or an admin can update the profile.
 // @Accept json
+// @Accept application/merge-patch+json
 // @Produce json
-// @Param payload body models.User true "User data"
+// @Param payload body models.User true "Fields to change"
 // @Param id path string true "User Id"
-// @Success 200
-// @Failure 400 {object} commons.ApiErrorResponsePayload
+// @Param If-Match header string false "ETag of the profile being updated"
+// @Success 200 {object} models.User
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 403 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
+// @Failure 412 {object} commons.ProblemDetails "Profile was modified since it was read"
+// @Failure 415 {object} commons.ProblemDetails
 // @Router /users/{id} [patch]
 func (u *ucontroller) UpdateUser(c echo.Context) error {
 	lcontext, logger := apploggers.GetLoggerFromEcho(c)
 	userId := c.Param("id")
-	logger.Info("Executing UpdateUser, userId: %s", userId)
+	logger.Infof("Executing UpdateUser, userId: %s", userId)
 	if len(strings.TrimSpace(userId)) == 0 {
 		logger.Error("'id' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'id' is required", nil))
+		return apperrors.Validation("'id' is required")
+	}
+	if err := middlewares.CheckOwnerOrAdmin(c, userId); err != nil {
+		logger.Error(err)
+		return err
+	}
+	if !commons.IsMergePatchContentType(c.Request().Header.Get(echo.HeaderContentType)) {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be "+commons.MIMEMergePatchJSON)
 	}
-	var user *models.User
-	err := c.Bind(&user)
-	if err != nil || user == nil {
+	expectedVersion, err := commons.GetIfMatch(c)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
 		logger.Error("invalid request payload")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("invalid request payload", nil))
+		return apperrors.Validation("invalid request payload")
+	}
+
+	user, serror := u.eservice.PatchUser(lcontext, userId, patch, expectedVersion)
+	if serror != nil {
+		logger.Error(serror)
+		return serror
 	}
+	logger.Infof("Executed UpdateUser, userId: %s", userId)
+	commons.SetETag(c, user.Version)
+	return c.JSON(http.StatusOK, user)
+}
 
-	if len(strings.TrimSpace(user.FirstName)) == 0 {
-		logger.Error("'firstName' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'firstName' is required", nil))
+// @Tags User Management
+// @Summary ChangeEmail
+// @Description start the change of the account email, a verification link is sent to the new address and the
+// @Description email changes once it is followed. Only the user or an admin can change the email.
+// @Accept json
+// @Produce json
+// @Param id path string true "User Id"
+// @Param payload body models.ChangeEmailRequest true "New email"
+// @Success 202 {object} map[string]string "Email verification sent"
+// @Failure 400 {object} commons.ProblemDetails
+// @Failure 403 {object} commons.ProblemDetails
+// @Failure 404 {object} commons.ProblemDetails
+// @Failure 503 {object} commons.ProblemDetails "No SMTP server is configured to send the verification"
+// @Router /users/{id}/email [post]
+func (u *ucontroller) ChangeEmail(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	userId := c.Param("id")
+	logger.Infof("Executing ChangeEmail, userId: %s", userId)
+	if err := middlewares.CheckOwnerOrAdmin(c, userId); err != nil {
+		logger.Error(err)
+		return err
+	}
+	var body models.ChangeEmailRequest
+	if err := c.Bind(&body); err != nil {
+		logger.Error("invalid request payload")
+		return apperrors.Validation("invalid request payload")
+	}
+	if err := commons.ValidateStruct(body); err != nil {
+		return err
 	}
 
-	if len(strings.TrimSpace(user.LastName)) == 0 {
-		logger.Error("'lastName' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'lastName' is required", nil))
+	if serror := u.eservice.ChangeEmail(lcontext, userId, body.Email); serror != nil {
+		logger.Error(serror)
+		return serror
 	}
+	logger.Infof("Executed ChangeEmail, userId: %s", userId)
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "Email change will be applied once the new address is verified",
+	})
+}
 
-	if len(strings.TrimSpace(user.Email)) == 0 {
-		logger.Error("'email' is required")
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse("'email' is required", nil))
+// @Tags User Management
+// @Summary VerifyEmail
+// @Description confirm an email change with the token sent to the new address
+// @Accept json
+// @Produce json
+// @Param payload body models.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} commons.ProblemDetails
+// @Router /users/email/verify [post]
+func (u *ucontroller) VerifyEmail(c echo.Context) error {
+	lcontext, logger := apploggers.GetLoggerFromEcho(c)
+	logger.Info("Executing VerifyEmail")
+	var body models.VerifyEmailRequest
+	if err := c.Bind(&body); err != nil {
+		logger.Error("invalid request payload")
+		return apperrors.Validation("invalid request payload")
 	}
-	serror := u.eservice.UpdateUser(lcontext, user, userId)
-	if serror != nil {
+	if err := commons.ValidateStruct(body); err != nil {
+		return err
+	}
+
+	if serror := u.eservice.VerifyEmailChange(lcontext, body.Token); serror != nil {
 		logger.Error(serror)
-		return c.JSON(http.StatusBadRequest, commons.ApiErrorResponse(serror.Error(), nil))
+		return serror
 	}
-	logger.Info("Executed UpdateUser, userId: %s", userId)
-	return c.NoContent(http.StatusOK)
+	logger.Info("Executed VerifyEmail")
+	return c.JSON(http.StatusOK, map[string]string{"message": "Email updated successfully"})
 }
@@ -0,0 +1,224 @@
+package apis_test
+
+import (
+	"Jevan/apis/middlewares"
+	"Jevan/commons"
+	"Jevan/internals/app"
+	"Jevan/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuthEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	s.login("asha@example.com")
+
+	tests := []struct {
+		name    string
+		request apiRequest
+		status  int
+		code    string
+	}{
+		{
+			"register duplicate email",
+			apiRequest{method: http.MethodPost, path: "/register", body: map[string]string{"firstName": "Asha", "lastName": "Rao", "email": "asha@example.com", "password": "secret-password"}},
+			http.StatusConflict, "EMAIL_ALREADY_EXISTS",
+		},
+		{
+			"register invalid email",
+			apiRequest{method: http.MethodPost, path: "/register", body: map[string]string{"firstName": "Ravi", "lastName": "Rao", "email": "ravi", "password": "secret-password"}},
+			http.StatusBadRequest, "VALIDATION",
+		},
+		{"login", apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{"email": "asha@example.com", "password": "secret-password"}}, http.StatusOK, ""},
+		{"login wrong password", apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{"email": "asha@example.com", "password": "wrong-password"}}, http.StatusUnauthorized, ""},
+		{"login unknown email", apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{"email": "ravi@example.com", "password": "secret-password"}}, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.t = t
+			if tt.status >= 400 {
+				s.expectProblem(tt.request, tt.status, tt.code)
+				return
+			}
+			s.expect(tt.request, tt.status, nil)
+		})
+	}
+}
+
+func TestUserEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	token, userId := s.login("asha@example.com")
+	userPath := "/users/" + userId
+
+	var user models.User
+	s.expect(apiRequest{method: http.MethodGet, path: userPath}, http.StatusOK, &user)
+	if user.Email != "asha@example.com" {
+		t.Fatalf("email = %s, want asha@example.com", user.Email)
+	}
+
+	mergePatch := map[string]string{commons.HeaderIfMatch: `"1"`, "Content-Type": commons.MIMEMergePatchJSON}
+	s.expect(apiRequest{method: http.MethodPatch, path: userPath, body: `{"firstName": "Ashwini"}`, token: token, headers: mergePatch}, http.StatusOK, &user)
+	if user.FirstName != "Ashwini" || user.LastName != "Rao" {
+		t.Errorf("user = %+v, want Ashwini Rao", user)
+	}
+	s.expectProblem(apiRequest{method: http.MethodPatch, path: userPath, body: `{"firstName": "Asha"}`, token: token, headers: mergePatch}, http.StatusPreconditionFailed, "VERSION_CONFLICT")
+	s.expectProblem(apiRequest{method: http.MethodPatch, path: userPath, body: `{"firstName": "Asha"}`, headers: mergePatch}, http.StatusUnauthorized, "UNAUTHORIZED")
+
+	// only the user or an admin can change the account
+	otherToken, _ := s.login("ravi@example.com")
+	s.expectProblem(apiRequest{method: http.MethodPatch, path: userPath, body: `{"firstName": "Ravi"}`, token: otherToken, headers: map[string]string{"Content-Type": commons.MIMEMergePatchJSON}}, http.StatusForbidden, "FORBIDDEN")
+	s.expectProblem(apiRequest{method: http.MethodPost, path: userPath + "/email", body: map[string]string{"email": "ravi.rao@example.com"}, token: otherToken}, http.StatusForbidden, "FORBIDDEN")
+	s.expectProblem(apiRequest{method: http.MethodDelete, path: userPath, token: otherToken}, http.StatusForbidden, "FORBIDDEN")
+
+	// the email is not part of the profile patch, it changes once the link sent to the new address is followed
+	s.expectProblem(apiRequest{method: http.MethodPatch, path: userPath, body: `{"email": "asha.rao@example.com"}`, token: token, headers: map[string]string{"Content-Type": commons.MIMEMergePatchJSON}}, http.StatusBadRequest, "INVALID_PATCH")
+	s.expectProblem(apiRequest{method: http.MethodPost, path: userPath + "/email", body: map[string]string{"email": "asha@example.com"}, token: token}, http.StatusBadRequest, "VALIDATION")
+	s.expect(apiRequest{method: http.MethodPost, path: userPath + "/email", body: map[string]string{"email": "asha.rao@example.com"}, token: token}, http.StatusAccepted, nil)
+	message := s.mailer.last()
+	if message.To != "asha.rao@example.com" {
+		t.Fatalf("verification sent to %q, want asha.rao@example.com", message.To)
+	}
+	verifyToken := message.Body[strings.Index(message.Body, "token=")+len("token="):]
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/users/email/verify", body: map[string]string{"token": "not-a-token"}}, http.StatusBadRequest, "")
+	s.expect(apiRequest{method: http.MethodPost, path: "/users/email/verify", body: map[string]string{"token": verifyToken}}, http.StatusOK, nil)
+	s.expect(apiRequest{method: http.MethodGet, path: userPath}, http.StatusOK, &user)
+	if user.Email != "asha.rao@example.com" {
+		t.Errorf("email = %s after verification, want asha.rao@example.com", user.Email)
+	}
+
+	var list struct {
+		Total int `json:"total"`
+	}
+	s.expect(apiRequest{method: http.MethodGet, path: "/users"}, http.StatusOK, &list)
+	if list.Total != 2 {
+		t.Errorf("total = %d, want 2", list.Total)
+	}
+
+	s.expect(apiRequest{method: http.MethodDelete, path: userPath, token: token}, http.StatusNoContent, nil)
+	s.expectProblem(apiRequest{method: http.MethodGet, path: userPath}, http.StatusNotFound, "USER_NOT_FOUND")
+	s.expectProblem(apiRequest{method: http.MethodGet, path: "/users/" + primitive.NewObjectID().Hex()}, http.StatusNotFound, "USER_NOT_FOUND")
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{"email": "asha.rao@example.com", "password": "secret-password"}}, http.StatusUnauthorized, "")
+
+	// the account was soft deleted, an admin can still read and restore it
+	adminToken := s.loginAdmin("admin@example.com")
+	s.expect(apiRequest{method: http.MethodGet, path: userPath + "?includeDeleted=true", token: adminToken}, http.StatusOK, &user)
+	if user.DeletedBy != userId {
+		t.Errorf("deletedBy = %q, want the user who deleted the account", user.DeletedBy)
+	}
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/admin/users/" + userId + "/restore", token: token}, http.StatusForbidden, "")
+	s.expect(apiRequest{method: http.MethodPost, path: "/admin/users/" + userId + "/restore", token: adminToken}, http.StatusOK, nil)
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/admin/users/" + userId + "/restore", token: adminToken}, http.StatusNotFound, "")
+	token, _ = s.relogin("asha.rao@example.com")
+
+	// the email of a deleted account can be registered again, the deleted account can't be restored then
+	s.expect(apiRequest{method: http.MethodDelete, path: userPath, token: token}, http.StatusNoContent, nil)
+	_, otherId := s.login("asha.rao@example.com")
+	if otherId == userId {
+		t.Fatal("registering the email of the deleted account logged into the deleted account")
+	}
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/admin/users/" + userId + "/restore", token: adminToken}, http.StatusConflict, "EMAIL_ALREADY_EXISTS")
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	userToken, userId := s.login("asha@example.com")
+	adminToken := s.loginAdmin("admin@example.com")
+	rolePath := "/admin/users/" + userId + "/role"
+
+	s.expectProblem(apiRequest{method: http.MethodPut, path: rolePath, body: map[string]string{"role": "admin"}}, http.StatusUnauthorized, "UNAUTHORIZED")
+	s.expectProblem(apiRequest{method: http.MethodPut, path: rolePath, body: map[string]string{"role": "admin"}, token: userToken}, http.StatusForbidden, "")
+	s.expectProblem(apiRequest{method: http.MethodPut, path: rolePath, body: map[string]string{"role": "owner"}, token: adminToken}, http.StatusBadRequest, "VALIDATION")
+	s.expect(apiRequest{method: http.MethodPut, path: rolePath, body: map[string]string{"role": "admin"}, token: adminToken}, http.StatusOK, nil)
+	s.expect(apiRequest{method: http.MethodPatch, path: "/users/" + userId, body: `{"lastName": "Rao"}`, token: adminToken, headers: map[string]string{"Content-Type": commons.MIMEMergePatchJSON}}, http.StatusOK, nil)
+
+	// the new role is in the token issued at the next login
+	userToken, _ = s.relogin("asha@example.com")
+	s.expect(apiRequest{method: http.MethodGet, path: "/admin/users/locked", token: userToken}, http.StatusOK, nil)
+}
+
+func TestChangeEmailWithoutMailer(t *testing.T) {
+	s := bootTestServer(t, app.NewBuilder(testConfig()))
+	token, userId := s.login("asha@example.com")
+
+	// the change is refused rather than waiting for a verification nobody receives
+	s.expectProblem(apiRequest{method: http.MethodPost, path: "/users/" + userId + "/email", body: map[string]string{"email": "asha.rao@example.com"}, token: token},
+		http.StatusServiceUnavailable, "MAIL_NOT_CONFIGURED")
+	s.relogin("asha@example.com")
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	_, userId := s.login("asha@example.com")
+	adminToken := s.loginAdmin("admin@example.com")
+	wrong := apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{"email": "asha@example.com", "password": "wrong-password"}}
+
+	for i := 0; i < 3; i++ {
+		s.expectProblem(wrong, http.StatusUnauthorized, "")
+	}
+	// locked out, even with the right password
+	rec := s.expect(apiRequest{method: http.MethodPost, path: "/login", body: map[string]string{"email": "asha@example.com", "password": "secret-password"}}, http.StatusTooManyRequests, nil)
+	if rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After = %q, want the 60 seconds of the lockout", rec.Header().Get("Retry-After"))
+	}
+
+	var locked models.LockedAccountsResponse
+	s.expect(apiRequest{method: http.MethodGet, path: "/admin/users/locked", token: adminToken}, http.StatusOK, &locked)
+	if locked.Total != 1 || locked.Accounts[0].Subject != "asha@example.com" {
+		t.Errorf("locked accounts = %+v, want asha@example.com", locked.Accounts)
+	}
+	s.expect(apiRequest{method: http.MethodPost, path: "/admin/users/" + userId + "/unlock", token: adminToken}, http.StatusOK, nil)
+	s.relogin("asha@example.com")
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	s.expect(apiRequest{method: http.MethodGet, path: "/healthz/live"}, http.StatusOK, nil)
+	s.expect(apiRequest{method: http.MethodGet, path: "/healthz/ready"}, http.StatusOK, nil)
+
+	s.container.HealthService.SetDraining(true)
+	s.expect(apiRequest{method: http.MethodGet, path: "/healthz/ready"}, http.StatusServiceUnavailable, nil)
+
+	// the metrics are only served by the internal metrics server
+	s.expect(apiRequest{method: http.MethodGet, path: "/metrics"}, http.StatusNotFound, nil)
+	rec := httptest.NewRecorder()
+	s.container.MetricsServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "jevan_http_request_duration_seconds") {
+		t.Errorf("metrics = %d, want the request durations, body: %.200s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOnlyAccessTokensAreAccepted(t *testing.T) {
+	s := newTestServer(t)
+	_, userId := s.login("asha@example.com")
+	expires := time.Now().Add(time.Hour).Unix()
+
+	tokens := map[string]jwt.MapClaims{
+		"sign in flow scope": {"scope": "oidc", "state": "state", "exp": expires},
+		"two-factor scope":   {"userId": userId, "role": "user", "scope": middlewares.ScopeTwoFactor, "exp": expires},
+		"no role":            {"userId": userId, "exp": expires},
+		"no user id":         {"role": "admin", "exp": expires},
+	}
+	for name, claims := range tokens {
+		t.Run(name, func(t *testing.T) {
+			s.t = t
+			token, err := middlewares.SignToken(claims)
+			if err != nil {
+				t.Fatalf("SignToken: %v", err)
+			}
+			s.expectProblem(apiRequest{method: http.MethodGet, path: "/me/cart", token: token}, http.StatusUnauthorized, "")
+			s.expectProblem(apiRequest{method: http.MethodGet, path: "/products?includeDeleted=true", token: token}, http.StatusUnauthorized, "")
+		})
+	}
+
+	// the flow cookie of the OpenID Connect login is not signed with the access token key
+	s.t = t
+	flow, _ := middlewares.SignFlowToken(jwt.MapClaims{"userId": userId, "role": "admin", "exp": expires})
+	s.expectProblem(apiRequest{method: http.MethodGet, path: "/me/cart", token: flow}, http.StatusUnauthorized, "")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"Jevan/commons/apperrors"
+	"Jevan/configs"
+	"Jevan/internals/app"
+	"Jevan/internals/models"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// accountResult is the outcome of create-admin and reset-password
+type accountResult struct {
+	UserId string `json:"userId"`
+	Email  string `json:"email"`
+	Action string `json:"action"` // created, promoted or password reset
+}
+
+// the first admin can't be created through the api, /admin/users/:id/role needs an admin already
+func createAdmin(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	flags, output := newFlagSet("create-admin")
+	email := flags.String("email", "", "email of the admin, an existing account is promoted")
+	firstName := flags.String("first-name", "Admin", "first name, for a new account")
+	lastName := flags.String("last-name", "User", "last name, for a new account")
+	password := flags.String("password", "", "password for a new account, read from stdin when empty")
+	flags.Parse(args) //nolint
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		registration := &models.UserDetails{FirstName: *firstName, LastName: *lastName, Email: *email, Password: *password}
+		// the password is only needed when there is no account to promote
+		if _, err := container.UserDbService.GetUserByEmail(ctx, *email); errors.Is(err, apperrors.ErrNotFound) && registration.Password == "" {
+			if registration.Password, err = readPassword(); err != nil {
+				return err
+			}
+		}
+		userId, created, err := container.UserService.EnsureAdmin(ctx, registration)
+		if err != nil {
+			return err
+		}
+		result := &accountResult{UserId: userId, Email: *email, Action: "promoted"}
+		if created {
+			result.Action = "created"
+		}
+		return printResult(*output, result)
+	})
+}
+
+func resetPassword(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	flags, output := newFlagSet("reset-password")
+	email := flags.String("email", "", "email of the account")
+	password := flags.String("password", "", "new password, read from stdin when empty")
+	flags.Parse(args) //nolint
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	if *password == "" {
+		var err error
+		if *password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		userId, err := container.UserService.ResetPassword(ctx, *email, *password)
+		if err != nil {
+			return err
+		}
+		return printResult(*output, &accountResult{UserId: userId, Email: *email, Action: "password reset"})
+	})
+}
+
+func repairAccounts(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	flags, output := newFlagSet("repair-accounts")
+	apply := flags.Bool("apply", false, "write the fixes, otherwise only report")
+	flags.Parse(args) //nolint
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		report, err := container.AccountRepairService.Repair(ctx, *apply)
+		if err != nil {
+			return err
+		}
+		return printResult(*output, report)
+	})
+}
+
+// function to read the password from the first line of stdin, so it does not show in the process list
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading the password from stdin: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("the password is empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/configs"
+	"Jevan/internals/app"
+	appseed "Jevan/internals/seed"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collections which can be exported and imported
+var collections = []string{
+	configs.MONGO_USERS_COLLECTION,
+	configs.MONGO_USERDETAILS_COLLECTION,
+	configs.MONGO_CARTS_COLLECTION,
+	configs.MONGO_ORDERS_COLLECTION,
+	configs.MONGO_PRODUCTS_COLLECTION,
+	configs.MONGO_LOGIN_ATTEMPTS_COLLECTION,
+}
+
+// documents inserted per call on import
+const importBatchSize = 500
+
+// transferResult is the outcome of exporting or importing one collection
+type transferResult struct {
+	Collection string `json:"collection"`
+	Documents  int    `json:"documents"`
+	File       string `json:"file"`
+}
+
+// generates the data set of -seed and writes it, records of an earlier run with the same seed are replaced
+func seed(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	seedOptions := appseed.DefaultOptions()
+	flags, output := newFlagSet("seed")
+	flags.Int64Var(&seedOptions.Seed, "seed", seedOptions.Seed, "seed of the generator, the same seed gives the same records")
+	flags.IntVar(&seedOptions.Users, "users", seedOptions.Users, "number of accounts, the first one is the admin "+appseed.AdminEmail)
+	flags.IntVar(&seedOptions.Products, "products", seedOptions.Products, "number of products, over every meal time and type")
+	flags.IntVar(&seedOptions.Orders, "orders", seedOptions.Orders, "number of historical orders")
+	flags.IntVar(&seedOptions.OrderDays, "days", seedOptions.OrderDays, "the orders are spread over the last days")
+	flags.StringVar(&seedOptions.Password, "password", seedOptions.Password, "password of every generated account")
+	now := flags.String("now", seedOptions.Now.Format(time.DateOnly), "date the records are generated at, YYYY-MM-DD")
+	flags.Parse(args) //nolint
+	var err error
+	if seedOptions.Now, err = time.Parse(time.DateOnly, *now); err != nil {
+		return fmt.Errorf("-now: %w", err)
+	}
+	dataset, err := appseed.Generate(seedOptions)
+	if err != nil {
+		return err
+	}
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		if err := appseed.Load(ctx, container.DbClient, dataset); err != nil {
+			return err
+		}
+		return printResult(*output, dataset.Report())
+	})
+}
+
+func rebuildAggregates(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	flags, output := newFlagSet("rebuild-aggregates")
+	flags.Parse(args) //nolint
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		report, err := container.CartService.RecalculateTotals(ctx)
+		if err != nil {
+			return err
+		}
+		return printResult(*output, report)
+	})
+}
+
+// every collection is written to <dir>/<collection>.jsonl, one canonical Extended JSON document per line
+func exportCollections(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	flags, output := newFlagSet("export")
+	names := flags.String("collections", strings.Join(collections, ","), "comma separated collections")
+	dir := flags.String("dir", ".", "directory the files are written to")
+	flags.Parse(args) //nolint
+	selected, err := selectCollections(*names)
+	if err != nil {
+		return err
+	}
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		results := make([]transferResult, 0, len(selected))
+		for _, name := range selected {
+			result, err := exportCollection(ctx, container.DbClient.Collection(name), name, *dir)
+			if err != nil {
+				return fmt.Errorf("exporting %s: %w", name, err)
+			}
+			results = append(results, *result)
+		}
+		return printResult(*output, results)
+	})
+}
+
+func exportCollection(ctx context.Context, collection appdb.DatabaseCollection, name, dir string) (*transferResult, error) {
+	var documents []bson.D
+	if err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}), &documents); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, name+".jsonl")
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	for _, document := range documents {
+		line, err := bson.MarshalExtJSON(document, true, false)
+		if err != nil {
+			return nil, err
+		}
+		writer.Write(line)     //nolint
+		writer.WriteByte('\n') //nolint
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return &transferResult{Collection: name, Documents: len(documents), File: path}, nil
+}
+
+// reads the files written by export, -replace empties the collections first, otherwise existing ids fail the import
+func importCollections(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	flags, output := newFlagSet("import")
+	names := flags.String("collections", strings.Join(collections, ","), "comma separated collections")
+	dir := flags.String("dir", ".", "directory the files are read from")
+	replace := flags.Bool("replace", false, "delete the documents of the collections before importing")
+	flags.Parse(args) //nolint
+	selected, err := selectCollections(*names)
+	if err != nil {
+		return err
+	}
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		results := make([]transferResult, 0, len(selected))
+		for _, name := range selected {
+			result, err := importCollection(ctx, container.DbClient.Collection(name), name, *dir, *replace)
+			if err != nil {
+				return fmt.Errorf("importing %s: %w", name, err)
+			}
+			results = append(results, *result)
+		}
+		return printResult(*output, results)
+	})
+}
+
+func importCollection(ctx context.Context, collection appdb.DatabaseCollection, name, dir string, replace bool) (*transferResult, error) {
+	path := filepath.Join(dir, name+".jsonl")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// the documents are deleted rather than the collection dropped, so the indexes of the migrations stay
+	if replace {
+		if _, err := collection.DeleteMany(ctx, bson.M{}); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &transferResult{Collection: name, File: path}
+	batch := make([]interface{}, 0, importBatchSize)
+	insert := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := collection.InsertMany(ctx, batch); err != nil {
+			return err
+		}
+		result.Documents += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	// the largest document MongoDB stores is 16MB
+	scanner.Buffer(make([]byte, 64*1024), 17*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var document bson.D
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &document); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		batch = append(batch, document)
+		if len(batch) == importBatchSize {
+			if err := insert(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	return result, insert()
+}
+
+func selectCollections(names string) ([]string, error) {
+	var selected []string
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, collection := range collections {
+			known = known || collection == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown collection %q, one of: %s", name, strings.Join(collections, ", "))
+		}
+		selected = append(selected, name)
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no collection selected")
+	}
+	return selected, nil
+}
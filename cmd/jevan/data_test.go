@@ -0,0 +1,75 @@
+package main
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/configs"
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source := appdb.NewMemoryDatabaseClient("source").Collection(configs.MONGO_PRODUCTS_COLLECTION)
+	id := primitive.NewObjectID()
+	documents := []interface{}{
+		bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "Tea"}, {Key: "price", Value: 10.5}, {Key: "version", Value: int64(2)}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "name", Value: "Coffee"}, {Key: "tags", Value: bson.A{"hot"}}},
+	}
+	if _, err := source.InsertMany(ctx, documents); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+
+	exported, err := exportCollection(ctx, source, configs.MONGO_PRODUCTS_COLLECTION, dir)
+	if err != nil || exported.Documents != 2 {
+		t.Fatalf("export = %+v, %v, want 2 documents", exported, err)
+	}
+
+	target := appdb.NewMemoryDatabaseClient("target").Collection(configs.MONGO_PRODUCTS_COLLECTION)
+	imported, err := importCollection(ctx, target, configs.MONGO_PRODUCTS_COLLECTION, dir, false)
+	if err != nil || imported.Documents != 2 {
+		t.Fatalf("import = %+v, %v, want 2 documents", imported, err)
+	}
+
+	// ids and types survive the round trip
+	var product bson.M
+	if err := target.FindOne(ctx, bson.M{"_id": id}, &product); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	if product["price"] != 10.5 || product["version"] != int64(2) {
+		t.Errorf("imported = %v, want price 10.5 and version int64 2", product)
+	}
+
+	if _, err := importCollection(ctx, target, configs.MONGO_PRODUCTS_COLLECTION, dir, false); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("import over existing ids = %v, want a duplicate key error", err)
+	}
+	if imported, err := importCollection(ctx, target, configs.MONGO_PRODUCTS_COLLECTION, dir, true); err != nil || imported.Documents != 2 {
+		t.Errorf("import with replace = %+v, %v, want 2 documents", imported, err)
+	}
+	if count, _ := target.CountDocuments(ctx, bson.M{}); count != 2 {
+		t.Errorf("documents = %d after replace, want 2", count)
+	}
+}
+
+func TestSelectCollections(t *testing.T) {
+	tests := []struct {
+		names   string
+		want    int
+		wantErr bool
+	}{
+		{"products", 1, false},
+		{"products, orders", 2, false},
+		{"products,menus", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		selected, err := selectCollections(tt.names)
+		if (err != nil) != tt.wantErr || len(selected) != tt.want {
+			t.Errorf("selectCollections(%q) = %v, %v", tt.names, selected, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"Jevan/commons/apploggers"
+	"Jevan/configs"
+	"Jevan/internals/app"
+	"Jevan/internals/models"
+	"context"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: jevan <command> [flags]
+
+Commands:
+  create-admin        create an admin account, or promote the account with -email
+  reset-password      set a new password for the account with -email and lift a login lockout
+  seed                generate users, products, carts and orders from -seed, a second run replaces them
+  export              write collections to <dir>/<collection>.jsonl as Extended JSON
+  import              read collections written by export, -replace deletes the existing documents first
+  rebuild-aggregates  recompute the cart totals from the current product prices
+  repair-accounts     find users / users-details records out of sync, fix them with -apply
+  migrate up          apply the pending schema migrations
+  migrate down        revert the last applied migration, or the last -steps
+  migrate status      list the migrations and whether they are applied
+
+Every command takes -output json (default) or -output table, run a command with -h for its flags.
+`
+
+type command func(ctx context.Context, config *configs.ApplicationConfig, args []string) error
+
+var commands = map[string]command{
+	"create-admin":       createAdmin,
+	"reset-password":     resetPassword,
+	"seed":               seed,
+	"export":             exportCollections,
+	"import":             importCollections,
+	"rebuild-aggregates": rebuildAggregates,
+	"repair-accounts":    repairAccounts,
+	"migrate":            migrate,
+}
+
+// jevan is the operations cli, it is built from the same packages as the server
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	config, err := configs.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+	// stdout is kept for the result of the command
+	if len(config.Log.Outputs) == 0 {
+		config.Log.Outputs = []string{apploggers.OutputStderr}
+	}
+	for i, output := range config.Log.Outputs {
+		if output == apploggers.OutputStdout {
+			config.Log.Outputs[i] = apploggers.OutputStderr
+		}
+	}
+	if err := apploggers.Configure(config.Log); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	ctx, logger := apploggers.NewLoggerWithCorrelationid(context.Background(), "")
+
+	if err := run(ctx, config, os.Args[2:]); err != nil {
+		logger.Errorf("%s failed: %v", os.Args[1], err)
+		apploggers.Sync() //nolint
+		os.Exit(1)
+	}
+	apploggers.Sync() //nolint
+}
+
+// function to wire the application for one command, the database connection is closed afterwards
+func withContainer(ctx context.Context, config *configs.ApplicationConfig, fn func(container *app.Container) error) error {
+	container, err := app.NewBuilder(config).Build(ctx)
+	if err != nil {
+		return err
+	}
+	defer container.Close(ctx)
+	return fn(container)
+}
+
+func migrate(ctx context.Context, config *configs.ApplicationConfig, args []string) error {
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	flags, output := newFlagSet("migrate " + args[0])
+	steps := flags.Int("steps", 1, "number of migrations to revert, for down")
+	flags.Parse(args[1:]) //nolint
+
+	return withContainer(ctx, config, func(container *app.Container) error {
+		var statuses []models.MigrationStatus
+		var err error
+		switch args[0] {
+		case "up":
+			statuses, err = container.Migrations.Up(ctx)
+		case "down":
+			statuses, err = container.Migrations.Down(ctx, *steps)
+		case "status":
+			statuses, err = container.Migrations.Status(ctx)
+		}
+		// what was applied before a failure is printed as well
+		if printErr := printResult(*output, statuses); printErr != nil && err == nil {
+			err = printErr
+		}
+		return err
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"Jevan/internals/models"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+)
+
+// function to create the flags of a command, every command takes -output
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	output := flags.String("output", outputJSON, "json or table")
+	return flags, output
+}
+
+// function to print the result of a command in the chosen format, results without a table form are printed as json
+func printResult(output string, payload interface{}) error {
+	if output == outputTable {
+		if header, rows, ok := tableOf(payload); ok {
+			return printTable(header, rows)
+		}
+	}
+	return printJSON(payload)
+}
+
+func printJSON(payload interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(payload)
+}
+
+func printTable(header []string, rows [][]string) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+func tableOf(payload interface{}) ([]string, [][]string, bool) {
+	switch result := payload.(type) {
+	case []models.MigrationStatus:
+		rows := make([][]string, 0, len(result))
+		for _, status := range result {
+			rows = append(rows, []string{strconv.Itoa(status.Version), status.Description, strconv.FormatBool(status.Applied), unixTime(status.AppliedAt)})
+		}
+		return []string{"VERSION", "DESCRIPTION", "APPLIED", "APPLIED AT"}, rows, true
+	case *models.AccountRepairReport:
+		var rows [][]string
+		for _, issue := range []struct {
+			name string
+			ids  []string
+		}{
+			{"orphaned credentials", result.OrphanedCredentials},
+			{"orphaned profile", result.OrphanedProfiles},
+			{"mismatched email", result.MismatchedEmails},
+			{"duplicate email", result.DuplicateEmails},
+		} {
+			for _, id := range issue.ids {
+				fixed := result.Applied && issue.name != "orphaned credentials" && issue.name != "duplicate email"
+				rows = append(rows, []string{issue.name, id, strconv.FormatBool(fixed)})
+			}
+		}
+		return []string{"ISSUE", "RECORD", "FIXED"}, rows, true
+	case *models.SeedReport:
+		return []string{"SEED", "USERS", "PRODUCTS", "CARTS", "ORDERS"}, [][]string{{
+			strconv.FormatInt(result.Seed, 10), strconv.Itoa(result.Users), strconv.Itoa(result.Products),
+			strconv.Itoa(result.Carts), strconv.Itoa(result.Orders),
+		}}, true
+	case *models.AggregatesReport:
+		return []string{"CARTS", "CHANGED"}, [][]string{{strconv.Itoa(result.Carts), strings.Join(result.ChangedCarts, ",")}}, true
+	case *accountResult:
+		return []string{"USER ID", "EMAIL", "ACTION"}, [][]string{{result.UserId, result.Email, result.Action}}, true
+	case []transferResult:
+		rows := make([][]string, 0, len(result))
+		for _, transfer := range result {
+			rows = append(rows, []string{transfer.Collection, strconv.Itoa(transfer.Documents), transfer.File})
+		}
+		return []string{"COLLECTION", "DOCUMENTS", "FILE"}, rows, true
+	}
+	return nil, nil, false
+}
+
+func unixTime(seconds int64) string {
+	if seconds == 0 {
+		return "-"
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,23 @@
+package appaudit
+
+import "context"
+
+type actorKey struct{}
+
+// Actor is the authenticated user behind a request, recorded with the audit events of the changes it makes
+type Actor struct {
+	UserId string
+	Role   string
+	IP     string
+}
+
+// function to store the actor of the request in the context
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// function to get the actor of the request, the zero Actor outside of an authenticated request, e.g. in the CLI
+func GetActor(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
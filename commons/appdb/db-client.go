@@ -5,12 +5,15 @@ import (
 	"context"
 
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type DatabaseClient interface {
 	GetDbName() string
 	Disconnect(ctx context.Context)
+	Ping(ctx context.Context) error
 	Collection(collection string) DatabaseCollection
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type dbclient struct {
@@ -27,10 +30,17 @@ func NewDatabaseClient(databasename string, client *mongo.Client) DatabaseClient
 
 // function to get close the db connection
 func (d *dbclient) Disconnect(ctx context.Context) {
-	logger := apploggers.GetLogger(ctx, false)
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	if err := d.client.Disconnect(ctx); err != nil {
-		logger.Info("Error disconnecting from DB: %v\n", err)
+		logger.Errorf("Error disconnecting from DB: %v", err)
+		return
 	}
+	logger.Info("Disconnected from DB")
+}
+
+// function to check the primary can be reached
+func (d *dbclient) Ping(ctx context.Context) error {
+	return d.client.Ping(ctx, readpref.Primary())
 }
 
 // function to get collection for the database
@@ -42,3 +52,18 @@ func (d *dbclient) Collection(collection string) DatabaseCollection {
 func (d *dbclient) GetDbName() string {
 	return d.databaseName
 }
+
+// function to run fn in a transaction, collection calls made with the passed context join it
+// fn may be retried by the driver on transient errors, so it must be safe to run again
+func (d *dbclient) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := d.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sctx)
+	})
+	return err
+}
@@ -0,0 +1,19 @@
+package appdb
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the shutdown disconnects with a context which has no request logger
+func TestDisconnectWithoutLogger(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	NewDatabaseClient("jevan", client).Disconnect(context.Background())
+	NewDatabaseClient("jevan", client).Disconnect(context.Background())
+}
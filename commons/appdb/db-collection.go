@@ -1,7 +1,9 @@
 package appdb
 
 import (
+	"Jevan/commons/appmetrics"
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -9,7 +11,7 @@ import (
 
 type DatabaseCollection interface {
 	FindOne(ctx context.Context, filter interface{}, document interface{}) error
-	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}) error
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, document interface{}) error
 	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
@@ -21,56 +23,72 @@ type DatabaseCollection interface {
 	Distinct(ctx context.Context, field string, response interface{}) ([]interface{}, error)
 	Drop(ctx context.Context) error
 	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	CreateIndexes(ctx context.Context, models []mongo.IndexModel) ([]string, error)
+	DropIndex(ctx context.Context, name string) error
 }
 
+// dbcollection measures every call, see appmetrics.ObserveDbOperation
 type dbcollection struct {
+	name       string
 	collection *mongo.Collection
 }
 
 func newDatabaseCollection(dbclient *mongo.Database, collection string) DatabaseCollection {
 	return &dbcollection{
+		name:       collection,
 		collection: dbclient.Collection(collection),
 	}
 }
 
-func (d *dbcollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+// function to record an operation, deferred with the start time and the named error of the method
+func (d *dbcollection) observe(operation string, start time.Time, err *error) {
+	appmetrics.ObserveDbOperation(d.name, operation, start, *err)
+}
+
+func (d *dbcollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (result *mongo.DeleteResult, err error) {
+	defer d.observe("delete_one", time.Now(), &err)
 	return d.collection.DeleteOne(ctx, filter, opts...)
 }
 
-func (d *dbcollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+func (d *dbcollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (result *mongo.DeleteResult, err error) {
+	defer d.observe("delete_many", time.Now(), &err)
 	return d.collection.DeleteMany(ctx, filter, opts...)
 }
 
-func (d *dbcollection) FindOne(ctx context.Context, filter interface{}, document interface{}) error {
+func (d *dbcollection) FindOne(ctx context.Context, filter interface{}, document interface{}) (err error) {
+	defer d.observe("find_one", time.Now(), &err)
 	return d.collection.FindOne(ctx, filter).Decode(document)
 }
 
-func (d *dbcollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}) error {
-	result := d.collection.FindOneAndUpdate(ctx, filter, update)
-	if result.Err() != nil {
-		return result.Err()
-	}
-	return nil
+// updates the first document of the filter and decodes it as it was before the update into document
+func (d *dbcollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, document interface{}) (err error) {
+	defer d.observe("find_one_and_update", time.Now(), &err)
+	return d.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(document)
 }
 
-func (d *dbcollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+func (d *dbcollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (result *mongo.InsertOneResult, err error) {
+	defer d.observe("insert_one", time.Now(), &err)
 	return d.collection.InsertOne(ctx, document, opts...)
 }
 
-func (d *dbcollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+func (d *dbcollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (result *mongo.UpdateResult, err error) {
+	defer d.observe("update_one", time.Now(), &err)
 	return d.collection.UpdateOne(ctx, filter, update, opts...)
 }
 
-func (d *dbcollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+func (d *dbcollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (result *mongo.UpdateResult, err error) {
+	defer d.observe("update_many", time.Now(), &err)
 	return d.collection.UpdateMany(ctx, filter, update, opts...)
 }
 
-func (d *dbcollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+func (d *dbcollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (count int64, err error) {
+	defer d.observe("count_documents", time.Now(), &err)
 	return d.collection.CountDocuments(ctx, filter, opts...)
 }
 
 func (d *dbcollection) Find(
-	ctx context.Context, filter interface{}, options *options.FindOptions, response interface{}) error {
+	ctx context.Context, filter interface{}, options *options.FindOptions, response interface{}) (err error) {
+	defer d.observe("find", time.Now(), &err)
 	results, dberror := d.collection.Find(ctx, filter, options)
 	if dberror != nil {
 		return dberror
@@ -81,11 +99,13 @@ func (d *dbcollection) Find(
 	return results.All(ctx, response)
 }
 
-func (d *dbcollection) Drop(ctx context.Context) error {
+func (d *dbcollection) Drop(ctx context.Context) (err error) {
+	defer d.observe("drop", time.Now(), &err)
 	return d.collection.Drop(ctx)
 }
 
-func (d *dbcollection) Aggregate(ctx context.Context, pipeline interface{}, response interface{}) error {
+func (d *dbcollection) Aggregate(ctx context.Context, pipeline interface{}, response interface{}) (err error) {
+	defer d.observe("aggregate", time.Now(), &err)
 	results, dberror := d.collection.Aggregate(ctx, pipeline)
 	if dberror != nil {
 		return dberror
@@ -95,10 +115,24 @@ func (d *dbcollection) Aggregate(ctx context.Context, pipeline interface{}, resp
 }
 
 func (d *dbcollection) Distinct(
-	ctx context.Context, field string, response interface{}) ([]interface{}, error) {
+	ctx context.Context, field string, response interface{}) (values []interface{}, err error) {
+	defer d.observe("distinct", time.Now(), &err)
 	return d.collection.Distinct(ctx, field, response)
 }
 
-func (d *dbcollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+func (d *dbcollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (result *mongo.InsertManyResult, err error) {
+	defer d.observe("insert_many", time.Now(), &err)
 	return d.collection.InsertMany(ctx, documents, opts...)
 }
+
+// function to create the indexes, returns their names; creating an existing index again is a no-op
+func (d *dbcollection) CreateIndexes(ctx context.Context, models []mongo.IndexModel) (names []string, err error) {
+	defer d.observe("create_indexes", time.Now(), &err)
+	return d.collection.Indexes().CreateMany(ctx, models)
+}
+
+func (d *dbcollection) DropIndex(ctx context.Context, name string) (err error) {
+	defer d.observe("drop_index", time.Now(), &err)
+	_, err = d.collection.Indexes().DropOne(ctx, name)
+	return err
+}
@@ -0,0 +1,89 @@
+package appdb
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// memoryclient keeps the collections in memory, documents are stored in their bson form so the
+// models decode exactly as they do from MongoDB. It is meant for tests and local runs, see
+// memory-query.go for the supported filter and update operators.
+type memoryclient struct {
+	databaseName string
+
+	mutex       sync.Mutex
+	collections map[string]*memorycollection
+
+	// serializes transactions, the data mutex is only held by single operations
+	transaction sync.Mutex
+}
+
+func NewMemoryDatabaseClient(databaseName string) DatabaseClient {
+	return &memoryclient{
+		databaseName: databaseName,
+		collections:  map[string]*memorycollection{},
+	}
+}
+
+func (m *memoryclient) GetDbName() string {
+	return m.databaseName
+}
+
+func (m *memoryclient) Disconnect(ctx context.Context) {}
+
+func (m *memoryclient) Ping(ctx context.Context) error {
+	return nil
+}
+
+// function to get the collection, it is created empty on first use
+func (m *memoryclient) Collection(collection string) DatabaseCollection {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if existing, ok := m.collections[collection]; ok {
+		return existing
+	}
+	created := &memorycollection{client: m, name: collection}
+	m.collections[collection] = created
+	return created
+}
+
+// function to run fn in a transaction, the collections are restored when fn fails; writes made
+// outside of the transaction while it runs are lost on rollback
+func (m *memoryclient) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.transaction.Lock()
+	defer m.transaction.Unlock()
+
+	snapshot := m.snapshot()
+	if err := fn(ctx); err != nil {
+		m.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+func (m *memoryclient) snapshot() map[string][]bson.M {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	snapshot := make(map[string][]bson.M, len(m.collections))
+	for name, collection := range m.collections {
+		documents := make([]bson.M, len(collection.documents))
+		for i, document := range collection.documents {
+			documents[i] = copyDocument(document)
+		}
+		snapshot[name] = documents
+	}
+	return snapshot
+}
+
+func (m *memoryclient) restore(snapshot map[string][]bson.M) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name, collection := range m.collections {
+		collection.documents = snapshot[name]
+	}
+}
@@ -0,0 +1,390 @@
+package appdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// memorycollection holds the documents in insertion order, guarded by the mutex of the client
+type memorycollection struct {
+	client    *memoryclient
+	name      string
+	documents []bson.M
+	indexes   []memoryindex
+}
+
+func (m *memorycollection) lock() func() {
+	m.client.mutex.Lock()
+	return m.client.mutex.Unlock
+}
+
+// function to get the indexes of the documents matching the filter
+func (m *memorycollection) match(filter bson.M) ([]int, error) {
+	var matched []int
+	for i, document := range m.documents {
+		ok, err := matchDocument(document, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, i)
+		}
+	}
+	return matched, nil
+}
+
+func (m *memorycollection) insert(document interface{}) (interface{}, error) {
+	normalized, err := toDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := normalized["_id"]
+	if !ok {
+		id = primitive.NewObjectID()
+		normalized["_id"] = id
+	}
+	if err := m.checkUnique(normalized, -1); err != nil {
+		return nil, err
+	}
+	m.documents = append(m.documents, normalized)
+	return id, nil
+}
+
+func (m *memorycollection) FindOne(ctx context.Context, filter interface{}, document interface{}) error {
+	defer m.lock()()
+
+	query, err := toDocument(filter)
+	if err != nil {
+		return err
+	}
+	matched, err := m.match(query)
+	if err != nil {
+		return err
+	}
+	if len(matched) == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return decodeDocument(m.documents[matched[0]], document)
+}
+
+func (m *memorycollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, document interface{}) error {
+	var before bson.M
+	result, err := m.update(filter, update, false, false, &before)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return decodeDocument(before, document)
+}
+
+func (m *memorycollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	defer m.lock()()
+
+	id, err := m.insert(document)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+func (m *memorycollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	defer m.lock()()
+
+	result := &mongo.InsertManyResult{}
+	for _, document := range documents {
+		id, err := m.insert(document)
+		if err != nil {
+			return result, err
+		}
+		result.InsertedIDs = append(result.InsertedIDs, id)
+	}
+	return result, nil
+}
+
+func (m *memorycollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return m.update(filter, update, false, upsert(opts), nil)
+}
+
+func (m *memorycollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return m.update(filter, update, true, upsert(opts), nil)
+}
+
+func upsert(opts []*options.UpdateOptions) bool {
+	for _, opt := range opts {
+		if opt != nil && opt.Upsert != nil {
+			return *opt.Upsert
+		}
+	}
+	return false
+}
+
+// before, when set, gets a copy of the first matched document as it was before the update
+func (m *memorycollection) update(filter interface{}, update interface{}, many, upsert bool, before *bson.M) (*mongo.UpdateResult, error) {
+	defer m.lock()()
+
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := toDocument(update)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := m.match(query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mongo.UpdateResult{}
+	if len(matched) == 0 {
+		if !upsert {
+			return result, nil
+		}
+		document := upsertDocument(query)
+		if err := applyUpdate(document, query, changes, true); err != nil {
+			return nil, err
+		}
+		id, err := m.insert(document)
+		if err != nil {
+			return nil, err
+		}
+		result.UpsertedCount = 1
+		result.UpsertedID = id
+		return result, nil
+	}
+
+	if !many {
+		matched = matched[:1]
+	}
+	if before != nil {
+		*before = copyDocument(m.documents[matched[0]])
+	}
+	for _, i := range matched {
+		document := copyDocument(m.documents[i])
+		if err := applyUpdate(document, query, changes, false); err != nil {
+			return nil, err
+		}
+		if err := m.checkUnique(document, i); err != nil {
+			return nil, err
+		}
+		result.MatchedCount++
+		if !reflect.DeepEqual(document, m.documents[i]) {
+			result.ModifiedCount++
+			m.documents[i] = document
+		}
+	}
+	return result, nil
+}
+
+func (m *memorycollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	defer m.lock()()
+
+	query, err := toDocument(filter)
+	if err != nil {
+		return 0, err
+	}
+	matched, err := m.match(query)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(matched)), nil
+}
+
+// function to find the documents, the sort, skip and limit options are applied
+func (m *memorycollection) Find(ctx context.Context, filter interface{}, opts *options.FindOptions, response interface{}) error {
+	defer m.lock()()
+
+	query, err := toDocument(filter)
+	if err != nil {
+		return err
+	}
+	matched, err := m.match(query)
+	if err != nil {
+		return err
+	}
+	documents := make([]bson.M, len(matched))
+	for i, index := range matched {
+		documents[i] = m.documents[index]
+	}
+
+	if opts != nil {
+		if opts.Sort != nil {
+			if documents, err = sortDocuments(documents, opts.Sort); err != nil {
+				return err
+			}
+		}
+		if opts.Skip != nil {
+			documents = documents[min(int(*opts.Skip), len(documents)):]
+		}
+		if opts.Limit != nil && *opts.Limit > 0 {
+			documents = documents[:min(int(*opts.Limit), len(documents))]
+		}
+	}
+	return decodeDocuments(documents, response)
+}
+
+// function to run the pipeline, the $match, $group (with $sum), $sort, $skip, $limit and $count stages are supported
+func (m *memorycollection) Aggregate(ctx context.Context, pipeline interface{}, response interface{}) error {
+	defer m.lock()()
+
+	stages, err := toStages(pipeline)
+	if err != nil {
+		return err
+	}
+	documents := append([]bson.M(nil), m.documents...)
+	for _, stage := range stages {
+		if documents, err = applyStage(documents, stage); err != nil {
+			return err
+		}
+	}
+	return decodeDocuments(documents, response)
+}
+
+func (m *memorycollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return m.delete(filter, false)
+}
+
+func (m *memorycollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return m.delete(filter, true)
+}
+
+func (m *memorycollection) delete(filter interface{}, many bool) (*mongo.DeleteResult, error) {
+	defer m.lock()()
+
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := m.match(query)
+	if err != nil {
+		return nil, err
+	}
+	if !many && len(matched) > 1 {
+		matched = matched[:1]
+	}
+
+	deleted := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		deleted[i] = true
+	}
+	remaining := m.documents[:0:0]
+	for i, document := range m.documents {
+		if !deleted[i] {
+			remaining = append(remaining, document)
+		}
+	}
+	m.documents = remaining
+	return &mongo.DeleteResult{DeletedCount: int64(len(matched))}, nil
+}
+
+// function to get the distinct values of the field among the documents matching the filter
+func (m *memorycollection) Distinct(ctx context.Context, field string, filter interface{}) ([]interface{}, error) {
+	defer m.lock()()
+
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := m.match(query)
+	if err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	for _, i := range matched {
+		for _, value := range expandArrays(lookup(m.documents[i], field)) {
+			if !containsValue(values, value) {
+				values = append(values, value)
+			}
+		}
+	}
+	return values, nil
+}
+
+func (m *memorycollection) Drop(ctx context.Context) error {
+	defer m.lock()()
+
+	m.documents = nil
+	m.indexes = nil
+	return nil
+}
+
+// function to convert a document, a struct, bson.M or bson.D, to its bson.M form as stored in MongoDB
+func toDocument(value interface{}) (bson.M, error) {
+	if value == nil {
+		return bson.M{}, nil
+	}
+	data, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var document bson.M
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// function to convert any value, e.g. a slice of structs, to the form it has once stored
+func toValue(value interface{}) (interface{}, error) {
+	document, err := toDocument(bson.M{"v": value})
+	if err != nil {
+		return nil, err
+	}
+	return document["v"], nil
+}
+
+func copyDocument(document bson.M) bson.M {
+	return copyValue(document).(bson.M)
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		copied := make(bson.M, len(v))
+		for key, member := range v {
+			copied[key] = copyValue(member)
+		}
+		return copied
+	case bson.A:
+		copied := make(bson.A, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+	return value
+}
+
+func decodeDocument(document bson.M, target interface{}) error {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, target)
+}
+
+// function to decode the documents into response, a pointer to a slice, like cursor.All
+func decodeDocuments(documents []bson.M, response interface{}) error {
+	target := reflect.ValueOf(response)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Slice {
+		return errors.New("response must be a pointer to a slice")
+	}
+	slice := reflect.MakeSlice(target.Elem().Type(), 0, len(documents))
+	for _, document := range documents {
+		item := reflect.New(slice.Type().Elem())
+		if err := decodeDocument(document, item.Interface()); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, item.Elem())
+	}
+	target.Elem().Set(slice)
+	return nil
+}
@@ -0,0 +1,431 @@
+package appdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testItem struct {
+	ItemID   string `bson:"itemid"`
+	Quantity int    `bson:"quantity"`
+}
+
+type testDocument struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	Name    string             `bson:"name"`
+	Price   float64            `bson:"price"`
+	Version int64              `bson:"version,omitempty"`
+	Tags    []string           `bson:"tags"`
+	Items   []testItem         `bson:"items"`
+}
+
+func seedCollection(t *testing.T) DatabaseCollection {
+	t.Helper()
+	collection := NewMemoryDatabaseClient("test").Collection("documents")
+	documents := []interface{}{
+		testDocument{Name: "tea", Price: 10, Version: 1, Tags: []string{"hot"}, Items: []testItem{{"a", 1}, {"b", 2}}},
+		testDocument{Name: "coffee", Price: 25, Version: 2, Tags: []string{"hot", "strong"}, Items: []testItem{}},
+		testDocument{Name: "juice", Price: 40, Tags: []string{"cold"}},
+	}
+	if _, err := collection.InsertMany(context.Background(), documents); err != nil {
+		t.Fatalf("seeding: %v", err)
+	}
+	return collection
+}
+
+func names(documents []testDocument) []string {
+	result := make([]string, len(documents))
+	for i, document := range documents {
+		result[i] = document.Name
+	}
+	return result
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryCollectionFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter bson.M
+		want   []string
+	}{
+		{"empty filter", bson.M{}, []string{"tea", "coffee", "juice"}},
+		{"equality", bson.M{"name": "coffee"}, []string{"coffee"}},
+		{"equality across number types", bson.M{"price": 25}, []string{"coffee"}},
+		{"equality on array element", bson.M{"tags": "hot"}, []string{"tea", "coffee"}},
+		{"dotted path into array of documents", bson.M{"items.itemid": "b"}, []string{"tea"}},
+		{"$eq", bson.M{"name": bson.M{"$eq": "tea"}}, []string{"tea"}},
+		{"$ne", bson.M{"name": bson.M{"$ne": "tea"}}, []string{"coffee", "juice"}},
+		{"$ne on dotted path", bson.M{"items.itemid": bson.M{"$ne": "a"}}, []string{"coffee", "juice"}},
+		{"$in", bson.M{"name": bson.M{"$in": bson.A{"tea", "juice"}}}, []string{"tea", "juice"}},
+		{"$in with null matches missing field", bson.M{"version": bson.M{"$in": bson.A{0, nil}}}, []string{"juice"}},
+		{"$nin", bson.M{"name": bson.M{"$nin": bson.A{"tea", "juice"}}}, []string{"coffee"}},
+		{"$gt", bson.M{"price": bson.M{"$gt": 10}}, []string{"coffee", "juice"}},
+		{"$gte and $lt range", bson.M{"price": bson.M{"$gte": 10, "$lt": 40}}, []string{"tea", "coffee"}},
+		{"$lte", bson.M{"price": bson.M{"$lte": 25.0}}, []string{"tea", "coffee"}},
+		{"$exists on array index", bson.M{"items.0": bson.M{"$exists": true}}, []string{"tea"}},
+		{"$exists false", bson.M{"version": bson.M{"$exists": false}}, []string{"juice"}},
+		{"$size", bson.M{"tags": bson.M{"$size": 2}}, []string{"coffee"}},
+		{"$elemMatch", bson.M{"items": bson.M{"$elemMatch": bson.M{"itemid": "b", "quantity": bson.M{"$lte": 2}}}}, []string{"tea"}},
+		{"$elemMatch without match", bson.M{"items": bson.M{"$elemMatch": bson.M{"itemid": "b", "quantity": bson.M{"$lte": 1}}}}, nil},
+		{"$or", bson.M{"$or": []bson.M{{"name": "tea"}, {"price": 40}}}, []string{"tea", "juice"}},
+		{"$and", bson.M{"$and": []bson.M{{"tags": "hot"}, {"price": bson.M{"$gt": 10}}}}, []string{"coffee"}},
+		{"$nor", bson.M{"$nor": []bson.M{{"tags": "hot"}}}, []string{"juice"}},
+	}
+
+	collection := seedCollection(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var documents []testDocument
+			if err := collection.Find(context.Background(), tt.filter, &options.FindOptions{}, &documents); err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			if got := names(documents); !equalNames(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCollectionUpdates(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       bson.M
+		update       bson.M
+		wantMatched  int64
+		wantModified int64
+		check        func(t *testing.T, document testDocument)
+	}{
+		{
+			name:   "$set",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$set": bson.M{"price": 12.5}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if d.Price != 12.5 {
+					t.Errorf("price = %v", d.Price)
+				}
+			},
+		},
+		{
+			name:   "$set struct",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$set": testDocument{Name: "tea", Price: 11, Tags: []string{"green"}}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if d.Price != 11 || len(d.Tags) != 1 || d.Tags[0] != "green" || d.Version != 1 {
+					t.Errorf("document = %+v", d)
+				}
+			},
+		},
+		{
+			name:   "$inc",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$inc": bson.M{"version": 1, "price": 0.5}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if d.Version != 2 || d.Price != 10.5 {
+					t.Errorf("document = %+v", d)
+				}
+			},
+		},
+		{
+			name:   "$inc with positional operator",
+			filter: bson.M{"name": "tea", "items": bson.M{"$elemMatch": bson.M{"itemid": "b"}}}, update: bson.M{"$inc": bson.M{"items.$.quantity": 3}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if d.Items[0].Quantity != 1 || d.Items[1].Quantity != 5 {
+					t.Errorf("items = %+v", d.Items)
+				}
+			},
+		},
+		{
+			name:   "$set with positional operator on dotted filter",
+			filter: bson.M{"name": "tea", "items.itemid": "a"}, update: bson.M{"$set": bson.M{"items.$.quantity": 7}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if d.Items[0].Quantity != 7 || d.Items[1].Quantity != 2 {
+					t.Errorf("items = %+v", d.Items)
+				}
+			},
+		},
+		{
+			name:   "$push",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$push": bson.M{"items": testItem{"c", 4}}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if len(d.Items) != 3 || d.Items[2].ItemID != "c" {
+					t.Errorf("items = %+v", d.Items)
+				}
+			},
+		},
+		{
+			name:   "$pull by document condition",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$pull": bson.M{"items": bson.M{"itemid": "a"}}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if len(d.Items) != 1 || d.Items[0].ItemID != "b" {
+					t.Errorf("items = %+v", d.Items)
+				}
+			},
+		},
+		{
+			name:   "$pull by value",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$pull": bson.M{"tags": "hot"}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if len(d.Tags) != 0 {
+					t.Errorf("tags = %v", d.Tags)
+				}
+			},
+		},
+		{
+			name:   "$unset",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$unset": bson.M{"version": ""}},
+			wantMatched: 1, wantModified: 1,
+			check: func(t *testing.T, d testDocument) {
+				if d.Version != 0 {
+					t.Errorf("version = %d", d.Version)
+				}
+			},
+		},
+		{
+			name:   "no change is matched but not modified",
+			filter: bson.M{"name": "tea"}, update: bson.M{"$set": bson.M{"price": 10.0}},
+			wantMatched: 1, wantModified: 0,
+		},
+		{
+			name:   "no match",
+			filter: bson.M{"name": "water"}, update: bson.M{"$set": bson.M{"price": 1}},
+			wantMatched: 0, wantModified: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			collection := seedCollection(t)
+			result, err := collection.UpdateOne(ctx, tt.filter, tt.update)
+			if err != nil {
+				t.Fatalf("UpdateOne: %v", err)
+			}
+			if result.MatchedCount != tt.wantMatched || result.ModifiedCount != tt.wantModified {
+				t.Errorf("matched %d, modified %d, want %d, %d", result.MatchedCount, result.ModifiedCount, tt.wantMatched, tt.wantModified)
+			}
+			if tt.check == nil {
+				return
+			}
+			var document testDocument
+			if err := collection.FindOne(ctx, bson.M{"name": "tea"}, &document); err != nil {
+				t.Fatalf("FindOne: %v", err)
+			}
+			tt.check(t, document)
+		})
+	}
+}
+
+func TestMemoryCollectionInsertAndDelete(t *testing.T) {
+	ctx := context.Background()
+	collection := seedCollection(t)
+
+	result, err := collection.InsertOne(ctx, testDocument{Name: "water"})
+	if err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok || id.IsZero() {
+		t.Fatalf("InsertedID = %v, want a generated ObjectID", result.InsertedID)
+	}
+
+	var found testDocument
+	if err := collection.FindOne(ctx, bson.M{"_id": id}, &found); err != nil || found.Name != "water" {
+		t.Fatalf("FindOne by generated id = %+v, %v", found, err)
+	}
+
+	if _, err := collection.InsertOne(ctx, testDocument{ID: id, Name: "again"}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("InsertOne with existing _id = %v, want a duplicate key error", err)
+	}
+
+	deleted, err := collection.DeleteMany(ctx, bson.M{"tags": "hot"})
+	if err != nil || deleted.DeletedCount != 2 {
+		t.Errorf("DeleteMany = %+v, %v, want 2 deleted", deleted, err)
+	}
+	count, _ := collection.CountDocuments(ctx, bson.M{})
+	if count != 2 {
+		t.Errorf("CountDocuments = %d, want 2", count)
+	}
+
+	if err := collection.FindOne(ctx, bson.M{"name": "tea"}, &found); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindOne of deleted = %v, want ErrNoDocuments", err)
+	}
+}
+
+func TestMemoryCollectionUniqueIndex(t *testing.T) {
+	ctx := context.Background()
+	collection := seedCollection(t)
+
+	names, err := collection.CreateIndexes(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "price", Value: -1}}, Options: options.Index().SetName("by_price")},
+	})
+	if err != nil || len(names) != 2 || names[0] != "name_1" || names[1] != "by_price" {
+		t.Fatalf("CreateIndexes = %v, %v, want [name_1 by_price]", names, err)
+	}
+
+	if _, err := collection.InsertOne(ctx, testDocument{Name: "tea"}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("InsertOne of a duplicate name = %v, want a duplicate key error", err)
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"name": "juice"}, bson.M{"$set": bson.M{"name": "coffee"}}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("UpdateOne to a duplicate name = %v, want a duplicate key error", err)
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"name": "juice"}, bson.M{"$set": bson.M{"price": 10}}); err != nil {
+		t.Errorf("UpdateOne of another field = %v", err)
+	}
+	if _, err := collection.CreateIndexes(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "price", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("CreateIndexes over duplicates = %v, want a duplicate key error", err)
+	}
+
+	if err := collection.DropIndex(ctx, "name_1"); err != nil {
+		t.Fatalf("DropIndex: %v", err)
+	}
+	if _, err := collection.InsertOne(ctx, testDocument{Name: "tea"}); err != nil {
+		t.Errorf("InsertOne after dropping the index = %v", err)
+	}
+	if err := collection.DropIndex(ctx, "name_1"); err == nil {
+		t.Error("DropIndex of a missing index should fail")
+	}
+}
+
+func TestMemoryCollectionUpsert(t *testing.T) {
+	ctx := context.Background()
+	collection := NewMemoryDatabaseClient("test").Collection("attempts")
+	update := bson.M{
+		"$inc":         bson.M{"failures": 1},
+		"$setOnInsert": bson.M{"kind": "account"},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": "account:a"}, update, options.Update().SetUpsert(true)); err != nil {
+			t.Fatalf("UpdateOne: %v", err)
+		}
+	}
+
+	var attempt struct {
+		Key      string `bson:"_id"`
+		Kind     string `bson:"kind"`
+		Failures int    `bson:"failures"`
+	}
+	if err := collection.FindOne(ctx, bson.M{"_id": "account:a"}, &attempt); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	if attempt.Kind != "account" || attempt.Failures != 2 {
+		t.Errorf("attempt = %+v, want kind account and 2 failures", attempt)
+	}
+}
+
+func TestMemoryCollectionFindOneAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	collection := seedCollection(t)
+
+	var before testDocument
+	err := collection.FindOneAndUpdate(ctx, bson.M{"name": "tea", "version": 1}, bson.M{"$set": bson.M{"price": 12}, "$inc": bson.M{"version": 1}}, &before)
+	if err != nil {
+		t.Fatalf("FindOneAndUpdate: %v", err)
+	}
+	if before.Price != 10 || before.Version != 1 {
+		t.Errorf("before = %+v, want the document at price 10 and version 1", before)
+	}
+	var after testDocument
+	if err := collection.FindOne(ctx, bson.M{"name": "tea"}, &after); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	if after.Price != 12 || after.Version != 2 {
+		t.Errorf("after = %+v, want price 12 at version 2", after)
+	}
+
+	err = collection.FindOneAndUpdate(ctx, bson.M{"name": "tea", "version": 1}, bson.M{"$set": bson.M{"price": 14}}, &before)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindOneAndUpdate at a stale version = %v, want mongo.ErrNoDocuments", err)
+	}
+}
+
+func TestMemoryCollectionFindOptionsAndAggregate(t *testing.T) {
+	ctx := context.Background()
+	collection := seedCollection(t)
+
+	var documents []testDocument
+	opts := options.Find().SetSort(bson.D{{Key: "price", Value: -1}}).SetSkip(1).SetLimit(1)
+	if err := collection.Find(ctx, bson.M{}, opts, &documents); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if got := names(documents); !equalNames(got, []string{"coffee"}) {
+		t.Errorf("sorted page = %v, want [coffee]", got)
+	}
+
+	var byName []struct {
+		Name  string  `bson:"_id"`
+		Total float64 `bson:"total"`
+	}
+	pipeline := bson.A{bson.M{"$group": bson.M{"_id": "$name", "total": bson.M{"$sum": "$price"}}}}
+	if err := collection.Aggregate(ctx, pipeline, &byName); err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	if len(byName) != 3 || byName[1].Name != "coffee" || byName[1].Total != 25 {
+		t.Errorf("groups = %+v", byName)
+	}
+}
+
+func TestMemoryClientTransaction(t *testing.T) {
+	ctx := context.Background()
+	client := NewMemoryDatabaseClient("test")
+	collection := client.Collection("documents")
+
+	failure := errors.New("failed")
+	err := client.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := collection.InsertOne(ctx, testDocument{Name: "rolled back"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("WithTransaction = %v, want %v", err, failure)
+	}
+	if count, _ := collection.CountDocuments(ctx, bson.M{}); count != 0 {
+		t.Errorf("CountDocuments after rollback = %d, want 0", count)
+	}
+
+	err = client.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := collection.InsertOne(ctx, testDocument{Name: "committed"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+	if count, _ := collection.CountDocuments(ctx, bson.M{}); count != 1 {
+		t.Errorf("CountDocuments after commit = %d, want 1", count)
+	}
+}
+
+func TestMemoryCollectionUnsupportedOperator(t *testing.T) {
+	collection := seedCollection(t)
+	var documents []testDocument
+	err := collection.Find(context.Background(), bson.M{"name": bson.M{"$regex": "^t"}}, nil, &documents)
+	if err == nil {
+		t.Error("Find with $regex should fail instead of matching nothing")
+	}
+}
@@ -0,0 +1,153 @@
+package appdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryindex only enforces uniqueness, other indexes are kept so they can be listed and dropped
+type memoryindex struct {
+	name   string
+	keys   []string
+	unique bool
+}
+
+// every collection has the unique index on _id
+var idIndex = memoryindex{name: "_id_", keys: []string{"_id"}, unique: true}
+
+// duplicateKeyError is what the driver returns for a duplicate key, so mongo.IsDuplicateKeyError works
+func duplicateKeyError(collection string, index memoryindex, values []interface{}) error {
+	keys := make([]string, len(index.keys))
+	for i, key := range index.keys {
+		keys[i] = fmt.Sprintf("%s: %v", key, values[i])
+	}
+	return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: %s dup key: { %s }", collection, index.name, strings.Join(keys, ", ")),
+	}}}
+}
+
+// function to get the default name of an index, e.g. email_1 or userid_1_orderedat_-1
+func indexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func indexKeys(keys interface{}) (bson.D, error) {
+	data, err := bson.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	var ordered bson.D
+	if err := bson.Unmarshal(data, &ordered); err != nil {
+		return nil, err
+	}
+	if len(ordered) == 0 {
+		return nil, fmt.Errorf("memory database: index keys are empty")
+	}
+	return ordered, nil
+}
+
+func (i memoryindex) values(document bson.M) []interface{} {
+	values := make([]interface{}, len(i.keys))
+	for k, key := range i.keys {
+		values[k] = firstValue(document, key)
+	}
+	return values
+}
+
+// numbers are compared by value, like the values in an index
+func equalKeys(a, b []interface{}) bool {
+	for i := range a {
+		if !equalValues(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// function to check the document against the unique indexes, skip is the position of the document
+// itself when it is being updated, -1 for an insert
+func (m *memorycollection) checkUnique(document bson.M, skip int) error {
+	for _, index := range append([]memoryindex{idIndex}, m.indexes...) {
+		if !index.unique {
+			continue
+		}
+		values := index.values(document)
+		for i, existing := range m.documents {
+			if i != skip && equalKeys(index.values(existing), values) {
+				return duplicateKeyError(m.name, index, values)
+			}
+		}
+	}
+	return nil
+}
+
+// function to create the indexes, a unique index fails when the documents already hold duplicates
+func (m *memorycollection) CreateIndexes(ctx context.Context, models []mongo.IndexModel) ([]string, error) {
+	defer m.lock()()
+
+	names := make([]string, 0, len(models))
+	for _, model := range models {
+		keys, err := indexKeys(model.Keys)
+		if err != nil {
+			return nil, err
+		}
+		index := memoryindex{name: indexName(keys)}
+		for _, key := range keys {
+			index.keys = append(index.keys, key.Key)
+		}
+		if model.Options != nil {
+			if model.Options.Name != nil {
+				index.name = *model.Options.Name
+			}
+			if model.Options.Unique != nil {
+				index.unique = *model.Options.Unique
+			}
+		}
+		names = append(names, index.name)
+		if m.hasIndex(index.name) {
+			continue
+		}
+
+		if index.unique {
+			for i, document := range m.documents {
+				for _, other := range m.documents[:i] {
+					if equalKeys(index.values(other), index.values(document)) {
+						return nil, duplicateKeyError(m.name, index, index.values(document))
+					}
+				}
+			}
+		}
+		m.indexes = append(m.indexes, index)
+	}
+	return names, nil
+}
+
+func (m *memorycollection) DropIndex(ctx context.Context, name string) error {
+	defer m.lock()()
+
+	for i, index := range m.indexes {
+		if index.name == name {
+			m.indexes = append(m.indexes[:i], m.indexes[i+1:]...)
+			return nil
+		}
+	}
+	return mongo.CommandError{Code: 27, Name: "IndexNotFound", Message: fmt.Sprintf("index not found with name [%s]", name)}
+}
+
+func (m *memorycollection) hasIndex(name string) bool {
+	for _, index := range m.indexes {
+		if index.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,800 @@
+package appdb
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The in-memory database evaluates the subset of the MongoDB query language used by the services:
+//   - filters: equality (also against array elements and null for missing fields), dotted paths into
+//     documents and arrays, $eq, $ne, $in, $nin, $gt, $gte, $lt, $lte, $exists, $elemMatch, $size,
+//     $and, $or and $nor
+//   - updates: $set, $setOnInsert, $unset, $inc, $push (with $each), $addToSet and $pull, the positional
+//     operator items.$.field refers to the first array element matched by the filter
+// Anything else fails with an error rather than silently behaving differently from MongoDB.
+
+func unsupported(operator string) error {
+	return fmt.Errorf("memory database: unsupported operator %s", operator)
+}
+
+func isOperatorDocument(value interface{}) (bson.M, bool) {
+	document, ok := value.(bson.M)
+	if !ok || len(document) == 0 {
+		return nil, false
+	}
+	for key := range document {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return document, true
+}
+
+// function to check the document matches every condition of the filter
+func matchDocument(document bson.M, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var matched bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			matched, err = matchLogical(document, key, condition)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, unsupported(key)
+			}
+			matched, err = matchField(lookup(document, key), condition)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(document bson.M, operator string, condition interface{}) (bool, error) {
+	filters, ok := condition.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("memory database: %s needs an array", operator)
+	}
+	matches := 0
+	for _, item := range filters {
+		filter, ok := item.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("memory database: %s needs an array of documents", operator)
+		}
+		matched, err := matchDocument(document, filter)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			matches++
+		}
+	}
+	switch operator {
+	case "$and":
+		return matches == len(filters), nil
+	case "$or":
+		return matches > 0, nil
+	default:
+		return matches == 0, nil
+	}
+}
+
+// function to check the values found at a path against a condition, either a value or operators
+func matchField(values []interface{}, condition interface{}) (bool, error) {
+	operators, ok := isOperatorDocument(condition)
+	if !ok {
+		return matchEquals(values, condition), nil
+	}
+	for operator, argument := range operators {
+		matched, err := matchOperator(values, operator, argument)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(values []interface{}, operator string, argument interface{}) (bool, error) {
+	switch operator {
+	case "$eq":
+		return matchEquals(values, argument), nil
+	case "$ne":
+		return !matchEquals(values, argument), nil
+	case "$in", "$nin":
+		items, ok := argument.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("memory database: %s needs an array", operator)
+		}
+		found := false
+		for _, item := range items {
+			if matchEquals(values, item) {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "$in"), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, value := range expandArrays(values) {
+			order, ok := compareValues(value, argument)
+			if !ok {
+				continue
+			}
+			if (operator == "$gt" && order > 0) || (operator == "$gte" && order >= 0) ||
+				(operator == "$lt" && order < 0) || (operator == "$lte" && order <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$exists":
+		return (len(values) > 0) == truthy(argument), nil
+	case "$size":
+		size, ok := toInt(argument)
+		if !ok {
+			return false, fmt.Errorf("memory database: $size needs a number")
+		}
+		for _, value := range values {
+			if array, ok := value.(bson.A); ok && len(array) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$elemMatch":
+		for _, value := range values {
+			array, ok := value.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, element := range array {
+				matched, err := matchElement(element, argument)
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, unsupported(operator)
+}
+
+// function to check one array element against the condition of $elemMatch
+func matchElement(element interface{}, condition interface{}) (bool, error) {
+	if _, ok := isOperatorDocument(condition); ok {
+		return matchField([]interface{}{element}, condition)
+	}
+	filter, ok := condition.(bson.M)
+	if !ok {
+		return false, fmt.Errorf("memory database: $elemMatch needs a document")
+	}
+	document, ok := element.(bson.M)
+	if !ok {
+		return false, nil
+	}
+	return matchDocument(document, filter)
+}
+
+// a value matches when it, or one of its elements if it is an array, equals expected; null also
+// matches a missing field
+func matchEquals(values []interface{}, expected interface{}) bool {
+	if expected == nil && len(values) == 0 {
+		return true
+	}
+	return containsValue(expandArrays(values), expected)
+}
+
+func containsValue(values []interface{}, expected interface{}) bool {
+	for _, value := range values {
+		if equalValues(value, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// function to get the values at a dotted path, arrays without an index are traversed like MongoDB does
+func lookup(value interface{}, path string) []interface{} {
+	return lookupParts(value, strings.Split(path, "."))
+}
+
+func lookupParts(value interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{value}
+	}
+	switch v := value.(type) {
+	case bson.M:
+		member, ok := v[parts[0]]
+		if !ok {
+			return nil
+		}
+		return lookupParts(member, parts[1:])
+	case bson.A:
+		if index, err := strconv.Atoi(parts[0]); err == nil {
+			if index < 0 || index >= len(v) {
+				return nil
+			}
+			return lookupParts(v[index], parts[1:])
+		}
+		var values []interface{}
+		for _, element := range v {
+			if _, ok := element.(bson.M); ok {
+				values = append(values, lookupParts(element, parts)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// function to add the elements of the arrays to the values
+func expandArrays(values []interface{}) []interface{} {
+	expanded := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		expanded = append(expanded, value)
+		if array, ok := value.(bson.A); ok {
+			expanded = append(expanded, array...)
+		}
+	}
+	return expanded
+}
+
+func equalValues(a, b interface{}) bool {
+	if order, ok := compareValues(a, b); ok {
+		return order == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// function to order two values of the same kind, numbers are compared by value whatever their type
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return compareOrdered(x, y), true
+		}
+		return 0, false
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(x[:], y[:]), true
+		}
+	case primitive.DateTime:
+		if y, ok := b.(primitive.DateTime); ok {
+			return compareOrdered(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0, true
+			}
+			if y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64 | primitive.DateTime](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+func truthy(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	if f, ok := toFloat(value); ok {
+		return f != 0
+	}
+	return value != nil
+}
+
+// function to build the document inserted by an upsert from the equality conditions of the filter
+func upsertDocument(filter bson.M) bson.M {
+	document := bson.M{}
+	for key, condition := range filter {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if _, ok := isOperatorDocument(condition); ok {
+			continue
+		}
+		setPath(document, key, copyValue(condition)) //nolint
+	}
+	return document
+}
+
+// function to apply the update operators to the document, inserting is set for the document of an upsert
+func applyUpdate(document bson.M, filter bson.M, update bson.M, inserting bool) error {
+	for operator, argument := range update {
+		fields, ok := argument.(bson.M)
+		if !ok {
+			if !strings.HasPrefix(operator, "$") {
+				return fmt.Errorf("memory database: replacement documents are not supported, use $set")
+			}
+			return fmt.Errorf("memory database: %s needs a document", operator)
+		}
+		for path, value := range fields {
+			path, err := resolvePositional(document, filter, path)
+			if err != nil {
+				return err
+			}
+			if err := applyOperator(document, operator, path, value, inserting); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyOperator(document bson.M, operator, path string, value interface{}, inserting bool) error {
+	switch operator {
+	case "$set":
+		return setPath(document, path, copyValue(value))
+	case "$setOnInsert":
+		if inserting {
+			return setPath(document, path, copyValue(value))
+		}
+		return nil
+	case "$unset":
+		unsetPath(document, path)
+		return nil
+	case "$inc":
+		current, _ := getPath(document, path)
+		sum, err := addNumbers(current, value)
+		if err != nil {
+			return fmt.Errorf("memory database: $inc of %s: %w", path, err)
+		}
+		return setPath(document, path, sum)
+	case "$push", "$addToSet":
+		array, err := arrayAt(document, path)
+		if err != nil {
+			return err
+		}
+		items := bson.A{value}
+		if each, ok := value.(bson.M); ok {
+			if list, ok := each["$each"].(bson.A); ok {
+				items = list
+			}
+		}
+		for _, item := range items {
+			if operator == "$addToSet" && containsValue(array, item) {
+				continue
+			}
+			array = append(array, copyValue(item))
+		}
+		return setPath(document, path, array)
+	case "$pull":
+		array, err := arrayAt(document, path)
+		if err != nil {
+			return err
+		}
+		remaining := bson.A{}
+		for _, element := range array {
+			matched, err := matchPull(element, value)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				remaining = append(remaining, element)
+			}
+		}
+		return setPath(document, path, remaining)
+	}
+	return unsupported(operator)
+}
+
+// an element is pulled when it equals the condition, matches its operators or, for documents, the filter
+func matchPull(element interface{}, condition interface{}) (bool, error) {
+	if _, ok := isOperatorDocument(condition); ok {
+		return matchField([]interface{}{element}, condition)
+	}
+	if filter, ok := condition.(bson.M); ok {
+		document, ok := element.(bson.M)
+		if !ok {
+			return false, nil
+		}
+		return matchDocument(document, filter)
+	}
+	return equalValues(element, condition), nil
+}
+
+// function to get the array at the path for $push and $pull, a missing field is an empty array
+func arrayAt(document bson.M, path string) (bson.A, error) {
+	current, ok := getPath(document, path)
+	if !ok || current == nil {
+		return bson.A{}, nil
+	}
+	array, ok := current.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("memory database: %s is not an array", path)
+	}
+	return array, nil
+}
+
+func addNumbers(current, delta interface{}) (interface{}, error) {
+	if current == nil {
+		return delta, nil
+	}
+	x, ok := toFloat(current)
+	if !ok {
+		return nil, fmt.Errorf("the field is not a number")
+	}
+	y, ok := toFloat(delta)
+	if !ok {
+		return nil, fmt.Errorf("the increment is not a number")
+	}
+	a, aInt := current.(int32)
+	b, bInt := delta.(int32)
+	if aInt && bInt {
+		return a + b, nil
+	}
+	_, aFloat := current.(float64)
+	_, bFloat := delta.(float64)
+	if aFloat || bFloat {
+		return x + y, nil
+	}
+	return int64(x) + int64(y), nil
+}
+
+// function to replace the positional operator $ in the path by the index of the first array
+// element which satisfies the conditions of the filter on that array
+func resolvePositional(document bson.M, filter bson.M, path string) (string, error) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		if part != "$" {
+			continue
+		}
+		arrayPath := strings.Join(parts[:i], ".")
+		index, err := positionalIndex(document, filter, arrayPath)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = strconv.Itoa(index)
+		return strings.Join(parts, "."), nil
+	}
+	return path, nil
+}
+
+func positionalIndex(document bson.M, filter bson.M, arrayPath string) (int, error) {
+	notFound := fmt.Errorf("memory database: the positional operator did not find the match needed from the query")
+	current, _ := getPath(document, arrayPath)
+	array, ok := current.(bson.A)
+	if !ok {
+		return 0, notFound
+	}
+
+	for i, element := range array {
+		related, matched := false, true
+		for key, condition := range filter {
+			var ok bool
+			var err error
+			switch {
+			case key == arrayPath:
+				if operators, isOperators := isOperatorDocument(condition); isOperators && operators["$elemMatch"] != nil {
+					ok, err = matchElement(element, operators["$elemMatch"])
+				} else {
+					ok, err = matchField([]interface{}{element}, condition)
+				}
+			case strings.HasPrefix(key, arrayPath+"."):
+				ok, err = matchField(lookup(element, strings.TrimPrefix(key, arrayPath+".")), condition)
+			default:
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			related = true
+			matched = matched && ok
+		}
+		if related && matched {
+			return i, nil
+		}
+	}
+	return 0, notFound
+}
+
+// function to get the value at a dotted path, array elements are addressed by index
+func getPath(document bson.M, path string) (interface{}, bool) {
+	var current interface{} = document
+	for _, part := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case bson.M:
+			member, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			current = member
+		case bson.A:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			current = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// function to set the value at a dotted path, missing documents on the way are created
+func setPath(document bson.M, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	var current interface{} = document
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch v := current.(type) {
+		case bson.M:
+			if last {
+				v[part] = value
+				return nil
+			}
+			member, ok := v[part]
+			if !ok || member == nil {
+				member = bson.M{}
+				v[part] = member
+			}
+			current = member
+		case bson.A:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(v) {
+				return fmt.Errorf("memory database: cannot set %s, %s is not an index of the array", path, part)
+			}
+			if last {
+				v[index] = value
+				return nil
+			}
+			current = v[index]
+		default:
+			return fmt.Errorf("memory database: cannot set %s, %s is not a document", path, strings.Join(parts[:i], "."))
+		}
+	}
+	return nil
+}
+
+func unsetPath(document bson.M, path string) {
+	parts := strings.Split(path, ".")
+	parent, ok := getPath(document, strings.Join(parts[:len(parts)-1], "."))
+	if len(parts) == 1 {
+		parent, ok = document, true
+	}
+	if member, isDocument := parent.(bson.M); ok && isDocument {
+		delete(member, parts[len(parts)-1])
+	}
+}
+
+// function to sort the documents by the keys of spec in order, 1 ascending and -1 descending
+func sortDocuments(documents []bson.M, spec interface{}) ([]bson.M, error) {
+	data, err := bson.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var keys bson.D
+	if err := bson.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	sorted := append([]bson.M(nil), documents...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, key := range keys {
+			direction, _ := toInt(key.Value)
+			order := compareSortValues(firstValue(sorted[i], key.Key), firstValue(sorted[j], key.Key))
+			if order != 0 {
+				return order*direction < 0
+			}
+		}
+		return false
+	})
+	return sorted, nil
+}
+
+func firstValue(document bson.M, path string) interface{} {
+	if values := lookup(document, path); len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// missing values sort first, like null in MongoDB
+func compareSortValues(a, b interface{}) int {
+	if order, ok := compareValues(a, b); ok {
+		return order
+	}
+	switch {
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return 0
+}
+
+func toStages(pipeline interface{}) ([]bson.M, error) {
+	value, err := toValue(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("memory database: the pipeline must be an array of stages")
+	}
+	stages := make([]bson.M, len(items))
+	for i, item := range items {
+		stage, ok := item.(bson.M)
+		if !ok || len(stage) != 1 {
+			return nil, fmt.Errorf("memory database: a stage must be a document with one operator")
+		}
+		stages[i] = stage
+	}
+	return stages, nil
+}
+
+func applyStage(documents []bson.M, stage bson.M) ([]bson.M, error) {
+	for operator, argument := range stage {
+		switch operator {
+		case "$match":
+			filter, ok := argument.(bson.M)
+			if !ok {
+				return nil, fmt.Errorf("memory database: $match needs a document")
+			}
+			var matched []bson.M
+			for _, document := range documents {
+				ok, err := matchDocument(document, filter)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					matched = append(matched, document)
+				}
+			}
+			return matched, nil
+		case "$group":
+			spec, ok := argument.(bson.M)
+			if !ok {
+				return nil, fmt.Errorf("memory database: $group needs a document")
+			}
+			return groupDocuments(documents, spec)
+		case "$sort":
+			return sortDocuments(documents, argument)
+		case "$skip", "$limit":
+			n, ok := toInt(argument)
+			if !ok || n < 0 {
+				return nil, fmt.Errorf("memory database: %s needs a positive number", operator)
+			}
+			n = min(n, len(documents))
+			if operator == "$skip" {
+				return documents[n:], nil
+			}
+			return documents[:n], nil
+		case "$count":
+			name, ok := argument.(string)
+			if !ok {
+				return nil, fmt.Errorf("memory database: $count needs a field name")
+			}
+			if len(documents) == 0 {
+				return nil, nil
+			}
+			return []bson.M{{name: int64(len(documents))}}, nil
+		}
+		return nil, unsupported(operator)
+	}
+	return documents, nil
+}
+
+// function to group the documents by the _id expression, the other fields accumulate with $sum
+func groupDocuments(documents []bson.M, spec bson.M) ([]bson.M, error) {
+	var groups []bson.M
+	for _, document := range documents {
+		id := evaluate(document, spec["_id"])
+		var group bson.M
+		for _, existing := range groups {
+			if equalValues(existing["_id"], id) {
+				group = existing
+				break
+			}
+		}
+		if group == nil {
+			group = bson.M{"_id": id}
+			groups = append(groups, group)
+		}
+
+		for field, accumulator := range spec {
+			if field == "_id" {
+				continue
+			}
+			operators, ok := accumulator.(bson.M)
+			if !ok || len(operators) != 1 || operators["$sum"] == nil {
+				return nil, fmt.Errorf("memory database: only $sum is supported in $group")
+			}
+			value := evaluate(document, operators["$sum"])
+			if _, ok := toFloat(value); !ok {
+				// non numeric values are ignored by $sum
+				value = int32(0)
+			}
+			if _, ok := group[field]; !ok {
+				group[field] = int32(0)
+			}
+			sum, err := addNumbers(group[field], value)
+			if err != nil {
+				return nil, err
+			}
+			group[field] = sum
+		}
+	}
+	return groups, nil
+}
+
+// function to evaluate an expression, "$field" is the value of the field, a document is evaluated
+// member by member and anything else is a literal
+func evaluate(document bson.M, expression interface{}) interface{} {
+	switch v := expression.(type) {
+	case string:
+		if strings.HasPrefix(v, "$") {
+			return firstValue(document, strings.TrimPrefix(v, "$"))
+		}
+	case bson.M:
+		evaluated := make(bson.M, len(v))
+		for key, member := range v {
+			evaluated[key] = evaluate(document, member)
+		}
+		return evaluated
+	}
+	return expression
+}
@@ -0,0 +1,131 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kind classifies an error, the http layer maps each kind to one status code
+type Kind string
+
+const (
+	KindNotFound           Kind = "NOT_FOUND"
+	KindConflict           Kind = "CONFLICT"
+	KindValidation         Kind = "VALIDATION"
+	KindForbidden          Kind = "FORBIDDEN"
+	KindInvalidID          Kind = "INVALID_ID"
+	KindPreconditionFailed Kind = "PRECONDITION_FAILED"
+	KindUnavailable        Kind = "UNAVAILABLE" // a dependency the request needs is not configured or not reachable
+)
+
+// Error is a domain error with a kind, a machine readable code and a message safe to show to clients
+type Error struct {
+	Kind    Kind
+	Code    string // defaults to the kind, e.g. CART_NOT_FOUND narrows NOT_FOUND
+	Message string
+	Fields  []FieldError // per field details of a validation error
+	Err     error        // underlying cause, not exposed to clients
+}
+
+// FieldError describes why one field of the request was rejected, Field is the JSON name of the field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// sentinels to test for a kind with errors.Is, e.g. errors.Is(err, apperrors.ErrNotFound)
+var (
+	ErrNotFound           = &Error{Kind: KindNotFound}
+	ErrConflict           = &Error{Kind: KindConflict}
+	ErrValidation         = &Error{Kind: KindValidation}
+	ErrForbidden          = &Error{Kind: KindForbidden}
+	ErrInvalidID          = &Error{Kind: KindInvalidID}
+	ErrPreconditionFailed = &Error{Kind: KindPreconditionFailed}
+	ErrUnavailable        = &Error{Kind: KindUnavailable}
+)
+
+// the message of the error, followed by the cause unless the cause is a domain error being detailed
+func (e *Error) Error() string {
+	if _, ok := e.Err.(*Error); e.Err != nil && !ok {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the same error, or a kind sentinel which has no code and message of its own
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code == "" && t.Message == "" {
+		return t.Kind == e.Kind
+	}
+	return t == e
+}
+
+// Detailf returns a copy of e with a more specific message, the copy wraps e so it still matches it with errors.Is
+func (e *Error) Detailf(format string, args ...interface{}) *Error {
+	return &Error{Kind: e.Kind, Code: e.Code, Message: fmt.Sprintf(format, args...), Fields: e.Fields, Err: e}
+}
+
+func New(kind Kind, code, message string) *Error {
+	if code == "" {
+		code = string(kind)
+	}
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// NotFound returns the error for a missing resource, the code is derived from the resource, e.g. PRODUCT_NOT_FOUND
+func NotFound(resource string) *Error {
+	return New(KindNotFound, codeFor(resource, "NOT_FOUND"), resource+" not found")
+}
+
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Validation(message string) *Error {
+	return New(KindValidation, "", message)
+}
+
+func Validationf(format string, args ...interface{}) *Error {
+	return New(KindValidation, "", fmt.Sprintf(format, args...))
+}
+
+// InvalidFields returns the validation error for a request with invalid fields
+func InvalidFields(fields []FieldError) *Error {
+	err := New(KindValidation, "", "request validation failed")
+	err.Fields = fields
+	return err
+}
+
+func Forbidden(message string) *Error {
+	return New(KindForbidden, "", message)
+}
+
+// InvalidID returns the error for an id which is not a valid ObjectID
+func InvalidID(resource, id string) *Error {
+	return New(KindInvalidID, "", fmt.Sprintf("invalid %s id: %s", resource, id))
+}
+
+// As returns the domain error in the chain of err, if any
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
+
+func codeFor(resource, suffix string) string {
+	resource = strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(resource))
+	return resource + "_" + suffix
+}
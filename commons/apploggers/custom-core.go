@@ -1,12 +1,32 @@
 package apploggers
 
 import (
+	"encoding/json"
+	"fmt"
+	"regexp"
 	"strings"
 
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-// wrapper for zap actual core to perform any required pre / post processing for message
+const redacted = "[REDACTED]"
+
+// keys of fields, or of key / value pairs in messages, whose value is never logged
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "otp", "recoverycode"}
+
+var (
+	// Authorization: Bearer <token>, or a bare bearer token
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	// signed JWTs anywhere in the text
+	jwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// password=..., "token": "...", secret: ...
+	keyValuePattern = regexp.MustCompile(`(?i)("?[a-z_]*(?:password|secret|token|authorization|otp)[a-z_]*"?\s*[:=]\s*)("[^"]*"|[^\s,}&]+)`)
+	emailPattern    = regexp.MustCompile(`\b([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})\b`)
+)
+
+// wrapper for zap actual core to perform any required pre / post processing for message,
+// messages and fields are redacted before they reach the delegate
 type customCore struct {
 	delegate zapcore.Core
 }
@@ -20,23 +40,117 @@ func (z *customCore) Enabled(l zapcore.Level) bool {
 }
 
 func (z *customCore) With(f []zapcore.Field) zapcore.Core {
-	newDelegate := z.delegate.With(f)
+	newDelegate := z.delegate.With(redactFields(f))
 	return NewCustomCore(newDelegate)
 }
 
 func (z *customCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
-	res := z.delegate.Check(e, ce)
-	if res != nil {
-		// remove all newlines from message
-		res.Message = strings.ReplaceAll(e.Message, "\n", "<LINEBREAK>")
+	// the entry is written through this core, not the delegate, so Write can redact it
+	if z.Enabled(e.Level) {
+		return ce.AddCore(e, z)
 	}
-	return res
+	return ce
 }
 
 func (z *customCore) Write(e zapcore.Entry, f []zapcore.Field) error {
-	return z.delegate.Write(e, f)
+	// remove all newlines from message
+	e.Message = strings.ReplaceAll(Redact(e.Message), "\n", "<LINEBREAK>")
+	return z.delegate.Write(e, redactFields(f))
 }
 
 func (z *customCore) Sync() error {
 	return z.delegate.Sync()
 }
+
+// Redact masks tokens, passwords, secrets and email addresses in s
+func Redact(s string) string {
+	s = bearerPattern.ReplaceAllString(s, "$1 "+redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = keyValuePattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := keyValuePattern.FindStringSubmatch(match)
+		if value := strings.ToLower(strings.Trim(parts[2], `"`)); value == "bearer" || value == "basic" || value == strings.ToLower(redacted) {
+			// already masked by the bearer pattern
+			return match
+		}
+		if strings.HasPrefix(parts[2], `"`) {
+			return parts[1] + `"` + redacted + `"`
+		}
+		return parts[1] + redacted
+	})
+	return emailPattern.ReplaceAllString(s, "$1***@$2")
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	if len(fields) == 0 {
+		return fields
+	}
+	result := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		result[i] = redactField(field)
+	}
+	return result
+}
+
+func redactField(field zapcore.Field) zapcore.Field {
+	if isSensitiveKey(field.Key) {
+		return zap.String(field.Key, redacted)
+	}
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = Redact(field.String)
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok {
+			return zap.String(field.Key, Redact(err.Error()))
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(fmt.Stringer); ok {
+			return zap.String(field.Key, Redact(stringer.String()))
+		}
+	case zapcore.ReflectType:
+		return redactReflected(field)
+	}
+	return field
+}
+
+// structs and maps are redacted through their JSON form, sensitive members are masked by key
+func redactReflected(field zapcore.Field) zapcore.Field {
+	data, err := json.Marshal(field.Interface)
+	if err != nil {
+		return field
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return field
+	}
+	return zap.Any(field.Key, redactValue(value))
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, member := range v {
+			if isSensitiveKey(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(member)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	case string:
+		return Redact(v)
+	}
+	return value
+}
@@ -104,3 +104,13 @@ func GetLoggerFromEcho(c echo.Context) (context.Context, *zap.SugaredLogger) {
 	}
 	return NewLoggerWithCorrelationid(context.Background(), "")
 }
+
+// function to add fields to the logger in the context, e.g. the request path or the user
+func WithLoggerFields(ctx context.Context, fields ...zap.Field) (context.Context, *zap.SugaredLogger) {
+	logger, _ := ctx.Value(loggerKey{}).(*zap.Logger)
+	if logger == nil {
+		logger = NewZapLogger()
+	}
+	logger = logger.With(fields...)
+	return context.WithValue(ctx, loggerKey{}, logger), logger.Sugar()
+}
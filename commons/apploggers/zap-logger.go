@@ -1,26 +1,157 @@
 package apploggers
 
 import (
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-// function to create new zap logger
-// logger will write to stdout only for now. hence commenting write to file
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+)
+
+// Config of the application logs, the zero value writes console format DEBUG logs to stdout
+type Config struct {
+	Format  string   `yaml:"format"`  // console or json
+	Level   string   `yaml:"level"`   // debug, info, warn or error
+	Outputs []string `yaml:"outputs"` // stdout, stderr and / or file
+
+	// sampling keeps the first SamplingInitial entries with the same level and message per second,
+	// then every SamplingThereafter-th one, it is disabled when SamplingInitial is 0
+	SamplingInitial    int `yaml:"samplingInitial"`
+	SamplingThereafter int `yaml:"samplingThereafter"`
+
+	File FileConfig `yaml:"file"`
+}
+
+// FileConfig of the rotating log file, used when Outputs contains file
+type FileConfig struct {
+	Path       string `yaml:"path"`
+	MaxSizeMB  int    `yaml:"maxSizeMB"`  // size of the file before it is rotated
+	MaxBackups int    `yaml:"maxBackups"` // rotated files to keep, 0 keeps all
+	MaxAgeDays int    `yaml:"maxAgeDays"` // days to keep rotated files, 0 keeps them forever
+	Compress   bool   `yaml:"compress"`
+}
+
+var (
+	coreMu sync.RWMutex
+	core   = mustNewCore(Config{})
+)
+
+// Configure replaces the core of the loggers created from now on, it is called once at startup,
+// loggers created before keep writing with the previous configuration
+func Configure(cfg Config) error {
+	newCore, err := newCore(cfg)
+	if err != nil {
+		return err
+	}
+	coreMu.Lock()
+	core = newCore
+	coreMu.Unlock()
+	return nil
+}
+
+// function to create new zap logger with the configured core
 func NewZapLogger() *zap.Logger {
-	encoder := getEncoder()
-	core := zapcore.NewTee(
-		NewCustomCore(zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), zapcore.DebugLevel)),
-	)
-	allLogger := zap.New(core, zap.AddCaller())
-	return allLogger
+	coreMu.RLock()
+	defer coreMu.RUnlock()
+	return zap.New(core, zap.AddCaller())
 }
 
-func getEncoder() zapcore.Encoder {
+// Sync flushes buffered log entries, called before the process exits
+func Sync() error {
+	coreMu.RLock()
+	defer coreMu.RUnlock()
+	return core.Sync()
+}
+
+func newCore(cfg Config) (zapcore.Core, error) {
+	level := zapcore.DebugLevel
+	if cfg.Level != "" {
+		parsed, err := zapcore.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %q", cfg.Level)
+		}
+		level = parsed
+	}
+
+	encoder, err := getEncoder(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := getWriter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var appCore zapcore.Core = NewCustomCore(zapcore.NewCore(encoder, writer, level))
+	if cfg.SamplingInitial > 0 {
+		appCore = zapcore.NewSamplerWithOptions(appCore, time.Second, cfg.SamplingInitial, cfg.SamplingThereafter)
+	}
+	return appCore, nil
+}
+
+func mustNewCore(cfg Config) zapcore.Core {
+	appCore, err := newCore(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return appCore
+}
+
+func getEncoder(format string) (zapcore.Encoder, error) {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
-	return zapcore.NewConsoleEncoder(encoderConfig)
+	switch strings.ToLower(format) {
+	case "", FormatConsole:
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	case FormatJSON:
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected console or json", format)
+	}
+}
+
+func getWriter(cfg Config) (zapcore.WriteSyncer, error) {
+	outputs := cfg.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{OutputStdout}
+	}
+
+	writers := make([]zapcore.WriteSyncer, 0, len(outputs))
+	for _, output := range outputs {
+		switch strings.ToLower(strings.TrimSpace(output)) {
+		case OutputStdout:
+			writers = append(writers, zapcore.Lock(os.Stdout))
+		case OutputStderr:
+			writers = append(writers, zapcore.Lock(os.Stderr))
+		case OutputFile:
+			if cfg.File.Path == "" {
+				return nil, fmt.Errorf("log output file requires a file path")
+			}
+			writers = append(writers, zapcore.AddSync(&lumberjack.Logger{
+				Filename:   cfg.File.Path,
+				MaxSize:    cfg.File.MaxSizeMB,
+				MaxBackups: cfg.File.MaxBackups,
+				MaxAge:     cfg.File.MaxAgeDays,
+				Compress:   cfg.File.Compress,
+			}))
+		default:
+			return nil, fmt.Errorf("invalid log output %q, expected stdout, stderr or file", output)
+		}
+	}
+	return zapcore.NewMultiWriteSyncer(writers...), nil
 }
@@ -0,0 +1,119 @@
+package appmetrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const namespace = "jevan"
+
+// Registry holds every application metric, it is served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "mongodb",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of MongoDB operations by collection and operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"collection", "operation"})
+
+	dbOperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "mongodb",
+		Name:      "operation_errors_total",
+		Help:      "Failed MongoDB operations by collection and operation, a missing document is not a failure.",
+	}, []string{"collection", "operation"})
+
+	ordersPlaced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_placed_total",
+		Help:      "Orders placed.",
+	})
+
+	orderRevenue = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "order_revenue_total",
+		Help:      "Sum of the total price of placed orders.",
+	})
+
+	ordersByStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orders",
+		Help:      "Orders by status, refreshed periodically from the database.",
+	}, []string{"status"})
+
+	activeCarts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_carts",
+		Help:      "Carts holding at least one item, refreshed periodically from the database.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		dbOperationDuration,
+		dbOperationErrors,
+		ordersPlaced,
+		orderRevenue,
+		ordersByStatus,
+		activeCarts,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTPRequest records a served request, route is the route template, e.g. /products/:id
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveDbOperation records a MongoDB operation started at start, err is the result of the operation
+func ObserveDbOperation(collection, operation string, start time.Time, err error) {
+	dbOperationDuration.WithLabelValues(collection, operation).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		dbOperationErrors.WithLabelValues(collection, operation).Inc()
+	}
+}
+
+// OrderPlaced counts a placed order and its total price
+func OrderPlaced(totalPrice float64) {
+	ordersPlaced.Inc()
+	if totalPrice > 0 {
+		orderRevenue.Add(totalPrice)
+	}
+}
+
+// SetOrdersByStatus replaces the number of orders per status
+func SetOrdersByStatus(counts map[string]int64) {
+	ordersByStatus.Reset()
+	for status, count := range counts {
+		ordersByStatus.WithLabelValues(status).Set(float64(count))
+	}
+}
+
+func SetActiveCarts(count int64) {
+	activeCarts.Set(float64(count))
+}
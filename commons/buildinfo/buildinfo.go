@@ -0,0 +1,43 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// set at build time, e.g. go build -ldflags "-X Jevan/commons/buildinfo.Version=1.4.0 -X Jevan/commons/buildinfo.Commit=$(git rev-parse HEAD)"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+var startedAt = time.Now()
+
+// function to get the commit, falls back to the vcs revision stamped by the go toolchain
+func GetCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+func GoVersion() string {
+	return runtime.Version()
+}
+
+// function to get the time the process started
+func StartedAt() time.Time {
+	return startedAt
+}
+
+func Uptime() time.Duration {
+	return time.Since(startedAt)
+}
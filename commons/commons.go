@@ -1,27 +1,25 @@
 package commons
 
 import (
+	"Jevan/commons/apperrors"
 	"encoding/json"
 )
 
-type ApiErrorResponsePayload struct {
-	Status         string                 `json:"status"`
-	Message        string                 `json:"message"`
-	AdditionalInfo map[string]interface{} `json:"additional_info,omitempty"`
+const MIMEProblemJSON = "application/problem+json"
+
+// ProblemDetails is the RFC 7807 body of every error response
+type ProblemDetails struct {
+	Type          string                 `json:"type"`
+	Title         string                 `json:"title"`
+	Status        int                    `json:"status"`
+	Detail        string                 `json:"detail,omitempty"`
+	Instance      string                 `json:"instance,omitempty"`
+	Code          string                 `json:"code,omitempty"` // machine readable, e.g. PRODUCT_NOT_FOUND
+	CorrelationID string                 `json:"correlationId,omitempty"`
+	Errors        []apperrors.FieldError `json:"errors,omitempty"`
 }
 
 func PrintStruct(payload interface{}) string {
 	pbytes, _ := json.Marshal(payload)
 	return string(pbytes)
 }
-
-func ApiErrorResponse(message string, additionalInfo map[string]interface{}) *ApiErrorResponsePayload {
-	response := &ApiErrorResponsePayload{
-		Status:  "Error",
-		Message: message,
-	}
-	if len(additionalInfo) > 0 {
-		response.AdditionalInfo = additionalInfo
-	}
-	return response
-}
@@ -1,7 +1,9 @@
 package commons
 
 import (
+	"Jevan/commons/apperrors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -9,42 +11,84 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-var validate = validator.New()
+var validate = newValidator()
 
+// validator reporting fields by their JSON name, as the client sent them
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// ValidateStruct validates obj, the error lists every invalid field with the failed rule
 func ValidateStruct(obj interface{}) error {
 	err := validate.Struct(obj)
 	if err == nil {
 		return nil
 	}
 
-	var sb strings.Builder
-	sb.WriteString("error(s): ")
-
-	if validationErrors, ok := err.(validator.ValidationErrors); ok {
-		var messages []string
-		for _, fieldErr := range validationErrors {
-			fieldName := strings.ToLower(fieldErr.Field())
-			switch fieldErr.Tag() {
-			case "required":
-				messages = append(messages, fmt.Sprintf(`"%s" is required field`, fieldName))
-			case "email":
-				messages = append(messages, fmt.Sprintf(`"%s" must be a valid email`, fieldName))
-			case "url":
-				messages = append(messages, fmt.Sprintf(`"%s" must be a valid URL`, fieldName))
-			case "oneof":
-				messages = append(messages, fmt.Sprintf(`"%s" must be one of [%s]`, fieldName, fieldErr.Param()))
-			case "min":
-				messages = append(messages, fmt.Sprintf(`"%s" must have at least %s item(s)`, fieldName, fieldErr.Param()))
-			default:
-				messages = append(messages, fmt.Sprintf(`"%s" is invalid`, fieldName))
-			}
-		}
-		sb.WriteString(strings.Join(messages, ", "))
-		return fmt.Errorf(sb.String())
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		// If it's not a validation error, just return it
+		return err
 	}
+	fields := make([]apperrors.FieldError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		fields = append(fields, apperrors.FieldError{
+			Field:   fieldPath(fieldErr),
+			Rule:    fieldErr.Tag(),
+			Param:   fieldErr.Param(),
+			Message: fieldMessage(fieldErr),
+		})
+	}
+	return apperrors.InvalidFields(fields)
+}
+
+// path of the field below the validated struct, e.g. items[0].quantity
+func fieldPath(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fieldErr.Field()
+}
 
-	// If it's not a validation error, just return it
-	return err
+func fieldMessage(fieldErr validator.FieldError) string {
+	name := fieldErr.Field()
+	switch fieldErr.Tag() {
+	case "required":
+		return fmt.Sprintf(`"%s" is required field`, name)
+	case "email":
+		return fmt.Sprintf(`"%s" must be a valid email`, name)
+	case "url":
+		return fmt.Sprintf(`"%s" must be a valid URL`, name)
+	case "oneof":
+		return fmt.Sprintf(`"%s" must be one of [%s]`, name, fieldErr.Param())
+	case "min":
+		switch fieldErr.Kind() {
+		case reflect.String:
+			return fmt.Sprintf(`"%s" must have at least %s character(s)`, name, fieldErr.Param())
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return fmt.Sprintf(`"%s" must have at least %s item(s)`, name, fieldErr.Param())
+		default:
+			return fmt.Sprintf(`"%s" must be at least %s`, name, fieldErr.Param())
+		}
+	case "gte":
+		return fmt.Sprintf(`"%s" must be greater than or equal to %s`, name, fieldErr.Param())
+	case "lte":
+		return fmt.Sprintf(`"%s" must be less than or equal to %s`, name, fieldErr.Param())
+	default:
+		return fmt.Sprintf(`"%s" is invalid`, name)
+	}
 }
 
 func GetQueryInt(c echo.Context, name string, defaultVal int) int {
@@ -57,3 +101,27 @@ func GetQueryInt(c echo.Context, name string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+const (
+	HeaderETag    = "ETag"
+	HeaderIfMatch = "If-Match"
+)
+
+// SetETag sends the version of the returned resource as a strong entity tag
+func SetETag(c echo.Context, version int64) {
+	c.Response().Header().Set(HeaderETag, strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// GetIfMatch returns the version required by the If-Match header, nil when the header is absent or "*"
+func GetIfMatch(c echo.Context) (*int64, error) {
+	value := strings.TrimSpace(c.Request().Header.Get(HeaderIfMatch))
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		return nil, apperrors.Validation("invalid If-Match header, expected the ETag of the resource")
+	}
+	return &version, nil
+}
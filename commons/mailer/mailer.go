@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"Jevan/commons/apperrors"
+	"Jevan/commons/apploggers"
+	"context"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// ErrNotConfigured is returned by the mailer used when no SMTP server is configured, the features
+// sending mails then fail instead of pretending the mail was sent
+var ErrNotConfigured = apperrors.New(apperrors.KindUnavailable, "MAIL_NOT_CONFIGURED", "sending emails is not configured on this server")
+
+type unconfiguredMailer struct{}
+
+// function to create the mailer used until an SMTP server is configured, every message is refused
+func NewUnconfiguredMailer() Mailer {
+	return &unconfiguredMailer{}
+}
+
+func (u *unconfiguredMailer) Send(ctx context.Context, message Message) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Warnf("Not sending mail, no SMTP server is configured, subject: %s", message.Subject)
+	return ErrNotConfigured
+}
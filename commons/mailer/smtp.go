@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"Jevan/commons/apploggers"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig is the server the mails are sent through, STARTTLS is used when the server offers it
+// and the credentials are only sent over TLS or to localhost
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"` // sender address, e.g. "Jevan <no-reply@jevan.app>"
+}
+
+// Configured reports whether a server is set, without one the unconfigured mailer is used
+func (c SMTPConfig) Configured() bool {
+	return c.Host != ""
+}
+
+type smtpMailer struct {
+	config SMTPConfig
+	send   func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// function to create a mailer sending through the SMTP server of the config
+func NewSMTPMailer(config SMTPConfig) Mailer {
+	return &smtpMailer{config: config, send: smtp.SendMail}
+}
+
+func (s *smtpMailer) Send(ctx context.Context, message Message) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Sending mail, subject: %s", message.Subject)
+
+	from, err := mail.ParseAddress(s.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+	if strings.ContainsAny(message.Subject, "\r\n") {
+		return errors.New("the subject must be a single line")
+	}
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	if err := s.send(addr, auth, from.Address, []string{to.Address}, buildMessage(from, to, message)); err != nil {
+		logger.Errorf("Failed to send mail: %v", err)
+		return err
+	}
+
+	logger.Infof("Sent mail, subject: %s", message.Subject)
+	return nil
+}
+
+// function to write the message as a plain text mail with its headers
+func buildMessage(from, to *mail.Address, message Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+// function to create the mailer with a send which keeps the message instead of dialing the server
+func newTestSMTPMailer(config SMTPConfig) (*smtpMailer, *[]byte) {
+	var sent []byte
+	m := NewSMTPMailer(config).(*smtpMailer)
+	m.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" || from != "no-reply@jevan.app" || len(to) != 1 || to[0] != "asha@example.com" {
+			return fmt.Errorf("unexpected envelope, addr: %s, from: %s, to: %v", addr, from, to)
+		}
+		sent = msg
+		return nil
+	}
+	return m, &sent
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	m, sent := newTestSMTPMailer(SMTPConfig{Host: "smtp.example.com", Port: 587, From: "Jevan <no-reply@jevan.app>"})
+
+	err := m.Send(context.Background(), Message{To: "asha@example.com", Subject: "Confirm your email", Body: "Open the link\nto confirm"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	message := string(*sent)
+	for _, want := range []string{"From: \"Jevan\" <no-reply@jevan.app>\r\n", "To: <asha@example.com>\r\n", "Subject: Confirm your email\r\n", "\r\n\r\nOpen the link\r\nto confirm\r\n"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message = %q, want it to contain %q", message, want)
+		}
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m, sent := newTestSMTPMailer(SMTPConfig{Host: "smtp.example.com", Port: 587, From: "no-reply@jevan.app"})
+
+	for _, message := range []Message{
+		{To: "asha@example.com\r\nBcc: mallory@example.com", Subject: "Hello"},
+		{To: "asha@example.com", Subject: "Hello\r\nBcc: mallory@example.com"},
+	} {
+		if err := m.Send(context.Background(), message); err == nil {
+			t.Errorf("Send(%+v) succeeded, want an error", message)
+		}
+	}
+	if *sent != nil {
+		t.Errorf("sent %q, want nothing sent", *sent)
+	}
+}
+
+func TestUnconfiguredMailerFails(t *testing.T) {
+	if err := NewUnconfiguredMailer().Send(context.Background(), Message{To: "asha@example.com"}); err != ErrNotConfigured {
+		t.Errorf("Send = %v, want ErrNotConfigured", err)
+	}
+}
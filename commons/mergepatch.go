@@ -0,0 +1,100 @@
+package commons
+
+import (
+	"Jevan/commons/apperrors"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"reflect"
+	"sort"
+)
+
+const MIMEMergePatchJSON = "application/merge-patch+json"
+
+// ErrInvalidPatch is returned for patches which are not a JSON object, touch an immutable field
+// or produce an invalid document
+var ErrInvalidPatch = apperrors.New(apperrors.KindValidation, "INVALID_PATCH", "invalid merge patch")
+
+// IsMergePatchContentType reports if the content type can carry a merge patch, plain JSON is accepted as well
+func IsMergePatchContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == MIMEMergePatchJSON || mediaType == "application/json"
+}
+
+// MergePatch applies an RFC 7396 merge patch to target, a pointer to a struct, through its JSON
+// representation: members of the patch replace those of the target, null removes them and nested
+// objects are merged. Fields listed as immutable, by JSON name, may only repeat the current value.
+func MergePatch(target interface{}, patch []byte, immutable ...string) error {
+	var patchDoc map[string]interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil || patchDoc == nil {
+		return ErrInvalidPatch.Detailf("invalid merge patch: the body must be a JSON object")
+	}
+
+	current, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+
+	for _, field := range immutable {
+		value, ok := patchDoc[field]
+		if ok && !reflect.DeepEqual(value, doc[field]) {
+			err := ErrInvalidPatch.Detailf("invalid merge patch: '%s' cannot be changed", field)
+			err.Fields = []apperrors.FieldError{{Field: field, Rule: "immutable", Message: fmt.Sprintf(`"%s" cannot be changed`, field)}}
+			return err
+		}
+	}
+
+	merged, err := json.Marshal(mergeValue(doc, patchDoc))
+	if err != nil {
+		return err
+	}
+
+	// decode into a zero value so removed members end up as zero values as well
+	value := reflect.ValueOf(target).Elem()
+	value.Set(reflect.Zero(value.Type()))
+	if err := json.Unmarshal(merged, target); err != nil {
+		return ErrInvalidPatch.Detailf("invalid merge patch: %s", err.Error())
+	}
+	return nil
+}
+
+// PatchFields returns the sorted names of the members of the patch, e.g. to log which fields it changes
+// without their values; none when the patch is not a JSON object
+func PatchFields(patch []byte) []string {
+	var patchDoc map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return nil
+	}
+	fields := make([]string, 0, len(patchDoc))
+	for field := range patchDoc {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"Jevan/commons/apploggers"
+	"context"
+	"sync"
+	"time"
+)
+
+type Job func(ctx context.Context) error
+
+// Scheduler runs background jobs at a fixed interval until stopped
+type Scheduler interface {
+	Every(name string, interval time.Duration, job Job)
+	Start()
+	Stop()
+}
+
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+type scheduler struct {
+	jobs   []scheduledJob
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler() Scheduler {
+	return &scheduler{}
+}
+
+// function to register a job, jobs must be registered before Start
+func (s *scheduler) Every(name string, interval time.Duration, job Job) {
+	if interval <= 0 {
+		return
+	}
+	s.jobs = append(s.jobs, scheduledJob{name: name, interval: interval, job: job})
+}
+
+func (s *scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.run(ctx, job)
+	}
+}
+
+// function to stop all jobs, waits for running jobs to return
+func (s *scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *scheduler) run(ctx context.Context, job scheduledJob) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			jctx, logger := apploggers.NewLoggerWithCorrelationid(ctx, "")
+			logger.Infof("Running scheduled job: %s", job.name)
+			if err := job.job(jctx); err != nil {
+				logger.Errorf("Scheduled job %s failed: %v", job.name, err)
+			}
+		}
+	}
+}
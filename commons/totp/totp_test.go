@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA1 secret of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B vectors, the 6 digit codes are the last digits of the 8 digit ones
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeForStepRFC6238(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := CodeForStep(rfcSecret, Step(time.Unix(vector.unix, 0)))
+		if err != nil || code != vector.code {
+			t.Errorf("code at %d = %s, %v, want %s", vector.unix, code, err, vector.code)
+		}
+	}
+	if code, err := CodeForStep(strings.ToLower(rfcSecret)+" ", 1); err != nil || code != "287082" {
+		t.Errorf("code of the lower case secret = %s, %v, want 287082", code, err)
+	}
+	if _, err := CodeForStep("not base32!", 1); err == nil {
+		t.Error("code of an invalid secret, want an error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	if step, ok := Validate(rfcSecret, "050471", now, 1); !ok || step != current {
+		t.Errorf("Validate of the current code = %d, %v, want step %d", step, ok, current)
+	}
+	// the code of the previous step is accepted within the skew, and returns its own step
+	if step, ok := Validate(rfcSecret, " 081804 ", now, 1); !ok || step != current-1 {
+		t.Errorf("Validate of the previous code = %d, %v, want step %d", step, ok, current-1)
+	}
+	for _, code := range []string{"081804", "050471", "50471", "0504710", "000000"} {
+		if _, ok := Validate(rfcSecret, code, now.Add(2*Period*time.Second), 1); ok {
+			t.Errorf("Validate(%q) outside the skew succeeded", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if _, err := CodeForStep(secret, 1); err != nil || len(secret) != 32 {
+		t.Errorf("secret %q, %v, want 32 base32 characters", secret, err)
+	}
+	if uri := URI("Jevan", "asha@example.com", secret); !strings.HasPrefix(uri, "otpauth://totp/Jevan:asha@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("uri = %s", uri)
+	}
+}
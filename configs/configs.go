@@ -3,66 +3,284 @@ package configs
 import (
 	"Jevan/commons/appdb"
 	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"Jevan/commons/mailer"
+	"Jevan/commons/oidc"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"net/url"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
 )
 
 var (
 	AppConfig *ApplicationConfig
 )
 
+// ApplicationConfig is read by LoadConfig from, in increasing precedence, the defaults, the optional
+// YAML file and the environment. Durations in the file are written as "15m", "500ms"; the environment
+// variables keep their unit in the name, e.g. LOGIN_LOCKOUT_MINUTES.
 type ApplicationConfig struct {
-	HttpPort  string
-	JwtSecret string
-	DbClient  appdb.DatabaseClient
+	HttpPort    string               `yaml:"httpPort"`
+	MetricsPort string               `yaml:"metricsPort"` // internal port of /metrics, not to be exposed publicly
+	JwtSecret   string               `yaml:"jwtSecret"`
+	Mongo       MongoConfig          `yaml:"mongo"`
+	DbClient    appdb.DatabaseClient `yaml:"-"`
+
+	// CIDR ranges of the reverse proxies whose X-Forwarded-For is trusted, without any the client ip is
+	// the address of the connection
+	TrustedProxies []string `yaml:"trustedProxies"`
+
+	Log     apploggers.Config `yaml:"log"`
+	Tracing apptracing.Config `yaml:"tracing"`
+
+	LoginMaxFailures     int           `yaml:"loginMaxFailures"`
+	LoginIPMaxFailures   int           `yaml:"loginIpMaxFailures"`
+	LoginLockoutDuration time.Duration `yaml:"loginLockoutDuration"`
+	LoginBaseDelay       time.Duration `yaml:"loginBaseDelay"`
+	LoginFailureWindow   time.Duration `yaml:"loginFailureWindow"` // failures are counted from the first one for this long
+
+	RequireAdminTwoFactor bool   `yaml:"requireAdminTwoFactor"`
+	TotpIssuer            string `yaml:"totpIssuer"`
+
+	OidcProviders []oidc.ProviderConfig `yaml:"oidcProviders"`
+
+	EmailVerifyURL string            `yaml:"emailVerifyUrl"`
+	Smtp           mailer.SMTPConfig `yaml:"smtp"` // without a host, the features sending mails are unavailable
+
+	CartItemTTL        time.Duration `yaml:"cartItemTtl"`
+	CartExpiryInterval time.Duration `yaml:"cartExpiryInterval"`
+	CartMaxItemQty     int           `yaml:"cartMaxItemQuantity"`
+
+	DeletedRetention time.Duration `yaml:"deletedRetention"` // soft deleted products and accounts are purged after it
+	PurgeInterval    time.Duration `yaml:"purgeInterval"`
+
+	MetricsRefreshInterval time.Duration `yaml:"metricsRefreshInterval"`
+	HealthCheckTimeout     time.Duration `yaml:"healthCheckTimeout"`
+
+	ShutdownTimeout    time.Duration `yaml:"shutdownTimeout"`
+	ShutdownDrainDelay time.Duration `yaml:"shutdownDrainDelay"`
 }
 
-func NewApplicationConfig(context context.Context) error {
-	logger := apploggers.GetLoggerWithCorrelationid(context)
-	if err := godotenv.Load(".env"); err != nil {
-		return err
+// function to get the configuration used when neither the file nor the environment set a value
+func defaultConfig() *ApplicationConfig {
+	return &ApplicationConfig{
+		HttpPort:    "8000",
+		MetricsPort: "9464",
+		Mongo: MongoConfig{
+			Database:               "jevan",
+			MaxPoolSize:            100,
+			ConnectTimeout:         10 * time.Second,
+			ServerSelectionTimeout: 10 * time.Second,
+		},
+
+		Log: apploggers.Config{
+			Format:             apploggers.FormatConsole,
+			Level:              "info",
+			Outputs:            []string{apploggers.OutputStdout},
+			SamplingThereafter: 100,
+			File: apploggers.FileConfig{
+				Path:       "logs/jevan.log",
+				MaxSizeMB:  100,
+				MaxBackups: 5,
+				MaxAgeDays: 30,
+				Compress:   true,
+			},
+		},
+		Tracing: apptracing.Config{
+			Exporter:    apptracing.ExporterNone,
+			ServiceName: "jevan",
+			SampleRatio: 1,
+		},
+
+		LoginMaxFailures:     5,
+		LoginIPMaxFailures:   20,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginBaseDelay:       500 * time.Millisecond,
+		LoginFailureWindow:   time.Hour,
+
+		TotpIssuer: "Jevan",
+
+		EmailVerifyURL: "http://localhost:3000/verify-email",
+		Smtp:           mailer.SMTPConfig{Port: 587},
+
+		CartItemTTL:        72 * time.Hour,
+		CartExpiryInterval: time.Hour,
+		CartMaxItemQty:     10,
+
+		DeletedRetention: 30 * 24 * time.Hour,
+		PurgeInterval:    time.Hour,
+
+		MetricsRefreshInterval: time.Minute,
+		HealthCheckTimeout:     2 * time.Second,
+
+		ShutdownTimeout: 30 * time.Second,
 	}
+}
 
-	user := os.Getenv(MONGO_USER)
-	password := os.Getenv(MONGO_PASSWORD)
-	cluster := os.Getenv(MONGO_CLUSTER)
+// LoadConfig reads and validates the configuration: the defaults, then the YAML file named by CONFIG_FILE
+// (config.yaml if present), then the environment, where variables from an optional .env file are added
+// to the ones already set. It does not connect to anything, see NewApplicationConfig.
+func LoadConfig() (*ApplicationConfig, error) {
+	config, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
-	if user == "" || password == "" || cluster == "" {
-		return fmt.Errorf("missing MongoDB configuration values")
+// LoadDemoConfig reads the configuration like LoadConfig for the server's --demo mode, which needs no setup:
+// without a JWT secret a random one is used for the process, and without a MongoDB server the in-memory
+// database. The demo data is only written into a MongoDB server on another machine when allowRemote is set,
+// so a configuration meant for a real deployment cannot get demo accounts by mistake.
+func LoadDemoConfig(allowRemote bool) (*ApplicationConfig, error) {
+	config, err := load()
+	if err != nil {
+		return nil, err
 	}
+	if strings.TrimSpace(config.JwtSecret) == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		config.JwtSecret = hex.EncodeToString(secret)
+	}
+	if !config.Mongo.Configured() {
+		config.Mongo.InMemory = true
+	}
+	if !config.Mongo.InMemory && !config.Mongo.Local() && !allowRemote {
+		return nil, errors.New("the demo data would be written into the configured MongoDB server, which is not on this machine; unset " +
+			MONGO_URI + " to use the in-memory database, or pass --demo-remote to write into it")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
-	// URL-encode the password in case it contains special characters
-	encodedPassword := url.QueryEscape(password)
+// function to read the defaults, the file and the environment, without validating the result
+func load() (*ApplicationConfig, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading .env: %w", err)
+	}
 
-	// Construct the URI
-	mongoURI := fmt.Sprintf("mongodb+srv://%s:%s@%s/?retryWrites=true&w=majority&appName=Cluster0", user, encodedPassword, cluster)
+	config := defaultConfig()
+	if err := config.loadFile(); err != nil {
+		return nil, err
+	}
+	if err := config.loadEnv(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
-	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	opts := options.Client().ApplyURI(mongoURI).SetServerAPIOptions(serverAPI)
+// function to merge the YAML file over the defaults, only the keys present in the file are changed
+func (c *ApplicationConfig) loadFile() error {
+	path, required := os.LookupEnv(CONFIG_FILE)
+	if !required {
+		path = DEFAULT_CONFIG_FILE
+	}
 
-	client, err := mongo.Connect(context, opts)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
 	if err != nil {
-		logger.Errorf("MongoDB connection error: %v", err)
-		return err
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid or missing value, the server refuses to start on any of them
+func (c *ApplicationConfig) Validate() error {
+	var problems []string
+	if strings.TrimSpace(c.JwtSecret) == "" {
+		problems = append(problems, JWT_SECRET+" is required")
+	}
+	if c.HttpPort == "" {
+		problems = append(problems, HTTP_PORT+" is required")
+	}
+	if c.MetricsPort == "" || c.MetricsPort == c.HttpPort {
+		problems = append(problems, METRICS_PORT+" is required and must differ from "+HTTP_PORT)
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("%s must list CIDR ranges, e.g. 10.0.0.0/8, got %q", TRUSTED_PROXIES, proxy))
+		}
+	}
+	if c.Mongo.Database == "" {
+		problems = append(problems, MONGO_DATABASE+" is required")
+	}
+	if _, err := c.Mongo.uri(); err != nil && !c.Mongo.InMemory {
+		problems = append(problems, err.Error())
+	}
+	if c.Mongo.MaxPoolSize > 0 && c.Mongo.MinPoolSize > c.Mongo.MaxPoolSize {
+		problems = append(problems, MONGO_MIN_POOL_SIZE+" must not exceed "+MONGO_MAX_POOL_SIZE)
+	}
+	if c.Mongo.TLS.CertFile != "" && c.Mongo.TLS.KeyFile == "" {
+		problems = append(problems, MONGO_TLS_KEY_FILE+" is required with "+MONGO_TLS_CERT_FILE)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, TRACING_SAMPLE_RATIO+" must be between 0 and 1")
+	}
+	for _, provider := range c.OidcProviders {
+		if provider.Name == "" || provider.IssuerURL == "" || provider.ClientID == "" {
+			problems = append(problems, "OpenID Connect providers require a name, issuer url and client id")
+			break
+		}
+	}
+	if c.Smtp.Configured() && c.Smtp.From == "" {
+		problems = append(problems, MAIL_FROM+" is required with "+SMTP_HOST)
+	}
+	if c.LoginFailureWindow <= 0 {
+		problems = append(problems, LOGIN_FAILURE_WINDOW_MINUTES+" must be positive")
+	}
+	if c.DeletedRetention < 0 {
+		problems = append(problems, DELETED_RETENTION_DAYS+" must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, SHUTDOWN_TIMEOUT_SECONDS+" must be positive")
 	}
 
-	if err := client.Ping(context, nil); err != nil {
-		logger.Errorf("MongoDB ping error: %v", err)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// NewApplicationConfig connects to MongoDB, or opens the in-memory database, with the loaded configuration
+// and makes it the AppConfig
+func NewApplicationConfig(context context.Context, config *ApplicationConfig) error {
+	logger := apploggers.GetLoggerWithCorrelationid(context)
+
+	if config.Mongo.InMemory {
+		logger.Warn("Using the in-memory database, the data is lost when the server stops")
+		config.DbClient = appdb.NewMemoryDatabaseClient(config.Mongo.Database)
+		AppConfig = config
+		return nil
+	}
+
+	client, err := connectMongo(context, config.Mongo)
+	if err != nil {
+		logger.Errorf("MongoDB connection error: %v", err)
 		return err
 	}
 
 	logger.Info("You successfully connected to MongoDB!")
-	dbClient := appdb.NewDatabaseClient(os.Getenv(MONGO_DATABASE), client)
-	AppConfig = &ApplicationConfig{
-		HttpPort:  os.Getenv(HTTP_PORT),
-		DbClient:  dbClient,
-		JwtSecret: os.Getenv(JWT_SECRET),
-	}
+	config.DbClient = appdb.NewDatabaseClient(config.Mongo.Database, client)
+	AppConfig = config
 	return nil
 }
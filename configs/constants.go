@@ -1,17 +1,92 @@
 package configs
 
 const (
-	HTTP_PORT = "HTTP_PORT"
-
-	MONGO_CLUSTER  = "MONGO_CLUSTER"
-	MONGO_USER     = "MONGO_USER"
-	MONGO_PASSWORD = "MONGO_PASSWORD"
-	MONGO_DATABASE = "MONGO_DATABASE"
-	JWT_SECRET     = "JWT_SECRET"
-
-	MONGO_USERS_COLLECTION       = "users"
-	MONGO_USERDETAILS_COLLECTION = "users-details"
-	MONGO_CARTS_COLLECTION       = "carts"
-	MONGO_ORDERS_COLLECTION      = "orders"
-	MONGO_PRODUCTS_COLLECTION    = "products"
+	CONFIG_FILE         = "CONFIG_FILE"
+	DEFAULT_CONFIG_FILE = "config.yaml"
+
+	HTTP_PORT       = "HTTP_PORT"
+	JWT_SECRET      = "JWT_SECRET"
+	TRUSTED_PROXIES = "TRUSTED_PROXIES"
+	METRICS_PORT    = "METRICS_PORT"
+
+	MONGO_URI                         = "MONGO_URI"
+	MONGO_CLUSTER                     = "MONGO_CLUSTER"
+	MONGO_USER                        = "MONGO_USER"
+	MONGO_PASSWORD                    = "MONGO_PASSWORD"
+	MONGO_DATABASE                    = "MONGO_DATABASE"
+	MONGO_MIN_POOL_SIZE               = "MONGO_MIN_POOL_SIZE"
+	MONGO_MAX_POOL_SIZE               = "MONGO_MAX_POOL_SIZE"
+	MONGO_MAX_CONN_IDLE_SECONDS       = "MONGO_MAX_CONN_IDLE_SECONDS"
+	MONGO_CONNECT_TIMEOUT_MS          = "MONGO_CONNECT_TIMEOUT_MS"
+	MONGO_SERVER_SELECTION_TIMEOUT_MS = "MONGO_SERVER_SELECTION_TIMEOUT_MS"
+	MONGO_SOCKET_TIMEOUT_MS           = "MONGO_SOCKET_TIMEOUT_MS"
+	MONGO_TLS                         = "MONGO_TLS"
+	MONGO_TLS_CA_FILE                 = "MONGO_TLS_CA_FILE"
+	MONGO_TLS_CERT_FILE               = "MONGO_TLS_CERT_FILE"
+	MONGO_TLS_KEY_FILE                = "MONGO_TLS_KEY_FILE"
+	MONGO_TLS_INSECURE                = "MONGO_TLS_INSECURE"
+	MONGO_IN_MEMORY                   = "MONGO_IN_MEMORY"
+
+	LOGIN_MAX_FAILURES    = "LOGIN_MAX_FAILURES"
+	LOGIN_IP_MAX_FAILURES = "LOGIN_IP_MAX_FAILURES"
+	LOGIN_LOCKOUT_MINUTES = "LOGIN_LOCKOUT_MINUTES"
+	LOGIN_BASE_DELAY_MS   = "LOGIN_BASE_DELAY_MS"
+
+	LOGIN_FAILURE_WINDOW_MINUTES = "LOGIN_FAILURE_WINDOW_MINUTES"
+
+	REQUIRE_ADMIN_2FA = "REQUIRE_ADMIN_2FA"
+	TOTP_ISSUER       = "TOTP_ISSUER"
+
+	OIDC_PROVIDER      = "OIDC_PROVIDER"
+	OIDC_ISSUER_URL    = "OIDC_ISSUER_URL"
+	OIDC_CLIENT_ID     = "OIDC_CLIENT_ID"
+	OIDC_CLIENT_SECRET = "OIDC_CLIENT_SECRET"
+	OIDC_REDIRECT_URL  = "OIDC_REDIRECT_URL"
+	OIDC_SCOPES        = "OIDC_SCOPES"
+
+	EMAIL_VERIFY_URL = "EMAIL_VERIFY_URL"
+	SMTP_HOST        = "SMTP_HOST"
+	SMTP_PORT        = "SMTP_PORT"
+	SMTP_USERNAME    = "SMTP_USERNAME"
+	SMTP_PASSWORD    = "SMTP_PASSWORD"
+	MAIL_FROM        = "MAIL_FROM"
+
+	CART_ITEM_TTL_HOURS          = "CART_ITEM_TTL_HOURS"
+	CART_EXPIRY_INTERVAL_MINUTES = "CART_EXPIRY_INTERVAL_MINUTES"
+	CART_MAX_ITEM_QUANTITY       = "CART_MAX_ITEM_QUANTITY"
+
+	DELETED_RETENTION_DAYS = "DELETED_RETENTION_DAYS"
+	PURGE_INTERVAL_MINUTES = "PURGE_INTERVAL_MINUTES"
+
+	METRICS_REFRESH_INTERVAL_SECONDS = "METRICS_REFRESH_INTERVAL_SECONDS"
+	HEALTH_CHECK_TIMEOUT_MS          = "HEALTH_CHECK_TIMEOUT_MS"
+
+	SHUTDOWN_TIMEOUT_SECONDS     = "SHUTDOWN_TIMEOUT_SECONDS"
+	SHUTDOWN_DRAIN_DELAY_SECONDS = "SHUTDOWN_DRAIN_DELAY_SECONDS"
+
+	TRACING_EXPORTER     = "TRACING_EXPORTER"
+	TRACING_SAMPLE_RATIO = "TRACING_SAMPLE_RATIO"
+	OTEL_SERVICE_NAME    = "OTEL_SERVICE_NAME"
+
+	LOG_FORMAT              = "LOG_FORMAT"
+	LOG_LEVEL               = "LOG_LEVEL"
+	LOG_OUTPUT              = "LOG_OUTPUT"
+	LOG_SAMPLING_INITIAL    = "LOG_SAMPLING_INITIAL"
+	LOG_SAMPLING_THEREAFTER = "LOG_SAMPLING_THEREAFTER"
+	LOG_FILE_PATH           = "LOG_FILE_PATH"
+	LOG_FILE_MAX_SIZE_MB    = "LOG_FILE_MAX_SIZE_MB"
+	LOG_FILE_MAX_BACKUPS    = "LOG_FILE_MAX_BACKUPS"
+	LOG_FILE_MAX_AGE_DAYS   = "LOG_FILE_MAX_AGE_DAYS"
+	LOG_FILE_COMPRESS       = "LOG_FILE_COMPRESS"
+
+	MONGO_USERS_COLLECTION          = "users"
+	MONGO_USERDETAILS_COLLECTION    = "users-details"
+	MONGO_CARTS_COLLECTION          = "carts"
+	MONGO_ORDERS_COLLECTION         = "orders"
+	MONGO_PRODUCTS_COLLECTION       = "products"
+	MONGO_LOGIN_ATTEMPTS_COLLECTION = "login-attempts"
+	MONGO_AUDIT_EVENTS_COLLECTION   = "audit_events"
+
+	MONGO_SCHEMA_MIGRATIONS_COLLECTION      = "schema_migrations"
+	MONGO_SCHEMA_MIGRATIONS_LOCK_COLLECTION = "schema_migrations_lock"
 )
@@ -0,0 +1,206 @@
+package configs
+
+import (
+	"Jevan/commons/oidc"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envReader overrides config values with the environment variables which are set,
+// values which cannot be parsed are collected and reported together
+type envReader struct {
+	problems []string
+}
+
+// function to apply the environment over the defaults and the config file
+func (c *ApplicationConfig) loadEnv() error {
+	env := &envReader{}
+
+	env.string(&c.HttpPort, HTTP_PORT)
+	env.string(&c.MetricsPort, METRICS_PORT)
+	env.string(&c.JwtSecret, JWT_SECRET)
+	env.list(&c.TrustedProxies, TRUSTED_PROXIES)
+
+	env.string(&c.Mongo.URI, MONGO_URI)
+	env.string(&c.Mongo.Database, MONGO_DATABASE)
+	env.string(&c.Mongo.Cluster, MONGO_CLUSTER)
+	env.string(&c.Mongo.User, MONGO_USER)
+	env.string(&c.Mongo.Password, MONGO_PASSWORD)
+	env.uint(&c.Mongo.MinPoolSize, MONGO_MIN_POOL_SIZE)
+	env.uint(&c.Mongo.MaxPoolSize, MONGO_MAX_POOL_SIZE)
+	env.duration(&c.Mongo.MaxConnIdleTime, MONGO_MAX_CONN_IDLE_SECONDS, time.Second)
+	env.duration(&c.Mongo.ConnectTimeout, MONGO_CONNECT_TIMEOUT_MS, time.Millisecond)
+	env.duration(&c.Mongo.ServerSelectionTimeout, MONGO_SERVER_SELECTION_TIMEOUT_MS, time.Millisecond)
+	env.duration(&c.Mongo.SocketTimeout, MONGO_SOCKET_TIMEOUT_MS, time.Millisecond)
+	env.bool(&c.Mongo.TLS.Enabled, MONGO_TLS)
+	env.string(&c.Mongo.TLS.CAFile, MONGO_TLS_CA_FILE)
+	env.string(&c.Mongo.TLS.CertFile, MONGO_TLS_CERT_FILE)
+	env.string(&c.Mongo.TLS.KeyFile, MONGO_TLS_KEY_FILE)
+	env.bool(&c.Mongo.TLS.InsecureSkipVerify, MONGO_TLS_INSECURE)
+	env.bool(&c.Mongo.InMemory, MONGO_IN_MEMORY)
+
+	env.string(&c.Log.Format, LOG_FORMAT)
+	env.string(&c.Log.Level, LOG_LEVEL)
+	env.list(&c.Log.Outputs, LOG_OUTPUT)
+	env.int(&c.Log.SamplingInitial, LOG_SAMPLING_INITIAL)
+	env.int(&c.Log.SamplingThereafter, LOG_SAMPLING_THEREAFTER)
+	env.string(&c.Log.File.Path, LOG_FILE_PATH)
+	env.int(&c.Log.File.MaxSizeMB, LOG_FILE_MAX_SIZE_MB)
+	env.int(&c.Log.File.MaxBackups, LOG_FILE_MAX_BACKUPS)
+	env.int(&c.Log.File.MaxAgeDays, LOG_FILE_MAX_AGE_DAYS)
+	env.bool(&c.Log.File.Compress, LOG_FILE_COMPRESS)
+
+	env.string(&c.Tracing.Exporter, TRACING_EXPORTER)
+	env.string(&c.Tracing.ServiceName, OTEL_SERVICE_NAME)
+	env.float(&c.Tracing.SampleRatio, TRACING_SAMPLE_RATIO)
+
+	env.int(&c.LoginMaxFailures, LOGIN_MAX_FAILURES)
+	env.int(&c.LoginIPMaxFailures, LOGIN_IP_MAX_FAILURES)
+	env.duration(&c.LoginLockoutDuration, LOGIN_LOCKOUT_MINUTES, time.Minute)
+	env.duration(&c.LoginBaseDelay, LOGIN_BASE_DELAY_MS, time.Millisecond)
+	env.duration(&c.LoginFailureWindow, LOGIN_FAILURE_WINDOW_MINUTES, time.Minute)
+
+	env.bool(&c.RequireAdminTwoFactor, REQUIRE_ADMIN_2FA)
+	env.string(&c.TotpIssuer, TOTP_ISSUER)
+
+	if provider, ok := env.oidcProvider(); ok {
+		c.OidcProviders = []oidc.ProviderConfig{provider}
+	}
+
+	env.string(&c.EmailVerifyURL, EMAIL_VERIFY_URL)
+	env.string(&c.Smtp.Host, SMTP_HOST)
+	env.int(&c.Smtp.Port, SMTP_PORT)
+	env.string(&c.Smtp.Username, SMTP_USERNAME)
+	env.string(&c.Smtp.Password, SMTP_PASSWORD)
+	env.string(&c.Smtp.From, MAIL_FROM)
+
+	env.duration(&c.CartItemTTL, CART_ITEM_TTL_HOURS, time.Hour)
+	env.duration(&c.CartExpiryInterval, CART_EXPIRY_INTERVAL_MINUTES, time.Minute)
+	env.int(&c.CartMaxItemQty, CART_MAX_ITEM_QUANTITY)
+
+	env.duration(&c.DeletedRetention, DELETED_RETENTION_DAYS, 24*time.Hour)
+	env.duration(&c.PurgeInterval, PURGE_INTERVAL_MINUTES, time.Minute)
+
+	env.duration(&c.MetricsRefreshInterval, METRICS_REFRESH_INTERVAL_SECONDS, time.Second)
+	env.duration(&c.HealthCheckTimeout, HEALTH_CHECK_TIMEOUT_MS, time.Millisecond)
+
+	env.duration(&c.ShutdownTimeout, SHUTDOWN_TIMEOUT_SECONDS, time.Second)
+	env.duration(&c.ShutdownDrainDelay, SHUTDOWN_DRAIN_DELAY_SECONDS, time.Second)
+
+	if len(env.problems) > 0 {
+		return fmt.Errorf("invalid environment: %s", strings.Join(env.problems, "; "))
+	}
+	return nil
+}
+
+// function to read the OpenID Connect provider, it replaces the providers of the file when an issuer is set
+func (e *envReader) oidcProvider() (oidc.ProviderConfig, bool) {
+	issuer := os.Getenv(OIDC_ISSUER_URL)
+	if issuer == "" {
+		return oidc.ProviderConfig{}, false
+	}
+	provider := oidc.ProviderConfig{
+		Name:         "google",
+		IssuerURL:    issuer,
+		ClientID:     os.Getenv(OIDC_CLIENT_ID),
+		ClientSecret: os.Getenv(OIDC_CLIENT_SECRET),
+		RedirectURL:  os.Getenv(OIDC_REDIRECT_URL),
+		Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(OIDC_SCOPES), ",", " ")),
+	}
+	e.string(&provider.Name, OIDC_PROVIDER)
+	return provider, true
+}
+
+func (e *envReader) invalid(key, value, expected string) {
+	e.problems = append(e.problems, fmt.Sprintf("%s=%q is not %s", key, value, expected))
+}
+
+func (e *envReader) string(target *string, key string) {
+	if val := os.Getenv(key); val != "" {
+		*target = val
+	}
+}
+
+// function to read a comma separated list
+func (e *envReader) list(target *[]string, key string) {
+	val := os.Getenv(key)
+	if val == "" {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*target = items
+}
+
+func (e *envReader) int(target *int, key string) {
+	val := os.Getenv(key)
+	if val == "" {
+		return
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		e.invalid(key, val, "an integer")
+		return
+	}
+	*target = i
+}
+
+func (e *envReader) uint(target *uint64, key string) {
+	val := os.Getenv(key)
+	if val == "" {
+		return
+	}
+	u, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		e.invalid(key, val, "a positive integer")
+		return
+	}
+	*target = u
+}
+
+func (e *envReader) float(target *float64, key string) {
+	val := os.Getenv(key)
+	if val == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		e.invalid(key, val, "a number")
+		return
+	}
+	*target = f
+}
+
+func (e *envReader) bool(target *bool, key string) {
+	val := os.Getenv(key)
+	if val == "" {
+		return
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		e.invalid(key, val, "a boolean")
+		return
+	}
+	*target = b
+}
+
+// function to read a duration given as a whole number of unit, e.g. minutes for LOGIN_LOCKOUT_MINUTES
+func (e *envReader) duration(target *time.Duration, key string, unit time.Duration) {
+	val := os.Getenv(key)
+	if val == "" {
+		return
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		e.invalid(key, val, "a positive integer")
+		return
+	}
+	*target = time.Duration(i) * unit
+}
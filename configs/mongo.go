@@ -0,0 +1,202 @@
+package configs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+)
+
+// MongoConfig of the connection, either a full URI, e.g. mongodb://localhost:27017, or the Atlas
+// cluster with its credentials from which a mongodb+srv URI is built. InMemory replaces MongoDB by the
+// in-memory database, nothing is kept once the process exits.
+type MongoConfig struct {
+	URI      string `yaml:"uri"`
+	Database string `yaml:"database"`
+
+	Cluster  string `yaml:"cluster"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+
+	MinPoolSize            uint64        `yaml:"minPoolSize"`
+	MaxPoolSize            uint64        `yaml:"maxPoolSize"`
+	MaxConnIdleTime        time.Duration `yaml:"maxConnIdleTime"`
+	ConnectTimeout         time.Duration `yaml:"connectTimeout"`
+	ServerSelectionTimeout time.Duration `yaml:"serverSelectionTimeout"`
+	SocketTimeout          time.Duration `yaml:"socketTimeout"`
+
+	TLS MongoTLSConfig `yaml:"tls"`
+
+	InMemory bool `yaml:"inMemory"`
+}
+
+// MongoTLSConfig enables TLS on top of the options of the URI, the files are PEM encoded
+type MongoTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// function to get the connection URI, the Atlas URI is only built when no URI is configured
+func (m MongoConfig) uri() (string, error) {
+	if m.URI != "" {
+		return m.URI, nil
+	}
+	if m.Cluster == "" || m.User == "" || m.Password == "" {
+		return "", fmt.Errorf("%s, or %s with %s and %s, is required", MONGO_URI, MONGO_CLUSTER, MONGO_USER, MONGO_PASSWORD)
+	}
+	// URL-encode the password in case it contains special characters
+	return fmt.Sprintf("mongodb+srv://%s:%s@%s/?retryWrites=true&w=majority&appName=Cluster0",
+		url.QueryEscape(m.User), url.QueryEscape(m.Password), m.Cluster), nil
+}
+
+// Configured reports whether a MongoDB server is set, by URI or Atlas cluster
+func (m MongoConfig) Configured() bool {
+	_, err := m.uri()
+	return err == nil
+}
+
+// Local reports whether the database is the in-memory one or every host of the URI is on this machine,
+// an Atlas cluster or a mongodb+srv URI is never local
+func (m MongoConfig) Local() bool {
+	if m.InMemory {
+		return true
+	}
+	if m.URI == "" || !strings.HasPrefix(m.URI, "mongodb://") {
+		return false
+	}
+	hosts := strings.TrimPrefix(m.URI, "mongodb://")
+	if i := strings.IndexAny(hosts, "/?"); i >= 0 {
+		hosts = hosts[:i]
+	}
+	if i := strings.LastIndex(hosts, "@"); i >= 0 {
+		hosts = hosts[i+1:]
+	}
+	for _, host := range strings.Split(hosts, ",") {
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		host = strings.Trim(host, "[]")
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m MongoConfig) clientOptions() (*options.ClientOptions, error) {
+	uri, err := m.uri()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Client().ApplyURI(uri).SetMonitor(otelmongo.NewMonitor())
+	if m.URI == "" {
+		// Atlas clusters are pinned to the stable api
+		opts.SetServerAPIOptions(options.ServerAPI(options.ServerAPIVersion1))
+	}
+	if m.MinPoolSize > 0 {
+		opts.SetMinPoolSize(m.MinPoolSize)
+	}
+	if m.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(m.MaxPoolSize)
+	}
+	if m.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(m.MaxConnIdleTime)
+	}
+	if m.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(m.ConnectTimeout)
+	}
+	if m.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(m.ServerSelectionTimeout)
+	}
+	if m.SocketTimeout > 0 {
+		opts.SetSocketTimeout(m.SocketTimeout)
+	}
+
+	if m.TLS.Enabled {
+		tlsConfig, err := m.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts, nil
+}
+
+func (t MongoTLSConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.InsecureSkipVerify, //nolint:gosec // opt-in for self signed development servers
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading MongoDB CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in MongoDB CA file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading MongoDB client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// function to connect and ping the primary, so a bad configuration fails at startup
+func connectMongo(ctx context.Context, config MongoConfig) (*mongo.Client, error) {
+	opts, err := config.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx) //nolint
+		return nil, fmt.Errorf("MongoDB ping error: %w", err)
+	}
+	if err := requireTransactions(ctx, client); err != nil {
+		client.Disconnect(ctx) //nolint
+		return nil, err
+	}
+	return client, nil
+}
+
+// function to check the server is a replica set member or a mongos, the account writes run in
+// transactions which a standalone mongod rejects
+func requireTransactions(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("MongoDB hello error: %w", err)
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return errors.New("MongoDB is a standalone server but transactions need a replica set, start mongod with --replSet and run rs.initiate(), see the Readme")
+	}
+	return nil
+}
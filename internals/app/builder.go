@@ -0,0 +1,69 @@
+package app
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/mailer"
+	"Jevan/commons/oidc"
+	"Jevan/configs"
+	"context"
+)
+
+// Builder creates the Container from the configuration, the database, the mailer and the OpenID Connect
+// clients are built from the configuration unless they are swapped, e.g. for an in-memory database in tests
+type Builder struct {
+	config      *configs.ApplicationConfig
+	dbClient    appdb.DatabaseClient
+	mailer      mailer.Mailer
+	oidcClients []oidc.Client
+}
+
+func NewBuilder(config *configs.ApplicationConfig) *Builder {
+	return &Builder{
+		config: config,
+	}
+}
+
+// function to use the given database instead of connecting to MongoDB
+func (b *Builder) WithDatabase(dbClient appdb.DatabaseClient) *Builder {
+	b.dbClient = dbClient
+	return b
+}
+
+// function to send mails through the given mailer instead of the SMTP server of the configuration
+func (b *Builder) WithMailer(mailer mailer.Mailer) *Builder {
+	b.mailer = mailer
+	return b
+}
+
+// function to use the given OpenID Connect clients instead of the providers of the configuration
+func (b *Builder) WithOidcClients(clients ...oidc.Client) *Builder {
+	b.oidcClients = clients
+	return b
+}
+
+// Build connects to the database, when none was given, and wires the services; the configuration
+// becomes configs.AppConfig as the middlewares read the JWT settings from it
+func (b *Builder) Build(ctx context.Context) (*Container, error) {
+	if b.dbClient == nil {
+		if err := configs.NewApplicationConfig(ctx, b.config); err != nil {
+			return nil, err
+		}
+	} else {
+		b.config.DbClient = b.dbClient
+		configs.AppConfig = b.config
+	}
+
+	if b.mailer == nil {
+		if b.config.Smtp.Configured() {
+			b.mailer = mailer.NewSMTPMailer(b.config.Smtp)
+		} else {
+			b.mailer = mailer.NewUnconfiguredMailer()
+		}
+	}
+	if b.oidcClients == nil {
+		for _, provider := range b.config.OidcProviders {
+			b.oidcClients = append(b.oidcClients, oidc.NewClient(provider, nil))
+		}
+	}
+	return newContainer(b.config, b.mailer, b.oidcClients), nil
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"Jevan/apis"
+	"Jevan/commons/appdb"
+	"Jevan/commons/mailer"
+	"Jevan/commons/oidc"
+	"Jevan/commons/scheduler"
+	"Jevan/configs"
+	"Jevan/internals/db"
+	"Jevan/internals/migrations"
+	"Jevan/internals/services"
+	"context"
+	"time"
+)
+
+// Container holds the components of the application, wired once by the Builder
+type Container struct {
+	Config   *configs.ApplicationConfig
+	DbClient appdb.DatabaseClient
+	Mailer   mailer.Mailer
+
+	CartDbService         db.CartDbService
+	OrderDbService        db.OrderDbService
+	ProductDbService      db.ProductDbService
+	UserDbService         db.UserDbService
+	LoginAttemptDbService db.LoginAttemptDbService
+	AccountDbService      db.AccountDbService
+	AuditDbService        db.AuditDbService
+
+	AuditService         services.AuditService
+	ProductService       services.ProductService
+	CartService          services.CartService
+	OrderService         services.OrderService
+	UserService          services.UserService
+	TwoFactorService     services.TwoFactorService
+	LoginThrottleService services.LoginThrottleService
+	AccountRepairService services.AccountRepairService
+	PurgeService         services.PurgeService
+	MetricsService       services.MetricsService
+	HealthService        services.HealthService
+
+	Migrations migrations.Runner
+
+	oidcClients []oidc.Client
+}
+
+func newContainer(config *configs.ApplicationConfig, mailer mailer.Mailer, oidcClients []oidc.Client) *Container {
+	c := &Container{
+		Config:      config,
+		DbClient:    config.DbClient,
+		Mailer:      mailer,
+		oidcClients: oidcClients,
+	}
+
+	c.CartDbService = db.NewCartDbService(c.DbClient)
+	c.OrderDbService = db.NewOrderDbService(c.DbClient)
+	c.ProductDbService = db.NewProductDbService(c.DbClient)
+	c.UserDbService = db.NewUserDbService(c.DbClient)
+	c.LoginAttemptDbService = db.NewLoginAttemptDbService(c.DbClient)
+	c.AccountDbService = db.NewAccountDbService(c.DbClient)
+	c.AuditDbService = db.NewAuditDbService(c.DbClient)
+
+	c.AuditService = services.NewAuditService(c.AuditDbService, c.DbClient)
+	c.ProductService = services.NewProductService(c.ProductDbService, c.AuditService)
+	c.CartService = services.NewCartService(c.CartDbService, c.UserDbService, c.ProductDbService, services.CartPolicy{
+		ItemTTL:         config.CartItemTTL,
+		MaxItemQuantity: config.CartMaxItemQty,
+	})
+	c.OrderService = services.NewOrderService(c.OrderDbService, c.ProductDbService, c.AuditService)
+	c.LoginThrottleService = services.NewLoginThrottleService(c.LoginAttemptDbService, services.LoginPolicy{
+		MaxAccountFailures: config.LoginMaxFailures,
+		MaxIPFailures:      config.LoginIPMaxFailures,
+		LockoutDuration:    config.LoginLockoutDuration,
+		BaseDelay:          config.LoginBaseDelay,
+		MaxDelay:           config.LoginLockoutDuration,
+		FailureWindow:      config.LoginFailureWindow,
+	})
+	c.UserService = services.NewUserService(c.UserDbService, c.AccountDbService, c.LoginThrottleService, c.AuditService, mailer, config.EmailVerifyURL)
+	c.TwoFactorService = services.NewTwoFactorService(c.UserDbService, c.LoginThrottleService, config.TotpIssuer)
+	c.AccountRepairService = services.NewAccountRepairService(c.AccountDbService)
+	c.PurgeService = services.NewPurgeService(c.ProductDbService, c.AccountDbService, config.DeletedRetention)
+	c.MetricsService = services.NewMetricsService(c.OrderDbService, c.CartDbService)
+	c.HealthService = services.NewHealthService(config.HealthCheckTimeout,
+		services.HealthCheck{Name: "mongodb", Check: c.DbClient.Ping},
+	)
+	c.Migrations = migrations.NewRunner(c.DbClient, migrations.All())
+	return c
+}
+
+// function to get every module of the api
+func (c *Container) Modules() []apis.Module {
+	return []apis.Module{
+		apis.NewOperationsModule(c.HealthService),
+		apis.NewUsersModule(c.UserService, c.TwoFactorService, c.oidcClients),
+		apis.NewProductsModule(c.ProductService),
+		apis.NewCartModule(c.CartService),
+		apis.NewOrdersModule(c.OrderService),
+		apis.NewAuditModule(c.AuditService),
+	}
+}
+
+// function to create the background jobs, they are started by the caller
+func (c *Container) Jobs() scheduler.Scheduler {
+	jobs := scheduler.NewScheduler()
+	jobs.Every("expire-abandoned-carts", c.Config.CartExpiryInterval, c.CartService.ExpireAbandonedCarts)
+	jobs.Every("refresh-business-metrics", c.Config.MetricsRefreshInterval, c.MetricsService.RefreshBusinessMetrics)
+	jobs.Every("purge-deleted-records", c.Config.PurgeInterval, c.PurgeService.PurgeDeleted)
+	return jobs
+}
+
+// how long closing the database connection may take, independent of what the shutdown of the server left
+const closeTimeout = 10 * time.Second
+
+// function to release the database connection
+func (c *Container) Close(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, closeTimeout)
+	defer cancel()
+	c.DbClient.Disconnect(ctx)
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"Jevan/apis"
+	_ "Jevan/apis/docs"
+	"Jevan/apis/middlewares"
+	"Jevan/commons/appmetrics"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	echoSwagger "github.com/swaggo/echo-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+)
+
+// Server creates the echo server with the middlewares and the routes of the given modules,
+// all of them when none are given, so a test can boot only the modules it exercises
+func (c *Container) Server(modules ...apis.Module) *echo.Echo {
+	if len(modules) == 0 {
+		modules = c.Modules()
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = middlewares.ErrorHandler
+	e.IPExtractor = ipExtractor(c.Config.TrustedProxies)
+
+	e.Use(otelecho.Middleware(c.Config.Tracing.ServiceName, otelecho.WithSkipper(func(c echo.Context) bool {
+		return strings.HasPrefix(c.Path(), "/healthz")
+	})))
+	e.Use(middlewares.Correlation())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		ExposeHeaders: []string{echo.HeaderXRequestID},
+	}))
+	e.Use(middlewares.RequestLogger())
+	e.Use(middlewares.Metrics())
+	e.Use(middleware.Recover())
+
+	// Swagger
+	e.GET("/swagger/*", echoSwagger.WrapHandler)
+
+	jwtMiddleware := middlewares.JWTMiddleware()
+	for _, module := range modules {
+		module.RegisterRoutes(e, jwtMiddleware)
+	}
+	return e
+}
+
+// MetricsServer creates the echo server of the Prometheus metrics, it listens on the internal metrics port
+// so the metrics are not exposed along with the api
+func (c *Container) MetricsServer() *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(middleware.Recover())
+	e.GET("/metrics", echo.WrapHandler(appmetrics.Handler()))
+	return e
+}
+
+// function to get the ip of the client, from X-Forwarded-For only when the request came through one of
+// the trusted proxies, so clients cannot pick the ip the login throttling counts their failures against
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	trust := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		if _, ipRange, err := net.ParseCIDR(proxy); err == nil {
+			trust = append(trust, echo.TrustIPRange(ipRange))
+		}
+	}
+	return echo.ExtractIPFromXFFHeader(trust...)
+}
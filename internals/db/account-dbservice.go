@@ -0,0 +1,412 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"Jevan/commons/apploggers"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrEmailAlreadyExists = apperrors.Conflict("EMAIL_ALREADY_EXISTS", "user already exists")
+	ErrAccountNotFound    = apperrors.NotFound("account")
+	ErrInvalidEmailToken  = apperrors.New(apperrors.KindValidation, "INVALID_EMAIL_TOKEN", "invalid or expired email verification token")
+)
+
+// AccountDbService writes the account aggregate, login credentials in `users` and profile in
+// `users-details` share one id and are always changed together in a transaction, along with
+// the cart owned by the user
+type AccountDbService interface {
+	CreateAccount(ctx context.Context, credentials *models.UserDetails, profile *models.User) (string, error)
+	UpdateProfile(ctx context.Context, userId string, profile *models.User, expectedVersion *int64) error
+	DeleteAccount(ctx context.Context, userId string, deletedBy string) error
+	RestoreAccount(ctx context.Context, userId string) error
+	PurgeDeletedAccounts(ctx context.Context, deletedBefore int64) (int64, error)
+	RequestEmailChange(ctx context.Context, userId, newEmail, tokenHash string, expiresAt int64) error
+	ConfirmEmailChange(ctx context.Context, tokenHash string, now int64) (string, error)
+
+	ListCredentials(ctx context.Context) ([]*models.UserDetails, error)
+	ListProfiles(ctx context.Context) ([]*models.User, error)
+	DeleteProfile(ctx context.Context, id primitive.ObjectID) error
+	SetProfileEmail(ctx context.Context, id primitive.ObjectID, email string) error
+}
+
+type accountDbService struct {
+	client      appdb.DatabaseClient
+	ucollection appdb.DatabaseCollection
+	dcollection appdb.DatabaseCollection
+	ccollection appdb.DatabaseCollection
+}
+
+func NewAccountDbService(dbclient appdb.DatabaseClient) AccountDbService {
+	return &accountDbService{
+		client:      dbclient,
+		ucollection: dbclient.Collection(configs.MONGO_USERS_COLLECTION),
+		dcollection: dbclient.Collection(configs.MONGO_USERDETAILS_COLLECTION),
+		ccollection: dbclient.Collection(configs.MONGO_CARTS_COLLECTION),
+	}
+}
+
+func (a *accountDbService) CreateAccount(ctx context.Context, credentials *models.UserDetails, profile *models.User) (string, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing CreateAccount, email: %s", credentials.Email)
+
+	id := primitive.NewObjectID()
+	err := a.client.WithTransaction(ctx, func(tctx context.Context) error {
+		if err := a.ensureEmailAvailable(tctx, credentials.Email, primitive.NilObjectID); err != nil {
+			return err
+		}
+		credentials.ID = id
+		if _, err := a.ucollection.InsertOne(tctx, credentials); err != nil {
+			return emailConflict(err)
+		}
+		profile.Id = id
+		profile.Email = credentials.Email
+		profile.Version = 1
+		if _, err := a.dcollection.InsertOne(tctx, profile); err != nil {
+			return err
+		}
+		return a.insertCart(tctx, profile)
+	})
+	if err != nil {
+		logger.Error("Failed to create account: ", err)
+		return "", err
+	}
+
+	logger.Infof("Executed CreateAccount, userId: %s", id.Hex())
+	return id.Hex(), nil
+}
+
+// updates the profile fields, names are kept in sync on the credentials as well; email is not
+// changed here, see RequestEmailChange. When expectedVersion is set the profile has to be at that version.
+func (a *accountDbService) UpdateProfile(ctx context.Context, userId string, profile *models.User, expectedVersion *int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing UpdateProfile, userId: %s", userId)
+
+	id, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return apperrors.InvalidID("user", userId)
+	}
+
+	err = a.client.WithTransaction(ctx, func(tctx context.Context) error {
+		names := bson.M{"firstName": profile.FirstName, "lastName": profile.LastName}
+		result, err := a.ucollection.UpdateOne(tctx, notDeleted(bson.M{"_id": id}), bson.M{"$set": names})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrAccountNotFound
+		}
+
+		update := bumpVersion(bson.M{"$set": bson.M{
+			"firstName": profile.FirstName,
+			"lastName":  profile.LastName,
+			"age":       profile.Age,
+			"isactive":  profile.IsActive,
+		}})
+		result, err = a.dcollection.UpdateOne(tctx, matchVersion(notDeleted(bson.M{"_id": id}), expectedVersion), update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return conflictOrNotFound(tctx, a.dcollection, notDeleted(bson.M{"_id": id}), ErrAccountNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed UpdateProfile, userId: %s", userId)
+	return nil
+}
+
+// soft deletes the credentials and the profile, the cart and the orders are kept. The email is free for
+// another account right away, see migration 5
+func (a *accountDbService) DeleteAccount(ctx context.Context, userId string, deletedBy string) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing DeleteAccount, userId: %s", userId)
+
+	id, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return apperrors.InvalidID("user", userId)
+	}
+
+	err = a.client.WithTransaction(ctx, func(tctx context.Context) error {
+		update := softDelete(deletedBy)
+		credentials, err := a.ucollection.UpdateOne(tctx, notDeleted(bson.M{"_id": id}), update)
+		if err != nil {
+			return emailConflict(err)
+		}
+		profiles, err := a.dcollection.UpdateOne(tctx, notDeleted(bson.M{"_id": id}), bumpVersion(update))
+		if err != nil {
+			return err
+		}
+		if credentials.MatchedCount == 0 && profiles.MatchedCount == 0 {
+			return ErrAccountNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed DeleteAccount, userId: %s", userId)
+	return nil
+}
+
+// brings back a soft deleted account, credentials and profile; ErrEmailAlreadyExists when another account
+// took its email in the meantime
+func (a *accountDbService) RestoreAccount(ctx context.Context, userId string) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing RestoreAccount, userId: %s", userId)
+
+	id, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return apperrors.InvalidID("user", userId)
+	}
+
+	err = a.client.WithTransaction(ctx, func(tctx context.Context) error {
+		credentials, err := a.ucollection.UpdateOne(tctx, onlyDeleted(bson.M{"_id": id}), restore())
+		if err != nil {
+			return emailConflict(err)
+		}
+		profiles, err := a.dcollection.UpdateOne(tctx, onlyDeleted(bson.M{"_id": id}), bumpVersion(restore()))
+		if err != nil {
+			return err
+		}
+		if credentials.MatchedCount == 0 && profiles.MatchedCount == 0 {
+			return ErrAccountNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed RestoreAccount, userId: %s", userId)
+	return nil
+}
+
+// hard deletes the accounts soft deleted before the given time with their carts, one transaction per
+// account; the orders are kept. Returns the number of accounts purged
+func (a *accountDbService) PurgeDeletedAccounts(ctx context.Context, deletedBefore int64) (int64, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing PurgeDeletedAccounts, deletedBefore: %d", deletedBefore)
+
+	filter := bson.M{"deletedAt": bson.M{"$lt": deletedBefore}}
+	var credentials []*models.UserDetails
+	if err := a.ucollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}), &credentials); err != nil {
+		logger.Error(err)
+		return 0, err
+	}
+	var profiles []*models.User
+	if err := a.dcollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}), &profiles); err != nil {
+		logger.Error(err)
+		return 0, err
+	}
+	ids := map[primitive.ObjectID]bool{}
+	for _, record := range credentials {
+		ids[record.ID] = true
+	}
+	for _, record := range profiles {
+		ids[record.Id] = true
+	}
+
+	var purged int64
+	for id := range ids {
+		err := a.client.WithTransaction(ctx, func(tctx context.Context) error {
+			if _, err := a.ucollection.DeleteOne(tctx, bson.M{"_id": id}); err != nil {
+				return err
+			}
+			_, err := a.deleteProfileAndCart(tctx, id)
+			return err
+		})
+		if err != nil {
+			logger.Error(err)
+			return purged, err
+		}
+		purged++
+	}
+
+	logger.Infof("Executed PurgeDeletedAccounts, purged: %d", purged)
+	return purged, nil
+}
+
+// stores the new email as pending, it only becomes the login email once confirmed
+func (a *accountDbService) RequestEmailChange(ctx context.Context, userId, newEmail, tokenHash string, expiresAt int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing RequestEmailChange, userId: %s", userId)
+
+	id, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return apperrors.InvalidID("user", userId)
+	}
+	if err := a.ensureEmailAvailable(ctx, newEmail, id); err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{
+		"pendingEmail":          newEmail,
+		"emailVerificationHash": tokenHash,
+		"emailVerificationExp":  expiresAt,
+	}}
+	result, err := a.ucollection.UpdateOne(ctx, notDeleted(bson.M{"_id": id}), update)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAccountNotFound
+	}
+
+	logger.Infof("Executed RequestEmailChange, userId: %s", userId)
+	return nil
+}
+
+// applies the pending email to credentials and profile, returns the user id
+func (a *accountDbService) ConfirmEmailChange(ctx context.Context, tokenHash string, now int64) (string, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing ConfirmEmailChange")
+
+	var userId string
+	err := a.client.WithTransaction(ctx, func(tctx context.Context) error {
+		var credentials models.UserDetails
+		filter := bson.M{"emailVerificationHash": tokenHash, "emailVerificationExp": bson.M{"$gt": now}}
+		if err := a.ucollection.FindOne(tctx, filter, &credentials); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return ErrInvalidEmailToken
+			}
+			return err
+		}
+		// the account was deleted after the change was requested
+		if credentials.DeletedAt != 0 {
+			return ErrAccountNotFound
+		}
+		if err := a.ensureEmailAvailable(tctx, credentials.PendingEmail, credentials.ID); err != nil {
+			return err
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"email": credentials.PendingEmail},
+			"$unset": bson.M{"pendingEmail": "", "emailVerificationHash": "", "emailVerificationExp": ""},
+		}
+		if _, err := a.ucollection.UpdateOne(tctx, notDeleted(bson.M{"_id": credentials.ID}), update); err != nil {
+			return emailConflict(err)
+		}
+		if _, err := a.dcollection.UpdateOne(tctx, notDeleted(bson.M{"_id": credentials.ID}), bumpVersion(bson.M{"$set": bson.M{"email": credentials.PendingEmail}})); err != nil {
+			return err
+		}
+		userId = credentials.ID.Hex()
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+		return "", err
+	}
+
+	logger.Infof("Executed ConfirmEmailChange, userId: %s", userId)
+	return userId, nil
+}
+
+// deletes the profile and the carts owned by the user, returns the number of profiles deleted
+func (a *accountDbService) deleteProfileAndCart(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	var existing models.User
+	cartFilter := bson.M{"userId": id.Hex()}
+	if err := a.dcollection.FindOne(ctx, bson.M{"_id": id}, &existing); err == nil {
+		if cartId, err := primitive.ObjectIDFromHex(existing.CartId); err == nil {
+			cartFilter = bson.M{"$or": []bson.M{{"_id": cartId}, {"userId": id.Hex()}}}
+		}
+	}
+
+	result, err := a.dcollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := a.ccollection.DeleteMany(ctx, cartFilter); err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// creates the empty cart referenced by the profile
+func (a *accountDbService) insertCart(ctx context.Context, profile *models.User) error {
+	cartId, err := primitive.ObjectIDFromHex(profile.CartId)
+	if err != nil {
+		return apperrors.InvalidID("cart", profile.CartId)
+	}
+	_, err = a.ccollection.InsertOne(ctx, &models.Cart{
+		ID:        cartId,
+		UserID:    profile.Id.Hex(),
+		Items:     []models.CartItem{},
+		UpdatedAt: time.Now().Unix(),
+		Version:   1,
+	})
+	return err
+}
+
+// returns ErrEmailAlreadyExists if another account which is not deleted uses the email for login. The
+// check gives a clear error up front, the unique index on users.email (migration 5) is what guarantees
+// it when two requests race, see emailConflict
+func (a *accountDbService) ensureEmailAvailable(ctx context.Context, email string, owner primitive.ObjectID) error {
+	var existing models.UserDetails
+	err := a.ucollection.FindOne(ctx, notDeleted(bson.M{"email": email}), &existing)
+	if err == nil {
+		if existing.ID == owner {
+			return nil
+		}
+		return ErrEmailAlreadyExists
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+// maps the duplicate key error of the unique index on users.email to ErrEmailAlreadyExists
+func emailConflict(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailAlreadyExists
+	}
+	return err
+}
+
+func (a *accountDbService) ListCredentials(ctx context.Context) ([]*models.UserDetails, error) {
+	var credentials []*models.UserDetails
+	if err := a.ucollection.Find(ctx, bson.M{}, &options.FindOptions{}, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (a *accountDbService) ListProfiles(ctx context.Context) ([]*models.User, error) {
+	var profiles []*models.User
+	if err := a.dcollection.Find(ctx, bson.M{}, &options.FindOptions{}, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (a *accountDbService) DeleteProfile(ctx context.Context, id primitive.ObjectID) error {
+	return a.client.WithTransaction(ctx, func(tctx context.Context) error {
+		_, err := a.deleteProfileAndCart(tctx, id)
+		return err
+	})
+}
+
+func (a *accountDbService) SetProfileEmail(ctx context.Context, id primitive.ObjectID, email string) error {
+	_, err := a.dcollection.UpdateOne(ctx, bson.M{"_id": id}, bumpVersion(bson.M{"$set": bson.M{"email": email}}))
+	return err
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apploggers"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditDbService only appends and reads, the audit log has no update or delete
+type AuditDbService interface {
+	SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error)
+}
+
+type auditDbService struct {
+	collection appdb.DatabaseCollection
+}
+
+func NewAuditDbService(client appdb.DatabaseClient) AuditDbService {
+	return &auditDbService{
+		collection: client.Collection(configs.MONGO_AUDIT_EVENTS_COLLECTION),
+	}
+}
+
+func (a *auditDbService) SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing SaveAuditEvent, action: %s, target: %s %s", event.Action, event.TargetType, event.TargetID)
+
+	if _, err := a.collection.InsertOne(ctx, event); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed SaveAuditEvent, action: %s", event.Action)
+	return nil
+}
+
+// lists the events matching the filter, the latest first
+func (a *auditDbService) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing GetAuditEvents, filter: %+v", *filter)
+
+	query := bson.M{}
+	for field, value := range map[string]string{
+		"actorId":    filter.ActorID,
+		"action":     filter.Action,
+		"targetType": filter.TargetType,
+		"targetId":   filter.TargetID,
+	} {
+		if value != "" {
+			query[field] = value
+		}
+	}
+	timestamp := bson.M{}
+	if filter.From > 0 {
+		timestamp["$gte"] = filter.From
+	}
+	if filter.To > 0 {
+		timestamp["$lte"] = filter.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		findOptions.SetLimit(int64(filter.Limit))
+	}
+	events := []*models.AuditEvent{}
+	if err := a.collection.Find(ctx, query, findOptions, &events); err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	logger.Infof("Executed GetAuditEvents, total fetched: %d", len(events))
+	return events, nil
+}
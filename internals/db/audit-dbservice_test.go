@@ -0,0 +1,60 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/internals/models"
+	"context"
+	"testing"
+)
+
+func TestAuditDbService(t *testing.T) {
+	ctx := context.Background()
+	service := NewAuditDbService(appdb.NewMemoryDatabaseClient("jevan"))
+
+	for _, event := range []*models.AuditEvent{
+		{Action: models.AuditUserRoleUpdated, ActorID: "admin-1", TargetType: "user", TargetID: "user-1", Timestamp: 100},
+		{Action: models.AuditProductPriceUpdated, ActorID: "admin-1", TargetType: "product", TargetID: "tea", Timestamp: 200,
+			Changes: []models.AuditChange{{Field: "price", Before: 10.0, After: 12.5}}},
+		{Action: models.AuditOrderForceUpdated, ActorID: "user-1", TargetType: "order", TargetID: "order-1", Timestamp: 300},
+		{Action: models.AuditProductPriceUpdated, ActorID: "admin-2", TargetType: "product", TargetID: "tea", Timestamp: 400},
+	} {
+		assertError(t, service.SaveAuditEvent(ctx, event), nil)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.AuditFilter
+		want   []int64 // timestamps, the latest first
+	}{
+		{"all", models.AuditFilter{}, []int64{400, 300, 200, 100}},
+		{"actor", models.AuditFilter{ActorID: "admin-1"}, []int64{200, 100}},
+		{"action", models.AuditFilter{Action: models.AuditProductPriceUpdated}, []int64{400, 200}},
+		{"target", models.AuditFilter{TargetType: "product", TargetID: "tea"}, []int64{400, 200}},
+		{"period", models.AuditFilter{From: 200, To: 300}, []int64{300, 200}},
+		{"limit", models.AuditFilter{Limit: 1}, []int64{400}},
+		{"no match", models.AuditFilter{TargetType: "order", TargetID: "tea"}, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := service.GetAuditEvents(ctx, &tt.filter)
+			assertError(t, err, nil)
+			got := []int64{}
+			for _, event := range events {
+				got = append(got, event.Timestamp)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("timestamps = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("timestamps = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	events, _ := service.GetAuditEvents(ctx, &models.AuditFilter{Action: models.AuditProductPriceUpdated, ActorID: "admin-1"})
+	if len(events) != 1 || events[0].ID.IsZero() || len(events[0].Changes) != 1 || events[0].Changes[0].After != 12.5 {
+		t.Errorf("events = %+v, want the price change with its id and diff", events)
+	}
+}
@@ -2,14 +2,22 @@ package db
 
 import (
 	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/configs"
 	"Jevan/internals/models"
 	"context"
-	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCartNotFound          = apperrors.NotFound("cart")
+	ErrCartItemNotFound      = apperrors.New(apperrors.KindNotFound, "CART_ITEM_NOT_FOUND", "item not found in cart")
+	ErrCartQuantityExhausted = apperrors.New(apperrors.KindValidation, "QUANTITY_LIMIT_REACHED", "quantity limit reached for item")
 )
 
 type cDbService struct {
@@ -18,8 +26,17 @@ type cDbService struct {
 
 type CartDbService interface {
 	GetCartById(ctx context.Context, cartId string) (*models.Cart, error)
-	SaveCart(ctx context.Context, cart *models.Cart) error
-	DeleteAllItemsFromCart(ctx context.Context, cartId string) error
+	GetCartByUserId(ctx context.Context, userId string) (*models.Cart, error)
+	CreateCart(ctx context.Context, cart *models.Cart) error
+	ReplaceItems(ctx context.Context, cartId string, items []models.CartItem, expectedVersion *int64) error
+	DeleteAllItemsFromCart(ctx context.Context, cartId string, expectedVersion *int64) error
+	ExpireAbandonedCarts(ctx context.Context, updatedBefore int64) (int64, error)
+	AddItem(ctx context.Context, cartId, itemId string, quantity, maxQuantity int, expectedVersion *int64) error
+	SetItemQuantity(ctx context.Context, cartId, itemId string, quantity int, expectedVersion *int64) error
+	RemoveItem(ctx context.Context, cartId, itemId string, expectedVersion *int64) error
+	SetTotalPrice(ctx context.Context, cartId string, totalPrice float64, version int64) error
+	CountActiveCarts(ctx context.Context) (int64, error)
+	GetAllCarts(ctx context.Context) ([]*models.Cart, error)
 }
 
 func NewCartDbService(dbclient appdb.DatabaseClient) CartDbService {
@@ -36,13 +53,13 @@ func (c *cDbService) GetCartById(ctx context.Context, cartId string) (*models.Ca
 	var cart models.Cart
 	cartObjId, oerror := primitive.ObjectIDFromHex(cartId)
 	if oerror != nil {
-		return nil, errors.New("error: invalid id provided")
+		return nil, apperrors.InvalidID("cart", cartId)
 	}
 	filter := bson.M{"_id": cartObjId}
 	dbError := c.ucollection.FindOne(ctx, filter, &cart)
 	if dbError != nil {
 		logger.Error(dbError)
-		return nil, dbError
+		return nil, wrapError(dbError, "cart")
 	}
 
 	logger.Infof("Executed GetCartById, cartId: %s", cartId)
@@ -50,62 +67,257 @@ func (c *cDbService) GetCartById(ctx context.Context, cartId string) (*models.Ca
 }
 
 // Delete all items from the cart
-func (c *cDbService) DeleteAllItemsFromCart(ctx context.Context, cartId string) error {
+func (c *cDbService) DeleteAllItemsFromCart(ctx context.Context, cartId string, expectedVersion *int64) error {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing DeleteAllItemsFromCart, cartId: %s", cartId)
 	cartObjId, oerror := primitive.ObjectIDFromHex(cartId)
 	if oerror != nil {
-		return errors.New("error: invalid id provided")
+		return apperrors.InvalidID("cart", cartId)
 	}
-	filter := bson.M{"_id": cartObjId}
-	update := bson.M{"$set": bson.M{"items": []models.CartItem{}, "totalprice": 0}}
+	filter := matchVersion(bson.M{"_id": cartObjId}, expectedVersion)
+	update := bumpVersion(bson.M{"$set": bson.M{"items": []models.CartItem{}, "totalprice": 0, "updatedAt": time.Now().Unix()}})
 
-	_, dbError := c.ucollection.UpdateOne(ctx, filter, update)
+	result, dbError := c.ucollection.UpdateOne(ctx, filter, update)
 	if dbError != nil {
 		logger.Error(dbError)
 		return dbError
 	}
+	if result.MatchedCount == 0 {
+		return conflictOrNotFound(ctx, c.ucollection, bson.M{"_id": cartObjId}, ErrCartNotFound)
+	}
 
 	logger.Infof("Executed DeleteAllItemsFromCart, cartId: %s", cartId)
 	return nil
 }
 
-func (c *cDbService) SaveCart(ctx context.Context, cart *models.Cart) error {
+func (c *cDbService) GetCartByUserId(ctx context.Context, userId string) (*models.Cart, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing GetCartByUserId, userId: %s", userId)
+
+	var cart models.Cart
+	dbError := c.ucollection.FindOne(ctx, bson.M{"userId": userId}, &cart)
+	if dbError != nil {
+		logger.Error(dbError)
+		return nil, wrapError(dbError, "cart")
+	}
+
+	logger.Infof("Executed GetCartByUserId, userId: %s", userId)
+	return &cart, nil
+}
+
+func (c *cDbService) CreateCart(ctx context.Context, cart *models.Cart) error {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing SaveCart")
-
-	if cart.ID.IsZero() {
-		logger.Error("Cart ID is required")
-		return errors.New("cart ID is required")
-	}
-
-	filter := bson.M{"_id": cart.ID}
-	var existing models.Cart
-
-	err := c.ucollection.FindOne(ctx, filter, &existing)
-	if err != nil {
-		if err.Error() == "mongo: no documents in result" {
-			// No document found, insert as new
-			_, insertErr := c.ucollection.InsertOne(ctx, cart)
-			if insertErr != nil {
-				logger.Error(insertErr)
-				return insertErr
-			}
-			logger.Infof("Inserted new cart with ID: %s", cart.ID.Hex())
+	logger.Infof("Executing CreateCart, userId: %s", cart.UserID)
+
+	if cart.Items == nil {
+		cart.Items = []models.CartItem{}
+	}
+	cart.Version = 1
+	_, dbError := c.ucollection.InsertOne(ctx, cart)
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+
+	logger.Infof("Executed CreateCart, cartId: %s", cart.ID.Hex())
+	return nil
+}
+
+// empties carts which were not updated since the given time, returns the number of carts emptied. Carts
+// stored before updatedAt was written have none, they are aged by the creation time in their id
+func (c *cDbService) ExpireAbandonedCarts(ctx context.Context, updatedBefore int64) (int64, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing ExpireAbandonedCarts, updatedBefore: %d", updatedBefore)
+
+	createdBefore := primitive.NewObjectIDFromTimestamp(time.Unix(updatedBefore, 0))
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"updatedAt": bson.M{"$lt": updatedBefore}},
+			bson.M{"updatedAt": bson.M{"$exists": false}, "_id": bson.M{"$lt": createdBefore}},
+		},
+		"items": bson.M{"$ne": []models.CartItem{}},
+	}
+	update := bumpVersion(bson.M{"$set": bson.M{"items": []models.CartItem{}, "totalprice": 0, "updatedAt": time.Now().Unix()}})
+	result, dbError := c.ucollection.UpdateMany(ctx, filter, update)
+	if dbError != nil {
+		logger.Error(dbError)
+		return 0, dbError
+	}
+
+	logger.Infof("Executed ExpireAbandonedCarts, expired: %d", result.ModifiedCount)
+	return result.ModifiedCount, nil
+}
+
+// overwrites the items of an existing cart; when expectedVersion is set the cart is only overwritten
+// at that version, and a missing cart is a version conflict as no version of it exists
+func (c *cDbService) ReplaceItems(ctx context.Context, cartId string, items []models.CartItem, expectedVersion *int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing ReplaceItems, cartId: %s, items: %d", cartId, len(items))
+
+	cartObjId, oerror := primitive.ObjectIDFromHex(cartId)
+	if oerror != nil {
+		return apperrors.InvalidID("cart", cartId)
+	}
+	filter := matchVersion(bson.M{"_id": cartObjId}, expectedVersion)
+	update := bumpVersion(bson.M{"$set": bson.M{"items": items, "updatedAt": time.Now().Unix()}})
+	result, dbError := c.ucollection.UpdateOne(ctx, filter, update)
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+	if result.MatchedCount == 0 {
+		notFound := ErrCartNotFound
+		if expectedVersion != nil {
+			notFound = ErrVersionConflict
+		}
+		return conflictOrNotFound(ctx, c.ucollection, bson.M{"_id": cartObjId}, notFound)
+	}
+
+	logger.Infof("Executed ReplaceItems, cartId: %s", cartId)
+	return nil
+}
+
+// increments the item quantity, or adds the item if not in the cart yet, without exceeding maxQuantity
+func (c *cDbService) AddItem(ctx context.Context, cartId, itemId string, quantity, maxQuantity int, expectedVersion *int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing AddItem, cartId: %s, itemId: %s, quantity: %d", cartId, itemId, quantity)
+
+	cartObjId, oerror := primitive.ObjectIDFromHex(cartId)
+	if oerror != nil {
+		return apperrors.InvalidID("cart", cartId)
+	}
+	now := time.Now().Unix()
+
+	// item already in the cart, increment only while the result stays within the limit
+	filter := matchVersion(bson.M{"_id": cartObjId, "items": bson.M{"$elemMatch": bson.M{"itemid": itemId, "quantity": bson.M{"$lte": maxQuantity - quantity}}}}, expectedVersion)
+	update := bumpVersion(bson.M{"$inc": bson.M{"items.$.quantity": quantity}, "$set": bson.M{"updatedAt": now}})
+	result, dbError := c.ucollection.UpdateOne(ctx, filter, update)
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+	if result.MatchedCount > 0 {
+		logger.Infof("Executed AddItem, incremented itemId: %s", itemId)
+		return nil
+	}
+
+	// item not in the cart yet
+	if quantity <= maxQuantity {
+		filter = matchVersion(bson.M{"_id": cartObjId, "items.itemid": bson.M{"$ne": itemId}}, expectedVersion)
+		update = bumpVersion(bson.M{"$push": bson.M{"items": models.CartItem{ItemID: itemId, Quantity: quantity}}, "$set": bson.M{"updatedAt": now}})
+		result, dbError = c.ucollection.UpdateOne(ctx, filter, update)
+		if dbError != nil {
+			logger.Error(dbError)
+			return dbError
+		}
+		if result.MatchedCount > 0 {
+			logger.Infof("Executed AddItem, added itemId: %s", itemId)
 			return nil
 		}
-		logger.Error(err)
-		return err
 	}
 
-	// Document exists, update it
-	update := bson.M{"$set": cart}
-	_, updateErr := c.ucollection.UpdateOne(ctx, filter, update)
-	if updateErr != nil {
-		logger.Error(updateErr)
-		return updateErr
+	count, dbError := c.ucollection.CountDocuments(ctx, matchVersion(bson.M{"_id": cartObjId}, expectedVersion))
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+	if count == 0 {
+		return conflictOrNotFound(ctx, c.ucollection, bson.M{"_id": cartObjId}, ErrCartNotFound)
+	}
+	return ErrCartQuantityExhausted
+}
+
+func (c *cDbService) SetItemQuantity(ctx context.Context, cartId, itemId string, quantity int, expectedVersion *int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing SetItemQuantity, cartId: %s, itemId: %s, quantity: %d", cartId, itemId, quantity)
+
+	cartObjId, oerror := primitive.ObjectIDFromHex(cartId)
+	if oerror != nil {
+		return apperrors.InvalidID("cart", cartId)
+	}
+	filter := matchVersion(bson.M{"_id": cartObjId, "items.itemid": itemId}, expectedVersion)
+	update := bumpVersion(bson.M{"$set": bson.M{"items.$.quantity": quantity, "updatedAt": time.Now().Unix()}})
+	result, dbError := c.ucollection.UpdateOne(ctx, filter, update)
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+	if result.MatchedCount == 0 {
+		return conflictOrNotFound(ctx, c.ucollection, bson.M{"_id": cartObjId, "items.itemid": itemId}, ErrCartItemNotFound)
+	}
+
+	logger.Infof("Executed SetItemQuantity, cartId: %s, itemId: %s", cartId, itemId)
+	return nil
+}
+
+func (c *cDbService) RemoveItem(ctx context.Context, cartId, itemId string, expectedVersion *int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing RemoveItem, cartId: %s, itemId: %s", cartId, itemId)
+
+	cartObjId, oerror := primitive.ObjectIDFromHex(cartId)
+	if oerror != nil {
+		return apperrors.InvalidID("cart", cartId)
+	}
+	filter := matchVersion(bson.M{"_id": cartObjId, "items.itemid": itemId}, expectedVersion)
+	update := bumpVersion(bson.M{"$pull": bson.M{"items": bson.M{"itemid": itemId}}, "$set": bson.M{"updatedAt": time.Now().Unix()}})
+	result, dbError := c.ucollection.UpdateOne(ctx, filter, update)
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+	if result.MatchedCount == 0 {
+		return conflictOrNotFound(ctx, c.ucollection, bson.M{"_id": cartObjId, "items.itemid": itemId}, ErrCartItemNotFound)
 	}
 
-	logger.Infof("Updated existing cart with ID: %s", cart.ID.Hex())
+	logger.Infof("Executed RemoveItem, cartId: %s, itemId: %s", cartId, itemId)
 	return nil
 }
+
+// stores the total computed from the cart at version, ErrVersionConflict when the cart changed since
+func (c *cDbService) SetTotalPrice(ctx context.Context, cartId string, totalPrice float64, version int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+
+	cartObjId, oerror := primitive.ObjectIDFromHex(cartId)
+	if oerror != nil {
+		return apperrors.InvalidID("cart", cartId)
+	}
+	filter := matchVersion(bson.M{"_id": cartObjId}, &version)
+	result, dbError := c.ucollection.UpdateOne(ctx, filter, bumpVersion(bson.M{"$set": bson.M{"totalprice": totalPrice}}))
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+	if result.MatchedCount == 0 {
+		return conflictOrNotFound(ctx, c.ucollection, bson.M{"_id": cartObjId}, ErrCartNotFound)
+	}
+	return nil
+}
+
+// counts the carts holding at least one item
+func (c *cDbService) CountActiveCarts(ctx context.Context) (int64, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing CountActiveCarts")
+
+	count, dbError := c.ucollection.CountDocuments(ctx, bson.M{"items.0": bson.M{"$exists": true}})
+	if dbError != nil {
+		logger.Error(dbError)
+		return 0, dbError
+	}
+
+	logger.Infof("Executed CountActiveCarts, count: %d", count)
+	return count, nil
+}
+
+func (c *cDbService) GetAllCarts(ctx context.Context) ([]*models.Cart, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing GetAllCarts")
+
+	var carts []*models.Cart
+	if dbError := c.ucollection.Find(ctx, bson.M{}, &options.FindOptions{}, &carts); dbError != nil {
+		logger.Error(dbError)
+		return nil, dbError
+	}
+
+	logger.Infof("Executed GetAllCarts, carts: %d", len(carts))
+	return carts, nil
+}
@@ -0,0 +1,240 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestCart(t *testing.T, service CartDbService, items ...models.CartItem) string {
+	t.Helper()
+	cart := &models.Cart{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID().Hex(), Items: items, UpdatedAt: time.Now().Unix()}
+	assertError(t, service.CreateCart(context.Background(), cart), nil)
+	return cart.ID.Hex()
+}
+
+func TestCartDbServiceAddItem(t *testing.T) {
+	tests := []struct {
+		name            string
+		items           []models.CartItem
+		itemId          string
+		quantity        int
+		expectedVersion *int64
+		wantErr         error
+		wantItems       []models.CartItem
+	}{
+		{"new item", nil, "tea", 2, nil, nil, []models.CartItem{{ItemID: "tea", Quantity: 2}}},
+		{"increments existing item", []models.CartItem{{ItemID: "tea", Quantity: 2}}, "tea", 3, nil, nil, []models.CartItem{{ItemID: "tea", Quantity: 5}}},
+		{"up to the limit", []models.CartItem{{ItemID: "tea", Quantity: 8}}, "tea", 2, nil, nil, []models.CartItem{{ItemID: "tea", Quantity: 10}}},
+		{"over the limit", []models.CartItem{{ItemID: "tea", Quantity: 9}}, "tea", 2, nil, ErrCartQuantityExhausted, []models.CartItem{{ItemID: "tea", Quantity: 9}}},
+		{"new item over the limit", nil, "tea", 11, nil, ErrCartQuantityExhausted, []models.CartItem{}},
+		{"keeps other items", []models.CartItem{{ItemID: "tea", Quantity: 1}}, "coffee", 1, nil, nil, []models.CartItem{{ItemID: "tea", Quantity: 1}, {ItemID: "coffee", Quantity: 1}}},
+		{"expected version", nil, "tea", 1, int64Ptr(1), nil, []models.CartItem{{ItemID: "tea", Quantity: 1}}},
+		{"stale version", nil, "tea", 1, int64Ptr(2), ErrVersionConflict, []models.CartItem{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			service := NewCartDbService(appdb.NewMemoryDatabaseClient("jevan"))
+			cartId := newTestCart(t, service, tt.items...)
+
+			err := service.AddItem(ctx, cartId, tt.itemId, tt.quantity, 10, tt.expectedVersion)
+			assertError(t, err, tt.wantErr)
+
+			cart, err := service.GetCartById(ctx, cartId)
+			assertError(t, err, nil)
+			assertItems(t, cart.Items, tt.wantItems)
+		})
+	}
+}
+
+func TestCartDbServiceItems(t *testing.T) {
+	items := []models.CartItem{{ItemID: "tea", Quantity: 2}, {ItemID: "coffee", Quantity: 1}}
+	missingCart := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name      string
+		change    func(ctx context.Context, service CartDbService, cartId string) error
+		wantErr   error
+		wantItems []models.CartItem
+	}{
+		{
+			name: "set quantity",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.SetItemQuantity(ctx, cartId, "coffee", 4, nil)
+			},
+			wantItems: []models.CartItem{{ItemID: "tea", Quantity: 2}, {ItemID: "coffee", Quantity: 4}},
+		},
+		{
+			name: "set quantity of missing item",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.SetItemQuantity(ctx, cartId, "juice", 4, nil)
+			},
+			wantErr:   ErrCartItemNotFound,
+			wantItems: items,
+		},
+		{
+			name: "set quantity at stale version",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.SetItemQuantity(ctx, cartId, "tea", 4, int64Ptr(7))
+			},
+			wantErr:   ErrVersionConflict,
+			wantItems: items,
+		},
+		{
+			name: "remove item",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.RemoveItem(ctx, cartId, "tea", int64Ptr(1))
+			},
+			wantItems: []models.CartItem{{ItemID: "coffee", Quantity: 1}},
+		},
+		{
+			name: "remove missing item",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.RemoveItem(ctx, cartId, "juice", nil)
+			},
+			wantErr:   ErrCartItemNotFound,
+			wantItems: items,
+		},
+		{
+			name: "delete all items",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.DeleteAllItemsFromCart(ctx, cartId, nil)
+			},
+			wantItems: []models.CartItem{},
+		},
+		{
+			name: "delete all items of missing cart",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.DeleteAllItemsFromCart(ctx, missingCart, nil)
+			},
+			wantErr:   ErrCartNotFound,
+			wantItems: items,
+		},
+		{
+			name: "replace items",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.ReplaceItems(ctx, cartId, []models.CartItem{{ItemID: "juice", Quantity: 3}}, int64Ptr(1))
+			},
+			wantItems: []models.CartItem{{ItemID: "juice", Quantity: 3}},
+		},
+		{
+			name: "replace items of missing cart at a version",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.ReplaceItems(ctx, missingCart, []models.CartItem{}, int64Ptr(1))
+			},
+			wantErr:   ErrVersionConflict,
+			wantItems: items,
+		},
+		{
+			name: "set total price",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.SetTotalPrice(ctx, cartId, 42, 1)
+			},
+			wantItems: items,
+		},
+		{
+			name: "set total price at stale version",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.SetTotalPrice(ctx, cartId, 42, 7)
+			},
+			wantErr:   ErrVersionConflict,
+			wantItems: items,
+		},
+		{
+			name: "invalid cart id",
+			change: func(ctx context.Context, service CartDbService, cartId string) error {
+				return service.RemoveItem(ctx, "cart", "tea", nil)
+			},
+			wantErr:   kind(apperrors.KindInvalidID),
+			wantItems: items,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			service := NewCartDbService(appdb.NewMemoryDatabaseClient("jevan"))
+			cartId := newTestCart(t, service, items...)
+
+			assertError(t, tt.change(ctx, service, cartId), tt.wantErr)
+
+			cart, err := service.GetCartById(ctx, cartId)
+			assertError(t, err, nil)
+			assertItems(t, cart.Items, tt.wantItems)
+			if tt.wantErr == nil && cart.Version != 2 {
+				t.Errorf("version = %d, want 2", cart.Version)
+			}
+		})
+	}
+}
+
+func TestCartDbServiceExpiry(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("jevan")
+	service := NewCartDbService(client)
+	now := time.Now().Unix()
+
+	carts := []*models.Cart{
+		{ID: primitive.NewObjectID(), UserID: "abandoned", Items: []models.CartItem{{ItemID: "tea", Quantity: 1}}, UpdatedAt: now - 7200},
+		{ID: primitive.NewObjectID(), UserID: "recent", Items: []models.CartItem{{ItemID: "tea", Quantity: 1}}, UpdatedAt: now},
+		{ID: primitive.NewObjectID(), UserID: "empty", Items: []models.CartItem{}, UpdatedAt: now - 7200},
+	}
+	for _, cart := range carts {
+		assertError(t, service.CreateCart(ctx, cart), nil)
+	}
+	// carts stored before updatedAt was written, created two hours ago and a minute ago
+	for userId, created := range map[string]int64{"legacy abandoned": now - 7200, "legacy recent": now - 60} {
+		legacy := bson.M{"_id": primitive.NewObjectIDFromTimestamp(time.Unix(created, 0)), "userId": userId, "items": bson.A{bson.M{"itemid": "tea", "quantity": 1}}}
+		if _, err := client.Collection(configs.MONGO_CARTS_COLLECTION).InsertOne(ctx, legacy); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+
+	active, err := service.CountActiveCarts(ctx)
+	assertError(t, err, nil)
+	if active != 4 {
+		t.Errorf("active carts = %d, want 4", active)
+	}
+
+	expired, err := service.ExpireAbandonedCarts(ctx, now-3600)
+	assertError(t, err, nil)
+	if expired != 2 {
+		t.Errorf("expired = %d, want 2", expired)
+	}
+
+	for _, userId := range []string{"abandoned", "legacy abandoned"} {
+		cart, err := service.GetCartByUserId(ctx, userId)
+		assertError(t, err, nil)
+		assertItems(t, cart.Items, []models.CartItem{})
+	}
+
+	active, err = service.CountActiveCarts(ctx)
+	assertError(t, err, nil)
+	if active != 2 {
+		t.Errorf("active carts after expiry = %d, want 2", active)
+	}
+
+	_, err = service.GetCartByUserId(ctx, "nobody")
+	assertError(t, err, kind(apperrors.KindNotFound))
+}
+
+func assertItems(t *testing.T, got, want []models.CartItem) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("items = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("items = %+v, want %+v", got, want)
+		}
+	}
+}
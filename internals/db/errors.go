@@ -0,0 +1,30 @@
+package db
+
+import (
+	"Jevan/commons/apperrors"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// wraps driver errors into domain errors: a missing document becomes a NotFound of the resource
+// and a duplicate key a Conflict, the driver error is kept as cause
+func wrapError(err error, resource string) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := apperrors.As(err); ok {
+		return err
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		notFound := apperrors.NotFound(resource)
+		notFound.Err = err
+		return notFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		conflict := apperrors.Conflict("", resource+" already exists")
+		conflict.Err = err
+		return conflict
+	}
+	return err
+}
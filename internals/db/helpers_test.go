@@ -0,0 +1,29 @@
+package db
+
+import (
+	"Jevan/commons/apperrors"
+	"errors"
+	"testing"
+)
+
+// kind matches any domain error of the kind with errors.Is
+func kind(k apperrors.Kind) error {
+	return &apperrors.Error{Kind: k}
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func assertError(t *testing.T, err error, want error) {
+	t.Helper()
+	if want == nil {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if !errors.Is(err, want) {
+		t.Fatalf("error = %v, want %v", err, want)
+	}
+}
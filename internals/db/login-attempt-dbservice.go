@@ -0,0 +1,136 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apploggers"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LoginAttemptDbService interface {
+	GetAttempt(ctx context.Context, kind, subject string) (*models.LoginAttempt, error)
+	RecordFailure(ctx context.Context, kind, subject string, failedAt, windowStart int64) (*models.LoginAttempt, error)
+	SetThrottle(ctx context.Context, kind, subject string, nextAttemptAt, lockedUntil int64) error
+	ResetAttempts(ctx context.Context, kind, subject string) error
+	GetLockedAccounts(ctx context.Context, now int64) ([]*models.LoginAttempt, error)
+}
+
+type loginAttemptDbService struct {
+	collection appdb.DatabaseCollection
+}
+
+func NewLoginAttemptDbService(dbclient appdb.DatabaseClient) LoginAttemptDbService {
+	return &loginAttemptDbService{
+		collection: dbclient.Collection(configs.MONGO_LOGIN_ATTEMPTS_COLLECTION),
+	}
+}
+
+func loginAttemptKey(kind, subject string) string {
+	return kind + ":" + subject
+}
+
+// returns nil without error, if there is no failure recorded for the subject
+func (l *loginAttemptDbService) GetAttempt(ctx context.Context, kind, subject string) (*models.LoginAttempt, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+
+	var attempt models.LoginAttempt
+	err := l.collection.FindOne(ctx, bson.M{"_id": loginAttemptKey(kind, subject)}, &attempt)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		logger.Error(err)
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// increments the failure counter for the subject, creating the record if needed; a counter whose first
+// failure is before windowStart starts over, unless the subject is locked out
+func (l *loginAttemptDbService) RecordFailure(ctx context.Context, kind, subject string, failedAt, windowStart int64) (*models.LoginAttempt, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing RecordFailure, kind: %s", kind)
+
+	key := loginAttemptKey(kind, subject)
+	// records from before the window was kept have no first failure, their last one is used instead
+	expired := bson.M{
+		"_id":         key,
+		"lockedUntil": bson.M{"$lt": failedAt},
+		"$or": bson.A{
+			bson.M{"firstFailureAt": bson.M{"$lt": windowStart}},
+			bson.M{"firstFailureAt": bson.M{"$exists": false}, "lastFailureAt": bson.M{"$lt": windowStart}},
+		},
+	}
+	if _, err := l.collection.DeleteOne(ctx, expired); err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	update := bson.M{
+		"$inc":         bson.M{"failures": 1},
+		"$set":         bson.M{"lastFailureAt": failedAt},
+		"$setOnInsert": bson.M{"kind": kind, "subject": subject, "firstFailureAt": failedAt, "nextAttemptAt": 0, "lockedUntil": 0},
+	}
+	_, err := l.collection.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	var attempt models.LoginAttempt
+	if err := l.collection.FindOne(ctx, bson.M{"_id": key}, &attempt); err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	logger.Infof("Executed RecordFailure, kind: %s, failures: %d", kind, attempt.Failures)
+	return &attempt, nil
+}
+
+func (l *loginAttemptDbService) SetThrottle(ctx context.Context, kind, subject string, nextAttemptAt, lockedUntil int64) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+
+	update := bson.M{"$set": bson.M{"nextAttemptAt": nextAttemptAt, "lockedUntil": lockedUntil}}
+	_, err := l.collection.UpdateOne(ctx, bson.M{"_id": loginAttemptKey(kind, subject)}, update)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (l *loginAttemptDbService) ResetAttempts(ctx context.Context, kind, subject string) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing ResetAttempts, kind: %s", kind)
+
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": loginAttemptKey(kind, subject)})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed ResetAttempts, kind: %s", kind)
+	return nil
+}
+
+func (l *loginAttemptDbService) GetLockedAccounts(ctx context.Context, now int64) ([]*models.LoginAttempt, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing GetLockedAccounts")
+
+	var attempts []*models.LoginAttempt
+	filter := bson.M{"kind": models.LoginAttemptKindAccount, "lockedUntil": bson.M{"$gt": now}}
+	err := l.collection.Find(ctx, filter, &options.FindOptions{}, &attempts)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	logger.Infof("Executed GetLockedAccounts, total: %d", len(attempts))
+	return attempts, nil
+}
@@ -2,21 +2,25 @@ package db
 
 import (
 	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/internals/models"
 	"context"
-	"fmt"
+	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrderDbService interface {
 	SaveOrder(ctx context.Context, order *models.Order) (string, error)
 	GetOrderById(ctx context.Context, orderId string) (*models.Order, error)
-	UpdateOrderStatus(ctx context.Context, orderId string, status *models.Order) error
+	UpdateOrderStatus(ctx context.Context, orderId string, status *models.Order, expectedVersion *int64) (*models.Order, error)
 	GetAllOrders(ctx context.Context) ([]*models.Order, error)
+	CountOrdersByStatus(ctx context.Context) (map[string]int64, error)
 }
 
 type orderDbService struct {
@@ -33,6 +37,7 @@ func (o *orderDbService) SaveOrder(ctx context.Context, order *models.Order) (st
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Info("Executing SaveOrder")
 
+	order.Version = 1
 	result, err := o.ucollection.InsertOne(ctx, order)
 	if err != nil {
 		logger.Error(err)
@@ -50,7 +55,7 @@ func (o *orderDbService) GetOrderById(ctx context.Context, orderId string) (*mod
 
 	id, err := primitive.ObjectIDFromHex(orderId)
 	if err != nil {
-		return nil, fmt.Errorf("invalid orderId: %s", orderId)
+		return nil, apperrors.InvalidID("order", orderId)
 	}
 
 	var order *models.Order
@@ -58,33 +63,39 @@ func (o *orderDbService) GetOrderById(ctx context.Context, orderId string) (*mod
 	err = o.ucollection.FindOne(ctx, filter, &order)
 	if err != nil {
 		logger.Error(err)
-		return nil, err
+		return nil, wrapError(err, "order")
 	}
 
 	logger.Infof("Executed GetOrderById, orderId: %s", orderId)
 	return order, nil
 }
 
-func (o *orderDbService) UpdateOrderStatus(ctx context.Context, orderId string, status *models.Order) error {
+// returns the order as it was before the change, when expectedVersion is set the status only changes
+// if the order is still at that version; the update time is the time of the write
+func (o *orderDbService) UpdateOrderStatus(ctx context.Context, orderId string, status *models.Order, expectedVersion *int64) (*models.Order, error) {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing UpdateOrderStatus, orderId: %s", orderId)
 
 	id, err := primitive.ObjectIDFromHex(orderId)
 	if err != nil {
-		return fmt.Errorf("invalid orderId: %s", orderId)
+		return nil, apperrors.InvalidID("order", orderId)
 	}
 
-	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{"status": status.Status, "updated_at": status.UpdatedAt}}
+	filter := matchVersion(bson.M{"_id": id}, expectedVersion)
+	update := bumpVersion(bson.M{"$set": bson.M{"status": status.Status, "updatedat": time.Now().Unix()}})
 
-	_, err = o.ucollection.UpdateOne(ctx, filter, update)
+	var before *models.Order
+	err = o.ucollection.FindOneAndUpdate(ctx, filter, update, &before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, conflictOrNotFound(ctx, o.ucollection, bson.M{"_id": id}, apperrors.NotFound("order"))
+	}
 	if err != nil {
 		logger.Error(err)
-		return err
+		return nil, err
 	}
 
 	logger.Infof("Executed UpdateOrderStatus, orderId: %s", orderId)
-	return nil
+	return before, nil
 }
 
 func (o *orderDbService) GetAllOrders(ctx context.Context) ([]*models.Order, error) {
@@ -103,3 +114,26 @@ func (o *orderDbService) GetAllOrders(ctx context.Context) ([]*models.Order, err
 	logger.Infof("Executed GetAllOrders, total fetched: %d", len(orders))
 	return orders, nil
 }
+
+// counts the orders per status
+func (o *orderDbService) CountOrdersByStatus(ctx context.Context) (map[string]int64, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing CountOrdersByStatus")
+
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	pipeline := bson.A{bson.M{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}}
+	if err := o.ucollection.Aggregate(ctx, pipeline, &groups); err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(groups))
+	for _, group := range groups {
+		counts[group.Status] = group.Count
+	}
+	logger.Infof("Executed CountOrdersByStatus, statuses: %d", len(counts))
+	return counts, nil
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"Jevan/internals/models"
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderDbService(t *testing.T) {
+	ctx := context.Background()
+	service := NewOrderDbService(appdb.NewMemoryDatabaseClient("jevan"))
+
+	var ids []string
+	for _, status := range []string{models.OrderStatusPlaced, models.OrderStatusPlaced, models.OrderStatusDelivered} {
+		id, err := service.SaveOrder(ctx, &models.Order{
+			UserID: "user-1",
+			Items:  []models.OrderItem{{ItemID: "tea", Quantity: 2}},
+			Status: status,
+		})
+		assertError(t, err, nil)
+		ids = append(ids, id)
+	}
+
+	t.Run("get", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			id         string
+			wantStatus string
+			wantErr    error
+		}{
+			{"existing", ids[2], models.OrderStatusDelivered, nil},
+			{"missing", primitive.NewObjectID().Hex(), "", kind(apperrors.KindNotFound)},
+			{"invalid id", "42", "", kind(apperrors.KindInvalidID)},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				order, err := service.GetOrderById(ctx, tt.id)
+				assertError(t, err, tt.wantErr)
+				if err == nil && (order.Status != tt.wantStatus || order.Version != 1 || len(order.Items) != 1) {
+					t.Errorf("order = %+v", order)
+				}
+			})
+		}
+	})
+
+	t.Run("update status", func(t *testing.T) {
+		tests := []struct {
+			name            string
+			id              string
+			status          string
+			expectedVersion *int64
+			wantErr         error
+			wantBefore      string
+		}{
+			{"expected version", ids[0], models.OrderStatusPreparing, int64Ptr(1), nil, models.OrderStatusPlaced},
+			{"stale version", ids[0], models.OrderStatusReady, int64Ptr(1), ErrVersionConflict, ""},
+			{"any version", ids[0], models.OrderStatusReady, nil, nil, models.OrderStatusPreparing},
+			{"missing", primitive.NewObjectID().Hex(), models.OrderStatusReady, nil, kind(apperrors.KindNotFound), ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				before, err := service.UpdateOrderStatus(ctx, tt.id, &models.Order{Status: tt.status}, tt.expectedVersion)
+				assertError(t, err, tt.wantErr)
+				if err != nil {
+					return
+				}
+				if before.Status != tt.wantBefore {
+					t.Errorf("before status = %s, want %s", before.Status, tt.wantBefore)
+				}
+				order, err := service.GetOrderById(ctx, tt.id)
+				assertError(t, err, nil)
+				if order.Status != tt.status || order.UpdatedAt == 0 {
+					t.Errorf("order = %+v, want status %s and the time of the update", order, tt.status)
+				}
+			})
+		}
+	})
+
+	t.Run("list and count", func(t *testing.T) {
+		orders, err := service.GetAllOrders(ctx)
+		assertError(t, err, nil)
+		if len(orders) != 3 {
+			t.Errorf("got %d orders, want 3", len(orders))
+		}
+
+		counts, err := service.CountOrdersByStatus(ctx)
+		assertError(t, err, nil)
+		want := map[string]int64{models.OrderStatusReady: 1, models.OrderStatusPlaced: 1, models.OrderStatusDelivered: 1}
+		for status, count := range want {
+			if counts[status] != count {
+				t.Errorf("counts = %v, want %v", counts, want)
+				break
+			}
+		}
+	})
+}
@@ -2,23 +2,28 @@ package db
 
 import (
 	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/configs"
 	"Jevan/internals/models"
 	"context"
-	"fmt"
+	"errors"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProductDbService interface {
 	CreateProduct(ctx context.Context, product *models.Product) (string, error)
-	GetAllProducts(ctx context.Context) ([]*models.Product, error)
-	UpdateProduct(ctx context.Context, product *models.Product, id string) error
-	GetProductById(ctx context.Context, id string) (*models.Product, error)
-	DeleteProductById(ctx context.Context, id string) error
+	GetAllProducts(ctx context.Context, includeDeleted bool) ([]*models.Product, error)
+	UpdateProduct(ctx context.Context, product *models.Product, id string, expectedVersion *int64) (*models.Product, error)
+	GetProductById(ctx context.Context, id string, includeDeleted bool) (*models.Product, error)
+	DeleteProductById(ctx context.Context, id string, deletedBy string) error
+	RestoreProductById(ctx context.Context, id string) error
+	PurgeDeletedProducts(ctx context.Context, deletedBefore int64) (int64, error)
+	GetProductsByIds(ctx context.Context, ids []string) ([]*models.Product, error)
 }
 
 type productDb struct {
@@ -33,12 +38,14 @@ func NewProductDbService(client appdb.DatabaseClient) ProductDbService {
 
 func (p *productDb) CreateProduct(ctx context.Context, product *models.Product) (string, error) {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Creating product: %v", product)
+	logger.Infof("Creating product, name: %s", product.Name)
 
+	product.Version = 1
+	product.DeletedAt, product.DeletedBy = 0, ""
 	result, err := p.collection.InsertOne(ctx, product)
 	if err != nil {
 		logger.Error("Failed to insert product: ", err)
-		return "", err
+		return "", wrapError(err, "product")
 	}
 
 	id := result.InsertedID.(primitive.ObjectID).Hex()
@@ -46,12 +53,17 @@ func (p *productDb) CreateProduct(ctx context.Context, product *models.Product)
 	return id, nil
 }
 
-func (p *productDb) GetAllProducts(ctx context.Context) ([]*models.Product, error) {
+// lists the products, the soft deleted ones only with includeDeleted
+func (p *productDb) GetAllProducts(ctx context.Context, includeDeleted bool) ([]*models.Product, error) {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Info("Fetching all products")
+	logger.Infof("Fetching all products, includeDeleted: %t", includeDeleted)
 
+	filter := bson.M{}
+	if !includeDeleted {
+		filter = notDeleted(filter)
+	}
 	var products []*models.Product
-	err := p.collection.Find(ctx, bson.M{}, &options.FindOptions{}, &products)
+	err := p.collection.Find(ctx, filter, &options.FindOptions{}, &products)
 	if err != nil {
 		logger.Error("Failed to fetch products: ", err)
 		return nil, err
@@ -61,63 +73,148 @@ func (p *productDb) GetAllProducts(ctx context.Context) ([]*models.Product, erro
 	return products, nil
 }
 
-func (p *productDb) UpdateProduct(ctx context.Context, product *models.Product, id string) error {
+// replaces the product and returns it as it was before the write, when expectedVersion is set the
+// write only applies at that version. A soft deleted product is not found, it has to be restored first
+func (p *productDb) UpdateProduct(ctx context.Context, product *models.Product, id string, expectedVersion *int64) (*models.Product, error) {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Updating product with ID: %s, %v", id, product)
+	logger.Infof("Updating product with ID: %s", id)
 
 	objId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		logger.Errorf("Invalid product ID: %s", id)
-		return fmt.Errorf("invalid id: %s", id)
+		return nil, apperrors.InvalidID("product", id)
 	}
 
-	_, err = p.collection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": product})
+	// the version is only ever incremented and the deletion only changed by delete and restore,
+	// never taken from the payload
+	product.Version = 0
+	product.DeletedAt, product.DeletedBy = 0, ""
+	filter := matchVersion(notDeleted(bson.M{"_id": objId}), expectedVersion)
+	var before *models.Product
+	err = p.collection.FindOneAndUpdate(ctx, filter, bumpVersion(bson.M{"$set": product}), &before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, conflictOrNotFound(ctx, p.collection, notDeleted(bson.M{"_id": objId}), apperrors.NotFound("product"))
+	}
 	if err != nil {
 		logger.Error("Failed to update product: ", err)
-		return err
+		return nil, err
 	}
 
 	logger.Infof("Successfully updated product with ID: %s", id)
-	return nil
+	return before, nil
 }
 
-func (p *productDb) GetProductById(ctx context.Context, id string) (*models.Product, error) {
+// gets the product, a soft deleted one only with includeDeleted
+func (p *productDb) GetProductById(ctx context.Context, id string, includeDeleted bool) (*models.Product, error) {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Fetching product by ID: %s", id)
 
 	objId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		logger.Errorf("Invalid product ID format: %s", id)
-		return nil, fmt.Errorf("invalid id: %s", id)
+		return nil, apperrors.InvalidID("product", id)
 	}
 
+	filter := bson.M{"_id": objId}
+	if !includeDeleted {
+		filter = notDeleted(filter)
+	}
 	var product *models.Product
-	err = p.collection.FindOne(ctx, bson.M{"_id": objId}, &product)
+	err = p.collection.FindOne(ctx, filter, &product)
 	if err != nil {
 		logger.Error("Failed to fetch product: ", err)
-		return nil, err
+		return nil, wrapError(err, "product")
 	}
 
-	logger.Infof("Fetched product: %+v", product)
+	logger.Debugf("Fetched product: %+v", product)
 	return product, nil
 }
 
-func (p *productDb) DeleteProductById(ctx context.Context, id string) error {
+// soft deletes the product, it stays readable by id for the orders referencing it until purged
+func (p *productDb) DeleteProductById(ctx context.Context, id string, deletedBy string) error {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Deleting product with ID: %s", id)
 
 	objId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		logger.Errorf("Invalid product ID: %s", id)
-		return fmt.Errorf("invalid id: %s", id)
+		return apperrors.InvalidID("product", id)
 	}
 
-	_, err = p.collection.DeleteOne(ctx, bson.M{"_id": objId})
+	result, err := p.collection.UpdateOne(ctx, notDeleted(bson.M{"_id": objId}), bumpVersion(softDelete(deletedBy)))
 	if err != nil {
 		logger.Error("Failed to delete product: ", err)
 		return err
 	}
+	if result.MatchedCount == 0 {
+		return apperrors.NotFound("product")
+	}
 
 	logger.Infof("Successfully deleted product with ID: %s", id)
 	return nil
 }
+
+// brings back a soft deleted product, NotFound when there is no deleted product with the id
+func (p *productDb) RestoreProductById(ctx context.Context, id string) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Restoring product with ID: %s", id)
+
+	objId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		logger.Errorf("Invalid product ID: %s", id)
+		return apperrors.InvalidID("product", id)
+	}
+
+	result, err := p.collection.UpdateOne(ctx, onlyDeleted(bson.M{"_id": objId}), bumpVersion(restore()))
+	if err != nil {
+		logger.Error("Failed to restore product: ", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.NotFound("product")
+	}
+
+	logger.Infof("Successfully restored product with ID: %s", id)
+	return nil
+}
+
+// hard deletes the products soft deleted before the given time, returns the number purged
+func (p *productDb) PurgeDeletedProducts(ctx context.Context, deletedBefore int64) (int64, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Purging products deleted before: %d", deletedBefore)
+
+	result, err := p.collection.DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		logger.Error("Failed to purge products: ", err)
+		return 0, err
+	}
+
+	logger.Infof("Purged %d products", result.DeletedCount)
+	return result.DeletedCount, nil
+}
+
+// gets the products which are not deleted, missing ids are left out
+func (p *productDb) GetProductsByIds(ctx context.Context, ids []string) ([]*models.Product, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Fetching products by IDs, count: %d", len(ids))
+
+	objIds := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			logger.Errorf("Invalid product ID format: %s", id)
+			return nil, apperrors.InvalidID("product", id)
+		}
+		objIds = append(objIds, objId)
+	}
+
+	var products []*models.Product
+	err := p.collection.Find(ctx, notDeleted(bson.M{"_id": bson.M{"$in": objIds}}), &options.FindOptions{}, &products)
+	if err != nil {
+		logger.Error("Failed to fetch products: ", err)
+		return nil, err
+	}
+
+	logger.Infof("Fetched %d products", len(products))
+	return products, nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"Jevan/internals/models"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProductDbService(t *testing.T) {
+	ctx := context.Background()
+	service := NewProductDbService(appdb.NewMemoryDatabaseClient("jevan"))
+
+	teaId, err := service.CreateProduct(ctx, &models.Product{Name: "Tea", Price: 10, IsAvailable: true})
+	assertError(t, err, nil)
+	coffeeId, err := service.CreateProduct(ctx, &models.Product{Name: "Coffee", Price: 25})
+	assertError(t, err, nil)
+	missingId := primitive.NewObjectID().Hex()
+
+	t.Run("get", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			id       string
+			wantName string
+			wantErr  error
+		}{
+			{"existing", teaId, "Tea", nil},
+			{"missing", missingId, "", kind(apperrors.KindNotFound)},
+			{"invalid id", "not-an-id", "", kind(apperrors.KindInvalidID)},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				product, err := service.GetProductById(ctx, tt.id, false)
+				assertError(t, err, tt.wantErr)
+				if err == nil && (product.Name != tt.wantName || product.Version != 1) {
+					t.Errorf("product = %+v", product)
+				}
+			})
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		products, err := service.GetAllProducts(ctx, false)
+		assertError(t, err, nil)
+		if len(products) != 2 {
+			t.Errorf("got %d products, want 2", len(products))
+		}
+
+		products, err = service.GetProductsByIds(ctx, []string{coffeeId, missingId})
+		assertError(t, err, nil)
+		if len(products) != 1 || products[0].Name != "Coffee" {
+			t.Errorf("GetProductsByIds = %+v", products)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		tests := []struct {
+			name            string
+			id              string
+			expectedVersion *int64
+			wantErr         error
+			wantVersion     int64
+		}{
+			{"any version", teaId, nil, nil, 2},
+			{"expected version", teaId, int64Ptr(2), nil, 3},
+			{"stale version", teaId, int64Ptr(2), ErrVersionConflict, 3},
+			{"missing", missingId, nil, kind(apperrors.KindNotFound), 0},
+			{"invalid id", "not-an-id", nil, kind(apperrors.KindInvalidID), 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				before, err := service.UpdateProduct(ctx, &models.Product{Name: "Green Tea", Price: 12, Version: 99}, tt.id, tt.expectedVersion)
+				assertError(t, err, tt.wantErr)
+				if tt.wantErr != nil {
+					return
+				}
+				if before.Version != tt.wantVersion-1 {
+					t.Errorf("before = %+v, want version %d", before, tt.wantVersion-1)
+				}
+				product, err := service.GetProductById(ctx, tt.id, false)
+				assertError(t, err, nil)
+				if product.Name != "Green Tea" || product.Version != tt.wantVersion {
+					t.Errorf("product = %+v, want version %d", product, tt.wantVersion)
+				}
+			})
+		}
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		assertError(t, service.DeleteProductById(ctx, coffeeId, "admin-1"), nil)
+		assertError(t, service.DeleteProductById(ctx, coffeeId, "admin-1"), kind(apperrors.KindNotFound))
+		_, err := service.GetProductById(ctx, coffeeId, false)
+		assertError(t, err, kind(apperrors.KindNotFound))
+		_, err = service.UpdateProduct(ctx, &models.Product{Name: "Coffee"}, coffeeId, nil)
+		assertError(t, err, kind(apperrors.KindNotFound))
+
+		// still there for the orders and the admins
+		product, err := service.GetProductById(ctx, coffeeId, true)
+		assertError(t, err, nil)
+		if product.DeletedAt == 0 || product.DeletedBy != "admin-1" {
+			t.Errorf("deleted product = %+v, want deletedAt and deletedBy", product)
+		}
+		if products, _ := service.GetAllProducts(ctx, false); len(products) != 1 {
+			t.Errorf("got %d products, want the deleted one left out", len(products))
+		}
+		if products, _ := service.GetAllProducts(ctx, true); len(products) != 2 {
+			t.Errorf("got %d products with includeDeleted, want 2", len(products))
+		}
+		if products, _ := service.GetProductsByIds(ctx, []string{coffeeId}); len(products) != 0 {
+			t.Errorf("GetProductsByIds = %+v, want the deleted product left out", products)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		assertError(t, service.RestoreProductById(ctx, coffeeId), nil)
+		assertError(t, service.RestoreProductById(ctx, coffeeId), kind(apperrors.KindNotFound))
+		assertError(t, service.RestoreProductById(ctx, missingId), kind(apperrors.KindNotFound))
+		product, err := service.GetProductById(ctx, coffeeId, false)
+		assertError(t, err, nil)
+		if product.DeletedAt != 0 || product.DeletedBy != "" {
+			t.Errorf("restored product = %+v", product)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		assertError(t, service.DeleteProductById(ctx, coffeeId, "admin-1"), nil)
+		purged, err := service.PurgeDeletedProducts(ctx, time.Now().Add(-time.Hour).Unix())
+		if err != nil || purged != 0 {
+			t.Errorf("purge within the retention = %d, %v, want 0", purged, err)
+		}
+		purged, err = service.PurgeDeletedProducts(ctx, time.Now().Add(time.Second).Unix())
+		if err != nil || purged != 1 {
+			t.Errorf("purge = %d, %v, want 1", purged, err)
+		}
+		_, err = service.GetProductById(ctx, coffeeId, true)
+		assertError(t, err, kind(apperrors.KindNotFound))
+		if _, err := service.GetProductById(ctx, teaId, false); err != nil {
+			t.Errorf("product which was not deleted: %v", err)
+		}
+	})
+}
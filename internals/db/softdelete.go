@@ -0,0 +1,30 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// restricts the filter to records which are not soft deleted, records deleted before soft deletes
+// existed are gone and never had the field
+func notDeleted(filter bson.M) bson.M {
+	filter["deletedAt"] = bson.M{"$exists": false}
+	return filter
+}
+
+// restricts the filter to soft deleted records
+func onlyDeleted(filter bson.M) bson.M {
+	filter["deletedAt"] = bson.M{"$exists": true}
+	return filter
+}
+
+// the update marking a record as deleted by the user
+func softDelete(deletedBy string) bson.M {
+	return bson.M{"$set": bson.M{"deletedAt": time.Now().Unix(), "deletedBy": deletedBy}}
+}
+
+// the update bringing a soft deleted record back
+func restore() bson.M {
+	return bson.M{"$unset": bson.M{"deletedAt": "", "deletedBy": ""}}
+}
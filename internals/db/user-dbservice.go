@@ -3,12 +3,11 @@ package db
 import (
 	"Jevan/commons"
 	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
 	"Jevan/configs"
 	"Jevan/internals/models"
 	"context"
-	"errors"
-	"fmt"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,14 +20,19 @@ type udbservice struct {
 }
 
 type UserDbService interface {
-	GetUserById(ctx context.Context, id string) (*models.User, error)
-	DeleteUserById(ctx context.Context, id string) error
-	GetUsers(ctx context.Context) ([]models.User, error)
-	CreateUserProfile(ctx context.Context, user *models.User) (string, error)
-	UpdateUser(ctx context.Context, user *models.User, userId string) error
-	RegisterUser(ctx context.Context, user *models.UserDetails) (string, error)
+	GetUserById(ctx context.Context, id string, includeDeleted bool) (*models.User, error)
+	GetUsers(ctx context.Context, includeDeleted bool) ([]models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.UserDetails, error)
+	GetUserDetailsById(ctx context.Context, userId string) (*models.UserDetails, error)
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*models.UserDetails, error)
+	LinkIdentity(ctx context.Context, userId string, identity models.ExternalIdentity) error
 	UpdateUserRole(ctx context.Context, userID string, newRole string) error
+	UpdatePassword(ctx context.Context, userId string, passwordHash string) error
+	SetTwoFactorPendingSecret(ctx context.Context, userId string, secret string) error
+	EnableTwoFactor(ctx context.Context, userId string, secret string, recoveryCodes []string, step int64) error
+	DisableTwoFactor(ctx context.Context, userId string) error
+	SetTwoFactorLastStep(ctx context.Context, userId string, step int64) (bool, error)
+	RemoveRecoveryCode(ctx context.Context, userId string, recoveryCode string) (bool, error)
 }
 
 func NewUserDbService(dbclient appdb.DatabaseClient) UserDbService {
@@ -38,50 +42,40 @@ func NewUserDbService(dbclient appdb.DatabaseClient) UserDbService {
 	}
 }
 
-func (u *udbservice) GetUserById(ctx context.Context, userId string) (*models.User, error) {
+// gets the profile, a soft deleted one only with includeDeleted
+func (u *udbservice) GetUserById(ctx context.Context, userId string, includeDeleted bool) (*models.User, error) {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing GetUserById, Id: %s", userId)
 	// get object id from userid string
 	id, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
-		return nil, fmt.Errorf("invalid userid provided, userId: %s", userId)
+		return nil, apperrors.InvalidID("user", userId)
 	}
 	var user *models.User
 	var filter = bson.M{"_id": id}
+	if !includeDeleted {
+		filter = notDeleted(filter)
+	}
 	dbError := u.dcollection.FindOne(ctx, filter, &user)
 	if dbError != nil {
 		logger.Error(dbError)
-		return nil, dbError
+		return nil, wrapError(dbError, "user")
 	}
 	logger.Infof("Executed GetUserById, user: %s", commons.PrintStruct(user))
 	return user, nil
 }
 
-func (u *udbservice) DeleteUserById(ctx context.Context, userId string) error {
-	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing DeleteUserById, Id: %s", userId)
-	// get object id from userid string
-	id, err := primitive.ObjectIDFromHex(userId)
-	if err != nil {
-		return fmt.Errorf("cannot delete user, invalid userid provided, userId: %s", userId)
-	}
-	var filter = bson.M{"_id": id}
-	_, dbError := u.dcollection.DeleteOne(ctx, filter)
-	if dbError != nil {
-		logger.Error(dbError)
-		return dbError
-	}
-	logger.Infof("Executed DeleteUserById, Id: %s", userId)
-	return nil
-}
-
-func (u *udbservice) GetUsers(ctx context.Context) ([]models.User, error) {
+// lists the profiles, the soft deleted ones only with includeDeleted
+func (u *udbservice) GetUsers(ctx context.Context, includeDeleted bool) ([]models.User, error) {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing GetUsers")
+	logger.Infof("Executing GetUsers, includeDeleted: %t", includeDeleted)
 
 	// create users payload to find data from db
 	var users []models.User
-	var filter = map[string]interface{}{}
+	var filter = bson.M{}
+	if !includeDeleted {
+		filter = notDeleted(filter)
+	}
 	dbError := u.dcollection.Find(ctx, filter, &options.FindOptions{}, &users)
 	if dbError != nil {
 		logger.Error(dbError)
@@ -91,83 +85,152 @@ func (u *udbservice) GetUsers(ctx context.Context) ([]models.User, error) {
 	return users, nil
 }
 
-func (u *udbservice) CreateUserProfile(ctx context.Context, user *models.User) (string, error) {
-	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing SaveUser...")
+func (u *udbservice) GetUserByEmail(ctx context.Context, email string) (*models.UserDetails, error) {
+	var user models.UserDetails
+	err := u.ucollection.FindOne(ctx, notDeleted(bson.M{"email": email}), &user)
+	if err != nil {
+		return nil, wrapError(err, "user")
+	}
+	return &user, nil
+}
 
-	// insert user in db
-	result, dbError := u.dcollection.InsertOne(ctx, user)
-	if dbError != nil {
-		logger.Error(dbError)
-		return "", dbError
+func (u *udbservice) GetUserDetailsById(ctx context.Context, userId string) (*models.UserDetails, error) {
+	id, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, apperrors.InvalidID("user", userId)
 	}
+	var user models.UserDetails
+	err = u.ucollection.FindOne(ctx, notDeleted(bson.M{"_id": id}), &user)
+	if err != nil {
+		return nil, wrapError(err, "user")
+	}
+	return &user, nil
+}
 
-	// Extract the inserted ID from the result
-	id := result.InsertedID.(primitive.ObjectID).Hex()
-	logger.Infof("Executed SaveUser, userid: %s", commons.PrintStruct(user))
-	return id, nil
+func (u *udbservice) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.UserDetails, error) {
+	var user models.UserDetails
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+	err := u.ucollection.FindOne(ctx, notDeleted(filter), &user)
+	if err != nil {
+		return nil, wrapError(err, "user")
+	}
+	return &user, nil
 }
 
-func (u *udbservice) UpdateUser(ctx context.Context, user *models.User, userId string) error {
+func (u *udbservice) LinkIdentity(ctx context.Context, userId string, identity models.ExternalIdentity) error {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing UpdateUser...")
-	// get object id from userid string
-	id, err := primitive.ObjectIDFromHex(userId)
+	logger.Infof("Linking %s identity to user: %s", identity.Provider, userId)
+	return u.updateUserDetails(ctx, userId, bson.M{"$push": bson.M{"identities": identity}})
+}
+
+func (u *udbservice) UpdateUserRole(ctx context.Context, userID string, newRole string) error {
+	objId, err := primitive.ObjectIDFromHex(userID)
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Updating user role for ID: %s to %s", userID, newRole)
 	if err != nil {
-		return fmt.Errorf("cannot delete user, invalid userid provided, userId: %s", userId)
-	}
-	var filter = bson.M{"_id": id}
-	update := bson.M{"$set": user} // Correct update document
-	// update user in db
-	_, dbError := u.dcollection.UpdateOne(ctx, filter, update)
-	if dbError != nil {
-		logger.Error(dbError)
-		return dbError
+		return apperrors.InvalidID("user", userID)
 	}
 
-	logger.Infof("Executed UpdateUser, userid: %s", commons.PrintStruct(user))
+	update := bson.M{"$set": bson.M{"role": newRole}}
+	result, err := u.ucollection.UpdateOne(ctx, notDeleted(bson.M{"_id": objId}), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.NotFound("user")
+	}
 	return nil
 }
 
-func (u *udbservice) RegisterUser(ctx context.Context, user *models.UserDetails) (string, error) {
+// replaces the login password, passwordHash is the bcrypt hash
+func (u *udbservice) UpdatePassword(ctx context.Context, userId string, passwordHash string) error {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Creating user: %s", user.Email)
+	logger.Infof("Executing UpdatePassword, userId: %s", userId)
+	return u.updateUserDetails(ctx, userId, bson.M{"$set": bson.M{"password": passwordHash}})
+}
+
+func (u *udbservice) SetTwoFactorPendingSecret(ctx context.Context, userId string, secret string) error {
+	return u.updateUserDetails(ctx, userId, bson.M{"$set": bson.M{"twoFactorPendingSecret": secret}})
+}
 
-	// check if user exists
-	var existing models.UserDetails
-	err := u.ucollection.FindOne(ctx, bson.M{"email": user.Email}, &existing)
-	if err == nil {
-		return "", errors.New("user already exists")
+func (u *udbservice) EnableTwoFactor(ctx context.Context, userId string, secret string, recoveryCodes []string, step int64) error {
+	update := bson.M{
+		"$set": bson.M{
+			"twoFactorEnabled":  true,
+			"twoFactorSecret":   secret,
+			"twoFactorLastStep": step,
+			"recoveryCodes":     recoveryCodes,
+		},
+		"$unset": bson.M{"twoFactorPendingSecret": ""},
 	}
+	return u.updateUserDetails(ctx, userId, update)
+}
 
-	result, err := u.ucollection.InsertOne(ctx, user)
-	if err != nil {
-		logger.Error("Failed to create user: ", err)
-		return "", err
+func (u *udbservice) DisableTwoFactor(ctx context.Context, userId string) error {
+	update := bson.M{
+		"$set":   bson.M{"twoFactorEnabled": false},
+		"$unset": bson.M{"twoFactorSecret": "", "twoFactorPendingSecret": "", "twoFactorLastStep": "", "recoveryCodes": ""},
 	}
-	userId := result.InsertedID.(primitive.ObjectID).Hex()
-	logger.Infof("User created successfully with ID: %s", userId)
-	return userId, nil
+	return u.updateUserDetails(ctx, userId, update)
 }
 
-func (u *udbservice) GetUserByEmail(ctx context.Context, email string) (*models.UserDetails, error) {
-	var user models.UserDetails
-	err := u.ucollection.FindOne(ctx, bson.M{"email": email}, &user)
+// records the totp step as used, false when it is not later than the last used one, e.g. when a
+// concurrent login used the same code first
+func (u *udbservice) SetTwoFactorLastStep(ctx context.Context, userId string, step int64) (bool, error) {
+	unused := bson.M{"$or": bson.A{
+		bson.M{"twoFactorLastStep": bson.M{"$lt": step}},
+		bson.M{"twoFactorLastStep": bson.M{"$exists": false}},
+	}}
+	return u.updateUserDetailsIf(ctx, userId, unused, bson.M{"$set": bson.M{"twoFactorLastStep": step}})
+}
+
+// consumes the recovery code, false when it was already consumed
+func (u *udbservice) RemoveRecoveryCode(ctx context.Context, userId string, recoveryCode string) (bool, error) {
+	return u.updateUserDetailsIf(ctx, userId, bson.M{"recoveryCodes": recoveryCode}, bson.M{"$pull": bson.M{"recoveryCodes": recoveryCode}})
+}
+
+// function to apply an update to the login credentials of the user when they match the condition,
+// returns whether they were modified; a deleted account is not found
+func (u *udbservice) updateUserDetailsIf(ctx context.Context, userId string, condition bson.M, update bson.M) (bool, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	id, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
-		return nil, err
+		return false, apperrors.InvalidID("user", userId)
 	}
-	return &user, nil
+
+	condition["_id"] = id
+	result, dbError := u.ucollection.UpdateOne(ctx, notDeleted(condition), update)
+	if dbError != nil {
+		logger.Error(dbError)
+		return false, dbError
+	}
+	if result.MatchedCount == 0 {
+		count, err := u.ucollection.CountDocuments(ctx, notDeleted(bson.M{"_id": id}))
+		if err != nil {
+			return false, err
+		}
+		if count == 0 {
+			return false, apperrors.NotFound("user")
+		}
+	}
+	return result.ModifiedCount > 0, nil
 }
 
-func (u *udbservice) UpdateUserRole(ctx context.Context, userID string, newRole string) error {
-	objId, err := primitive.ObjectIDFromHex(userID)
+// function to apply an update to the login credentials of the user, a deleted account is not found
+func (u *udbservice) updateUserDetails(ctx context.Context, userId string, update bson.M) error {
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Updating user role for ID: %s to %s", userID, newRole)
+	id, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
-		return err
+		return apperrors.InvalidID("user", userId)
 	}
 
-	update := bson.M{"$set": bson.M{"role": newRole}}
-	_, err = u.ucollection.UpdateOne(ctx, bson.M{"_id": objId}, update)
-	return err
+	result, dbError := u.ucollection.UpdateOne(ctx, notDeleted(bson.M{"_id": id}), update)
+	if dbError != nil {
+		logger.Error(dbError)
+		return dbError
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.NotFound("user")
+	}
+	return nil
 }
@@ -0,0 +1,329 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"Jevan/configs"
+	"Jevan/internals/migrations"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestAccount(t *testing.T, accounts AccountDbService, email string) string {
+	t.Helper()
+	id, err := accounts.CreateAccount(context.Background(),
+		&models.UserDetails{FirstName: "Asha", LastName: "Rao", Email: email, Password: "hash", Role: "user"},
+		&models.User{FirstName: "Asha", LastName: "Rao", CartId: primitive.NewObjectID().Hex(), IsActive: true},
+	)
+	assertError(t, err, nil)
+	return id
+}
+
+func TestAccountDbServiceCreate(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("jevan")
+	accounts := NewAccountDbService(client)
+	users := NewUserDbService(client)
+	carts := NewCartDbService(client)
+
+	id := newTestAccount(t, accounts, "asha@example.com")
+
+	credentials, err := users.GetUserByEmail(ctx, "asha@example.com")
+	assertError(t, err, nil)
+	profile, err := users.GetUserById(ctx, id, false)
+	assertError(t, err, nil)
+	if credentials.ID.Hex() != id || profile.Email != "asha@example.com" || profile.Version != 1 {
+		t.Errorf("credentials = %+v, profile = %+v", credentials, profile)
+	}
+	if _, err := carts.GetCartById(ctx, profile.CartId); err != nil {
+		t.Errorf("cart of the new account: %v", err)
+	}
+
+	_, err = accounts.CreateAccount(ctx,
+		&models.UserDetails{Email: "asha@example.com", Password: "hash"},
+		&models.User{CartId: primitive.NewObjectID().Hex()},
+	)
+	assertError(t, err, ErrEmailAlreadyExists)
+
+	profiles, err := users.GetUsers(ctx, false)
+	assertError(t, err, nil)
+	if len(profiles) != 1 {
+		t.Errorf("got %d profiles after the duplicate, want 1", len(profiles))
+	}
+	if count, _ := client.Collection(configs.MONGO_CARTS_COLLECTION).CountDocuments(ctx, map[string]interface{}{}); count != 1 {
+		t.Errorf("got %d carts after the duplicate, want 1, the transaction should roll back", count)
+	}
+}
+
+func TestAccountDbServiceProfileAndEmail(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("jevan")
+	accounts := NewAccountDbService(client)
+	users := NewUserDbService(client)
+
+	id := newTestAccount(t, accounts, "asha@example.com")
+	newTestAccount(t, accounts, "ravi@example.com")
+
+	tests := []struct {
+		name            string
+		expectedVersion *int64
+		wantErr         error
+	}{
+		{"expected version", int64Ptr(1), nil},
+		{"stale version", int64Ptr(1), ErrVersionConflict},
+		{"any version", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run("update profile/"+tt.name, func(t *testing.T) {
+			err := accounts.UpdateProfile(ctx, id, &models.User{FirstName: "Asha", LastName: "Iyer", Age: 30}, tt.expectedVersion)
+			assertError(t, err, tt.wantErr)
+		})
+	}
+	profile, err := users.GetUserById(ctx, id, false)
+	assertError(t, err, nil)
+	if profile.LastName != "Iyer" || profile.Version != 3 {
+		t.Errorf("profile = %+v, want last name Iyer at version 3", profile)
+	}
+
+	now := time.Now().Unix()
+	assertError(t, accounts.RequestEmailChange(ctx, id, "ravi@example.com", "hash", now+60), ErrEmailAlreadyExists)
+	assertError(t, accounts.RequestEmailChange(ctx, id, "asha.iyer@example.com", "hash", now+60), nil)
+
+	_, err = accounts.ConfirmEmailChange(ctx, "other", now)
+	assertError(t, err, ErrInvalidEmailToken)
+	_, err = accounts.ConfirmEmailChange(ctx, "hash", now+120)
+	assertError(t, err, ErrInvalidEmailToken)
+
+	userId, err := accounts.ConfirmEmailChange(ctx, "hash", now)
+	assertError(t, err, nil)
+	if userId != id {
+		t.Errorf("confirmed user = %s, want %s", userId, id)
+	}
+	credentials, err := users.GetUserByEmail(ctx, "asha.iyer@example.com")
+	assertError(t, err, nil)
+	if credentials.PendingEmail != "" || credentials.EmailVerificationHash != "" {
+		t.Errorf("pending email change not cleared: %+v", credentials)
+	}
+	profile, err = users.GetUserById(ctx, id, false)
+	assertError(t, err, nil)
+	if profile.Email != "asha.iyer@example.com" {
+		t.Errorf("profile email = %s", profile.Email)
+	}
+
+}
+
+func TestAccountDbServiceSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("jevan")
+	if _, err := migrations.NewRunner(client, migrations.All()).Up(ctx); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	accounts := NewAccountDbService(client)
+	users := NewUserDbService(client)
+	carts := NewCartDbService(client)
+
+	id := newTestAccount(t, accounts, "asha@example.com")
+	keptId := newTestAccount(t, accounts, "ravi@example.com")
+	profile, err := users.GetUserById(ctx, id, false)
+	assertError(t, err, nil)
+	now := time.Now().Unix()
+	assertError(t, accounts.RequestEmailChange(ctx, id, "asha.iyer@example.com", "hash", now+60), nil)
+
+	assertError(t, accounts.DeleteAccount(ctx, id, "admin-1"), nil)
+	assertError(t, accounts.DeleteAccount(ctx, id, "admin-1"), ErrAccountNotFound)
+	// a deleted account takes no writes
+	assertError(t, users.UpdateUserRole(ctx, id, "admin"), kind(apperrors.KindNotFound))
+	assertError(t, users.UpdatePassword(ctx, id, "other-hash"), kind(apperrors.KindNotFound))
+	_, err = users.RemoveRecoveryCode(ctx, id, "code")
+	assertError(t, err, kind(apperrors.KindNotFound))
+	assertError(t, accounts.RequestEmailChange(ctx, id, "asha.rao@example.com", "other", now+60), ErrAccountNotFound)
+	_, err = accounts.ConfirmEmailChange(ctx, "hash", now)
+	assertError(t, err, ErrAccountNotFound)
+	_, err = users.GetUserById(ctx, id, false)
+	assertError(t, err, kind(apperrors.KindNotFound))
+	_, err = users.GetUserByEmail(ctx, "asha@example.com")
+	assertError(t, err, kind(apperrors.KindNotFound))
+	assertError(t, accounts.UpdateProfile(ctx, id, &models.User{FirstName: "Asha", LastName: "Iyer"}, nil), ErrAccountNotFound)
+	if profiles, _ := users.GetUsers(ctx, false); len(profiles) != 1 {
+		t.Errorf("got %d profiles, want the deleted one left out", len(profiles))
+	}
+
+	deleted, err := users.GetUserById(ctx, id, true)
+	assertError(t, err, nil)
+	if deleted.DeletedAt == 0 || deleted.DeletedBy != "admin-1" || deleted.Version != 2 {
+		t.Errorf("deleted profile = %+v", deleted)
+	}
+	assertError(t, accounts.RestoreAccount(ctx, id), nil)
+	assertError(t, accounts.RestoreAccount(ctx, id), ErrAccountNotFound)
+	if _, err := users.GetUserByEmail(ctx, "asha@example.com"); err != nil {
+		t.Errorf("restored account can't be found by email: %v", err)
+	}
+
+	assertError(t, accounts.DeleteAccount(ctx, id, id), nil)
+	// the email is free again, the deleted account can't be restored while another account uses it
+	otherId := newTestAccount(t, accounts, "asha@example.com")
+	assertError(t, accounts.RestoreAccount(ctx, id), ErrEmailAlreadyExists)
+
+	purged, err := accounts.PurgeDeletedAccounts(ctx, time.Now().Add(-time.Hour).Unix())
+	if err != nil || purged != 0 {
+		t.Errorf("purge within the retention = %d, %v, want 0", purged, err)
+	}
+	purged, err = accounts.PurgeDeletedAccounts(ctx, time.Now().Add(time.Second).Unix())
+	if err != nil || purged != 1 {
+		t.Errorf("purge = %d, %v, want 1", purged, err)
+	}
+	_, err = users.GetUserById(ctx, id, true)
+	assertError(t, err, kind(apperrors.KindNotFound))
+	_, err = carts.GetCartById(ctx, profile.CartId)
+	assertError(t, err, kind(apperrors.KindNotFound))
+	for _, kept := range []string{keptId, otherId} {
+		if _, err := users.GetUserById(ctx, kept, false); err != nil {
+			t.Errorf("account which was not deleted: %v", err)
+		}
+	}
+}
+
+func TestUserDbServiceCredentials(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("jevan")
+	users := NewUserDbService(client)
+	id := newTestAccount(t, NewAccountDbService(client), "asha@example.com")
+	missingId := primitive.NewObjectID().Hex()
+	// the two-factor writes report whether the code was unused, an already used one is an error here
+	errAlreadyUsed := errors.New("already used")
+	marked := func(ok bool, err error) error {
+		if err == nil && !ok {
+			return errAlreadyUsed
+		}
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		change  func() error
+		wantErr error
+		check   func(t *testing.T, user *models.UserDetails)
+	}{
+		{
+			name:   "update role",
+			change: func() error { return users.UpdateUserRole(ctx, id, "admin") },
+			check: func(t *testing.T, user *models.UserDetails) {
+				if user.Role != "admin" {
+					t.Errorf("role = %s", user.Role)
+				}
+			},
+		},
+		{
+			name:    "update role of missing user",
+			change:  func() error { return users.UpdateUserRole(ctx, missingId, "admin") },
+			wantErr: kind(apperrors.KindNotFound),
+		},
+		{
+			name:   "pending two-factor secret",
+			change: func() error { return users.SetTwoFactorPendingSecret(ctx, id, "pending") },
+			check: func(t *testing.T, user *models.UserDetails) {
+				if user.TwoFactorPendingSecret != "pending" || user.TwoFactorEnabled {
+					t.Errorf("user = %+v", user)
+				}
+			},
+		},
+		{
+			name:   "enable two-factor",
+			change: func() error { return users.EnableTwoFactor(ctx, id, "secret", []string{"a", "b"}, 42) },
+			check: func(t *testing.T, user *models.UserDetails) {
+				if !user.TwoFactorEnabled || user.TwoFactorSecret != "secret" || user.TwoFactorPendingSecret != "" || user.TwoFactorLastStep != 42 || len(user.RecoveryCodes) != 2 {
+					t.Errorf("user = %+v", user)
+				}
+			},
+		},
+		{
+			name:   "remove recovery code",
+			change: func() error { return marked(users.RemoveRecoveryCode(ctx, id, "a")) },
+			check: func(t *testing.T, user *models.UserDetails) {
+				if len(user.RecoveryCodes) != 1 || user.RecoveryCodes[0] != "b" {
+					t.Errorf("recovery codes = %v", user.RecoveryCodes)
+				}
+			},
+		},
+		{
+			name:    "remove used recovery code",
+			change:  func() error { return marked(users.RemoveRecoveryCode(ctx, id, "a")) },
+			wantErr: errAlreadyUsed,
+		},
+		{
+			name:   "last step",
+			change: func() error { return marked(users.SetTwoFactorLastStep(ctx, id, 43)) },
+			check: func(t *testing.T, user *models.UserDetails) {
+				if user.TwoFactorLastStep != 43 {
+					t.Errorf("last step = %d", user.TwoFactorLastStep)
+				}
+			},
+		},
+		{
+			name:    "reuse last step",
+			change:  func() error { return marked(users.SetTwoFactorLastStep(ctx, id, 43)) },
+			wantErr: errAlreadyUsed,
+		},
+		{
+			name:    "earlier step",
+			change:  func() error { return marked(users.SetTwoFactorLastStep(ctx, id, 41)) },
+			wantErr: errAlreadyUsed,
+		},
+		{
+			name:   "disable two-factor",
+			change: func() error { return users.DisableTwoFactor(ctx, id) },
+			check: func(t *testing.T, user *models.UserDetails) {
+				if user.TwoFactorEnabled || user.TwoFactorSecret != "" || user.TwoFactorLastStep != 0 || len(user.RecoveryCodes) != 0 {
+					t.Errorf("user = %+v", user)
+				}
+			},
+		},
+		{
+			name: "link identity",
+			change: func() error {
+				return users.LinkIdentity(ctx, id, models.ExternalIdentity{Provider: "google", Subject: "123"})
+			},
+			check: func(t *testing.T, user *models.UserDetails) {
+				linked, err := users.GetUserByIdentity(ctx, "google", "123")
+				assertError(t, err, nil)
+				if linked.ID != user.ID {
+					t.Errorf("identity linked to %s, want %s", linked.ID.Hex(), user.ID.Hex())
+				}
+				_, err = users.GetUserByIdentity(ctx, "google", "456")
+				assertError(t, err, kind(apperrors.KindNotFound))
+			},
+		},
+		{
+			name:   "update password",
+			change: func() error { return users.UpdatePassword(ctx, id, "new-hash") },
+			check: func(t *testing.T, user *models.UserDetails) {
+				if user.Password != "new-hash" {
+					t.Errorf("password = %s, want new-hash", user.Password)
+				}
+			},
+		},
+		{
+			name:    "invalid id",
+			change:  func() error { return users.DisableTwoFactor(ctx, "user") },
+			wantErr: kind(apperrors.KindInvalidID),
+		},
+	}
+
+	// the cases run in order, each one building on the state left by the previous
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertError(t, tt.change(), tt.wantErr)
+			if tt.check == nil {
+				return
+			}
+			user, err := users.GetUserDetailsById(ctx, id)
+			assertError(t, err, nil)
+			tt.check(t, user)
+		})
+	}
+}
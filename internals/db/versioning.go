@@ -0,0 +1,49 @@
+package db
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrVersionConflict is returned when a conditional write finds the document at another version
+var ErrVersionConflict = apperrors.New(apperrors.KindPreconditionFailed, "VERSION_CONFLICT", "resource was modified by another request, reload it and retry")
+
+// restricts the filter to the expected version, nil matches any version; documents written
+// before versioning have no version field and are at version 0
+func matchVersion(filter bson.M, expected *int64) bson.M {
+	if expected == nil {
+		return filter
+	}
+	if *expected == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["version"] = *expected
+	}
+	return filter
+}
+
+// adds the version increment to the update, every write to a versioned document goes through here
+func bumpVersion(update bson.M) bson.M {
+	inc, ok := update["$inc"].(bson.M)
+	if !ok {
+		inc = bson.M{}
+	}
+	inc["version"] = 1
+	update["$inc"] = inc
+	return update
+}
+
+// tells apart a missing document from a stale version after a conditional write matched nothing
+func conflictOrNotFound(ctx context.Context, collection appdb.DatabaseCollection, filter bson.M, notFound error) error {
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFound
+	}
+	return ErrVersionConflict
+}
@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrLocked = apperrors.Conflict("MIGRATIONS_LOCKED", "migrations are being run by another instance")
+
+// a crashed run keeps the lock until it expires
+const lockTimeout = 10 * time.Minute
+
+const lockId = "migrations"
+
+// lock is a single document, whoever inserts it runs the migrations
+type lock struct {
+	collection appdb.DatabaseCollection
+	owner      string
+}
+
+type lockDocument struct {
+	Id        string `bson:"_id"`
+	Owner     string `bson:"owner"`
+	LockedAt  int64  `bson:"lockedAt"`
+	ExpiresAt int64  `bson:"expiresAt"`
+}
+
+func newLock(collection appdb.DatabaseCollection) *lock {
+	host, _ := os.Hostname()
+	return &lock{collection: collection, owner: fmt.Sprintf("%s:%d", host, os.Getpid())}
+}
+
+// function to take the lock, an expired lock is taken over; returns ErrLocked while another instance holds it
+func (l *lock) acquire(ctx context.Context) error {
+	now := time.Now()
+	document := lockDocument{Id: lockId, Owner: l.owner, LockedAt: now.Unix(), ExpiresAt: now.Add(lockTimeout).Unix()}
+	_, err := l.collection.InsertOne(ctx, document)
+	if err == nil {
+		return nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	filter := bson.M{"_id": lockId, "expiresAt": bson.M{"$lt": now.Unix()}}
+	update := bson.M{"$set": bson.M{"owner": document.Owner, "lockedAt": document.LockedAt, "expiresAt": document.ExpiresAt}}
+	result, err := l.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		var holder lockDocument
+		if err := l.collection.FindOne(ctx, bson.M{"_id": lockId}, &holder); err != nil {
+			return ErrLocked
+		}
+		return ErrLocked.Detailf("migrations are locked by %s until %s", holder.Owner, time.Unix(holder.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// function to release the lock, only if it is still ours
+func (l *lock) release(ctx context.Context) error {
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": lockId, "owner": l.owner})
+	return err
+}
@@ -0,0 +1,164 @@
+package migrations
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All returns the migrations of the application. Versions are never reused or reordered, a
+// change to the schema is a new migration with the next version.
+func All() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "unique index on users.email",
+			Up: func(ctx context.Context, client appdb.DatabaseClient) error {
+				return createIndexes(ctx, client, configs.MONGO_USERS_COLLECTION, mongo.IndexModel{
+					Keys:    bson.D{{Key: "email", Value: 1}},
+					Options: options.Index().SetName("email_unique").SetUnique(true),
+				})
+			},
+			Down: func(ctx context.Context, client appdb.DatabaseClient) error {
+				return client.Collection(configs.MONGO_USERS_COLLECTION).DropIndex(ctx, "email_unique")
+			},
+		},
+		{
+			// models.Order has no bson tags, the fields are stored as userid and orderedat
+			Version:     2,
+			Description: "indexes on orders.userId and orders.orderedAt",
+			Up: func(ctx context.Context, client appdb.DatabaseClient) error {
+				return createIndexes(ctx, client, configs.MONGO_ORDERS_COLLECTION,
+					mongo.IndexModel{Keys: bson.D{{Key: "userid", Value: 1}}, Options: options.Index().SetName("userid_1")},
+					mongo.IndexModel{Keys: bson.D{{Key: "orderedat", Value: -1}}, Options: options.Index().SetName("orderedat_-1")},
+				)
+			},
+			Down: func(ctx context.Context, client appdb.DatabaseClient) error {
+				return dropIndexes(ctx, client, configs.MONGO_ORDERS_COLLECTION, "userid_1", "orderedat_-1")
+			},
+		},
+		{
+			Version:     3,
+			Description: "indexes on audit_events.timestamp, actorId and target",
+			Up: func(ctx context.Context, client appdb.DatabaseClient) error {
+				return createIndexes(ctx, client, configs.MONGO_AUDIT_EVENTS_COLLECTION,
+					mongo.IndexModel{Keys: bson.D{{Key: "timestamp", Value: -1}}, Options: options.Index().SetName("timestamp_-1")},
+					mongo.IndexModel{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "timestamp", Value: -1}}, Options: options.Index().SetName("actorId_1_timestamp_-1")},
+					mongo.IndexModel{Keys: bson.D{{Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}, {Key: "timestamp", Value: -1}}, Options: options.Index().SetName("target_1_timestamp_-1")},
+				)
+			},
+			Down: func(ctx context.Context, client appdb.DatabaseClient) error {
+				return dropIndexes(ctx, client, configs.MONGO_AUDIT_EVENTS_COLLECTION, "timestamp_-1", "actorId_1_timestamp_-1", "target_1_timestamp_-1")
+			},
+		},
+		{
+			// the lines of older orders only had the product id, their total price is kept as it was charged
+			Version:     4,
+			Description: "snapshot the products onto the lines of older orders",
+			Up:          snapshotOrderItems,
+			Down: func(ctx context.Context, client appdb.DatabaseClient) error {
+				// the snapshots are extra fields on the lines, they are left in place
+				return nil
+			},
+		},
+		{
+			// a partial index can't select documents without deletedAt, but every account which is not
+			// deleted has the same missing deletedAt, so an email is unique among them and free again
+			// once its account is deleted; restoring the account fails while the email is taken, as does
+			// deleting a second account of the email within the same second
+			Version:     5,
+			Description: "unique index on users.email of the accounts which are not deleted",
+			Up: func(ctx context.Context, client appdb.DatabaseClient) error {
+				err := createIndexes(ctx, client, configs.MONGO_USERS_COLLECTION, mongo.IndexModel{
+					Keys:    bson.D{{Key: "email", Value: 1}, {Key: "deletedAt", Value: 1}},
+					Options: options.Index().SetName("email_deletedAt_unique").SetUnique(true),
+				})
+				if err != nil {
+					return err
+				}
+				return dropIndexes(ctx, client, configs.MONGO_USERS_COLLECTION, "email_unique")
+			},
+			Down: func(ctx context.Context, client appdb.DatabaseClient) error {
+				err := createIndexes(ctx, client, configs.MONGO_USERS_COLLECTION, mongo.IndexModel{
+					Keys:    bson.D{{Key: "email", Value: 1}},
+					Options: options.Index().SetName("email_unique").SetUnique(true),
+				})
+				if err != nil {
+					return err
+				}
+				return dropIndexes(ctx, client, configs.MONGO_USERS_COLLECTION, "email_deletedAt_unique")
+			},
+		},
+	}
+}
+
+func createIndexes(ctx context.Context, client appdb.DatabaseClient, collection string, indexes ...mongo.IndexModel) error {
+	_, err := client.Collection(collection).CreateIndexes(ctx, indexes)
+	return err
+}
+
+func dropIndexes(ctx context.Context, client appdb.DatabaseClient, collection string, names ...string) error {
+	for _, name := range names {
+		if err := client.Collection(collection).DropIndex(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function to copy the current product, deleted or not, onto the order lines without a snapshot, marked as
+// backfilled as the product may have been repriced since; the lines of purged products are left as they are
+func snapshotOrderItems(ctx context.Context, client appdb.DatabaseClient) error {
+	var orders []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Items []models.OrderItem `bson:"items"`
+	}
+	if err := client.Collection(configs.MONGO_ORDERS_COLLECTION).Find(ctx, bson.M{}, options.Find(), &orders); err != nil {
+		return err
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, order := range orders {
+		for _, item := range order.Items {
+			if id, err := primitive.ObjectIDFromHex(item.ItemID); err == nil && item.Name == "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var products []*models.Product
+	if err := client.Collection(configs.MONGO_PRODUCTS_COLLECTION).Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find(), &products); err != nil {
+		return err
+	}
+	byId := make(map[string]*models.Product, len(products))
+	for _, product := range products {
+		byId[product.ID.Hex()] = product
+	}
+
+	for _, order := range orders {
+		changed := false
+		for i, item := range order.Items {
+			if product, found := byId[item.ItemID]; found && item.Name == "" {
+				order.Items[i] = models.SnapshotOrderItem(product, item.Quantity)
+				order.Items[i].SnapshotBackfilled = true
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		update := bson.M{"$set": bson.M{"items": order.Items}}
+		if _, err := client.Collection(configs.MONGO_ORDERS_COLLECTION).UpdateOne(ctx, bson.M{"_id": order.ID}, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSnapshotOrderItems(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	tea := &models.Product{ID: primitive.NewObjectID(), Name: "Masala Chai", Price: 15, Category: "Beverages", TaxRate: 0.05, DeletedAt: 1}
+	if _, err := client.Collection(configs.MONGO_PRODUCTS_COLLECTION).InsertOne(ctx, tea); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	purged := primitive.NewObjectID().Hex()
+	snapshotted := models.OrderItem{ItemID: tea.ID.Hex(), Quantity: 1, Name: "Chai", UnitPrice: 12}
+	old := &models.Order{
+		ID:         primitive.NewObjectID(),
+		Items:      []models.OrderItem{{ItemID: tea.ID.Hex(), Quantity: 2}, {ItemID: purged, Quantity: 1}, snapshotted},
+		TotalPrice: 50,
+	}
+	if _, err := client.Collection(configs.MONGO_ORDERS_COLLECTION).InsertOne(ctx, old); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	if err := snapshotOrderItems(ctx, client); err != nil {
+		t.Fatalf("snapshotOrderItems: %v", err)
+	}
+	var order models.Order
+	if err := client.Collection(configs.MONGO_ORDERS_COLLECTION).FindOne(ctx, bson.M{"_id": old.ID}, &order); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	want := models.SnapshotOrderItem(tea, 2)
+	want.SnapshotBackfilled = true
+	if order.Items[0] != want {
+		t.Errorf("line of the deleted product = %+v, want %+v", order.Items[0], want)
+	}
+	if order.Items[1] != old.Items[1] || order.Items[2] != snapshotted {
+		t.Errorf("lines = %+v, want the purged product and the existing snapshot unchanged", order.Items)
+	}
+	if order.TotalPrice != 50 {
+		t.Errorf("total price = %v, want the charged 50", order.TotalPrice)
+	}
+}
@@ -0,0 +1,198 @@
+package migrations
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apploggers"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is one numbered change of the schema, Down reverts what Up did
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, client appdb.DatabaseClient) error
+	Down        func(ctx context.Context, client appdb.DatabaseClient) error
+}
+
+// Runner applies the migrations in order of version, each applied migration is recorded in the
+// `schema_migrations` collection. Only one instance runs at a time, see lock.
+type Runner interface {
+	Up(ctx context.Context) ([]models.MigrationStatus, error)
+	Down(ctx context.Context, steps int) ([]models.MigrationStatus, error)
+	Status(ctx context.Context) ([]models.MigrationStatus, error)
+}
+
+type record struct {
+	Version     int    `bson:"_id"`
+	Description string `bson:"description"`
+	AppliedAt   int64  `bson:"appliedAt"`
+}
+
+type runner struct {
+	client     appdb.DatabaseClient
+	collection appdb.DatabaseCollection
+	lock       *lock
+	migrations []Migration
+}
+
+func NewRunner(client appdb.DatabaseClient, migrations []Migration) Runner {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &runner{
+		client:     client,
+		collection: client.Collection(configs.MONGO_SCHEMA_MIGRATIONS_COLLECTION),
+		lock:       newLock(client.Collection(configs.MONGO_SCHEMA_MIGRATIONS_LOCK_COLLECTION)),
+		migrations: sorted,
+	}
+}
+
+// function to apply the pending migrations, returns the ones applied; it stops at the first failure
+func (r *runner) Up(ctx context.Context) ([]models.MigrationStatus, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing migrations Up")
+
+	applied := []models.MigrationStatus{}
+	err := r.locked(ctx, func() error {
+		records, err := r.records(ctx)
+		if err != nil {
+			return err
+		}
+		done := make(map[int]bool, len(records))
+		for _, record := range records {
+			done[record.Version] = true
+		}
+
+		for _, migration := range r.migrations {
+			if done[migration.Version] {
+				continue
+			}
+			logger.Infof("Applying migration %d: %s", migration.Version, migration.Description)
+			if err := migration.Up(ctx, r.client); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Description, err)
+			}
+			record := record{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now().Unix()}
+			if _, err := r.collection.InsertOne(ctx, record); err != nil {
+				return err
+			}
+			applied = append(applied, record.status())
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+		return applied, err
+	}
+
+	logger.Infof("Executed migrations Up, applied: %d", len(applied))
+	return applied, nil
+}
+
+// function to revert the last steps applied migrations, newest first; returns the ones reverted
+func (r *runner) Down(ctx context.Context, steps int) ([]models.MigrationStatus, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing migrations Down, steps: %d", steps)
+
+	reverted := []models.MigrationStatus{}
+	err := r.locked(ctx, func() error {
+		records, err := r.records(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(records) - 1; i >= 0 && len(reverted) < steps; i-- {
+			record := records[i]
+			migration, ok := r.find(record.Version)
+			if !ok {
+				return fmt.Errorf("migration %d (%s) is applied but unknown to this build", record.Version, record.Description)
+			}
+			logger.Infof("Reverting migration %d: %s", migration.Version, migration.Description)
+			if err := migration.Down(ctx, r.client); err != nil {
+				return fmt.Errorf("reverting migration %d (%s) failed: %w", migration.Version, migration.Description, err)
+			}
+			if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": record.Version}); err != nil {
+				return err
+			}
+			status := record.status()
+			status.Applied = false
+			reverted = append(reverted, status)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+		return reverted, err
+	}
+
+	logger.Infof("Executed migrations Down, reverted: %d", len(reverted))
+	return reverted, nil
+}
+
+// function to list the migrations known to this build and those recorded as applied, by version
+func (r *runner) Status(ctx context.Context) ([]models.MigrationStatus, error) {
+	records, err := r.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	statuses := make([]models.MigrationStatus, 0, len(r.migrations))
+	for _, migration := range r.migrations {
+		status := models.MigrationStatus{Version: migration.Version, Description: migration.Description}
+		if record, ok := applied[migration.Version]; ok {
+			status = record.status()
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	// applied by a newer build
+	for _, record := range applied {
+		statuses = append(statuses, record.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// function to run fn while holding the lock
+func (r *runner) locked(ctx context.Context, fn func() error) error {
+	if err := r.lock.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if err := r.lock.release(ctx); err != nil {
+			apploggers.GetLoggerWithCorrelationid(ctx).Errorf("Failed to release the migrations lock: %v", err)
+		}
+	}()
+	return fn()
+}
+
+// function to get the applied migrations, oldest first
+func (r *runner) records(ctx context.Context) ([]record, error) {
+	var records []record
+	if err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}), &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (r *runner) find(version int) (Migration, bool) {
+	for _, migration := range r.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+func (r record) status() models.MigrationStatus {
+	return models.MigrationStatus{Version: r.Version, Description: r.Description, Applied: true, AppliedAt: r.AppliedAt}
+}
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func versions(statuses []models.MigrationStatus) []int {
+	result := make([]int, len(statuses))
+	for i, status := range statuses {
+		result[i] = status.Version
+	}
+	return result
+}
+
+func equalVersions(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRunnerUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	runner := NewRunner(client, All())
+
+	applied, err := runner.Up(ctx)
+	if err != nil || !equalVersions(versions(applied), []int{1, 2, 3, 4, 5}) {
+		t.Fatalf("Up = %v, %v, want 1 to 5 applied", versions(applied), err)
+	}
+	applied, err = runner.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second Up = %v, %v, want nothing applied", versions(applied), err)
+	}
+
+	users := client.Collection(configs.MONGO_USERS_COLLECTION)
+	if _, err := users.InsertOne(ctx, bson.M{"email": "asha@example.com"}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	if _, err := users.InsertOne(ctx, bson.M{"email": "asha@example.com"}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("InsertOne of a duplicate email = %v, want a duplicate key error", err)
+	}
+	// the email of a deleted account can be used again, which the index of 1 does not allow
+	if _, err := users.InsertOne(ctx, bson.M{"email": "asha@example.com", "deletedAt": int64(1)}); err != nil {
+		t.Errorf("InsertOne of the email of a deleted account = %v", err)
+	}
+	if _, err := runner.Down(ctx, 1); err == nil {
+		t.Error("Down of 5 while a deleted account shares an email should fail")
+	}
+	if _, err := users.DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$exists": true}}); err != nil {
+		t.Fatalf("DeleteMany: %v", err)
+	}
+
+	reverted, err := runner.Down(ctx, 4)
+	if err != nil || !equalVersions(versions(reverted), []int{5, 4, 3, 2}) {
+		t.Fatalf("Down = %v, %v, want 5 to 2 reverted", versions(reverted), err)
+	}
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) != 5 || !statuses[0].Applied || statuses[0].AppliedAt == 0 || statuses[1].Applied || statuses[4].Applied {
+		t.Errorf("Status = %+v, want 1 applied, 2 to 5 pending", statuses)
+	}
+
+	reverted, err = runner.Down(ctx, 5)
+	if err != nil || !equalVersions(versions(reverted), []int{1}) {
+		t.Fatalf("Down of more steps than applied = %v, %v, want 1 reverted", versions(reverted), err)
+	}
+	if _, err := users.InsertOne(ctx, bson.M{"email": "asha@example.com"}); err != nil {
+		t.Errorf("InsertOne of a duplicate email without the index = %v", err)
+	}
+	if _, err := runner.Up(ctx); err == nil {
+		t.Error("Up over duplicate emails should fail")
+	}
+}
+
+func TestRunnerStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	noop := func(ctx context.Context, client appdb.DatabaseClient) error { return nil }
+	failed := errors.New("failed")
+	runner := NewRunner(client, []Migration{
+		{Version: 3, Description: "third", Up: noop, Down: noop},
+		{Version: 1, Description: "first", Up: noop, Down: noop},
+		{Version: 2, Description: "second", Up: func(ctx context.Context, client appdb.DatabaseClient) error { return failed }, Down: noop},
+	})
+
+	applied, err := runner.Up(ctx)
+	if !errors.Is(err, failed) || !equalVersions(versions(applied), []int{1}) {
+		t.Fatalf("Up = %v, %v, want 1 applied and the failure of 2", versions(applied), err)
+	}
+	statuses, _ := runner.Status(ctx)
+	if len(statuses) != 3 || !statuses[0].Applied || statuses[1].Applied || statuses[2].Applied {
+		t.Errorf("Status = %+v, want only 1 applied", statuses)
+	}
+}
+
+func TestRunnerLock(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	runner := NewRunner(client, All())
+	locks := client.Collection(configs.MONGO_SCHEMA_MIGRATIONS_LOCK_COLLECTION)
+
+	other := lockDocument{Id: lockId, Owner: "other:1", LockedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	if _, err := locks.InsertOne(ctx, other); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	if _, err := runner.Up(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Up while locked = %v, want ErrLocked", err)
+	}
+
+	// the lock of a crashed run expires
+	if _, err := locks.UpdateOne(ctx, bson.M{"_id": lockId}, bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Minute).Unix()}}); err != nil {
+		t.Fatalf("UpdateOne: %v", err)
+	}
+	if _, err := runner.Up(ctx); err != nil {
+		t.Fatalf("Up after the lock expired = %v", err)
+	}
+	if count, _ := locks.CountDocuments(ctx, bson.M{}); count != 0 {
+		t.Errorf("locks = %d after Up, want the lock released", count)
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// AuditEvent records who changed what, it is written once and never updated or deleted
+type AuditEvent struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Action        string             `json:"action" bson:"action"`
+	ActorID       string             `json:"actorId" bson:"actorId"` // user id, empty when the change did not come from a request
+	ActorRole     string             `json:"actorRole,omitempty" bson:"actorRole,omitempty"`
+	TargetType    string             `json:"targetType" bson:"targetType"` // user, product or order
+	TargetID      string             `json:"targetId" bson:"targetId"`
+	Changes       []AuditChange      `json:"changes" bson:"changes"`
+	IP            string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	CorrelationID string             `json:"correlationId,omitempty" bson:"correlationId,omitempty"`
+	Timestamp     int64              `json:"timestamp" bson:"timestamp"` // Unix timestamp
+}
+
+// AuditChange is one field of the target, as it was before and after the action
+type AuditChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// actions of the audit log
+const (
+	AuditUserRoleUpdated     = "user.role.updated"
+	AuditUserPasswordReset   = "user.password.reset"   // by an operator, without the current password
+	AuditProductPriceUpdated = "product.price.updated" // the price or the tax rate
+	AuditOrderUpdated        = "order.updated"
+	AuditOrderForceUpdated   = "order.force_updated" // without If-Match, whatever the version of the order
+)
+
+// AuditFilter selects audit events, the empty fields match every event
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       int64 // Unix timestamps, inclusive
+	To         int64
+	Limit      int
+}
+
+type AuditEventsResponse struct {
+	Total  int           `json:"total"`
+	Events []*AuditEvent `json:"events"`
+}
@@ -11,6 +11,30 @@ type CartItem struct {
 // Cart represents the structure of a user's cart
 type Cart struct {
 	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	UserID     string             `json:"userId" bson:"userId"`
 	Items      []CartItem         `json:"items" validate:"required"`
 	TotalPrice float64            `json:"totalPrice"`
+	UpdatedAt  int64              `json:"updatedAt" bson:"updatedAt"`       // Unix timestamp, carts untouched past the ttl are emptied
+	Version    int64              `json:"version" bson:"version,omitempty"` // incremented on every write, sent as ETag
+}
+
+// replaces all items of the cart, an empty list empties it
+type ReplaceCartRequest struct {
+	Items []CartItem `json:"items" validate:"required,dive"`
+}
+
+type AddCartItemRequest struct {
+	ItemID   string `json:"itemId" validate:"required"`
+	Quantity int    `json:"quantity" validate:"required,min=1"`
+}
+
+// quantity 0 removes the item from the cart
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" validate:"min=0"`
+}
+
+// AggregatesReport lists the carts whose stored total differed from the one recomputed from the product prices
+type AggregatesReport struct {
+	Carts        int      `json:"carts"`
+	ChangedCarts []string `json:"changedCarts"`
 }
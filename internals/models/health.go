@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const (
+	HealthStatusUp          = "up"
+	HealthStatusDown        = "down"
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// HealthReport is the response of the liveness and readiness probes
+type HealthReport struct {
+	Status   string                     `json:"status"` // ok or unavailable
+	Draining bool                       `json:"draining,omitempty"`
+	Checks   map[string]DependencyCheck `json:"checks,omitempty"`
+	Build    BuildInfo                  `json:"build"`
+}
+
+// DependencyCheck is the result of checking one dependency, e.g. mongodb
+type DependencyCheck struct {
+	Status    string  `json:"status"` // up or down
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type BuildInfo struct {
+	Version       string    `json:"version"`
+	Commit        string    `json:"commit"`
+	GoVersion     string    `json:"goVersion"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+}
@@ -0,0 +1,23 @@
+package models
+
+const (
+	LoginAttemptKindAccount = "account"
+	LoginAttemptKindIP      = "ip"
+)
+
+// LoginAttempt tracks consecutive failed logins for an account (email) or a client IP
+type LoginAttempt struct {
+	Key            string `bson:"_id" json:"key"`
+	Kind           string `bson:"kind" json:"kind"`       // "account" or "ip"
+	Subject        string `bson:"subject" json:"subject"` // email or ip address
+	Failures       int    `bson:"failures" json:"failures"`
+	FirstFailureAt int64  `bson:"firstFailureAt" json:"firstFailureAt"` // Unix timestamp, start of the failure window
+	LastFailureAt  int64  `bson:"lastFailureAt" json:"lastFailureAt"`   // Unix timestamp
+	NextAttemptAt  int64  `bson:"nextAttemptAt" json:"nextAttemptAt"`   // Unix timestamp in milliseconds, progressive delay
+	LockedUntil    int64  `bson:"lockedUntil" json:"lockedUntil"`       // Unix timestamp, 0 when not locked
+}
+
+type LockedAccountsResponse struct {
+	Total    int             `json:"total"`
+	Accounts []*LoginAttempt `json:"accounts"`
+}
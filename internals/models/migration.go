@@ -0,0 +1,9 @@
+package models
+
+// MigrationStatus is one schema migration as reported by `jevan migrate`
+type MigrationStatus struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Applied     bool   `json:"applied"`
+	AppliedAt   int64  `json:"appliedAt,omitempty"` // Unix timestamp
+}
@@ -1,18 +1,75 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Order struct {
 	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	UserID     string             `json:"userId" validate:"required"`
-	Items      []OrderItem        `json:"items" validate:"required"`
-	TotalPrice float64            `json:"totalPrice"`
-	Status     string             `json:"status"`    // e.g., "Order Placed", "Ready", "Preparing", "Delivered", "Shipped"
-	OrderedAt  int64              `json:"orderedAt"` // Unix timestamp
+	Items      []OrderItem        `json:"items" validate:"required,min=1,dive"`
+	TotalPrice float64            `json:"totalPrice"` // computed from the snapshots of the items, see OrderTotal
+	Status     string             `json:"status"`     // one of the OrderStatus constants
+	OrderedAt  int64              `json:"orderedAt"`  // Unix timestamp
 	UpdatedAt  int64              `json:"updatedAt"`
+	Version    int64              `json:"version" bson:"version,omitempty"` // incremented on every write, sent as ETag
 }
 
+// statuses of an order, CreateOrder sets placed
+const (
+	OrderStatusPlaced    = "placed"
+	OrderStatusPreparing = "preparing"
+	OrderStatusReady     = "ready"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+)
+
+// function to check the status is one of the OrderStatus constants
+func IsOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPlaced, OrderStatusPreparing, OrderStatusReady, OrderStatusDelivered, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// OrderItem is a line of the order, the product is snapshotted when the order is created so the order
+// keeps what was bought at which price whatever later happens to the product
 type OrderItem struct {
 	ItemID   string `json:"itemId" validate:"required"`
 	Quantity int    `json:"quantity" validate:"required,min=1"`
+
+	Name      string  `json:"name"`
+	UnitPrice float64 `json:"unitPrice"`
+	Category  string  `json:"category"`
+	TaxRate   float64 `json:"taxRate"` // e.g. 0.05 for 5%
+	ImageURL  string  `json:"image"`
+
+	// set on the lines of orders placed before the snapshots, migration 4 filled them from the product
+	// as it was then, so the unit price and tax rate may differ from what was charged
+	SnapshotBackfilled bool `json:"snapshotBackfilled,omitempty"`
+}
+
+// function to build the line of an order for the quantity of the product, with the snapshot of the product
+func SnapshotOrderItem(product *Product, quantity int) OrderItem {
+	return OrderItem{
+		ItemID:    product.ID.Hex(),
+		Quantity:  quantity,
+		Name:      product.Name,
+		UnitPrice: product.Price,
+		Category:  product.Category,
+		TaxRate:   product.TaxRate,
+		ImageURL:  product.ImageURL,
+	}
+}
+
+// function to compute the total price of the lines from their snapshots, taxes included and rounded to the cent
+func OrderTotal(items []OrderItem) float64 {
+	total := 0.0
+	for _, item := range items {
+		total += item.UnitPrice * float64(item.Quantity) * (1 + item.TaxRate)
+	}
+	return math.Round(total*100) / 100
 }
@@ -4,13 +4,24 @@ import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Product struct {
 	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name        string             `json:"name" bson:"name"`
+	Name        string             `json:"name" bson:"name" validate:"required"`
 	Description string             `json:"description" bson:"description"`
-	Price       float64            `json:"price" bson:"price"`
+	Price       float64            `json:"price" bson:"price" validate:"gte=0"`
 	Category    string             `json:"category" bson:"category"`
 	ImageURL    string             `json:"image" bson:"image"`
 	IsAvailable bool               `json:"isAvailable" bson:"isAvailable"`
 	Rating      float64            `json:"rating" bson:"rating"`
 	Type        string             `json:"type" bson:"type"`
 	MealTime    string             `json:"mealTime" bson:"mealTime"`
+	TaxRate     float64            `json:"taxRate" bson:"taxRate" validate:"gte=0,lte=1"`                       // share of the price added as tax, e.g. 0.05 for 5%
+	MaxQuantity int                `json:"maxQuantity,omitempty" bson:"maxQuantity,omitempty" validate:"gte=0"` // per cart, 0 uses the default limit
+	Version     int64              `json:"version" bson:"version,omitempty"`                                    // incremented on every write, sent as ETag
+	DeletedAt   int64              `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`                      // Unix timestamp, soft deleted until purged
+	DeletedBy   string             `json:"deletedBy,omitempty" bson:"deletedBy,omitempty"`                      // user id
 }
+
+// meal times and types the menu is organised by
+var (
+	MealTimes    = []string{"breakfast", "lunch", "snacks", "dinner"}
+	ProductTypes = []string{"veg", "non-veg"}
+)
@@ -0,0 +1,10 @@
+package models
+
+// SeedReport counts the records written by the seed generator
+type SeedReport struct {
+	Seed     int64 `json:"seed"`
+	Users    int   `json:"users"`
+	Products int   `json:"products"`
+	Carts    int   `json:"carts"`
+	Orders   int   `json:"orders"`
+}
@@ -11,6 +11,9 @@ type User struct {
 	Type      string             `json:"type"`
 	Age       int                `json:"age"`
 	IsActive  bool               `json:"isActive"`
+	Version   int64              `json:"version" bson:"version,omitempty"`               // incremented on every profile write, sent as ETag
+	DeletedAt int64              `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"` // Unix timestamp, soft deleted until purged
+	DeletedBy string             `json:"deletedBy,omitempty" bson:"deletedBy,omitempty"` // user id
 }
 
 type UserDetails struct {
@@ -20,6 +23,47 @@ type UserDetails struct {
 	Email     string             `bson:"email" json:"email" validate:"required,email"`
 	Password  string             `bson:"password" json:"password,omitempty" validate:"required,min=6"`
 	Role      string             `bson:"role" json:"role" validate:"omitempty,oneof=admin user"`
+
+	TwoFactorEnabled       bool     `bson:"twoFactorEnabled" json:"twoFactorEnabled"`
+	TwoFactorSecret        string   `bson:"twoFactorSecret,omitempty" json:"-"`
+	TwoFactorPendingSecret string   `bson:"twoFactorPendingSecret,omitempty" json:"-"`
+	TwoFactorLastStep      int64    `bson:"twoFactorLastStep,omitempty" json:"-"`
+	RecoveryCodes          []string `bson:"recoveryCodes,omitempty" json:"-"` // bcrypt hashes
+
+	Identities []ExternalIdentity `bson:"identities,omitempty" json:"-"`
+
+	// email change waiting for verification, applied to both collections once confirmed
+	PendingEmail          string `bson:"pendingEmail,omitempty" json:"-"`
+	EmailVerificationHash string `bson:"emailVerificationHash,omitempty" json:"-"` // sha256 of the token
+	EmailVerificationExp  int64  `bson:"emailVerificationExp,omitempty" json:"-"`  // Unix timestamp
+
+	// set together with the profile, a deleted account can't log in
+	DeletedAt int64  `bson:"deletedAt,omitempty" json:"-"` // Unix timestamp
+	DeletedBy string `bson:"deletedBy,omitempty" json:"-"`
+}
+
+type ChangeEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// AccountRepairReport lists the inconsistencies found between users and users-details
+type AccountRepairReport struct {
+	Applied             bool     `json:"applied"`
+	OrphanedCredentials []string `json:"orphanedCredentials"` // credentials without profile, reported only
+	OrphanedProfiles    []string `json:"orphanedProfiles"`    // profile without credentials, profile deleted
+	MismatchedEmails    []string `json:"mismatchedEmails"`    // profile email differs, copied from credentials
+	DuplicateEmails     []string `json:"duplicateEmails"`     // emails used by more than one login, reported only
+}
+
+// ExternalIdentity links an account to a subject of an OpenID Connect provider
+type ExternalIdentity struct {
+	Provider string `bson:"provider" json:"provider"`
+	Subject  string `bson:"subject" json:"subject"`
+	LinkedAt int64  `bson:"linkedAt" json:"linkedAt"` // Unix timestamp
 }
 
 type UserLoginRequest struct {
@@ -31,7 +75,29 @@ type UserLoginResponse struct {
 	UserId string `json:"userId"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
-	Token  string `json:"token"`
+	Token  string `json:"token,omitempty"`
+
+	// set instead of token, when the account has two-factor authentication enabled
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	InterimToken      string `json:"interimToken,omitempty"`
+}
+
+type TwoFactorLoginRequest struct {
+	InterimToken string `json:"interimToken" validate:"required"`
+	Code         string `json:"code" validate:"required"` // totp or recovery code
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpAuthURI string `json:"otpauthUri"`
+}
+
+type TwoFactorRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
 }
 
 type UpdateUserRoleRequest struct {
@@ -0,0 +1,320 @@
+package seed
+
+import (
+	"Jevan/internals/models"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// email domain of the generated accounts, the first one is the admin
+const (
+	EmailDomain = "demo.jevan.app"
+	AdminEmail  = "admin@" + EmailDomain
+)
+
+// Options of the generated data set. Everything, ids included, is derived from Seed, the dates are relative
+// to Now: the same options give the same records, so seeding again replaces them instead of adding more.
+type Options struct {
+	Seed     int64
+	Users    int    // accounts with a cart each, at least 1 for the admin
+	Products int    // spread over every meal time and type
+	Orders   int    // placed over the last OrderDays days
+	Password string // of every generated account, stored as bcrypt hash
+
+	Now       time.Time
+	OrderDays int
+}
+
+// DefaultOptions are the volumes of the demo mode, dated from the start of the current day (UTC)
+func DefaultOptions() Options {
+	return Options{
+		Seed:      1,
+		Users:     25,
+		Products:  40,
+		Orders:    300,
+		Password:  "jevan-demo",
+		Now:       time.Now().UTC().Truncate(24 * time.Hour),
+		OrderDays: 90,
+	}
+}
+
+// Dataset is the generated records, by collection
+type Dataset struct {
+	Seed        int64
+	Credentials []*models.UserDetails // users
+	Profiles    []*models.User        // users-details
+	Products    []*models.Product
+	Carts       []*models.Cart
+	Orders      []*models.Order
+}
+
+// tax rate of every generated product, the GST on restaurant food
+const foodTaxRate = 0.05
+
+type dish struct {
+	name        string
+	description string
+	category    string
+	price       float64
+}
+
+// menus are the dishes of the catalogue by meal time and type, products beyond it are variants of these
+var menus = map[string]map[string][]dish{
+	"breakfast": {
+		"veg": {
+			{"Masala Dosa", "Rice crepe with spiced potato filling", "South Indian", 60},
+			{"Idli Sambar", "Steamed rice cakes with lentil stew", "South Indian", 40},
+			{"Poha", "Flattened rice with peanuts and curry leaves", "Maharashtrian", 30},
+			{"Aloo Paratha", "Flatbread stuffed with spiced potato, with curd", "North Indian", 55},
+		},
+		"non-veg": {
+			{"Masala Omelette", "Eggs with onion, tomato and green chilli", "Eggs", 45},
+			{"Keema Pav", "Spiced minced mutton with buttered buns", "Mumbai", 90},
+			{"Egg Bhurji", "Scrambled eggs with spices and pav", "Eggs", 50},
+		},
+	},
+	"lunch": {
+		"veg": {
+			{"Veg Thali", "Two curries, dal, rice, chapati and salad", "Thali", 120},
+			{"Curd Rice", "Rice with yoghurt and tempering", "South Indian", 50},
+			{"Rajma Chawal", "Kidney bean curry with steamed rice", "North Indian", 90},
+			{"Chole Bhature", "Chickpea curry with fried bread", "North Indian", 100},
+		},
+		"non-veg": {
+			{"Chicken Biryani", "Basmati rice layered with spiced chicken", "Rice", 180},
+			{"Fish Curry Rice", "Coconut fish curry with red rice", "Coastal", 160},
+			{"Mutton Thali", "Mutton curry, rice, chapati and salad", "Thali", 220},
+		},
+	},
+	"snacks": {
+		"veg": {
+			{"Masala Chai", "Tea brewed with milk and spices", "Beverages", 15},
+			{"Samosa", "Fried pastry with potato and peas", "Street Food", 20},
+			{"Vada Pav", "Spiced potato fritter in a bun", "Street Food", 25},
+			{"Pav Bhaji", "Mashed vegetable curry with buttered buns", "Street Food", 80},
+		},
+		"non-veg": {
+			{"Chicken Roll", "Paratha wrapped around chicken tikka", "Street Food", 90},
+			{"Egg Puff", "Puff pastry with a spiced egg", "Bakery", 30},
+			{"Chicken Momos", "Steamed dumplings with chilli chutney", "Street Food", 80},
+		},
+	},
+	"dinner": {
+		"veg": {
+			{"Paneer Butter Masala", "Cottage cheese in tomato butter gravy", "North Indian", 150},
+			{"Dal Khichdi", "Rice and lentils cooked with ghee", "Comfort", 90},
+			{"Veg Pulao", "Rice cooked with vegetables and whole spices", "Rice", 100},
+			{"Malai Kofta", "Paneer dumplings in a cashew gravy", "North Indian", 160},
+		},
+		"non-veg": {
+			{"Egg Curry", "Boiled eggs in onion tomato gravy", "North Indian", 110},
+			{"Butter Chicken", "Tandoori chicken in tomato butter gravy", "North Indian", 200},
+			{"Mutton Rogan Josh", "Kashmiri mutton curry", "Kashmiri", 240},
+		},
+	},
+}
+
+var (
+	firstNames = []string{"Asha", "Rohan", "Priya", "Vikram", "Meera", "Arjun", "Kavya", "Rahul", "Sneha", "Aditya", "Ananya", "Karan", "Divya", "Siddharth", "Pooja", "Nikhil"}
+	lastNames  = []string{"Sharma", "Patel", "Iyer", "Reddy", "Nair", "Gupta", "Joshi", "Kulkarni", "Menon", "Singh", "Das", "Bose"}
+)
+
+type generator struct {
+	rand    *rand.Rand
+	options Options
+}
+
+// Generate builds the data set of the options without touching the database, see Load
+func Generate(options Options) (*Dataset, error) {
+	if options.Users < 1 {
+		return nil, errors.New("at least one user, the admin, is required")
+	}
+	if options.Products < 1 {
+		return nil, errors.New("at least one product is required")
+	}
+	if options.Orders < 0 {
+		return nil, errors.New("the number of orders can't be negative")
+	}
+	if len(options.Password) < 6 {
+		return nil, errors.New("the password must have at least 6 characters")
+	}
+	if options.OrderDays < 1 {
+		options.OrderDays = 1
+	}
+
+	// one hash for every account, bcrypt is slow by design
+	hash, err := bcrypt.GenerateFromPassword([]byte(options.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{rand: rand.New(rand.NewSource(options.Seed)), options: options}
+	dataset := &Dataset{Seed: options.Seed}
+	dataset.Products = g.products()
+	for i := 0; i < options.Users; i++ {
+		credentials, profile := g.account(i, string(hash))
+		dataset.Credentials = append(dataset.Credentials, credentials)
+		dataset.Profiles = append(dataset.Profiles, profile)
+		dataset.Carts = append(dataset.Carts, g.cart(profile, dataset.Products))
+	}
+	for i := 0; i < options.Orders; i++ {
+		profile := dataset.Profiles[g.rand.Intn(len(dataset.Profiles))]
+		dataset.Orders = append(dataset.Orders, g.order(profile, dataset.Products))
+	}
+	return dataset, nil
+}
+
+// function to get the next id, taken from the seeded source so it is the same on every run
+func (g *generator) objectID() primitive.ObjectID {
+	var id primitive.ObjectID
+	g.rand.Read(id[:]) //nolint
+	return id
+}
+
+// function to build the products, going round the meal times and types so every one of them is on the menu
+func (g *generator) products() []*models.Product {
+	var combinations [][]dish
+	for _, mealTime := range models.MealTimes {
+		for _, productType := range models.ProductTypes {
+			combinations = append(combinations, menus[mealTime][productType])
+		}
+	}
+
+	products := make([]*models.Product, 0, g.options.Products)
+	for i := 0; i < g.options.Products; i++ {
+		combination := i % len(combinations)
+		dishes := combinations[combination]
+		round := i / len(combinations)
+		dish := dishes[round%len(dishes)]
+
+		product := &models.Product{
+			ID:          g.objectID(),
+			Name:        dish.name,
+			Description: dish.description,
+			Price:       dish.price,
+			Category:    dish.category,
+			IsAvailable: g.rand.Intn(10) > 0,
+			Rating:      math.Round((3.5+g.rand.Float64()*1.5)*10) / 10,
+			MealTime:    models.MealTimes[combination/len(models.ProductTypes)],
+			Type:        models.ProductTypes[combination%len(models.ProductTypes)],
+			TaxRate:     foodTaxRate,
+			Version:     1,
+		}
+		// the catalogue is exhausted, the next products are its variants, priced a little higher
+		if variant := round / len(dishes); variant > 0 {
+			product.Name = fmt.Sprintf("%s (Special %d)", dish.name, variant)
+			product.Price = dish.price + float64(10*variant)
+		}
+		products = append(products, product)
+	}
+	return products
+}
+
+func (g *generator) account(i int, hash string) (*models.UserDetails, *models.User) {
+	id := g.objectID()
+	firstName := firstNames[g.rand.Intn(len(firstNames))]
+	lastName := lastNames[g.rand.Intn(len(lastNames))]
+	email := fmt.Sprintf("user%03d@%s", i, EmailDomain)
+	role := "user"
+	if i == 0 {
+		firstName, lastName, email, role = "Demo", "Admin", AdminEmail, "admin"
+	}
+
+	credentials := &models.UserDetails{
+		ID:        id,
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+		Password:  hash,
+		Role:      role,
+	}
+	profile := &models.User{
+		Id:        id,
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+		CartId:    g.objectID().Hex(),
+		Type:      "user",
+		Age:       18 + g.rand.Intn(43),
+		IsActive:  true,
+		Version:   1,
+	}
+	return credentials, profile
+}
+
+// function to build the cart of a profile, about half of them have items; they were updated in the last
+// hours so the cart expiry job leaves them alone
+func (g *generator) cart(profile *models.User, products []*models.Product) *models.Cart {
+	cartId, _ := primitive.ObjectIDFromHex(profile.CartId)
+	cart := &models.Cart{
+		ID:        cartId,
+		UserID:    profile.Id.Hex(),
+		Items:     []models.CartItem{},
+		UpdatedAt: g.options.Now.Add(-time.Duration(g.rand.Intn(12*60)) * time.Minute).Unix(),
+		Version:   1,
+	}
+	if g.rand.Intn(2) == 0 {
+		return cart
+	}
+	for _, product := range g.pick(products, 1+g.rand.Intn(3)) {
+		quantity := 1 + g.rand.Intn(3)
+		cart.Items = append(cart.Items, models.CartItem{ItemID: product.ID.Hex(), Quantity: quantity})
+		cart.TotalPrice += product.Price * float64(quantity)
+	}
+	return cart
+}
+
+// function to build an order placed in the last OrderDays days, orders of the last day are still in the
+// kitchen while the older ones were delivered, or cancelled
+func (g *generator) order(profile *models.User, products []*models.Product) *models.Order {
+	age := time.Duration(g.rand.Int63n(int64(time.Duration(g.options.OrderDays) * 24 * time.Hour)))
+	orderedAt := g.options.Now.Add(-age)
+	order := &models.Order{
+		ID:        g.objectID(),
+		UserID:    profile.Id.Hex(),
+		Items:     []models.OrderItem{},
+		OrderedAt: orderedAt.Unix(),
+		UpdatedAt: orderedAt.Unix(),
+		Version:   1,
+	}
+	for _, product := range g.pick(products, 1+g.rand.Intn(4)) {
+		quantity := 1 + g.rand.Intn(3)
+		order.Items = append(order.Items, models.SnapshotOrderItem(product, quantity))
+	}
+	order.TotalPrice = models.OrderTotal(order.Items)
+
+	switch {
+	case age < 24*time.Hour:
+		statuses := []string{models.OrderStatusPlaced, models.OrderStatusPreparing, models.OrderStatusReady, models.OrderStatusDelivered}
+		order.Status = statuses[g.rand.Intn(len(statuses))]
+	case g.rand.Intn(10) == 0:
+		order.Status = models.OrderStatusCancelled
+	default:
+		order.Status = models.OrderStatusDelivered
+	}
+	if order.Status != models.OrderStatusPlaced {
+		order.UpdatedAt = orderedAt.Add(time.Duration(5+g.rand.Intn(90)) * time.Minute).Unix()
+		if order.UpdatedAt > g.options.Now.Unix() {
+			order.UpdatedAt = g.options.Now.Unix()
+		}
+	}
+	return order
+}
+
+// function to pick n different products, fewer when there are not so many
+func (g *generator) pick(products []*models.Product, n int) []*models.Product {
+	if n > len(products) {
+		n = len(products)
+	}
+	picked := make([]*models.Product, 0, n)
+	for _, i := range g.rand.Perm(len(products))[:n] {
+		picked = append(picked, products[i])
+	}
+	return picked
+}
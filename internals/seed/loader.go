@@ -0,0 +1,90 @@
+package seed
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apploggers"
+	"Jevan/configs"
+	"Jevan/internals/models"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// records inserted per call
+const batchSize = 500
+
+// Load writes the data set, records with the same ids are replaced so loading the same seed twice leaves one
+// copy. Other records are kept, but a generated email taken by another account fails the load.
+func Load(ctx context.Context, client appdb.DatabaseClient, dataset *Dataset) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing Load, seed: %d", dataset.Seed)
+
+	collections := []struct {
+		name      string
+		ids       []primitive.ObjectID
+		documents []interface{}
+	}{
+		{name: configs.MONGO_PRODUCTS_COLLECTION},
+		{name: configs.MONGO_USERS_COLLECTION},
+		{name: configs.MONGO_USERDETAILS_COLLECTION},
+		{name: configs.MONGO_CARTS_COLLECTION},
+		{name: configs.MONGO_ORDERS_COLLECTION},
+	}
+	for _, product := range dataset.Products {
+		collections[0].ids = append(collections[0].ids, product.ID)
+		collections[0].documents = append(collections[0].documents, product)
+	}
+	for _, credentials := range dataset.Credentials {
+		collections[1].ids = append(collections[1].ids, credentials.ID)
+		collections[1].documents = append(collections[1].documents, credentials)
+	}
+	for _, profile := range dataset.Profiles {
+		collections[2].ids = append(collections[2].ids, profile.Id)
+		collections[2].documents = append(collections[2].documents, profile)
+	}
+	for _, cart := range dataset.Carts {
+		collections[3].ids = append(collections[3].ids, cart.ID)
+		collections[3].documents = append(collections[3].documents, cart)
+	}
+	for _, order := range dataset.Orders {
+		collections[4].ids = append(collections[4].ids, order.ID)
+		collections[4].documents = append(collections[4].documents, order)
+	}
+
+	for _, collection := range collections {
+		if len(collection.documents) == 0 {
+			continue
+		}
+		target := client.Collection(collection.name)
+		if _, err := target.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": collection.ids}}); err != nil {
+			logger.Error(err)
+			return fmt.Errorf("seeding %s: %w", collection.name, err)
+		}
+		for start := 0; start < len(collection.documents); start += batchSize {
+			end := start + batchSize
+			if end > len(collection.documents) {
+				end = len(collection.documents)
+			}
+			if _, err := target.InsertMany(ctx, collection.documents[start:end]); err != nil {
+				logger.Error(err)
+				return fmt.Errorf("seeding %s: %w", collection.name, err)
+			}
+		}
+	}
+
+	logger.Infof("Executed Load, users: %d, products: %d, orders: %d", len(dataset.Profiles), len(dataset.Products), len(dataset.Orders))
+	return nil
+}
+
+// Report counts the records of the data set
+func (d *Dataset) Report() *models.SeedReport {
+	return &models.SeedReport{
+		Seed:     d.Seed,
+		Users:    len(d.Profiles),
+		Products: len(d.Products),
+		Carts:    len(d.Carts),
+		Orders:   len(d.Orders),
+	}
+}
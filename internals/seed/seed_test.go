@@ -0,0 +1,162 @@
+package seed
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/configs"
+	"Jevan/internals/migrations"
+	"Jevan/internals/models"
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testOptions() Options {
+	return Options{
+		Seed:      42,
+		Users:     5,
+		Products:  30,
+		Orders:    60,
+		Password:  "secret1",
+		Now:       time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		OrderDays: 30,
+	}
+}
+
+// the bcrypt salt is random, the rest of the data set must not be
+func withoutHashes(dataset *Dataset) *Dataset {
+	for _, credentials := range dataset.Credentials {
+		credentials.Password = ""
+	}
+	return dataset
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	first, err := Generate(testOptions())
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	second, _ := Generate(testOptions())
+	if !reflect.DeepEqual(withoutHashes(first), withoutHashes(second)) {
+		t.Error("the same options generated different data sets")
+	}
+
+	options := testOptions()
+	options.Seed = 43
+	other, _ := Generate(options)
+	if other.Products[0].ID == first.Products[0].ID || reflect.DeepEqual(withoutHashes(other).Orders, first.Orders) {
+		t.Error("another seed generated the same data set")
+	}
+}
+
+func TestGenerateContent(t *testing.T) {
+	options := testOptions()
+	dataset, err := Generate(options)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(dataset.Credentials) != 5 || len(dataset.Profiles) != 5 || len(dataset.Carts) != 5 || len(dataset.Products) != 30 || len(dataset.Orders) != 60 {
+		t.Fatalf("report = %+v, want the volumes of the options", dataset.Report())
+	}
+
+	admin := dataset.Credentials[0]
+	if admin.Email != AdminEmail || admin.Role != "admin" || dataset.Credentials[1].Role != "user" {
+		t.Errorf("first account = %s %s, want the admin", admin.Email, admin.Role)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(options.Password)) != nil {
+		t.Error("the password is not stored as bcrypt hash of the option")
+	}
+
+	menu := map[string]bool{}
+	prices := map[string]float64{}
+	for _, product := range dataset.Products {
+		menu[product.MealTime+"/"+product.Type] = true
+		prices[product.ID.Hex()] = product.Price
+	}
+	for _, mealTime := range models.MealTimes {
+		for _, productType := range models.ProductTypes {
+			if !menu[mealTime+"/"+productType] {
+				t.Errorf("no %s %s product", productType, mealTime)
+			}
+		}
+	}
+
+	statuses := map[string]int{}
+	for _, order := range dataset.Orders {
+		statuses[order.Status]++
+		total := 0.0
+		for _, item := range order.Items {
+			if item.UnitPrice != prices[item.ItemID] || item.Name == "" || item.TaxRate != foodTaxRate {
+				t.Errorf("order %s line %+v, want the snapshot of product %s", order.ID.Hex(), item, item.ItemID)
+			}
+			total += prices[item.ItemID] * float64(item.Quantity) * (1 + foodTaxRate)
+		}
+		if math.Abs(order.TotalPrice-total) > 0.005 || len(order.Items) == 0 {
+			t.Errorf("order %s total = %v, want %v from %d items", order.ID.Hex(), order.TotalPrice, total, len(order.Items))
+		}
+		if order.OrderedAt > options.Now.Unix() || order.OrderedAt < options.Now.AddDate(0, 0, -options.OrderDays).Unix() || order.UpdatedAt < order.OrderedAt {
+			t.Errorf("order %s dated %d-%d, outside the last %d days", order.ID.Hex(), order.OrderedAt, order.UpdatedAt, options.OrderDays)
+		}
+	}
+	if statuses[models.OrderStatusDelivered] == 0 || statuses[models.OrderStatusCancelled] == 0 || len(statuses) < 3 {
+		t.Errorf("statuses = %v, want delivered, cancelled and open orders", statuses)
+	}
+
+	for i, cart := range dataset.Carts {
+		if cart.ID.Hex() != dataset.Profiles[i].CartId || cart.UserID != dataset.Profiles[i].Id.Hex() {
+			t.Errorf("cart %d does not belong to its profile", i)
+		}
+	}
+}
+
+func TestGenerateValidates(t *testing.T) {
+	for name, change := range map[string]func(*Options){
+		"no users":       func(o *Options) { o.Users = 0 },
+		"no products":    func(o *Options) { o.Products = 0 },
+		"short password": func(o *Options) { o.Password = "abc" },
+	} {
+		options := testOptions()
+		change(&options)
+		if _, err := Generate(options); err == nil {
+			t.Errorf("%s: Generate succeeded", name)
+		}
+	}
+}
+
+func TestLoadReplacesPreviousRun(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	if _, err := migrations.NewRunner(client, migrations.All()).Up(ctx); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	// records not generated by the seed are kept
+	if _, err := client.Collection(configs.MONGO_PRODUCTS_COLLECTION).InsertOne(ctx, &models.Product{Name: "Filter Coffee"}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	dataset, err := Generate(testOptions())
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for run := 1; run <= 2; run++ {
+		if err := Load(ctx, client, dataset); err != nil {
+			t.Fatalf("Load run %d: %v", run, err)
+		}
+	}
+
+	for collection, want := range map[string]int64{
+		configs.MONGO_PRODUCTS_COLLECTION:    31,
+		configs.MONGO_USERS_COLLECTION:       5,
+		configs.MONGO_USERDETAILS_COLLECTION: 5,
+		configs.MONGO_CARTS_COLLECTION:       5,
+		configs.MONGO_ORDERS_COLLECTION:      60,
+	} {
+		if count, _ := client.Collection(collection).CountDocuments(ctx, bson.M{}); count != want {
+			t.Errorf("%s has %d documents after two loads, want %d", collection, count, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccountRepairService finds and fixes records of `users` and `users-details` which are out of sync,
+// left behind by the non-transactional writes of older releases
+type AccountRepairService interface {
+	Repair(ctx context.Context, apply bool) (*models.AccountRepairReport, error)
+}
+
+type accountRepairService struct {
+	accountDb db.AccountDbService
+}
+
+func NewAccountRepairService(accountDb db.AccountDbService) AccountRepairService {
+	return &accountRepairService{accountDb: accountDb}
+}
+
+// credentials are the source of truth: orphaned profiles are removed and profile emails are reset to the
+// login email. Credentials without a profile are only reported, they may be left by an account deleted
+// halfway and recreating the profile would bring it back. Nothing is written unless apply is set.
+func (a *accountRepairService) Repair(ctx context.Context, apply bool) (*models.AccountRepairReport, error) {
+	ctx, span := apptracing.Start(ctx, "AccountRepairService.Repair")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing Repair, apply: %v", apply)
+
+	credentials, err := a.accountDb.ListCredentials(ctx)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	profiles, err := a.accountDb.ListProfiles(ctx)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	report := &models.AccountRepairReport{
+		Applied:             apply,
+		OrphanedCredentials: []string{},
+		OrphanedProfiles:    []string{},
+		MismatchedEmails:    []string{},
+		DuplicateEmails:     []string{},
+	}
+
+	profileById := make(map[primitive.ObjectID]*models.User, len(profiles))
+	for _, profile := range profiles {
+		profileById[profile.Id] = profile
+	}
+
+	credentialById := make(map[primitive.ObjectID]*models.UserDetails, len(credentials))
+	emails := map[string]int{}
+	for _, credential := range credentials {
+		credentialById[credential.ID] = credential
+		// a deleted account gives up its email, see migration 5
+		if credential.DeletedAt == 0 {
+			emails[strings.ToLower(credential.Email)]++
+		}
+	}
+	for email, count := range emails {
+		if count > 1 {
+			report.DuplicateEmails = append(report.DuplicateEmails, email)
+		}
+	}
+
+	for _, credential := range credentials {
+		profile, ok := profileById[credential.ID]
+		if !ok {
+			report.OrphanedCredentials = append(report.OrphanedCredentials, credential.ID.Hex())
+			continue
+		}
+		if profile.Email != credential.Email {
+			report.MismatchedEmails = append(report.MismatchedEmails, credential.ID.Hex())
+			if apply {
+				if err := a.accountDb.SetProfileEmail(ctx, credential.ID, credential.Email); err != nil {
+					logger.Error(err)
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, profile := range profiles {
+		if _, ok := credentialById[profile.Id]; ok {
+			continue
+		}
+		report.OrphanedProfiles = append(report.OrphanedProfiles, profile.Id.Hex())
+		if apply {
+			if err := a.accountDb.DeleteProfile(ctx, profile.Id); err != nil {
+				logger.Error(err)
+				return nil, err
+			}
+		}
+	}
+
+	logger.Infof("Executed Repair, orphaned credentials: %d, orphaned profiles: %d, mismatched emails: %d, duplicate emails: %d",
+		len(report.OrphanedCredentials), len(report.OrphanedProfiles), len(report.MismatchedEmails), len(report.DuplicateEmails))
+	return report, nil
+}
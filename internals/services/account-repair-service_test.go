@@ -0,0 +1,35 @@
+package services
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/configs"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRepairReportsOrphanedCredentials(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	orphaned := &models.UserDetails{ID: primitive.NewObjectID(), Email: "asha@example.com"}
+	if _, err := client.Collection(configs.MONGO_USERS_COLLECTION).InsertOne(ctx, orphaned); err != nil {
+		t.Fatalf("inserting the credentials: %v", err)
+	}
+
+	repair := NewAccountRepairService(db.NewAccountDbService(client))
+	report, err := repair.Repair(ctx, true)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if len(report.OrphanedCredentials) != 1 || report.OrphanedCredentials[0] != orphaned.ID.Hex() {
+		t.Errorf("orphaned credentials = %v, want %s", report.OrphanedCredentials, orphaned.ID.Hex())
+	}
+
+	// reported again, as no profile was created for them
+	if report, err = repair.Repair(ctx, true); err != nil || len(report.OrphanedCredentials) != 1 {
+		t.Errorf("second repair = %+v, %v, want the credentials reported again", report, err)
+	}
+}
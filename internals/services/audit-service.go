@@ -0,0 +1,123 @@
+package services
+
+import (
+	"Jevan/commons/appaudit"
+	"Jevan/commons/appdb"
+	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// events returned by GetAuditEvents without a limit, and at most
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 10000
+)
+
+type AuditService interface {
+	Record(ctx context.Context, action, targetType, targetId string, before, after interface{}) error
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error)
+}
+
+type auditService struct {
+	dbservice db.AuditDbService
+	client    appdb.DatabaseClient
+}
+
+func NewAuditService(dbservice db.AuditDbService, client appdb.DatabaseClient) AuditService {
+	return &auditService{dbservice: dbservice, client: client}
+}
+
+// WithTransaction runs the audited write and the Record of its event in one transaction, pass the context
+// of fn to both; a write is rolled back when its event cannot be recorded
+func (a *auditService) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return a.client.WithTransaction(ctx, fn)
+}
+
+// Record appends the event of an action done by the actor of the context, with the fields which differ
+// between before and after, both compared by their JSON form. A failure to record it is returned, an
+// audited action must not look successful without its event.
+func (a *auditService) Record(ctx context.Context, action, targetType, targetId string, before, after interface{}) error {
+	ctx, span := apptracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing Record, action: %s, target: %s %s", action, targetType, targetId)
+
+	actor := appaudit.GetActor(ctx)
+	event := &models.AuditEvent{
+		Action:        action,
+		ActorID:       actor.UserId,
+		ActorRole:     actor.Role,
+		TargetType:    targetType,
+		TargetID:      targetId,
+		Changes:       auditChanges(before, after),
+		IP:            actor.IP,
+		CorrelationID: apploggers.GetCorrelationId(ctx),
+		Timestamp:     time.Now().Unix(),
+	}
+	if err := a.dbservice.SaveAuditEvent(ctx, event); err != nil {
+		logger.Errorf("Failed to record audit event %s of %s %s: %v", action, targetType, targetId, err)
+		return err
+	}
+
+	logger.Infof("Executed Record, action: %s", action)
+	return nil
+}
+
+// lists the events of the filter, the latest first, by default the last 100
+func (a *auditService) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	ctx, span := apptracing.Start(ctx, "AuditService.GetAuditEvents")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing GetAuditEvents")
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	filter.Limit = min(filter.Limit, maxAuditLimit)
+	events, err := a.dbservice.GetAuditEvents(ctx, filter)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	logger.Infof("Executed GetAuditEvents, total: %d", len(events))
+	return events, nil
+}
+
+// function to list the fields which differ between before and after, sorted by name
+func auditChanges(before, after interface{}) []models.AuditChange {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+	names := map[string]bool{}
+	for name := range beforeFields {
+		names[name] = true
+	}
+	for name := range afterFields {
+		names[name] = true
+	}
+
+	changes := []models.AuditChange{}
+	for name := range names {
+		if !reflect.DeepEqual(beforeFields[name], afterFields[name]) {
+			changes = append(changes, models.AuditChange{Field: name, Before: beforeFields[name], After: afterFields[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// function to get the fields of a record by their JSON name, none for nil
+func auditFields(record interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if raw, err := json.Marshal(record); err == nil && record != nil {
+		json.Unmarshal(raw, &fields) //nolint
+	}
+	return fields
+}
@@ -1,27 +1,60 @@
 package services
 
 import (
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
 	"Jevan/internals/db"
 	"Jevan/internals/models"
 	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type CartService interface {
-	UpdateCart(ctx context.Context, cart *models.Cart) error
+	UpdateCart(ctx context.Context, cartId string, items []models.CartItem, expectedVersion *int64) (*models.Cart, error)
 	GetCartItemsById(ctx context.Context, cartId string) (*models.Cart, error)
-	DeleteAllItems(ctx context.Context, cartId string) error
+	DeleteAllItems(ctx context.Context, cartId string, expectedVersion *int64) error
+	GetCartForUser(ctx context.Context, userId string) (*models.Cart, error)
+	ExpireAbandonedCarts(ctx context.Context) error
+	AddItem(ctx context.Context, cartId string, item *models.AddCartItemRequest, expectedVersion *int64) (*models.Cart, error)
+	UpdateItemQuantity(ctx context.Context, cartId, itemId string, quantity int, expectedVersion *int64) (*models.Cart, error)
+	RemoveItem(ctx context.Context, cartId, itemId string, expectedVersion *int64) (*models.Cart, error)
+	RecalculateTotals(ctx context.Context) (*models.AggregatesReport, error)
+}
+
+var ErrProductUnavailable = apperrors.New(apperrors.KindValidation, "PRODUCT_UNAVAILABLE", "product is not available")
+
+// times the total of a cart is computed again when the cart keeps changing while it is stored
+const maxRecalculateAttempts = 3
+
+// CartPolicy configures cart limits and expiry
+type CartPolicy struct {
+	ItemTTL         time.Duration // how long items stay in a cart which is not updated, zero disables expiry
+	MaxItemQuantity int           // per item, used when the product has no own limit
 }
 
 type cartService struct {
-	dbservice db.CartDbService
+	dbservice        db.CartDbService
+	userDbService    db.UserDbService
+	productDbService db.ProductDbService
+	policy           CartPolicy
 }
 
-func NewCartService(dbservice db.CartDbService) CartService {
-	return &cartService{dbservice: dbservice}
+func NewCartService(dbservice db.CartDbService, userDbService db.UserDbService, productDbService db.ProductDbService, policy CartPolicy) CartService {
+	return &cartService{
+		dbservice:        dbservice,
+		userDbService:    userDbService,
+		productDbService: productDbService,
+		policy:           policy,
+	}
 }
 
 func (c *cartService) GetCartItemsById(ctx context.Context, cartId string) (*models.Cart, error) {
+	ctx, span := apptracing.Start(ctx, "CartService.GetCartItemsById")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing GetCartItemsById, cartId: %s", cartId)
 
@@ -35,11 +68,13 @@ func (c *cartService) GetCartItemsById(ctx context.Context, cartId string) (*mod
 	return cart, nil
 }
 
-func (c *cartService) DeleteAllItems(ctx context.Context, cartId string) error {
+func (c *cartService) DeleteAllItems(ctx context.Context, cartId string, expectedVersion *int64) error {
+	ctx, span := apptracing.Start(ctx, "CartService.DeleteAllItems")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing DeleteAllItems, cartId: %s", cartId)
 
-	err := c.dbservice.DeleteAllItemsFromCart(ctx, cartId)
+	err := c.dbservice.DeleteAllItemsFromCart(ctx, cartId, expectedVersion)
 	if err != nil {
 		logger.Errorf("Failed to delete items for cart %s: %v", cartId, err)
 		return err
@@ -49,16 +84,252 @@ func (c *cartService) DeleteAllItems(ctx context.Context, cartId string) error {
 	return nil
 }
 
-func (cs *cartService) UpdateCart(ctx context.Context, cart *models.Cart) error {
+// replaces the items of the cart; every item is checked against the same availability and quantity
+// limit as AddItem, and the total is recalculated from the current product prices
+func (cs *cartService) UpdateCart(ctx context.Context, cartId string, items []models.CartItem, expectedVersion *int64) (*models.Cart, error) {
+	ctx, span := apptracing.Start(ctx, "CartService.UpdateCart")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing UpdateCart, cartId: %s, items: %d", cartId, len(items))
+
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if seen[item.ItemID] {
+			return nil, apperrors.Validationf("item %s is listed more than once", item.ItemID)
+		}
+		seen[item.ItemID] = true
+		maxQuantity, err := cs.maxQuantity(ctx, item.ItemID)
+		if err != nil {
+			return nil, err
+		}
+		if item.Quantity > maxQuantity {
+			return nil, db.ErrCartQuantityExhausted.Detailf("quantity limit reached for item %s, max: %d", item.ItemID, maxQuantity)
+		}
+	}
+	if err := cs.dbservice.ReplaceItems(ctx, cartId, items, expectedVersion); err != nil {
+		logger.Errorf("Failed to update cart %s: %v", cartId, err)
+		return nil, err
+	}
+
+	logger.Infof("Executed UpdateCart, cartId: %s", cartId)
+	return cs.recalculate(ctx, cartId)
+}
+
+// resolves the cart from the user profile, carts missing for older accounts are created on first access
+func (c *cartService) GetCartForUser(ctx context.Context, userId string) (*models.Cart, error) {
+	ctx, span := apptracing.Start(ctx, "CartService.GetCartForUser")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing GetCartForUser, userId: %s", userId)
+
+	user, err := c.userDbService.GetUserById(ctx, userId, false)
+	if err != nil {
+		logger.Errorf("Failed to get user %s: %v", userId, err)
+		return nil, err
+	}
+
+	cart, err := c.dbservice.GetCartById(ctx, user.CartId)
+	if err == nil {
+		logger.Infof("Executed GetCartForUser, cartId: %s", user.CartId)
+		return cart, nil
+	}
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		logger.Errorf("Failed to get cart for user %s: %v", userId, err)
+		return nil, err
+	}
+
+	cartId, err := primitive.ObjectIDFromHex(user.CartId)
+	if err != nil {
+		return nil, apperrors.InvalidID("cart", user.CartId)
+	}
+	cart = &models.Cart{
+		ID:        cartId,
+		UserID:    userId,
+		Items:     []models.CartItem{},
+		UpdatedAt: time.Now().Unix(),
+	}
+	if err := c.dbservice.CreateCart(ctx, cart); err != nil {
+		logger.Errorf("Failed to provision cart for user %s: %v", userId, err)
+		return nil, err
+	}
+
+	logger.Infof("Executed GetCartForUser, provisioned cartId: %s", user.CartId)
+	return cart, nil
+}
+
+func (c *cartService) ExpireAbandonedCarts(ctx context.Context) error {
+	ctx, span := apptracing.Start(ctx, "CartService.ExpireAbandonedCarts")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing UpdateCart, cartId: %s", cart.ID)
+	if c.policy.ItemTTL <= 0 {
+		return nil
+	}
+	logger.Infof("Executing ExpireAbandonedCarts, ttl: %s", c.policy.ItemTTL)
 
-	err := cs.dbservice.SaveCart(ctx, cart)
+	expired, err := c.dbservice.ExpireAbandonedCarts(ctx, time.Now().Add(-c.policy.ItemTTL).Unix())
 	if err != nil {
-		logger.Errorf("Failed to update cart %s: %v", cart.ID, err)
+		logger.Errorf("Failed to expire abandoned carts: %v", err)
 		return err
 	}
 
-	logger.Infof("Cart %s updated successfully", cart.ID)
+	logger.Infof("Executed ExpireAbandonedCarts, expired: %d", expired)
 	return nil
 }
+
+func (c *cartService) AddItem(ctx context.Context, cartId string, item *models.AddCartItemRequest, expectedVersion *int64) (*models.Cart, error) {
+	ctx, span := apptracing.Start(ctx, "CartService.AddItem")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing AddItem, cartId: %s, itemId: %s", cartId, item.ItemID)
+
+	maxQuantity, err := c.maxQuantity(ctx, item.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.dbservice.AddItem(ctx, cartId, item.ItemID, item.Quantity, maxQuantity, expectedVersion); err != nil {
+		logger.Errorf("Failed to add item %s to cart %s: %v", item.ItemID, cartId, err)
+		if errors.Is(err, db.ErrCartQuantityExhausted) {
+			return nil, db.ErrCartQuantityExhausted.Detailf("quantity limit reached for item, max: %d", maxQuantity)
+		}
+		return nil, err
+	}
+
+	logger.Infof("Executed AddItem, cartId: %s, itemId: %s", cartId, item.ItemID)
+	return c.recalculate(ctx, cartId)
+}
+
+func (c *cartService) UpdateItemQuantity(ctx context.Context, cartId, itemId string, quantity int, expectedVersion *int64) (*models.Cart, error) {
+	ctx, span := apptracing.Start(ctx, "CartService.UpdateItemQuantity")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing UpdateItemQuantity, cartId: %s, itemId: %s, quantity: %d", cartId, itemId, quantity)
+
+	if quantity == 0 {
+		return c.RemoveItem(ctx, cartId, itemId, expectedVersion)
+	}
+	maxQuantity, err := c.maxQuantity(ctx, itemId)
+	if err != nil {
+		return nil, err
+	}
+	if quantity > maxQuantity {
+		return nil, db.ErrCartQuantityExhausted.Detailf("quantity limit reached for item, max: %d", maxQuantity)
+	}
+	if err := c.dbservice.SetItemQuantity(ctx, cartId, itemId, quantity, expectedVersion); err != nil {
+		logger.Errorf("Failed to update item %s in cart %s: %v", itemId, cartId, err)
+		return nil, err
+	}
+
+	logger.Infof("Executed UpdateItemQuantity, cartId: %s, itemId: %s", cartId, itemId)
+	return c.recalculate(ctx, cartId)
+}
+
+func (c *cartService) RemoveItem(ctx context.Context, cartId, itemId string, expectedVersion *int64) (*models.Cart, error) {
+	ctx, span := apptracing.Start(ctx, "CartService.RemoveItem")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing RemoveItem, cartId: %s, itemId: %s", cartId, itemId)
+
+	if err := c.dbservice.RemoveItem(ctx, cartId, itemId, expectedVersion); err != nil {
+		logger.Errorf("Failed to remove item %s from cart %s: %v", itemId, cartId, err)
+		return nil, err
+	}
+
+	logger.Infof("Executed RemoveItem, cartId: %s, itemId: %s", cartId, itemId)
+	return c.recalculate(ctx, cartId)
+}
+
+// returns the quantity limit for the product, products which are not available cannot be added
+func (c *cartService) maxQuantity(ctx context.Context, itemId string) (int, error) {
+	product, err := c.productDbService.GetProductById(ctx, itemId, false)
+	if err != nil {
+		return 0, err
+	}
+	if !product.IsAvailable {
+		return 0, ErrProductUnavailable
+	}
+	if product.MaxQuantity > 0 {
+		return product.MaxQuantity, nil
+	}
+	return c.policy.MaxItemQuantity, nil
+}
+
+// function to recompute the total of every cart from the current product prices, e.g. after prices
+// were changed directly in the database
+func (c *cartService) RecalculateTotals(ctx context.Context) (*models.AggregatesReport, error) {
+	ctx, span := apptracing.Start(ctx, "CartService.RecalculateTotals")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing RecalculateTotals")
+
+	carts, err := c.dbservice.GetAllCarts(ctx)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	report := &models.AggregatesReport{Carts: len(carts), ChangedCarts: []string{}}
+	for _, cart := range carts {
+		recalculated, err := c.recalculate(ctx, cart.ID.Hex())
+		if err != nil {
+			logger.Errorf("Failed to recalculate cart %s: %v", cart.ID.Hex(), err)
+			return report, err
+		}
+		if recalculated.TotalPrice != cart.TotalPrice {
+			report.ChangedCarts = append(report.ChangedCarts, cart.ID.Hex())
+		}
+	}
+
+	logger.Infof("Executed RecalculateTotals, carts: %d, changed: %d", report.Carts, len(report.ChangedCarts))
+	return report, nil
+}
+
+// recalculates the total from the current product prices and stores it on the cart; the total is only
+// written to the version of the cart it was computed from, and computed again when the cart changed since
+func (c *cartService) recalculate(ctx context.Context, cartId string) (*models.Cart, error) {
+	for attempt := 1; ; attempt++ {
+		cart, err := c.recalculateOnce(ctx, cartId)
+		if errors.Is(err, db.ErrVersionConflict) && attempt < maxRecalculateAttempts {
+			continue
+		}
+		return cart, err
+	}
+}
+
+func (c *cartService) recalculateOnce(ctx context.Context, cartId string) (*models.Cart, error) {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+
+	cart, err := c.dbservice.GetCartById(ctx, cartId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		ids = append(ids, item.ItemID)
+	}
+	prices := map[string]float64{}
+	if len(ids) > 0 {
+		products, err := c.productDbService.GetProductsByIds(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range products {
+			prices[product.ID.Hex()] = product.Price
+		}
+	}
+
+	total := 0.0
+	for _, item := range cart.Items {
+		total += prices[item.ItemID] * float64(item.Quantity)
+	}
+	if total == cart.TotalPrice {
+		return cart, nil
+	}
+	if err := c.dbservice.SetTotalPrice(ctx, cartId, total, cart.Version); err != nil {
+		return nil, err
+	}
+	cart.TotalPrice = total
+	cart.Version++
+
+	logger.Infof("Recalculated cart %s, total: %.2f", cartId, total)
+	return cart, nil
+}
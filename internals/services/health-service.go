@@ -0,0 +1,111 @@
+package services
+
+import (
+	"Jevan/commons/apploggers"
+	"Jevan/commons/buildinfo"
+	"Jevan/internals/models"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheck checks one dependency, e.g. pings mongodb
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type HealthService interface {
+	Liveness(ctx context.Context) *models.HealthReport
+	Readiness(ctx context.Context) *models.HealthReport
+	SetDraining(draining bool)
+}
+
+type healthService struct {
+	timeout  time.Duration
+	checks   []HealthCheck
+	draining atomic.Bool
+}
+
+func NewHealthService(timeout time.Duration, checks ...HealthCheck) HealthService {
+	return &healthService{
+		timeout: timeout,
+		checks:  checks,
+	}
+}
+
+// function to report the process is up, it does not check dependencies
+func (h *healthService) Liveness(ctx context.Context) *models.HealthReport {
+	return &models.HealthReport{Status: models.HealthStatusOK, Build: getBuildInfo()}
+}
+
+// function to report if the server can take traffic: every dependency is up and the server is not draining,
+// dependencies are checked concurrently, each within the timeout
+func (h *healthService) Readiness(ctx context.Context) *models.HealthReport {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+
+	report := &models.HealthReport{
+		Status:   models.HealthStatusOK,
+		Draining: h.draining.Load(),
+		Checks:   make(map[string]models.DependencyCheck, len(h.checks)),
+		Build:    getBuildInfo(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := h.runCheck(ctx, check)
+			mu.Lock()
+			report.Checks[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	for name, check := range report.Checks {
+		if check.Status != models.HealthStatusUp {
+			logger.Errorf("Readiness check %s failed: %s", name, check.Error)
+			report.Status = models.HealthStatusUnavailable
+		}
+	}
+	if report.Draining {
+		report.Status = models.HealthStatusUnavailable
+	}
+	return report
+}
+
+// function to mark the server as draining, it then reports not ready so no new traffic is routed to it
+func (h *healthService) SetDraining(draining bool) {
+	h.draining.Store(draining)
+}
+
+func (h *healthService) runCheck(ctx context.Context, check HealthCheck) models.DependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := models.DependencyCheck{
+		Status:    models.HealthStatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = models.HealthStatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func getBuildInfo() models.BuildInfo {
+	return models.BuildInfo{
+		Version:       buildinfo.Version,
+		Commit:        buildinfo.GetCommit(),
+		GoVersion:     buildinfo.GoVersion(),
+		StartedAt:     buildinfo.StartedAt(),
+		UptimeSeconds: int64(buildinfo.Uptime().Seconds()),
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCredentials is returned for every failed login, so callers cannot tell
+// an unknown account from a wrong password
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LoginThrottledError is returned while an account or ip is delayed or locked out
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+// LoginPolicy configures progressive delays and lockout for failed logins
+type LoginPolicy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	LockoutDuration    time.Duration
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	FailureWindow      time.Duration // failures are forgotten this long after the first one, 0 keeps them
+}
+
+type LoginThrottleService interface {
+	CheckAllowed(ctx context.Context, email, ip string) error
+	RecordFailure(ctx context.Context, email, ip string) error
+	RecordSuccess(ctx context.Context, email string) error
+	GetLockedAccounts(ctx context.Context) ([]*models.LoginAttempt, error)
+	UnlockAccount(ctx context.Context, email string) error
+}
+
+type loginThrottleService struct {
+	dbservice db.LoginAttemptDbService
+	policy    LoginPolicy
+	now       func() time.Time
+}
+
+func NewLoginThrottleService(dbservice db.LoginAttemptDbService, policy LoginPolicy) LoginThrottleService {
+	return &loginThrottleService{
+		dbservice: dbservice,
+		policy:    policy,
+		now:       time.Now,
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// returns LoginThrottledError if either the account or the ip is currently throttled
+func (l *loginThrottleService) CheckAllowed(ctx context.Context, email, ip string) error {
+	ctx, span := apptracing.Start(ctx, "LoginThrottleService.CheckAllowed")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+
+	subjects := map[string]string{
+		models.LoginAttemptKindAccount: normalizeEmail(email),
+		models.LoginAttemptKindIP:      ip,
+	}
+	now := l.now()
+	var retryAfter time.Duration
+	for kind, subject := range subjects {
+		if subject == "" {
+			continue
+		}
+		attempt, err := l.dbservice.GetAttempt(ctx, kind, subject)
+		if err != nil {
+			return err
+		}
+		if attempt == nil {
+			continue
+		}
+
+		// lockout is over, give the subject a fresh set of attempts
+		if attempt.LockedUntil > 0 && attempt.LockedUntil <= now.Unix() {
+			if err := l.dbservice.ResetAttempts(ctx, kind, subject); err != nil {
+				return err
+			}
+			continue
+		}
+
+		wait := time.Duration(max(attempt.LockedUntil*1000, attempt.NextAttemptAt)-now.UnixMilli()) * time.Millisecond
+		if wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		logger.Warnf("Login throttled, retry after %s", retryAfter)
+		return &LoginThrottledError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (l *loginThrottleService) RecordFailure(ctx context.Context, email, ip string) error {
+	ctx, span := apptracing.Start(ctx, "LoginThrottleService.RecordFailure")
+	defer span.End()
+	if err := l.recordFailure(ctx, models.LoginAttemptKindAccount, normalizeEmail(email), l.policy.MaxAccountFailures); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return l.recordFailure(ctx, models.LoginAttemptKindIP, ip, l.policy.MaxIPFailures)
+}
+
+func (l *loginThrottleService) recordFailure(ctx context.Context, kind, subject string, maxFailures int) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+
+	now := l.now()
+	var windowStart int64
+	if l.policy.FailureWindow > 0 {
+		windowStart = now.Add(-l.policy.FailureWindow).Unix()
+	}
+	attempt, err := l.dbservice.RecordFailure(ctx, kind, subject, now.Unix(), windowStart)
+	if err != nil {
+		return err
+	}
+
+	// in milliseconds, the first delays are shorter than a second
+	nextAttemptAt := now.Add(l.delay(attempt.Failures)).UnixMilli()
+	var lockedUntil int64
+	if maxFailures > 0 && attempt.Failures >= maxFailures {
+		lockedUntil = now.Add(l.policy.LockoutDuration).Unix()
+		logger.Warnf("Login locked, kind: %s, failures: %d", kind, attempt.Failures)
+	}
+	return l.dbservice.SetThrottle(ctx, kind, subject, nextAttemptAt, lockedUntil)
+}
+
+// delay doubles with every consecutive failure, starting from the base delay
+func (l *loginThrottleService) delay(failures int) time.Duration {
+	if l.policy.BaseDelay <= 0 || failures <= 0 {
+		return 0
+	}
+	delay := l.policy.BaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if l.policy.MaxDelay > 0 && delay >= l.policy.MaxDelay {
+			return l.policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+// resets the failures of the account only, the failures of the ip are kept until its lockout ends,
+// otherwise logging into an own account between guesses would clear them
+func (l *loginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	ctx, span := apptracing.Start(ctx, "LoginThrottleService.RecordSuccess")
+	defer span.End()
+	return l.dbservice.ResetAttempts(ctx, models.LoginAttemptKindAccount, normalizeEmail(email))
+}
+
+func (l *loginThrottleService) GetLockedAccounts(ctx context.Context) ([]*models.LoginAttempt, error) {
+	ctx, span := apptracing.Start(ctx, "LoginThrottleService.GetLockedAccounts")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing GetLockedAccounts")
+
+	accounts, err := l.dbservice.GetLockedAccounts(ctx, l.now().Unix())
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	logger.Infof("Executed GetLockedAccounts, total: %d", len(accounts))
+	return accounts, nil
+}
+
+func (l *loginThrottleService) UnlockAccount(ctx context.Context, email string) error {
+	ctx, span := apptracing.Start(ctx, "LoginThrottleService.UnlockAccount")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing UnlockAccount")
+
+	if err := l.dbservice.ResetAttempts(ctx, models.LoginAttemptKindAccount, normalizeEmail(email)); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Info("Executed UnlockAccount")
+	return nil
+}
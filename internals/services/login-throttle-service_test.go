@@ -0,0 +1,131 @@
+package services
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/internals/db"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// function to create the throttle on an in-memory database, with a clock the test moves
+func newTestThrottle(policy LoginPolicy) (*loginThrottleService, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := NewLoginThrottleService(db.NewLoginAttemptDbService(appdb.NewMemoryDatabaseClient("test")), policy).(*loginThrottleService)
+	throttle.now = func() time.Time { return now }
+	return throttle, &now
+}
+
+// function to get how long the subject has to wait, 0 when it may log in
+func retryAfter(t *testing.T, throttle LoginThrottleService, email, ip string) time.Duration {
+	t.Helper()
+	err := throttle.CheckAllowed(context.Background(), email, ip)
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter
+	}
+	if err != nil {
+		t.Fatalf("CheckAllowed: %v", err)
+	}
+	return 0
+}
+
+func TestLoginDelayDoubles(t *testing.T) {
+	ctx := context.Background()
+	throttle, now := newTestThrottle(LoginPolicy{BaseDelay: 500 * time.Millisecond, MaxDelay: 2 * time.Second})
+
+	for _, want := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 2 * time.Second} {
+		if err := throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1"); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+		if got := retryAfter(t, throttle, "Asha@example.com", ""); got != want {
+			t.Errorf("retry after = %s, want %s", got, want)
+		}
+		*now = now.Add(want)
+		if got := retryAfter(t, throttle, "asha@example.com", "192.0.2.1"); got != 0 {
+			t.Errorf("retry after = %s once the delay passed, want 0", got)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	throttle, now := newTestThrottle(LoginPolicy{MaxAccountFailures: 3, MaxIPFailures: 5, LockoutDuration: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1") //nolint
+	}
+	if got := retryAfter(t, throttle, "asha@example.com", "198.51.100.7"); got != time.Minute {
+		t.Errorf("retry after = %s, want the account locked for a minute from any ip", got)
+	}
+	locked, err := throttle.GetLockedAccounts(ctx)
+	if err != nil || len(locked) != 1 || locked[0].Subject != "asha@example.com" {
+		t.Errorf("locked accounts = %+v, %v, want asha@example.com", locked, err)
+	}
+
+	*now = now.Add(time.Minute)
+	if got := retryAfter(t, throttle, "asha@example.com", "192.0.2.1"); got != 0 {
+		t.Errorf("retry after = %s once the lockout ended, want 0", got)
+	}
+	throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1") //nolint
+	if got := retryAfter(t, throttle, "asha@example.com", ""); got != 0 {
+		t.Errorf("retry after = %s after one failure, want the failures counted afresh", got)
+	}
+}
+
+func TestLoginSuccessKeepsIPFailures(t *testing.T) {
+	ctx := context.Background()
+	throttle, _ := newTestThrottle(LoginPolicy{MaxAccountFailures: 3, MaxIPFailures: 3, LockoutDuration: time.Minute})
+
+	// guessing the passwords of other accounts, while logging into an own one in between
+	for _, email := range []string{"asha@example.com", "ravi@example.com"} {
+		throttle.RecordFailure(ctx, email, "192.0.2.1") //nolint
+		if err := throttle.RecordSuccess(ctx, "mallory@example.com"); err != nil {
+			t.Fatalf("RecordSuccess: %v", err)
+		}
+	}
+	throttle.RecordFailure(ctx, "meera@example.com", "192.0.2.1") //nolint
+
+	if got := retryAfter(t, throttle, "mallory@example.com", "192.0.2.1"); got != time.Minute {
+		t.Errorf("retry after = %s, want the ip locked for a minute", got)
+	}
+	if got := retryAfter(t, throttle, "meera@example.com", "198.51.100.7"); got != 0 {
+		t.Errorf("retry after = %s from another ip, want 0", got)
+	}
+
+	// a success resets the account it logged into
+	throttle.RecordFailure(ctx, "asha@example.com", "") //nolint
+	throttle.RecordFailure(ctx, "asha@example.com", "") //nolint
+	throttle.RecordSuccess(ctx, "asha@example.com")     //nolint
+	throttle.RecordFailure(ctx, "asha@example.com", "") //nolint
+	if got := retryAfter(t, throttle, "asha@example.com", ""); got != 0 {
+		t.Errorf("retry after = %s, want the failures before the success forgotten", got)
+	}
+}
+
+func TestLoginFailuresExpireAfterWindow(t *testing.T) {
+	ctx := context.Background()
+	throttle, now := newTestThrottle(LoginPolicy{MaxAccountFailures: 3, MaxIPFailures: 3, LockoutDuration: time.Minute, FailureWindow: time.Hour})
+
+	// two failures, then the third one within the window locks the account and the ip
+	throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1") //nolint
+	*now = now.Add(30 * time.Minute)
+	throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1") //nolint
+	*now = now.Add(31 * time.Minute)
+	throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1") //nolint
+	if got := retryAfter(t, throttle, "asha@example.com", "192.0.2.1"); got != 0 {
+		t.Errorf("retry after = %s, want the failures before the window forgotten", got)
+	}
+
+	// the window starts at the failure which started the count over
+	*now = now.Add(10 * time.Minute)
+	throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1") //nolint
+	throttle.RecordFailure(ctx, "asha@example.com", "192.0.2.1") //nolint
+	if got := retryAfter(t, throttle, "asha@example.com", ""); got != time.Minute {
+		t.Errorf("retry after = %s, want the account locked by three failures within the window", got)
+	}
+	if got := retryAfter(t, throttle, "", "192.0.2.1"); got != time.Minute {
+		t.Errorf("retry after = %s, want the ip locked by three failures within the window", got)
+	}
+}
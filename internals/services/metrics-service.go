@@ -0,0 +1,50 @@
+package services
+
+import (
+	"Jevan/commons/apploggers"
+	"Jevan/commons/appmetrics"
+	"Jevan/commons/apptracing"
+	"Jevan/internals/db"
+	"context"
+)
+
+// MetricsService refreshes the business gauges which are read from the database
+type MetricsService interface {
+	RefreshBusinessMetrics(ctx context.Context) error
+}
+
+type metricsService struct {
+	orderDbService db.OrderDbService
+	cartDbService  db.CartDbService
+}
+
+func NewMetricsService(orderDbService db.OrderDbService, cartDbService db.CartDbService) MetricsService {
+	return &metricsService{
+		orderDbService: orderDbService,
+		cartDbService:  cartDbService,
+	}
+}
+
+// function to update the orders by status and active carts gauges, run as a scheduled job
+func (m *metricsService) RefreshBusinessMetrics(ctx context.Context) error {
+	ctx, span := apptracing.Start(ctx, "MetricsService.RefreshBusinessMetrics")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Info("Executing RefreshBusinessMetrics")
+
+	ordersByStatus, err := m.orderDbService.CountOrdersByStatus(ctx)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	activeCarts, err := m.cartDbService.CountActiveCarts(ctx)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	appmetrics.SetOrdersByStatus(ordersByStatus)
+	appmetrics.SetActiveCarts(activeCarts)
+	logger.Infof("Executed RefreshBusinessMetrics, activeCarts: %d", activeCarts)
+	return nil
+}
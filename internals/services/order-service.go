@@ -1,7 +1,10 @@
 package services
 
 import (
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
+	"Jevan/commons/appmetrics"
+	"Jevan/commons/apptracing"
 	"Jevan/internals/db"
 	"Jevan/internals/models"
 	"context"
@@ -12,76 +15,152 @@ import (
 type OrderService interface {
 	CreateOrder(context context.Context, order *models.Order) (string, error)
 	GetOrderById(context context.Context, orderId string) (*models.Order, error)
-	UpdateOrder(context context.Context, orderId string, status *models.Order) error
+	UpdateOrder(context context.Context, orderId string, status *models.Order, expectedVersion *int64) (int64, error)
 	GetAllOrders(context context.Context) ([]*models.Order, error)
 }
 
 type orderService struct {
 	dbservice db.OrderDbService
+	productDb db.ProductDbService
+	audit     AuditService
 }
 
-func NewOrderService(dbservice db.OrderDbService) OrderService {
+func NewOrderService(dbservice db.OrderDbService, productDb db.ProductDbService, audit AuditService) OrderService {
 	return &orderService{
 		dbservice: dbservice,
+		productDb: productDb,
+		audit:     audit,
 	}
 }
 
+// places the order, the lines get the snapshot of their product and the total price is computed from
+// them, whatever the client sent
 func (os *orderService) CreateOrder(ctx context.Context, order *models.Order) (string, error) {
+	ctx, span := apptracing.Start(ctx, "OrderService.CreateOrder")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Info("Executing CreateOrder")
+
+	items, err := os.snapshotItems(ctx, order.Items)
+	if err != nil {
+		logger.Error(err)
+		return "", err
+	}
+	order.Items = items
+	order.TotalPrice = models.OrderTotal(items)
 	currentTime := time.Now().Unix()
 	order.OrderedAt = currentTime
 	order.UpdatedAt = currentTime
-	order.Status = "placed"
+	order.Status = models.OrderStatusPlaced
 
 	orderID, err := os.dbservice.SaveOrder(ctx, order)
 	if err != nil {
 		logger.Error(err)
-		return "", fmt.Errorf("error creating order: %s", err)
+		return "", fmt.Errorf("error creating order: %w", err)
 	}
 
+	appmetrics.OrderPlaced(order.TotalPrice)
 	logger.Infof("Executed CreateOrder, orderId: %s", orderID)
 	return orderID, nil
 }
 
 func (os *orderService) GetOrderById(ctx context.Context, orderId string) (*models.Order, error) {
+	ctx, span := apptracing.Start(ctx, "OrderService.GetOrderById")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing GetOrderById, orderId: %s", orderId)
 
 	order, err := os.dbservice.GetOrderById(ctx, orderId)
 	if err != nil {
 		logger.Error(err)
-		return nil, fmt.Errorf("order not found: %s", err)
+		return nil, fmt.Errorf("order not found: %w", err)
 	}
 
 	logger.Infof("Executed GetOrderById, orderId: %s", orderId)
 	return order, nil
 }
 
-func (os *orderService) UpdateOrder(ctx context.Context, orderId string, status *models.Order) error {
+// updates the status of the order and records it in the audit log, returns the version it was written at;
+// without expectedVersion the update is forced over whatever version the order is at
+func (os *orderService) UpdateOrder(ctx context.Context, orderId string, status *models.Order, expectedVersion *int64) (int64, error) {
+	ctx, span := apptracing.Start(ctx, "OrderService.UpdateOrder")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing UpdateOrder, orderId: %s", orderId)
 
-	err := os.dbservice.UpdateOrderStatus(ctx, orderId, status)
+	if !models.IsOrderStatus(status.Status) {
+		return 0, apperrors.Validationf("invalid order status: %q, want one of %s, %s, %s, %s or %s", status.Status,
+			models.OrderStatusPlaced, models.OrderStatusPreparing, models.OrderStatusReady, models.OrderStatusDelivered, models.OrderStatusCancelled)
+	}
+	action := models.AuditOrderUpdated
+	if expectedVersion == nil {
+		action = models.AuditOrderForceUpdated
+	}
+	var version int64
+	err := os.audit.WithTransaction(ctx, func(tctx context.Context) error {
+		before, err := os.dbservice.UpdateOrderStatus(tctx, orderId, status, expectedVersion)
+		if err != nil {
+			logger.Error(err)
+			return fmt.Errorf("error updating order status: %w", err)
+		}
+		after := *before
+		after.Status, after.Version = status.Status, before.Version+1
+		version = after.Version
+		return os.audit.Record(tctx, action, "order", orderId, before, &after)
+	})
 	if err != nil {
-		logger.Error(err)
-		return fmt.Errorf("error updating order status: %s", err)
+		return 0, err
 	}
 
 	logger.Infof("Executed UpdateOrder, orderId: %s", orderId)
-	return nil
+	return version, nil
 }
 
 func (os *orderService) GetAllOrders(ctx context.Context) ([]*models.Order, error) {
+	ctx, span := apptracing.Start(ctx, "OrderService.GetAllOrders")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Info("Executing GetAllOrders")
 
 	orders, err := os.dbservice.GetAllOrders(ctx)
 	if err != nil {
 		logger.Error(err)
-		return nil, fmt.Errorf("error fetching orders: %s", err)
+		return nil, fmt.Errorf("error fetching orders: %w", err)
 	}
 
 	logger.Infof("Executed GetAllOrders, total: %d", len(orders))
 	return orders, nil
 }
+
+// function to snapshot the current products onto the lines, the products must exist and be available
+func (os *orderService) snapshotItems(ctx context.Context, items []models.OrderItem) ([]models.OrderItem, error) {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ItemID)
+	}
+	products, err := os.productDb.GetProductsByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]*models.Product, len(products))
+	for _, product := range products {
+		byId[product.ID.Hex()] = product
+	}
+
+	snapshots := make([]models.OrderItem, 0, len(items))
+	for _, item := range items {
+		// a line below one would take its price off the other lines
+		if item.Quantity < 1 {
+			return nil, apperrors.Validationf("quantity of item %s must be at least 1", item.ItemID)
+		}
+		product, found := byId[item.ItemID]
+		if !found {
+			return nil, apperrors.NotFound("product")
+		}
+		if !product.IsAvailable {
+			return nil, ErrProductUnavailable
+		}
+		snapshots = append(snapshots, models.SnapshotOrderItem(product, item.Quantity))
+	}
+	return snapshots, nil
+}
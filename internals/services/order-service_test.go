@@ -0,0 +1,29 @@
+package services
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/apperrors"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"testing"
+)
+
+func TestCreateOrderRejectsQuantityBelowOne(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	products := db.NewProductDbService(client)
+	orders := NewOrderService(db.NewOrderDbService(client), products, NewAuditService(db.NewAuditDbService(client), client))
+	teaId, err := products.CreateProduct(ctx, &models.Product{Name: "Tea", Price: 10, IsAvailable: true})
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+
+	for _, quantity := range []int{0, -5} {
+		order := &models.Order{UserID: "user-1", Items: []models.OrderItem{{ItemID: teaId, Quantity: 2}, {ItemID: teaId, Quantity: quantity}}}
+		_, err := orders.CreateOrder(ctx, order)
+		if appErr, ok := apperrors.As(err); !ok || appErr.Kind != apperrors.KindValidation {
+			t.Errorf("CreateOrder with quantity %d = %v, want a validation error", quantity, err)
+		}
+	}
+}
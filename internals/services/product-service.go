@@ -1,7 +1,9 @@
 package services
 
 import (
+	"Jevan/commons"
 	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
 	"Jevan/internals/db"
 	"Jevan/internals/models"
 	"context"
@@ -9,23 +11,28 @@ import (
 
 type ProductService interface {
 	CreateProduct(ctx context.Context, product *models.Product) (string, error)
-	GetAllProducts(ctx context.Context) ([]*models.Product, error)
-	UpdateProduct(ctx context.Context, product *models.Product, id string) error
-	GetProductById(ctx context.Context, id string) (*models.Product, error)
-	DeleteProductById(ctx context.Context, id string) error
+	GetAllProducts(ctx context.Context, includeDeleted bool) ([]*models.Product, error)
+	UpdateProduct(ctx context.Context, product *models.Product, id string, expectedVersion *int64) (int64, error)
+	PatchProduct(ctx context.Context, id string, patch []byte, expectedVersion *int64) (*models.Product, error)
+	GetProductById(ctx context.Context, id string, includeDeleted bool) (*models.Product, error)
+	DeleteProductById(ctx context.Context, id string, deletedBy string) error
+	RestoreProductById(ctx context.Context, id string) error
 }
 
 type productService struct {
-	db db.ProductDbService
+	db    db.ProductDbService
+	audit AuditService
 }
 
-func NewProductService(db db.ProductDbService) ProductService {
-	return &productService{db: db}
+func NewProductService(db db.ProductDbService, audit AuditService) ProductService {
+	return &productService{db: db, audit: audit}
 }
 
 func (p *productService) CreateProduct(ctx context.Context, product *models.Product) (string, error) {
+	ctx, span := apptracing.Start(ctx, "ProductService.CreateProduct")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing CreateProduct: %v", product)
+	logger.Infof("Executing CreateProduct, name: %s", product.Name)
 
 	productId, err := p.db.CreateProduct(ctx, product)
 	if err != nil {
@@ -37,11 +44,14 @@ func (p *productService) CreateProduct(ctx context.Context, product *models.Prod
 	return productId, nil
 }
 
-func (p *productService) GetAllProducts(ctx context.Context) ([]*models.Product, error) {
+// lists the products, the soft deleted ones only with includeDeleted
+func (p *productService) GetAllProducts(ctx context.Context, includeDeleted bool) ([]*models.Product, error) {
+	ctx, span := apptracing.Start(ctx, "ProductService.GetAllProducts")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Info("Executing GetAllProducts")
+	logger.Infof("Executing GetAllProducts, includeDeleted: %t", includeDeleted)
 
-	products, err := p.db.GetAllProducts(ctx)
+	products, err := p.db.GetAllProducts(ctx, includeDeleted)
 	if err != nil {
 		logger.Errorf("Failed to fetch products: %v", err)
 		return nil, err
@@ -51,25 +61,84 @@ func (p *productService) GetAllProducts(ctx context.Context) ([]*models.Product,
 	return products, nil
 }
 
-func (p *productService) UpdateProduct(ctx context.Context, product *models.Product, id string) error {
+// replaces the product and returns the version it was written at, a price change is recorded in the audit
+// log with the product as the write found it
+func (p *productService) UpdateProduct(ctx context.Context, product *models.Product, id string, expectedVersion *int64) (int64, error) {
+	ctx, span := apptracing.Start(ctx, "ProductService.UpdateProduct")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	logger.Infof("Executing UpdateProduct id: %s, payload: %v", id, product)
-
-	err := p.db.UpdateProduct(ctx, product, id)
+	logger.Infof("Executing UpdateProduct id: %s", id)
+
+	var version int64
+	err := p.audit.WithTransaction(ctx, func(tctx context.Context) error {
+		before, err := p.db.UpdateProduct(tctx, product, id, expectedVersion)
+		if err != nil {
+			logger.Errorf("Failed to update product %s: %v", id, err)
+			return err
+		}
+		after := *product
+		after.ID, after.Version = before.ID, before.Version+1
+		version = after.Version
+		return p.auditPriceChange(tctx, before, &after)
+	})
 	if err != nil {
-		logger.Errorf("Failed to update product %s: %v", id, err)
-		return err
+		return 0, err
 	}
 
 	logger.Infof("Product %s updated successfully", id)
-	return nil
+	return version, nil
+}
+
+// applies a JSON merge patch to the stored product; the write is conditional on the version which
+// was patched, so a concurrent update fails with db.ErrVersionConflict instead of being overwritten
+func (p *productService) PatchProduct(ctx context.Context, id string, patch []byte, expectedVersion *int64) (*models.Product, error) {
+	ctx, span := apptracing.Start(ctx, "ProductService.PatchProduct")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing PatchProduct id: %s, fields: %v", id, commons.PatchFields(patch))
+
+	product, err := p.db.GetProductById(ctx, id, false)
+	if err != nil {
+		logger.Errorf("Failed to fetch product %s: %v", id, err)
+		return nil, err
+	}
+	if expectedVersion != nil && *expectedVersion != product.Version {
+		return nil, db.ErrVersionConflict
+	}
+	version := product.Version
+
+	if err := commons.MergePatch(product, patch, "id", "version", "deletedAt", "deletedBy"); err != nil {
+		return nil, err
+	}
+	if err := commons.ValidateStruct(product); err != nil {
+		return nil, err
+	}
+
+	err = p.audit.WithTransaction(ctx, func(tctx context.Context) error {
+		before, err := p.db.UpdateProduct(tctx, product, id, &version)
+		if err != nil {
+			logger.Errorf("Failed to patch product %s: %v", id, err)
+			return err
+		}
+		product.Version = version + 1
+		return p.auditPriceChange(tctx, before, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Product %s patched successfully", id)
+	return product, nil
 }
 
-func (p *productService) GetProductById(ctx context.Context, id string) (*models.Product, error) {
+// gets the product, a soft deleted one only with includeDeleted
+func (p *productService) GetProductById(ctx context.Context, id string, includeDeleted bool) (*models.Product, error) {
+	ctx, span := apptracing.Start(ctx, "ProductService.GetProductById")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing GetProductById for id: %s", id)
 
-	product, err := p.db.GetProductById(ctx, id)
+	product, err := p.db.GetProductById(ctx, id, includeDeleted)
 	if err != nil {
 		logger.Errorf("Failed to fetch product %s: %v", id, err)
 		return nil, err
@@ -79,11 +148,14 @@ func (p *productService) GetProductById(ctx context.Context, id string) (*models
 	return product, nil
 }
 
-func (p *productService) DeleteProductById(ctx context.Context, id string) error {
+// soft deletes the product, it is purged once the retention has passed unless restored
+func (p *productService) DeleteProductById(ctx context.Context, id string, deletedBy string) error {
+	ctx, span := apptracing.Start(ctx, "ProductService.DeleteProductById")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Executing DeleteProductById for id: %s", id)
 
-	err := p.db.DeleteProductById(ctx, id)
+	err := p.db.DeleteProductById(ctx, id, deletedBy)
 	if err != nil {
 		logger.Errorf("Failed to delete product %s: %v", id, err)
 		return err
@@ -92,3 +164,27 @@ func (p *productService) DeleteProductById(ctx context.Context, id string) error
 	logger.Infof("Product %s deleted successfully", id)
 	return nil
 }
+
+func (p *productService) RestoreProductById(ctx context.Context, id string) error {
+	ctx, span := apptracing.Start(ctx, "ProductService.RestoreProductById")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing RestoreProductById for id: %s", id)
+
+	if err := p.db.RestoreProductById(ctx, id); err != nil {
+		logger.Errorf("Failed to restore product %s: %v", id, err)
+		return err
+	}
+
+	logger.Infof("Product %s restored successfully", id)
+	return nil
+}
+
+// function to record the update of the product in the audit log when its price or tax rate changed, both
+// make up what an order of it is charged
+func (p *productService) auditPriceChange(ctx context.Context, before, after *models.Product) error {
+	if before.Price == after.Price && before.TaxRate == after.TaxRate {
+		return nil
+	}
+	return p.audit.Record(ctx, models.AuditProductPriceUpdated, "product", before.ID.Hex(), before, after)
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+// failingAuditDb stands for an audit log which cannot be written
+type failingAuditDb struct {
+	db.AuditDbService
+}
+
+var errAuditDown = errors.New("audit log unavailable")
+
+func (failingAuditDb) SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return errAuditDown
+}
+
+func TestProductPriceAuditUsesWrittenVersion(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	audit := NewAuditService(db.NewAuditDbService(client), client)
+	products := NewProductService(db.NewProductDbService(client), audit)
+	id, err := products.CreateProduct(ctx, &models.Product{Name: "Tea", Price: 10})
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+
+	if _, err := products.UpdateProduct(ctx, &models.Product{Name: "Tea", Price: 12}, id, nil); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	events, err := audit.GetAuditEvents(ctx, &models.AuditFilter{TargetID: id})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	var price *models.AuditChange
+	for i, change := range events[0].Changes {
+		if change.Field == "price" {
+			price = &events[0].Changes[i]
+		}
+	}
+	if price == nil || price.Before != 10.0 || price.After != 12.0 {
+		t.Errorf("changes = %+v, want the price from 10 to 12", events[0].Changes)
+	}
+}
+
+func TestProductPriceAuditFailureIsReturned(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	products := NewProductService(db.NewProductDbService(client), NewAuditService(failingAuditDb{}, client))
+	id, err := products.CreateProduct(ctx, &models.Product{Name: "Tea", Price: 10})
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+
+	_, err = products.UpdateProduct(ctx, &models.Product{Name: "Tea", Price: 12}, id, nil)
+	if !errors.Is(err, errAuditDown) {
+		t.Errorf("UpdateProduct = %v, want the audit failure", err)
+	}
+	if product, _ := products.GetProductById(ctx, id, false); product.Price != 10 {
+		t.Errorf("price = %v, want the update rolled back with its event", product.Price)
+	}
+	// a product update without a price change has nothing to record
+	if _, err := products.UpdateProduct(ctx, &models.Product{Name: "Green Tea", Price: 10}, id, nil); err != nil {
+		t.Errorf("UpdateProduct without a price change = %v", err)
+	}
+}
+
+func TestProductTaxRateChangeIsAudited(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	audit := NewAuditService(db.NewAuditDbService(client), client)
+	products := NewProductService(db.NewProductDbService(client), audit)
+	id, err := products.CreateProduct(ctx, &models.Product{Name: "Tea", Price: 10, TaxRate: 0.05})
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+
+	if _, err := products.PatchProduct(ctx, id, []byte(`{"taxRate": 0.12}`), nil); err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+	events, err := audit.GetAuditEvents(ctx, &models.AuditFilter{TargetID: id, Action: models.AuditProductPriceUpdated})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	if len(events) != 1 || len(events[0].Changes) == 0 {
+		t.Fatalf("events = %+v, want the tax rate change", events)
+	}
+	for _, change := range events[0].Changes {
+		if change.Field == "taxRate" && change.Before == 0.05 && change.After == 0.12 {
+			return
+		}
+	}
+	t.Errorf("changes = %+v, want the tax rate from 0.05 to 0.12", events[0].Changes)
+}
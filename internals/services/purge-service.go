@@ -0,0 +1,50 @@
+package services
+
+import (
+	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"Jevan/internals/db"
+	"context"
+	"time"
+)
+
+// PurgeService hard-deletes the products and accounts which were soft deleted longer ago than the retention
+type PurgeService interface {
+	PurgeDeleted(ctx context.Context) error
+}
+
+type purgeService struct {
+	productDb db.ProductDbService
+	accountDb db.AccountDbService
+	retention time.Duration // zero keeps the deleted records
+}
+
+func NewPurgeService(productDb db.ProductDbService, accountDb db.AccountDbService, retention time.Duration) PurgeService {
+	return &purgeService{productDb: productDb, accountDb: accountDb, retention: retention}
+}
+
+// runs as a scheduled job; the orders referencing the purged records are kept
+func (p *purgeService) PurgeDeleted(ctx context.Context) error {
+	ctx, span := apptracing.Start(ctx, "PurgeService.PurgeDeleted")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	if p.retention <= 0 {
+		return nil
+	}
+	logger.Infof("Executing PurgeDeleted, retention: %s", p.retention)
+
+	deletedBefore := time.Now().Add(-p.retention).Unix()
+	products, err := p.productDb.PurgeDeletedProducts(ctx, deletedBefore)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	accounts, err := p.accountDb.PurgeDeletedAccounts(ctx, deletedBefore)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed PurgeDeleted, products: %d, accounts: %d", products, accounts)
+	return nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"Jevan/commons/apperrors"
+	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"Jevan/commons/totp"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorNotEnabled     = apperrors.Conflict("TWO_FACTOR_NOT_ENABLED", "two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = apperrors.Conflict("TWO_FACTOR_ALREADY_ENABLED", "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = apperrors.Conflict("TWO_FACTOR_NOT_ENROLLED", "two-factor enrollment has not been started")
+	ErrInvalidTwoFactorCode    = apperrors.New(apperrors.KindValidation, "INVALID_TWO_FACTOR_CODE", "invalid two-factor code")
+)
+
+type TwoFactorService interface {
+	BeginEnrollment(ctx context.Context, userId string) (*models.TwoFactorEnrollmentResponse, error)
+	ConfirmEnrollment(ctx context.Context, userId, code string) ([]string, error)
+	VerifyLogin(ctx context.Context, userId, code, ip string) (*models.UserDetails, error)
+	RegenerateRecoveryCodes(ctx context.Context, userId, code, ip string) ([]string, error)
+	Disable(ctx context.Context, userId, code, ip string) error
+}
+
+type twoFactorService struct {
+	dbservice db.UserDbService
+	throttle  LoginThrottleService
+	issuer    string
+	now       func() time.Time
+}
+
+func NewTwoFactorService(dbservice db.UserDbService, throttle LoginThrottleService, issuer string) TwoFactorService {
+	return &twoFactorService{
+		dbservice: dbservice,
+		throttle:  throttle,
+		issuer:    issuer,
+		now:       time.Now,
+	}
+}
+
+// generates a pending secret, which is activated once the user confirms a valid code
+func (t *twoFactorService) BeginEnrollment(ctx context.Context, userId string) (*models.TwoFactorEnrollmentResponse, error) {
+	ctx, span := apptracing.Start(ctx, "TwoFactorService.BeginEnrollment")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing BeginEnrollment, userId: %s", userId)
+
+	user, err := t.dbservice.GetUserDetailsById(ctx, userId)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if err := t.dbservice.SetTwoFactorPendingSecret(ctx, userId, secret); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Executed BeginEnrollment, userId: %s", userId)
+	return &models.TwoFactorEnrollmentResponse{
+		Secret:     secret,
+		OtpAuthURI: totp.URI(t.issuer, user.Email, secret),
+	}, nil
+}
+
+// activates the pending secret and returns the plain recovery codes, which are shown only once
+func (t *twoFactorService) ConfirmEnrollment(ctx context.Context, userId, code string) ([]string, error) {
+	ctx, span := apptracing.Start(ctx, "TwoFactorService.ConfirmEnrollment")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing ConfirmEnrollment, userId: %s", userId)
+
+	user, err := t.dbservice.GetUserDetailsById(ctx, userId)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactorPendingSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Validate(user.TwoFactorPendingSecret, code, t.now(), 1)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if err := t.dbservice.EnableTwoFactor(ctx, userId, user.TwoFactorPendingSecret, hashes, step); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Executed ConfirmEnrollment, userId: %s", userId)
+	return codes, nil
+}
+
+// second login step, accepts a totp code or an unused recovery code
+func (t *twoFactorService) VerifyLogin(ctx context.Context, userId, code, ip string) (*models.UserDetails, error) {
+	ctx, span := apptracing.Start(ctx, "TwoFactorService.VerifyLogin")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing VerifyLogin, userId: %s", userId)
+
+	user, err := t.dbservice.GetUserDetailsById(ctx, userId)
+	if err != nil {
+		logger.Error(err)
+		return nil, ErrInvalidCredentials
+	}
+	if err := t.verifyThrottledCode(ctx, user, code, ip); err != nil {
+		return nil, err
+	}
+
+	if err := t.throttle.RecordSuccess(ctx, user.Email); err != nil {
+		logger.Error("Failed to reset login attempts: ", err)
+	}
+
+	logger.Infof("Executed VerifyLogin, userId: %s", userId)
+	return user, nil
+}
+
+// replaces the recovery codes, the code is throttled like the login step
+func (t *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userId, code, ip string) ([]string, error) {
+	ctx, span := apptracing.Start(ctx, "TwoFactorService.RegenerateRecoveryCodes")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing RegenerateRecoveryCodes, userId: %s", userId)
+
+	user, err := t.dbservice.GetUserDetailsById(ctx, userId)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if err := t.verifyThrottledCode(ctx, user, code, ip); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if err := t.dbservice.EnableTwoFactor(ctx, userId, user.TwoFactorSecret, hashes, user.TwoFactorLastStep); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Executed RegenerateRecoveryCodes, userId: %s", userId)
+	return codes, nil
+}
+
+// turns two-factor off, the code is throttled like the login step
+func (t *twoFactorService) Disable(ctx context.Context, userId, code, ip string) error {
+	ctx, span := apptracing.Start(ctx, "TwoFactorService.Disable")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing Disable two-factor, userId: %s", userId)
+
+	user, err := t.dbservice.GetUserDetailsById(ctx, userId)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if err := t.verifyThrottledCode(ctx, user, code, ip); err != nil {
+		return err
+	}
+	if err := t.dbservice.DisableTwoFactor(ctx, userId); err != nil {
+		return err
+	}
+
+	logger.Infof("Executed Disable two-factor, userId: %s", userId)
+	return nil
+}
+
+// verifies the code unless the account or ip is throttled, a wrong code counts as a failed login of the
+// account and ip, so guessing codes through any endpoint ends in the same lockout
+func (t *twoFactorService) verifyThrottledCode(ctx context.Context, user *models.UserDetails, code, ip string) error {
+	if err := t.throttle.CheckAllowed(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	err := t.verifyCode(ctx, user, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if rerr := t.throttle.RecordFailure(ctx, user.Email, ip); rerr != nil {
+			apploggers.GetLoggerWithCorrelationid(ctx).Error("Failed to record login attempt: ", rerr)
+		}
+	}
+	return err
+}
+
+// verifies a totp code (rejecting reuse of an already used time step) or consumes a recovery code
+func (t *twoFactorService) verifyCode(ctx context.Context, user *models.UserDetails, code string) error {
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	userId := user.ID.Hex()
+
+	// the codes are marked used with conditional writes, of two requests racing with the same code only
+	// the first one passes
+	if step, ok := totp.Validate(user.TwoFactorSecret, code, t.now(), 1); ok {
+		if step <= user.TwoFactorLastStep {
+			return ErrInvalidTwoFactorCode
+		}
+		return usedCode(t.dbservice.SetTwoFactorLastStep(ctx, userId, step))
+	}
+
+	for _, hash := range user.RecoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			return usedCode(t.dbservice.RemoveRecoveryCode(ctx, userId, hash))
+		}
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// function to reject a code which another request marked used first
+func usedCode(marked bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// returns plain recovery codes along with their bcrypt hashes for storage
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(raw)
+		code = code[:5] + "-" + code[5:]
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, string(hash))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/totp"
+	"Jevan/configs"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// two requests with the same code which both read the user before either marked the code used, only
+// the first one is accepted
+func TestTwoFactorCodeIsUsedOnce(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("abcde-12345"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hashing the recovery code: %v", err)
+	}
+	user := &models.UserDetails{ID: primitive.NewObjectID(), Email: "asha@example.com", TwoFactorEnabled: true, TwoFactorSecret: secret, RecoveryCodes: []string{string(hash)}}
+	if _, err := client.Collection(configs.MONGO_USERS_COLLECTION).InsertOne(ctx, user); err != nil {
+		t.Fatalf("inserting the user: %v", err)
+	}
+
+	users := db.NewUserDbService(client)
+	service := NewTwoFactorService(users, NewLoginThrottleService(db.NewLoginAttemptDbService(client), LoginPolicy{}), "Jevan").(*twoFactorService)
+	service.now = func() time.Time { return time.Unix(1700000000, 0) }
+	code, err := totp.CodeForStep(secret, totp.Step(service.now()))
+	if err != nil {
+		t.Fatalf("CodeForStep: %v", err)
+	}
+
+	for name, code := range map[string]string{"totp": code, "recovery": "abcde-12345"} {
+		stale, err := users.GetUserDetailsById(ctx, user.ID.Hex())
+		if err != nil {
+			t.Fatalf("GetUserDetailsById: %v", err)
+		}
+		if err := service.verifyCode(ctx, stale, code); err != nil {
+			t.Errorf("first %s code: %v", name, err)
+		}
+		if err := service.verifyCode(ctx, stale, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("second %s code = %v, want ErrInvalidTwoFactorCode", name, err)
+		}
+	}
+}
+
+// wrong codes sent to disable two-factor or to regenerate the recovery codes count as failed logins,
+// once the account is locked out not even a valid code is checked
+func TestTwoFactorManagementIsThrottled(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	user := &models.UserDetails{ID: primitive.NewObjectID(), Email: "asha@example.com", TwoFactorEnabled: true, TwoFactorSecret: secret}
+	if _, err := client.Collection(configs.MONGO_USERS_COLLECTION).InsertOne(ctx, user); err != nil {
+		t.Fatalf("inserting the user: %v", err)
+	}
+
+	users := db.NewUserDbService(client)
+	throttle := NewLoginThrottleService(db.NewLoginAttemptDbService(client), LoginPolicy{MaxAccountFailures: 3, LockoutDuration: time.Minute})
+	service := NewTwoFactorService(users, throttle, "Jevan").(*twoFactorService)
+	service.now = func() time.Time { return time.Unix(1700000000, 0) }
+	code, err := totp.CodeForStep(secret, totp.Step(service.now()))
+	if err != nil {
+		t.Fatalf("CodeForStep: %v", err)
+	}
+
+	userId := user.ID.Hex()
+	if err := service.Disable(ctx, userId, "wrong-code", "192.0.2.1"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("Disable with a wrong code = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := service.RegenerateRecoveryCodes(ctx, userId, "wrong-code", "192.0.2.1"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("RegenerateRecoveryCodes with a wrong code = %v, want ErrInvalidTwoFactorCode", err)
+		}
+	}
+
+	var throttled *LoginThrottledError
+	if err := service.Disable(ctx, userId, code, "198.51.100.7"); !errors.As(err, &throttled) {
+		t.Errorf("Disable after three wrong codes = %v, want the account locked out", err)
+	}
+	if _, err := service.RegenerateRecoveryCodes(ctx, userId, code, "198.51.100.7"); !errors.As(err, &throttled) {
+		t.Errorf("RegenerateRecoveryCodes after three wrong codes = %v, want the account locked out", err)
+	}
+	if stored, _ := users.GetUserDetailsById(ctx, userId); !stored.TwoFactorEnabled {
+		t.Errorf("two-factor was disabled while the account was locked out")
+	}
+}
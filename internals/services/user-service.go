@@ -1,42 +1,77 @@
 package services
 
 import (
+	"Jevan/commons"
+	"Jevan/commons/apperrors"
 	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
+	"Jevan/commons/mailer"
+	"Jevan/commons/oidc"
 	"Jevan/internals/db"
 	"Jevan/internals/models"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService interface {
-	GetUserById(context context.Context, userId string) (*models.User, error)
-	DeleteUserById(context context.Context, userId string) error
-	GetUsers(context context.Context) ([]models.User, error)
-	CreateUserProfile(context context.Context, user *models.User) (string, error)
-	UpdateUser(context context.Context, user *models.User, userId string) error
-	RegisterUser(ctx context.Context, email, password string) (string, error)
-	AuthenticateUser(ctx context.Context, email, password string) (*models.UserDetails, bool, error)
+	GetUserById(context context.Context, userId string, includeDeleted bool) (*models.User, error)
+	DeleteUserById(context context.Context, userId string, deletedBy string) error
+	RestoreUserById(context context.Context, userId string) error
+	GetUsers(context context.Context, includeDeleted bool) ([]models.User, error)
+	PatchUser(context context.Context, userId string, patch []byte, expectedVersion *int64) (*models.User, error)
+	ChangeEmail(ctx context.Context, userId string, newEmail string) error
+	RegisterUser(ctx context.Context, registration *models.UserDetails) (string, error)
+	VerifyEmailChange(ctx context.Context, token string) error
+	AuthenticateUser(ctx context.Context, email, password, ip string) (*models.UserDetails, bool, error)
 	UpdateUserRole(ctx context.Context, userID, newRole string) error
+	GetLockedAccounts(ctx context.Context) ([]*models.LoginAttempt, error)
+	UnlockAccount(ctx context.Context, userId string) error
+	EnsureAdmin(ctx context.Context, registration *models.UserDetails) (string, bool, error)
+	ResetPassword(ctx context.Context, email, password string) (string, error)
+	LoginExternalUser(ctx context.Context, provider string, claims *oidc.Claims) (*models.UserDetails, error)
 }
 
 type userService struct {
-	dbservice db.UserDbService
+	dbservice      db.UserDbService
+	accountDb      db.AccountDbService
+	throttle       LoginThrottleService
+	audit          AuditService
+	mailer         mailer.Mailer
+	verifyEmailURL string
 }
 
-func NewUserService(dbservice db.UserDbService) UserService {
+// how long an email change verification link stays valid
+const emailVerificationTTL = 24 * time.Hour
+
+// hash compared against when the account does not exist, so both failures cost the same
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("jevan-dummy-password"), bcrypt.DefaultCost)
+
+func NewUserService(dbservice db.UserDbService, accountDb db.AccountDbService, throttle LoginThrottleService, audit AuditService, mailer mailer.Mailer, verifyEmailURL string) UserService {
 	return &userService{
-		dbservice: dbservice,
+		dbservice:      dbservice,
+		accountDb:      accountDb,
+		throttle:       throttle,
+		audit:          audit,
+		mailer:         mailer,
+		verifyEmailURL: verifyEmailURL,
 	}
 }
 
-func (e *userService) GetUserById(context context.Context, userId string) (*models.User, error) {
+func (e *userService) GetUserById(context context.Context, userId string, includeDeleted bool) (*models.User, error) {
+	context, span := apptracing.Start(context, "UserService.GetUserById")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(context)
 	logger.Infof("Executing GetUserById, userId: %s", userId)
-	user, dberror := e.dbservice.GetUserById(context, userId)
+	user, dberror := e.dbservice.GetUserById(context, userId, includeDeleted)
 	if dberror != nil {
 		logger.Error(dberror)
 		return nil, dberror
@@ -45,10 +80,13 @@ func (e *userService) GetUserById(context context.Context, userId string) (*mode
 	return user, nil
 }
 
-func (e *userService) DeleteUserById(context context.Context, userId string) error {
+// soft deletes the account, it can't log in anymore and is purged once the retention has passed unless restored
+func (e *userService) DeleteUserById(context context.Context, userId string, deletedBy string) error {
+	context, span := apptracing.Start(context, "UserService.DeleteUserById")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(context)
 	logger.Infof("Executing DeleteUserById, userId: %s", userId)
-	dberror := e.dbservice.DeleteUserById(context, userId)
+	dberror := e.accountDb.DeleteAccount(context, userId, deletedBy)
 	if dberror != nil {
 		logger.Error(dberror)
 		return dberror
@@ -57,10 +95,26 @@ func (e *userService) DeleteUserById(context context.Context, userId string) err
 	return nil
 }
 
-func (e *userService) GetUsers(context context.Context) ([]models.User, error) {
+func (e *userService) RestoreUserById(context context.Context, userId string) error {
+	context, span := apptracing.Start(context, "UserService.RestoreUserById")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(context)
+	logger.Infof("Executing RestoreUserById, userId: %s", userId)
+	dberror := e.accountDb.RestoreAccount(context, userId)
+	if dberror != nil {
+		logger.Error(dberror)
+		return dberror
+	}
+	logger.Infof("Executed RestoreUserById, userId: %s", userId)
+	return nil
+}
+
+func (e *userService) GetUsers(context context.Context, includeDeleted bool) ([]models.User, error) {
+	context, span := apptracing.Start(context, "UserService.GetUsers")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(context)
 	logger.Infof("Executing GetUsers...")
-	users, dberror := e.dbservice.GetUsers(context)
+	users, dberror := e.dbservice.GetUsers(context, includeDeleted)
 	if dberror != nil {
 		logger.Error(dberror)
 		return nil, dberror
@@ -69,48 +123,136 @@ func (e *userService) GetUsers(context context.Context) ([]models.User, error) {
 	return users, nil
 }
 
-func (e *userService) CreateUserProfile(context context.Context, user *models.User) (string, error) {
+// applies a JSON merge patch to the profile, the merged profile is validated and written at the
+// version which was patched. The email is immutable here, it changes through ChangeEmail
+func (e *userService) PatchUser(context context.Context, userId string, patch []byte, expectedVersion *int64) (*models.User, error) {
+	context, span := apptracing.Start(context, "UserService.PatchUser")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(context)
-	logger.Infof("Executing CreateUserProfile...")
+	logger.Infof("Executing PatchUser, userId: %s", userId)
 
-	user.CartId = primitive.NewObjectID().Hex()
-	userId, dberror := e.dbservice.CreateUserProfile(context, user)
+	user, dberror := e.dbservice.GetUserById(context, userId, false)
 	if dberror != nil {
 		logger.Error(dberror)
-		return "", dberror
+		return nil, dberror
 	}
-	logger.Infof("Executed CreateUserProfile, userId: %v", userId)
-	return userId, nil
-}
+	if expectedVersion != nil && *expectedVersion != user.Version {
+		return nil, db.ErrVersionConflict
+	}
+	version := user.Version
 
-func (e *userService) UpdateUser(context context.Context, user *models.User, userId string) error {
-	logger := apploggers.GetLoggerWithCorrelationid(context)
-	logger.Infof("Executing UpdateUser...")
+	if err := commons.MergePatch(user, patch, "_id", "email", "cartId", "type", "version", "deletedAt", "deletedBy"); err != nil {
+		return nil, err
+	}
+	if err := commons.ValidateStruct(user); err != nil {
+		return nil, err
+	}
 
-	dberror := e.dbservice.UpdateUser(context, user, userId)
+	dberror = e.accountDb.UpdateProfile(context, userId, user, &version)
 	if dberror != nil {
 		logger.Error(dberror)
-		return dberror
+		return nil, dberror
 	}
-	logger.Infof("Executed UpdateUser, userId: %v", userId)
+	user.Version = version + 1
+
+	logger.Infof("Executed PatchUser, userId: %v", userId)
+	return user, nil
+}
+
+// starts the change of the login and profile email, it is applied once the new address is verified
+func (e *userService) ChangeEmail(ctx context.Context, userId string, newEmail string) error {
+	ctx, span := apptracing.Start(ctx, "UserService.ChangeEmail")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing ChangeEmail, userId: %s", userId)
+
+	credentials, err := e.dbservice.GetUserDetailsById(ctx, userId)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if strings.EqualFold(newEmail, credentials.Email) {
+		return apperrors.Validation("the new email is the current one")
+	}
+	if err := e.requestEmailChange(ctx, userId, newEmail); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed ChangeEmail, userId: %s", userId)
 	return nil
 }
 
-func (s *userService) RegisterUser(ctx context.Context, email, password string) (string, error) {
+// sends a verification token to the new address, only its sha256 is stored
+func (e *userService) requestEmailChange(ctx context.Context, userId, newEmail string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(raw)
+	expiresAt := time.Now().Add(emailVerificationTTL).Unix()
+
+	if err := e.accountDb.RequestEmailChange(ctx, userId, newEmail, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+	return e.mailer.Send(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Jevan email address",
+		Body:    fmt.Sprintf("Confirm your new email address by opening %s?token=%s", e.verifyEmailURL, token),
+	})
+}
+
+func (e *userService) VerifyEmailChange(ctx context.Context, token string) error {
+	ctx, span := apptracing.Start(ctx, "UserService.VerifyEmailChange")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	logger.Info("Executing VerifyEmailChange")
+
+	userId, err := e.accountDb.ConfirmEmailChange(ctx, hashToken(token), time.Now().Unix())
 	if err != nil {
-		logger.Error("Password hashing failed: ", err)
-		return "", err
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed VerifyEmailChange, userId: %s", userId)
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// creates the login credentials and the profile together, the password is stored as bcrypt hash
+func (s *userService) RegisterUser(ctx context.Context, registration *models.UserDetails) (string, error) {
+	ctx, span := apptracing.Start(ctx, "UserService.RegisterUser")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	credentials := &models.UserDetails{
+		FirstName:  registration.FirstName,
+		LastName:   registration.LastName,
+		Email:      registration.Email,
+		Role:       "user",
+		Identities: registration.Identities,
+	}
+	if registration.Password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(registration.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logger.Error("Password hashing failed: ", err)
+			return "", err
+		}
+		credentials.Password = string(hashed)
 	}
 
-	user := &models.UserDetails{
-		Email:    email,
-		Password: string(hashed),
-		Role:     "user",
+	profile := &models.User{
+		FirstName: registration.FirstName,
+		LastName:  registration.LastName,
+		Email:     registration.Email,
+		Type:      "user",
+		CartId:    primitive.NewObjectID().Hex(),
 	}
 
-	id, err := s.dbservice.RegisterUser(ctx, user)
+	id, err := s.accountDb.CreateAccount(ctx, credentials, profile)
 	if err != nil {
 		logger.Error("Failed to register user: ", err)
 		return "", err
@@ -120,31 +262,244 @@ func (s *userService) RegisterUser(ctx context.Context, email, password string)
 	return id, nil
 }
 
-func (s *userService) AuthenticateUser(ctx context.Context, email, password string) (*models.UserDetails, bool, error) {
+func (s *userService) AuthenticateUser(ctx context.Context, email, password, ip string) (*models.UserDetails, bool, error) {
+	ctx, span := apptracing.Start(ctx, "UserService.AuthenticateUser")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Authenticating user: %s", email)
 
+	if err := s.throttle.CheckAllowed(ctx, email, ip); err != nil {
+		return nil, false, err
+	}
+
 	user, err := s.dbservice.GetUserByEmail(ctx, email)
 	if err != nil {
-		return nil, false, errors.New("user not found")
+		// compare anyway, so response time does not reveal whether the account exists
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password)) //nolint
+		logger.Error("Login failed: ", err)
+		return nil, false, s.loginFailed(ctx, email, ip)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
 		logger.Error("Password mismatch")
-		return nil, false, errors.New("invalid password")
+		return nil, false, s.loginFailed(ctx, email, ip)
+	}
+
+	if err := s.throttle.RecordSuccess(ctx, email); err != nil {
+		logger.Error("Failed to reset login attempts: ", err)
 	}
 
 	logger.Info("User authenticated successfully: ", email)
 	return user, true, nil
 }
 
+// records the failed attempt and returns the uniform invalid credentials error
+func (s *userService) loginFailed(ctx context.Context, email, ip string) error {
+	if err := s.throttle.RecordFailure(ctx, email, ip); err != nil {
+		logger := apploggers.GetLoggerWithCorrelationid(ctx)
+		logger.Error("Failed to record login attempt: ", err)
+	}
+	return ErrInvalidCredentials
+}
+
+// changes the role of the account, an actual change is recorded in the audit log
 func (s *userService) UpdateUserRole(ctx context.Context, userID string, newRole string) error {
+	ctx, span := apptracing.Start(ctx, "UserService.UpdateUserRole")
+	defer span.End()
 	logger := apploggers.GetLoggerWithCorrelationid(ctx)
 	logger.Infof("Updating role for user ID: %s to %s", userID, newRole)
 	if newRole != "admin" && newRole != "user" {
-		return fmt.Errorf("invalid role: %s", newRole)
+		return apperrors.Validationf("invalid role: %s", newRole)
+	}
+
+	user, err := s.dbservice.GetUserDetailsById(ctx, userID)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return s.updateRole(ctx, userID, user.Role, newRole)
+}
+
+// function to set the role of the account, a change of it is recorded in the audit log in the same transaction
+func (s *userService) updateRole(ctx context.Context, userID, oldRole, newRole string) error {
+	return s.audit.WithTransaction(ctx, func(tctx context.Context) error {
+		if err := s.dbservice.UpdateUserRole(tctx, userID, newRole); err != nil {
+			apploggers.GetLoggerWithCorrelationid(tctx).Error(err)
+			return err
+		}
+		if oldRole == newRole {
+			return nil
+		}
+		return s.audit.Record(tctx, models.AuditUserRoleUpdated, "user", userID, map[string]string{"role": oldRole}, map[string]string{"role": newRole})
+	})
+}
+
+func (s *userService) GetLockedAccounts(ctx context.Context) ([]*models.LoginAttempt, error) {
+	ctx, span := apptracing.Start(ctx, "UserService.GetLockedAccounts")
+	defer span.End()
+	return s.throttle.GetLockedAccounts(ctx)
+}
+
+func (s *userService) UnlockAccount(ctx context.Context, userId string) error {
+	ctx, span := apptracing.Start(ctx, "UserService.UnlockAccount")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing UnlockAccount, userId: %s", userId)
+
+	user, err := s.dbservice.GetUserDetailsById(ctx, userId)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	if err := s.throttle.UnlockAccount(ctx, user.Email); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("Executed UnlockAccount, userId: %s", userId)
+	return nil
+}
+
+// function to promote the account with the email to admin, or to register it as admin when there is
+// none; returns the user id and whether the account was created. The password is only used for a new account.
+func (s *userService) EnsureAdmin(ctx context.Context, registration *models.UserDetails) (string, bool, error) {
+	ctx, span := apptracing.Start(ctx, "UserService.EnsureAdmin")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing EnsureAdmin, email: %s", registration.Email)
+
+	existing, err := s.dbservice.GetUserByEmail(ctx, registration.Email)
+	if err == nil {
+		if err := s.updateRole(ctx, existing.ID.Hex(), existing.Role, "admin"); err != nil {
+			return "", false, err
+		}
+		logger.Infof("Executed EnsureAdmin, promoted userId: %s", existing.ID.Hex())
+		return existing.ID.Hex(), false, nil
+	}
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		logger.Error(err)
+		return "", false, err
+	}
+
+	if err := commons.ValidateStruct(registration); err != nil {
+		return "", false, err
+	}
+	id, err := s.RegisterUser(ctx, registration)
+	if err != nil {
+		return "", false, err
+	}
+	if err := s.updateRole(ctx, id, "user", "admin"); err != nil {
+		return "", false, err
+	}
+
+	logger.Infof("Executed EnsureAdmin, created userId: %s", id)
+	return id, true, nil
+}
+
+// function to set a new password for the account with the email and lift a login lockout, returns the user id
+func (s *userService) ResetPassword(ctx context.Context, email, password string) (string, error) {
+	ctx, span := apptracing.Start(ctx, "UserService.ResetPassword")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing ResetPassword, email: %s", email)
+
+	if len(password) < 6 {
+		return "", apperrors.Validation("password must be at least 6 characters")
+	}
+	user, err := s.dbservice.GetUserByEmail(ctx, email)
+	if err != nil {
+		logger.Error(err)
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("Password hashing failed: ", err)
+		return "", err
+	}
+	err = s.audit.WithTransaction(ctx, func(tctx context.Context) error {
+		if err := s.dbservice.UpdatePassword(tctx, user.ID.Hex(), string(hashed)); err != nil {
+			logger.Error(err)
+			return err
+		}
+		return s.audit.Record(tctx, models.AuditUserPasswordReset, "user", user.ID.Hex(), nil, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.throttle.UnlockAccount(ctx, user.Email); err != nil {
+		logger.Error(err)
+		return "", err
+	}
+
+	logger.Infof("Executed ResetPassword, userId: %s", user.ID.Hex())
+	return user.ID.Hex(), nil
+}
+
+// function to find the account linked to the provider identity, links an existing account by
+// verified email, or creates a new account and profile the same way registration does when the email is verified
+func (s *userService) LoginExternalUser(ctx context.Context, provider string, claims *oidc.Claims) (*models.UserDetails, error) {
+	ctx, span := apptracing.Start(ctx, "UserService.LoginExternalUser")
+	defer span.End()
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	logger.Infof("Executing LoginExternalUser, provider: %s", provider)
+
+	user, err := s.dbservice.GetUserByIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		logger.Infof("Executed LoginExternalUser, existing identity, userId: %s", user.ID.Hex())
+		return user, nil
+	}
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		logger.Error(err)
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" {
+		return nil, apperrors.Forbidden("identity provider did not return an email")
+	}
+	// only a verified email proves ownership, of an existing account as well as of the email a new
+	// account claims, which could otherwise no longer be registered by its owner
+	if !claims.EmailVerified {
+		return nil, apperrors.Forbidden("email is not verified by the identity provider")
+	}
+	identity := models.ExternalIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		LinkedAt: time.Now().Unix(),
+	}
+
+	existing, err := s.dbservice.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		logger.Error(err)
+		return nil, err
+	}
+	if err == nil {
+		userId := existing.ID.Hex()
+		if err := s.dbservice.LinkIdentity(ctx, userId, identity); err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		logger.Infof("Executed LoginExternalUser, linked existing account, userId: %s", userId)
+		return s.dbservice.GetUserDetailsById(ctx, userId)
+	}
+
+	firstName := claims.GivenName
+	if firstName == "" {
+		firstName = claims.Name
+	}
+	id, err := s.RegisterUser(ctx, &models.UserDetails{
+		FirstName:  firstName,
+		LastName:   claims.FamilyName,
+		Email:      email,
+		Identities: []models.ExternalIdentity{identity},
+	})
+	if err != nil {
+		logger.Error("Failed to register external user: ", err)
+		return nil, err
 	}
 
-	return s.dbservice.UpdateUserRole(ctx, userID, newRole)
+	logger.Infof("Executed LoginExternalUser, created account, userId: %s", id)
+	return s.dbservice.GetUserDetailsById(ctx, id)
 }
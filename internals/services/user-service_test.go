@@ -0,0 +1,60 @@
+package services
+
+import (
+	"Jevan/commons/appdb"
+	"Jevan/commons/mailer"
+	"Jevan/internals/db"
+	"Jevan/internals/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAdminGrantAndPasswordResetAreAudited(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	audit := NewAuditService(db.NewAuditDbService(client), client)
+	users := NewUserService(db.NewUserDbService(client), db.NewAccountDbService(client), NewLoginThrottleService(db.NewLoginAttemptDbService(client), LoginPolicy{}), audit, mailer.NewUnconfiguredMailer(), "")
+
+	id, created, err := users.EnsureAdmin(ctx, &models.UserDetails{FirstName: "Asha", LastName: "Rao", Email: "asha@example.com", Password: "secret123"})
+	if err != nil || !created {
+		t.Fatalf("EnsureAdmin = %v, created %v", err, created)
+	}
+	if _, err := users.ResetPassword(ctx, "asha@example.com", "another123"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	events, err := audit.GetAuditEvents(ctx, &models.AuditFilter{TargetID: id})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	actions := map[string]bool{}
+	for _, event := range events {
+		actions[event.Action] = true
+	}
+	if len(events) != 2 || !actions[models.AuditUserRoleUpdated] || !actions[models.AuditUserPasswordReset] {
+		t.Errorf("events = %+v, want the role update and the password reset", events)
+	}
+}
+
+func TestRoleUpdateIsRolledBackWithoutItsEvent(t *testing.T) {
+	ctx := context.Background()
+	client := appdb.NewMemoryDatabaseClient("test")
+	userDb := db.NewUserDbService(client)
+	users := NewUserService(userDb, db.NewAccountDbService(client), NewLoginThrottleService(db.NewLoginAttemptDbService(client), LoginPolicy{}), NewAuditService(failingAuditDb{}, client), mailer.NewUnconfiguredMailer(), "")
+	id, err := users.RegisterUser(ctx, &models.UserDetails{FirstName: "Asha", LastName: "Rao", Email: "asha@example.com", Password: "secret123"})
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+
+	if err := users.UpdateUserRole(ctx, id, "admin"); !errors.Is(err, errAuditDown) {
+		t.Fatalf("UpdateUserRole = %v, want the audit failure", err)
+	}
+	user, err := userDb.GetUserDetailsById(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserDetailsById: %v", err)
+	}
+	if user.Role != "user" {
+		t.Errorf("role = %s, want the update rolled back", user.Role)
+	}
+}
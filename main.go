@@ -1,19 +1,21 @@
 package main
 
 import (
-	"Jevan/apis"
-	"Jevan/apis/middlewares"
-	"Jevan/internals/db"
-	"Jevan/internals/services"
-
-	_ "Jevan/apis/docs"
 	"Jevan/commons/apploggers"
+	"Jevan/commons/apptracing"
 	"Jevan/configs"
+	"Jevan/internals/app"
+	"Jevan/internals/seed"
 	"context"
-
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	echoSwagger "github.com/swaggo/echo-swagger"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // @title Jevan - Mess Management API
@@ -27,90 +29,133 @@ import (
 // @in header
 // @name Authorization
 func main() {
+	demo := flag.Bool("demo", false, "serve generated demo data, from the in-memory database unless MongoDB is configured")
+	demoRemote := flag.Bool("demo-remote", false, "allow --demo to write into a MongoDB server which is not on this machine")
+	flag.Parse()
+
+	// Load configuration, the server refuses to start when it is invalid
+	loadConfig := configs.LoadConfig
+	if *demo {
+		loadConfig = func() (*configs.ApplicationConfig, error) { return configs.LoadDemoConfig(*demoRemote) }
+	}
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load app config: %v", err)
+	}
+
 	// Set up logging and context
+	if err := apploggers.Configure(config.Log); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
 	ctx, logger := apploggers.NewLoggerWithCorrelationid(context.Background(), "")
 
-	// Load configuration
-	if err := configs.NewApplicationConfig(ctx); err != nil {
-		logger.Errorf("Failed to load app config: %v", err)
+	// Set up tracing
+	shutdownTracing, err := apptracing.Init(ctx, config.Tracing)
+	if err != nil {
+		logger.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	// Connect to the database and wire the application
+	container, err := app.NewBuilder(config).Build(ctx)
+	if err != nil {
+		logger.Fatalf("Failed to connect to the database: %v", err)
+	}
+
+	// The demo data is written on every start, replacing the records of the previous one
+	if *demo {
+		if err := loadDemo(ctx, container); err != nil {
+			logger.Fatalf("Failed to load the demo data: %v", err)
+		}
+	}
+
+	// Migrations are applied with `jevan migrate up`, the server only reports pending ones
+	if statuses, err := container.Migrations.Status(ctx); err != nil {
+		logger.Errorf("Failed to read the migration status: %v", err)
+	} else {
+		for _, status := range statuses {
+			if !status.Applied {
+				logger.Warnf("Migration %d (%s) is not applied, run `jevan migrate up`", status.Version, status.Description)
+			}
+		}
 	}
 
-	// Initialize DB
-	cartDbService := db.NewCartDbService(configs.AppConfig.DbClient)
-	orderDbService := db.NewOrderDbService(configs.AppConfig.DbClient)
-	productDbService := db.NewProductDbService(configs.AppConfig.DbClient)
-	userDbService := db.NewUserDbService(configs.AppConfig.DbClient)
-
-	// Initialize services
-	productService := services.NewProductService(productDbService)
-	cartService := services.NewCartService(cartDbService)
-	orderService := services.NewOrderService(orderDbService)
-	userService := services.NewUserService(userDbService)
-
-	// Controllers
-	productController := apis.NewProductController(productService)
-	cartController := apis.NewCartController(cartService)
-	orderController := apis.NewOrderController(orderService)
-	userController := apis.NewUserController(userService)
-	authController := apis.NewAuthController(userService)
-
-	e := echo.New()
-
-	e.Use(middleware.CORS())
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-
-	jwtMiddleware := middlewares.JWTMiddleware()
-
-	// Swagger
-	e.GET("/swagger/*", echoSwagger.WrapHandler)
-
-	// Health check
-	e.GET("/health", func(c echo.Context) error {
-		return c.String(200, "Jevan API is healthy!")
-	})
-
-	// Auth
-	e.POST("/login", authController.Login)
-	e.POST("/register", authController.Register)
-
-	// Admin-only endpoints
-	admin := e.Group("/admin")
-	admin.Use(jwtMiddleware, middlewares.AdminOnly)
-	admin.PUT("/users/:id/role", authController.UpdateUserRole)
-
-	// Public Routes
-	e.GET("/users", userController.GetUsers)
-	e.GET("/users/:id", userController.GetUserById)
-
-	// Auth-Protected User Actions
-	userPrivate := e.Group("/users", jwtMiddleware)
-	userPrivate.DELETE("/:id", userController.DeleteUserById)
-	userPrivate.PATCH("/:id", userController.UpdateUser)
-
-	// Product Routes
-	productPublic := e.Group("/products")
-	productPublic.GET("", productController.GetAllProducts)
-	productPublic.GET("/:id", productController.GetProductById)
-
-	productPrivate := e.Group("/products", jwtMiddleware)
-	productPrivate.POST("", productController.CreateProduct)
-	productPrivate.PUT("/:id", productController.UpdateProduct)
-	productPrivate.DELETE("/:id", productController.DeleteProductById)
-
-	// Cart Routes
-	cart := e.Group("/cart", jwtMiddleware)
-	cart.POST("/:id", cartController.UpdateCart)
-	cart.GET("/:id", cartController.GetCartItemsById)
-	cart.DELETE("/:id/all", cartController.DeleteAllItems)
-
-	// Order Routes
-	order := e.Group("/orders", jwtMiddleware)
-	order.POST("", orderController.CreateOrder)
-	order.GET("", orderController.GetAllOrders)
-	order.GET("/:id", orderController.GetOrderById)
-	order.PUT("/:id", orderController.UpdateOrder)
-
-	logger.Infof("Starting Jevan API server on port %s", configs.AppConfig.HttpPort)
-	e.Logger.Fatal(e.Start(":" + configs.AppConfig.HttpPort))
+	// Background jobs
+	jobs := container.Jobs()
+	jobs.Start()
+
+	e := container.Server()
+	metrics := container.MetricsServer()
+
+	signalCtx, stopSignals := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		logger.Infof("Starting Jevan API server on port %s", config.HttpPort)
+		if err := e.Start(":" + config.HttpPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+	go func() {
+		logger.Infof("Serving metrics on port %s", config.MetricsPort)
+		if err := metrics.Start(":" + config.MetricsPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-signalCtx.Done():
+		logger.Info("Shutdown signal received, draining")
+	case err := <-serverErr:
+		logger.Errorf("Server failed: %v", err)
+	}
+
+	// Graceful shutdown: report not ready so the load balancer stops routing here, give it time to notice,
+	// then stop accepting connections and wait for in-flight requests before releasing the dependencies
+	container.HealthService.SetDraining(true)
+	time.Sleep(config.ShutdownDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, config.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Failed to drain in-flight requests: %v", err)
+	}
+	if err := metrics.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Failed to stop the metrics server: %v", err)
+	}
+	jobs.Stop()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Errorf("Failed to flush traces: %v", err)
+	}
+	container.Close(ctx)
+	logger.Info("Jevan API server stopped")
+	apploggers.Sync() //nolint
+}
+
+// function to apply the migrations and load the demo data set, see seed.DefaultOptions
+func loadDemo(ctx context.Context, container *app.Container) error {
+	logger := apploggers.GetLoggerWithCorrelationid(ctx)
+	if _, err := container.Migrations.Up(ctx); err != nil {
+		return err
+	}
+	options := seed.DefaultOptions()
+	// the well known demo password is only used in memory, accounts kept in MongoDB get a random one
+	if !container.Config.Mongo.InMemory {
+		raw := make([]byte, 9)
+		if _, err := rand.Read(raw); err != nil {
+			return err
+		}
+		options.Password = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	dataset, err := seed.Generate(options)
+	if err != nil {
+		return err
+	}
+	if err := seed.Load(ctx, container.DbClient, dataset); err != nil {
+		return err
+	}
+	// emails are masked in the logs, the accounts are admin and user001 to user0NN at the demo domain
+	logger.Infof("Demo data loaded: %d users, %d products, %d orders; sign in as admin, or user001, at %s with the password %s",
+		len(dataset.Profiles), len(dataset.Products), len(dataset.Orders), seed.EmailDomain, options.Password)
+	return nil
 }